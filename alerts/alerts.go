@@ -0,0 +1,388 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Valimere/donkey/socialmedia"
+	"golang.org/x/time/rate"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRateLimit is the default of Config.RateLimit
+	DefaultRateLimit = 10
+	// DefaultDedupWindow is the default of Config.DedupWindow
+	DefaultDedupWindow = 24 * time.Hour
+)
+
+// deliveryQueueSize bounds the alerts waiting for their sinks, further alerts are dropped
+const deliveryQueueSize = 256
+
+// maxBodyLength truncates the body carried by an alert
+const maxBodyLength = 500
+
+// Config holds the alert rules and sinks, alerts go to stdout when no sink is configured
+type Config struct {
+	// RateLimit is the most alerts a rule fires per minute, further matches are dropped
+	RateLimit int `yaml:"rate_limit"`
+	// DedupWindow is how long a rule doesn't alert on the same post or comment again
+	DedupWindow time.Duration `yaml:"dedup_window"`
+	Sinks       []SinkConfig  `yaml:"sinks"`
+	Rules       []Rule        `yaml:"rules"`
+}
+
+// Validate checks the rules and sinks, errors name the offending entry
+func (c Config) Validate() error {
+	var errs []error
+	if c.RateLimit < 1 {
+		errs = append(errs, fmt.Errorf("rate_limit: must be at least 1, got %d", c.RateLimit))
+	}
+	if c.DedupWindow < 0 {
+		errs = append(errs, fmt.Errorf("dedup_window: must not be negative, got %s", c.DedupWindow))
+	}
+	sinks := make(map[string]bool)
+	for i, sink := range c.Sinks {
+		if err := sink.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("sinks[%d]: %w", i, err))
+		}
+		if sinks[sink.Name] {
+			errs = append(errs, fmt.Errorf("sinks[%d]: duplicate name %q", i, sink.Name))
+		}
+		sinks[sink.Name] = true
+	}
+	rules := make(map[string]bool)
+	for i, rule := range c.Rules {
+		if _, err := rule.compile(); err != nil {
+			errs = append(errs, fmt.Errorf("rules[%d]: %w", i, err))
+		}
+		if rules[rule.Name] {
+			errs = append(errs, fmt.Errorf("rules[%d]: duplicate name %q", i, rule.Name))
+		}
+		rules[rule.Name] = true
+		for _, name := range rule.Sinks {
+			if !sinks[name] {
+				errs = append(errs, fmt.Errorf("rules[%d]: unknown sink %q", i, name))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Alert is a post or comment that matched a rule, sinks receive it as JSON
+type Alert struct {
+	Rule string `json:"rule"`
+	// Kind is post or comment
+	Kind        string    `json:"kind"`
+	ID          string    `json:"id"`
+	PostID      string    `json:"post_id"`
+	Subreddit   string    `json:"subreddit"`
+	Author      string    `json:"author"`
+	Title       string    `json:"title,omitempty"`
+	Body        string    `json:"body,omitempty"`
+	URL         string    `json:"url"`
+	UpVotes     int       `json:"upvotes"`
+	NumComments int       `json:"num_comments"`
+	Matched     []string  `json:"matched"`
+	Time        time.Time `json:"time"`
+}
+
+// delivery is an alert for its sinks, or sinks to close once the alerts queued before are delivered
+type delivery struct {
+	alert Alert
+	sinks []namedSink
+	close []Sink
+}
+
+type namedSink struct {
+	name string
+	Sink
+}
+
+// Engine evaluates the rules against posts and comments and delivers the alerts to the sinks
+// from a background goroutine, so checks never wait for a sink
+type Engine struct {
+	// Now returns the current time, time.Now if nil
+	Now func() time.Time
+
+	logger *slog.Logger
+	out    io.Writer
+
+	mu       sync.Mutex
+	closed   bool
+	cfg      Config
+	rules    []*compiledRule
+	sinks    []namedSink
+	limiters map[string]*rate.Limiter
+	// fired maps rule, kind and id to the time of the alert for the deduplication
+	fired  map[string]time.Time
+	pruned time.Time
+
+	queue chan delivery
+	done  chan struct{}
+}
+
+// NewEngine validates the configuration, opens the sinks and starts delivering, stdout sinks write to out.
+// Close stops it.
+func NewEngine(cfg Config, out io.Writer, logger *slog.Logger) (*Engine, error) {
+	e := &Engine{
+		logger:   logger,
+		out:      out,
+		limiters: make(map[string]*rate.Limiter),
+		fired:    make(map[string]time.Time),
+		queue:    make(chan delivery, deliveryQueueSize),
+		done:     make(chan struct{}),
+	}
+	rules, sinks, err := e.load(cfg)
+	if err != nil {
+		return nil, err
+	}
+	e.cfg, e.rules, e.sinks = cfg, rules, sinks
+	go e.deliver()
+	return e, nil
+}
+
+// load compiles the rules and opens the sinks of the configuration
+func (e *Engine) load(cfg Config) ([]*compiledRule, []namedSink, error) {
+	err := cfg.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+	rules := make([]*compiledRule, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		compiled, _ := rule.compile()
+		rules = append(rules, compiled)
+	}
+	sinkConfigs := cfg.Sinks
+	if len(sinkConfigs) == 0 {
+		sinkConfigs = []SinkConfig{{Name: SinkStdout, Type: SinkStdout}}
+	}
+	sinks := make([]namedSink, 0, len(sinkConfigs))
+	for _, sinkConfig := range sinkConfigs {
+		sink, err := sinkConfig.open(e.out)
+		if err != nil {
+			closeSinks(sinks)
+			return nil, nil, fmt.Errorf("sink %s: %w", sinkConfig.Name, err)
+		}
+		sinks = append(sinks, namedSink{name: sinkConfig.Name, Sink: sink})
+	}
+	return rules, sinks, nil
+}
+
+// Reload replaces the rules and sinks, the previous sinks are closed once the alerts queued for them are delivered.
+// The deduplication state is kept. On errors the previous configuration stays in effect.
+func (e *Engine) Reload(cfg Config) error {
+	rules, sinks, err := e.load(cfg)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		closeSinks(sinks)
+		return errors.New("alert engine is closed")
+	}
+	previous := e.sinks
+	e.cfg, e.rules, e.sinks = cfg, rules, sinks
+	for name, limiter := range e.limiters {
+		limiter.SetLimit(perMinute(cfg.RateLimit))
+		limiter.SetBurst(cfg.RateLimit)
+		if !e.hasRule(name) {
+			delete(e.limiters, name)
+		}
+	}
+	stale := make([]Sink, 0, len(previous))
+	for _, sink := range previous {
+		stale = append(stale, sink.Sink)
+	}
+	e.queue <- delivery{close: stale}
+	e.logger.Info("alert rules loaded", "rules", len(rules), "sinks", len(sinks))
+	return nil
+}
+
+// Rules returns the number of loaded rules
+func (e *Engine) Rules() int {
+	if e == nil {
+		return 0
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.rules)
+}
+
+// CheckPost alerts on the post for every matching rule, it may be called again when the score of the post changes
+func (e *Engine) CheckPost(post socialmedia.Post) {
+	e.check(postItem(post), Alert{
+		Kind:        "post",
+		ID:          post.PostID,
+		PostID:      post.PostID,
+		Subreddit:   post.SubReddit,
+		Author:      post.Author,
+		Title:       post.Title,
+		Body:        truncate(post.Body, maxBodyLength),
+		URL:         post.Link(),
+		UpVotes:     post.UpVotes,
+		NumComments: post.NumComments,
+	})
+}
+
+// CheckComment alerts on the comment for every matching rule
+func (e *Engine) CheckComment(comment socialmedia.Comment) {
+	e.check(commentItem(comment), Alert{
+		Kind:      "comment",
+		ID:        comment.CommentID,
+		PostID:    comment.PostID,
+		Subreddit: comment.SubReddit,
+		Author:    comment.Author,
+		Body:      truncate(comment.Body, maxBodyLength),
+		URL:       "https://www.reddit.com/comments/" + comment.PostID + "/comment/" + comment.CommentID + "/",
+		UpVotes:   comment.UpVotes,
+	})
+}
+
+func (e *Engine) check(it item, alert Alert) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	now := e.now()
+	e.prune(now)
+	for _, rule := range e.rules {
+		matched, ok := rule.match(it)
+		if !ok {
+			continue
+		}
+		key := rule.Name + "/" + alert.Kind + "/" + alert.ID
+		if fired, found := e.fired[key]; found && now.Sub(fired) < e.cfg.DedupWindow {
+			continue
+		}
+		if !e.limiter(rule.Name).AllowN(now, 1) {
+			e.logger.Warn("alert rate limited", "rule", rule.Name, "kind", alert.Kind, "id", alert.ID)
+			continue
+		}
+		e.fired[key] = now
+
+		fired := alert
+		fired.Rule, fired.Matched, fired.Time = rule.Name, matched, now
+		select {
+		case e.queue <- delivery{alert: fired, sinks: e.sinksFor(rule)}:
+		default:
+			e.logger.Warn("alert dropped, the sinks are falling behind", "rule", rule.Name, "kind", alert.Kind, "id", alert.ID)
+		}
+	}
+}
+
+// Close delivers the queued alerts, closes the sinks and stops the engine
+func (e *Engine) Close() error {
+	if e == nil {
+		return nil
+	}
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	close(e.queue)
+	e.mu.Unlock()
+
+	<-e.done
+	return closeSinks(e.sinks)
+}
+
+func (e *Engine) deliver() {
+	defer close(e.done)
+	for d := range e.queue {
+		for _, sink := range d.sinks {
+			err := sink.Send(context.Background(), d.alert)
+			if err != nil {
+				e.logger.Error("alert delivery failed", "sink", sink.name, "rule", d.alert.Rule, "id", d.alert.ID, "error", err)
+			}
+		}
+		for _, sink := range d.close {
+			if err := sink.Close(); err != nil {
+				e.logger.Error("closing alert sink failed", "error", err)
+			}
+		}
+	}
+}
+
+func (e *Engine) now() time.Time {
+	if e.Now != nil {
+		return e.Now()
+	}
+	return time.Now()
+}
+
+// prune forgets the alerts outside of the deduplication window, at most once a minute
+func (e *Engine) prune(now time.Time) {
+	if now.Sub(e.pruned) < time.Minute {
+		return
+	}
+	e.pruned = now
+	for key, fired := range e.fired {
+		if now.Sub(fired) >= e.cfg.DedupWindow {
+			delete(e.fired, key)
+		}
+	}
+}
+
+func (e *Engine) limiter(rule string) *rate.Limiter {
+	limiter, found := e.limiters[rule]
+	if !found {
+		limiter = rate.NewLimiter(perMinute(e.cfg.RateLimit), e.cfg.RateLimit)
+		e.limiters[rule] = limiter
+	}
+	return limiter
+}
+
+func (e *Engine) hasRule(name string) bool {
+	for _, rule := range e.rules {
+		if rule.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sinksFor returns the sinks named by the rule, all sinks if it names none
+func (e *Engine) sinksFor(rule *compiledRule) []namedSink {
+	if len(rule.Sinks) == 0 {
+		return e.sinks
+	}
+	var sinks []namedSink
+	for _, sink := range e.sinks {
+		if slices.Contains(rule.Sinks, sink.name) {
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks
+}
+
+func perMinute(n int) rate.Limit {
+	return rate.Limit(float64(n) / 60)
+}
+
+func closeSinks(sinks []namedSink) error {
+	var errs []error
+	for _, sink := range sinks {
+		errs = append(errs, sink.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
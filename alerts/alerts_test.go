@@ -0,0 +1,151 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func TestRuleMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		post    socialmedia.Post
+		matched []string
+	}{
+		{"keyword", Rule{Keywords: []string{"donkey"}}, socialmedia.Post{Title: "I love Donkey!"}, []string{"keyword:donkey"}},
+		{"keyword whole word", Rule{Keywords: []string{"go"}}, socialmedia.Post{Title: "good times"}, nil},
+		{"keyword in body", Rule{Keywords: []string{"go"}}, socialmedia.Post{Body: "written in Go."}, []string{"keyword:go"}},
+		{"regex", Rule{Regexes: []string{`v\d+\.\d+`}}, socialmedia.Post{Title: "donkey v1.2 released"}, []string{`regex:v\d+\.\d+`}},
+		{"author", Rule{Authors: []string{"Alice"}}, socialmedia.Post{Author: "alice"}, []string{"author:alice"}},
+		{"flair", Rule{Flairs: []string{"news"}}, socialmedia.Post{Flair: "News"}, []string{"flair:News"}},
+		{"language", Rule{Languages: []string{"de"}}, socialmedia.Post{Title: "Was haltet ihr von dem neuen Trailer?"}, []string{"language:de"}},
+		{"language mismatch", Rule{Languages: []string{"de"}}, socialmedia.Post{Title: "Ein Trailer", Language: "en"}, nil},
+		{"subreddit mismatch", Rule{Subreddits: []string{"golang"}, Keywords: []string{"donkey"}},
+			socialmedia.Post{SubReddit: "rust", Title: "donkey"}, nil},
+		{"threshold", Rule{Keywords: []string{"donkey"}, MinUpvotes: 100}, socialmedia.Post{Title: "donkey", UpVotes: 99}, nil},
+		{"threshold crossed", Rule{Keywords: []string{"donkey"}, MinUpvotes: 100},
+			socialmedia.Post{Title: "donkey", UpVotes: 100}, []string{"keyword:donkey", "upvotes>=100"}},
+		{"comments only", Rule{On: OnComments, Keywords: []string{"donkey"}}, socialmedia.Post{Title: "donkey"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rule.Name = tt.name
+			rule, err := tt.rule.compile()
+			assert.NoError(t, err)
+			matched, ok := rule.match(postItem(tt.post))
+			assert.Equal(t, tt.matched != nil, ok)
+			assert.Equal(t, tt.matched, matched)
+		})
+	}
+
+	rule, err := Rule{Name: "flair", Flairs: []string{"news"}}.compile()
+	assert.NoError(t, err)
+	_, ok := rule.match(commentItem(socialmedia.Comment{Body: "news"}))
+	assert.False(t, ok)
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Config{
+		RateLimit: 1,
+		Sinks:     []SinkConfig{{Name: "hook", Type: SinkWebhook, URL: "localhost"}},
+		Rules: []Rule{
+			{Name: "empty"},
+			{Name: "regex", Regexes: []string{"("}},
+			{Name: "sinks", Keywords: []string{"donkey"}, Sinks: []string{"slack"}},
+			{Name: "language", Languages: []string{"klingon"}},
+		},
+	}
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, "sinks[0]: url")
+	assert.ErrorContains(t, err, "rules[0]: needs at least one condition")
+	assert.ErrorContains(t, err, "rules[1]: invalid regex")
+	assert.ErrorContains(t, err, `rules[2]: unknown sink "slack"`)
+	assert.ErrorContains(t, err, `rules[3]: unknown language "klingon"`)
+
+	assert.NoError(t, Config{RateLimit: 1}.Validate())
+}
+
+func TestEngineDedupAndRateLimit(t *testing.T) {
+	var out bytes.Buffer
+	cfg := Config{RateLimit: 2, DedupWindow: time.Hour, Rules: []Rule{{Name: "donkey", Keywords: []string{"donkey"}}}}
+	engine, err := NewEngine(cfg, &out, testLogger)
+	assert.NoError(t, err)
+	now := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	engine.Now = func() time.Time { return now }
+
+	post := socialmedia.Post{PostID: "1", SubReddit: "golang", Author: "a", Title: "donkey"}
+	engine.CheckPost(post)
+	// the same post again, i.e. after a score update
+	engine.CheckPost(post)
+	engine.CheckPost(socialmedia.Post{PostID: "2", Title: "donkey"})
+	// over the rate limit of 2 per minute
+	engine.CheckPost(socialmedia.Post{PostID: "3", Title: "donkey"})
+	engine.CheckPost(socialmedia.Post{PostID: "4", Title: "nothing"})
+
+	now = now.Add(2 * time.Hour)
+	engine.CheckPost(post)
+	assert.NoError(t, engine.Close())
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "ALERT [donkey] r/golang post 1 by a: donkey (https://www.reddit.com/comments/1/) matched keyword:donkey", lines[0])
+	assert.Contains(t, lines[1], "post 2")
+	assert.Contains(t, lines[2], "post 1")
+
+	// checks after closing are ignored
+	engine.CheckPost(socialmedia.Post{PostID: "5", Title: "donkey"})
+}
+
+func TestEngineReloadAndFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "alerts.jsonl")
+	cfg := Config{
+		RateLimit:   10,
+		DedupWindow: time.Hour,
+		Sinks:       []SinkConfig{{Name: "file", Type: SinkFile, Path: path}},
+		Rules:       []Rule{{Name: "comments", On: OnComments, Keywords: []string{"donkey"}}},
+	}
+	engine, err := NewEngine(cfg, io.Discard, testLogger)
+	assert.NoError(t, err)
+	engine.CheckComment(socialmedia.Comment{CommentID: "c1", PostID: "1", Body: "a donkey", SubReddit: "golang"})
+
+	cfg.Rules = []Rule{{Name: "authors", Authors: []string{"bob"}}}
+	assert.NoError(t, engine.Reload(cfg))
+	engine.CheckComment(socialmedia.Comment{CommentID: "c2", PostID: "1", Body: "a donkey"})
+	engine.CheckPost(socialmedia.Post{PostID: "2", Author: "bob"})
+
+	cfg.Rules = []Rule{{Name: "invalid"}}
+	assert.Error(t, engine.Reload(cfg))
+	assert.Equal(t, 1, engine.Rules())
+	assert.NoError(t, engine.Close())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, 2)
+	var alert Alert
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &alert))
+	assert.Equal(t, "comments", alert.Rule)
+	assert.Equal(t, "comment", alert.Kind)
+	assert.Equal(t, "https://www.reddit.com/comments/1/comment/c1/", alert.URL)
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &alert))
+	assert.Equal(t, "authors", alert.Rule)
+	assert.Equal(t, "2", alert.ID)
+}
+
+func TestNilEngine(t *testing.T) {
+	var engine *Engine
+	engine.CheckPost(socialmedia.Post{Title: "donkey"})
+	engine.CheckComment(socialmedia.Comment{Body: "donkey"})
+	assert.NoError(t, engine.Close())
+}
@@ -0,0 +1,162 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Valimere/donkey/language"
+	"github.com/Valimere/donkey/socialmedia"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Targets of a rule
+const (
+	OnPosts    = "posts"
+	OnComments = "comments"
+	OnBoth     = "both"
+)
+
+// Rule selects the posts and comments to alert on, every condition that is set has to match.
+// Within a condition any entry matches, keywords and regexes together form a single text condition
+// matched against the title and body.
+type Rule struct {
+	Name string `yaml:"name"`
+	// On is posts, comments or both, the default
+	On         string   `yaml:"on,omitempty"`
+	Subreddits []string `yaml:"subreddits,omitempty"`
+	// Keywords match whole words, ignoring case
+	Keywords []string `yaml:"keywords,omitempty"`
+	// Regexes use the RE2 syntax, (?i) ignores case
+	Regexes []string `yaml:"regexes,omitempty"`
+	Authors []string `yaml:"authors,omitempty"`
+	// Flairs only match posts
+	Flairs []string `yaml:"flairs,omitempty"`
+	// Languages are ISO 639-1 codes, i.e. en or de, they only match posts and "und" those whose language is unknown
+	Languages   []string `yaml:"languages,omitempty"`
+	MinUpvotes  int      `yaml:"min_upvotes,omitempty"`
+	MinComments int      `yaml:"min_comments,omitempty"`
+	// Sinks names the sinks the alerts go to, all sinks if empty
+	Sinks []string `yaml:"sinks,omitempty"`
+}
+
+// compiledRule is a validated rule with its text patterns compiled
+type compiledRule struct {
+	Rule
+	// patterns holds the keywords followed by the regexes, labels names them in alerts
+	patterns []*regexp.Regexp
+	labels   []string
+}
+
+// compile validates the rule and compiles its keywords and regexes
+func (r Rule) compile() (*compiledRule, error) {
+	if strings.TrimSpace(r.Name) == "" {
+		return nil, errors.New("name must not be empty")
+	}
+	if r.On != "" && r.On != OnPosts && r.On != OnComments && r.On != OnBoth {
+		return nil, fmt.Errorf("on must be posts, comments or both, got %q", r.On)
+	}
+	if len(r.Subreddits)+len(r.Keywords)+len(r.Regexes)+len(r.Authors)+len(r.Flairs)+len(r.Languages) == 0 && r.MinUpvotes <= 0 && r.MinComments <= 0 {
+		return nil, errors.New("needs at least one condition")
+	}
+	for _, code := range r.Languages {
+		if code != language.Unknown && !slices.Contains(language.Languages(), strings.ToLower(code)) {
+			return nil, fmt.Errorf("unknown language %q, known are %s and %s", code, strings.Join(language.Languages(), ", "), language.Unknown)
+		}
+	}
+	rule := &compiledRule{Rule: r}
+	for _, keyword := range r.Keywords {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" {
+			return nil, errors.New("keywords must not be empty")
+		}
+		rule.patterns = append(rule.patterns, regexp.MustCompile(`(?i)(^|\W)`+regexp.QuoteMeta(keyword)+`($|\W)`))
+		rule.labels = append(rule.labels, "keyword:"+keyword)
+	}
+	for _, expr := range r.Regexes {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %w", expr, err)
+		}
+		rule.patterns = append(rule.patterns, pattern)
+		rule.labels = append(rule.labels, "regex:"+expr)
+	}
+	return rule, nil
+}
+
+// item is the part of a post or comment the rules look at
+type item struct {
+	comment     bool
+	subreddit   string
+	author      string
+	flair       string
+	language    string
+	text        string
+	upvotes     int
+	numComments int
+}
+
+func postItem(post socialmedia.Post) item {
+	text := post.Title + "\n" + post.Body
+	// posts that were not stored have no language yet
+	lang := post.Language
+	if lang == "" {
+		lang = language.Detect(text)
+	}
+	return item{subreddit: post.SubReddit, author: post.Author, flair: post.Flair, language: lang, text: text,
+		upvotes: post.UpVotes, numComments: post.NumComments}
+}
+
+func commentItem(comment socialmedia.Comment) item {
+	return item{comment: true, subreddit: comment.SubReddit, author: comment.Author, text: comment.Body, upvotes: comment.UpVotes}
+}
+
+// match reports whether the item matches every condition of the rule and describes what matched
+func (r *compiledRule) match(it item) ([]string, bool) {
+	switch {
+	case r.On == OnPosts && it.comment, r.On == OnComments && !it.comment:
+		return nil, false
+	case len(r.Subreddits) > 0 && !containsFold(r.Subreddits, it.subreddit):
+		return nil, false
+	case len(r.Authors) > 0 && !containsFold(r.Authors, it.author):
+		return nil, false
+	case len(r.Flairs) > 0 && (it.comment || !containsFold(r.Flairs, it.flair)):
+		return nil, false
+	case len(r.Languages) > 0 && (it.comment || !containsFold(r.Languages, it.language)):
+		return nil, false
+	case r.MinUpvotes > 0 && it.upvotes < r.MinUpvotes:
+		return nil, false
+	case r.MinComments > 0 && it.numComments < r.MinComments:
+		return nil, false
+	}
+
+	var matched []string
+	for i, pattern := range r.patterns {
+		if pattern.MatchString(it.text) {
+			matched = append(matched, r.labels[i])
+		}
+	}
+	if len(r.patterns) > 0 && len(matched) == 0 {
+		return nil, false
+	}
+	if len(r.Authors) > 0 {
+		matched = append(matched, "author:"+it.author)
+	}
+	if len(r.Flairs) > 0 {
+		matched = append(matched, "flair:"+it.flair)
+	}
+	if len(r.Languages) > 0 {
+		matched = append(matched, "language:"+it.language)
+	}
+	if r.MinUpvotes > 0 {
+		matched = append(matched, fmt.Sprintf("upvotes>=%d", r.MinUpvotes))
+	}
+	if r.MinComments > 0 {
+		matched = append(matched, fmt.Sprintf("comments>=%d", r.MinComments))
+	}
+	return matched, true
+}
+
+func containsFold(values []string, value string) bool {
+	return slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, value) })
+}
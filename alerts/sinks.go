@@ -0,0 +1,144 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sink types
+const (
+	SinkStdout  = "stdout"
+	SinkFile    = "file"
+	SinkWebhook = "webhook"
+)
+
+// webhookTimeout bounds a single webhook request
+const webhookTimeout = 10 * time.Second
+
+// SinkConfig configures where alerts are sent to
+type SinkConfig struct {
+	Name string `yaml:"name"`
+	// Type is stdout, file or webhook
+	Type string `yaml:"type"`
+	// Path is the file alerts are appended to as JSON lines, for the file type
+	Path string `yaml:"path,omitempty"`
+	// URL receives every alert as a JSON POST, for the webhook type
+	URL string `yaml:"url,omitempty"`
+}
+
+// Sink delivers alerts, Send is only called from one goroutine at a time
+type Sink interface {
+	Send(ctx context.Context, alert Alert) error
+	Close() error
+}
+
+// validate checks the sink configuration without opening anything
+func (c SinkConfig) validate() error {
+	if strings.TrimSpace(c.Name) == "" {
+		return errors.New("name must not be empty")
+	}
+	switch c.Type {
+	case SinkStdout:
+	case SinkFile:
+		if c.Path == "" {
+			return errors.New("path is required for file sinks")
+		}
+	case SinkWebhook:
+		if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an absolute http(s) URL, got %q", c.URL)
+		}
+	default:
+		return fmt.Errorf("type must be stdout, file or webhook, got %q", c.Type)
+	}
+	return nil
+}
+
+// open creates the sink, stdout is written to out
+func (c SinkConfig) open(out io.Writer) (Sink, error) {
+	switch c.Type {
+	case SinkFile:
+		f, err := os.OpenFile(c.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open alert file: %w", err)
+		}
+		return &fileSink{f: f}, nil
+	case SinkWebhook:
+		return &webhookSink{url: c.URL, client: &http.Client{Timeout: webhookTimeout}}, nil
+	default:
+		return &writerSink{out: out}, nil
+	}
+}
+
+// writerSink prints one line per alert
+type writerSink struct {
+	out io.Writer
+}
+
+func (s *writerSink) Send(_ context.Context, alert Alert) error {
+	_, err := fmt.Fprintf(s.out, "ALERT [%s] r/%s %s %s by %s: %s (%s) matched %s\n",
+		alert.Rule, alert.Subreddit, alert.Kind, alert.ID, alert.Author, alert.Title, alert.URL, strings.Join(alert.Matched, ", "))
+	return err
+}
+
+func (s *writerSink) Close() error {
+	return nil
+}
+
+// fileSink appends alerts as JSON lines
+type fileSink struct {
+	f *os.File
+}
+
+func (s *fileSink) Send(_ context.Context, alert Alert) error {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.f.Close()
+}
+
+// webhookSink posts alerts as JSON
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Send(ctx context.Context, alert Alert) error {
+	data, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered with status: %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	return nil
+}
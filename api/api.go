@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/Valimere/donkey/logging"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Server is donkey's HTTP API, the subsystems register their handlers before Start
+type Server struct {
+	Addr   string
+	Mux    *http.ServeMux
+	Logger *slog.Logger
+
+	server *http.Server
+}
+
+func NewServer(addr string, logger *slog.Logger) *Server {
+	return &Server{
+		Addr:   addr,
+		Mux:    http.NewServeMux(),
+		Logger: logging.Component(logger, logging.ComponentAPI),
+	}
+}
+
+// Handle registers a handler for the pattern, see http.ServeMux for the pattern syntax
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.Mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers a handler function for the pattern
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.Mux.HandleFunc(pattern, handler)
+}
+
+// Start listens on Addr and serves in the background, listen errors are returned right away
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	s.server = &http.Server{
+		Handler:           s.Mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.Logger.Info("api server listening", "addr", listener.Addr().String())
+	go func() {
+		err := s.server.Serve(listener)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.Logger.Error("api server stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Shutdown stops the server, waiting for active requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
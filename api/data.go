@@ -0,0 +1,517 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Valimere/donkey/events"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/statistics"
+	"github.com/Valimere/donkey/store"
+	"github.com/Valimere/donkey/textdiff"
+	"github.com/Valimere/donkey/trends"
+	"gorm.io/gorm"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+)
+
+// defaultSentimentPeriod is the period the sentiment is averaged over unless ?period= is given
+const defaultSentimentPeriod = 24 * time.Hour
+
+// defaultFront is how many ranks of a listing count as its front page unless ?front= is given
+const defaultFront = 25
+
+// sseBuffer is how many events may queue up for a slow stream client before they are dropped
+const sseBuffer = 256
+
+// sseHeartbeat keeps idle event streams from being closed by proxies
+const sseHeartbeat = 15 * time.Second
+
+// LeaderboardResponse is the body of GET /api/leaderboard
+type LeaderboardResponse struct {
+	Posts   []socialmedia.Post            `json:"posts"`
+	Authors []socialmedia.AuthorStatistic `json:"authors"`
+}
+
+// PostResponse is the body of GET /api/posts/{id}
+type PostResponse struct {
+	Post    socialmedia.Post           `json:"post"`
+	History []socialmedia.PostSnapshot `json:"history"`
+}
+
+// RevisionsResponse is the body of GET /api/posts/{id}/revisions, Revisions is empty for posts that were never edited
+type RevisionsResponse struct {
+	PostID    string             `json:"post_id"`
+	Revisions []RevisionResponse `json:"revisions"`
+}
+
+// RevisionResponse is a revision of a post with its changes against the previous revision, the diffs are empty for the original
+type RevisionResponse struct {
+	socialmedia.PostRevision
+	TitleDiff []textdiff.Line `json:"title_diff,omitempty"`
+	BodyDiff  []textdiff.Line `json:"body_diff,omitempty"`
+}
+
+// RanksResponse is the body of GET /api/ranks/{subreddit}/{listing}
+type RanksResponse struct {
+	Subreddit string       `json:"subreddit"`
+	Listing   string       `json:"listing"`
+	Front     int          `json:"front"`
+	Polled    time.Time    `json:"polled"`
+	Posts     []RankedPost `json:"posts"`
+}
+
+// RankedPost is a post that reached the front of a listing and how long it stayed there
+type RankedPost struct {
+	statistics.ListingStint
+	// Post is nil if the post is not stored
+	Post *socialmedia.Post `json:"post"`
+}
+
+// DeliveryResponse is one entry of GET /api/webhooks/deliveries
+type DeliveryResponse struct {
+	ID             uint            `json:"id"`
+	Endpoint       string          `json:"endpoint"`
+	Event          string          `json:"event"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttempt    time.Time       `json:"next_attempt"`
+	LastError      string          `json:"last_error,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	Created        time.Time       `json:"created"`
+	Updated        time.Time       `json:"updated"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// writeError answers with a JSON error, internal errors are logged and not exposed to the client
+func writeError(w http.ResponseWriter, r *http.Request, logger *slog.Logger, status int, err error) {
+	msg := err.Error()
+	if status >= http.StatusInternalServerError {
+		logger.ErrorContext(r.Context(), "request failed", "path", r.URL.Path, "error", err)
+		msg = http.StatusText(status)
+	}
+	writeJSON(w, status, errorResponse{Error: msg})
+}
+
+// limitParam reads the limit query parameter, defaulting to defaultLimit and capped at maxLimit
+func limitParam(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, fmt.Errorf("limit must be a positive number, got %q", value)
+	}
+	return min(limit, maxLimit), nil
+}
+
+// Rising serves the posts gaining upvotes fastest compared to their subreddit, ?limit= sets how many
+func Rising(st store.Store, opts statistics.RisingOptions, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, err := limitParam(r)
+		if err != nil {
+			writeError(w, r, logger, http.StatusBadRequest, err)
+			return
+		}
+		rising, err := statistics.GetRising(st, time.Now(), opts)
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, append([]socialmedia.PostVelocity{}, rising[:min(limit, len(rising))]...))
+	})
+}
+
+// Trending serves the terms trending right now, in the subreddit given by ?subreddit= or across all of them, ?limit= sets how many
+func Trending(tracker *trends.Tracker, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, err := limitParam(r)
+		if err != nil {
+			writeError(w, r, logger, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, append([]socialmedia.TrendingTerm{}, tracker.Trending(r.URL.Query().Get("subreddit"), limit)...))
+	})
+}
+
+// Removals serves the deleted and removed posts per subreddit, the highest removal rate first
+func Removals(st store.Store, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		removals, err := statistics.GetRemovalStatistics(st, store.Filter{})
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, removals)
+	})
+}
+
+// Sentiment serves the average sentiment of the posts per subreddit and ?period=, a day by default, in order of the subreddit
+// and time, ?subreddit= and ?language= narrow it down to the posts of one subreddit and language
+func Sentiment(st store.Store, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		period := defaultSentimentPeriod
+		if value := r.URL.Query().Get("period"); value != "" {
+			var err error
+			period, err = time.ParseDuration(value)
+			if err != nil || period < time.Minute {
+				writeError(w, r, logger, http.StatusBadRequest, fmt.Errorf("period must be a duration of at least 1m, got %q", value))
+				return
+			}
+		}
+		averages, err := statistics.GetSentimentStatistics(st, postFilter(r), period)
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, averages)
+	})
+}
+
+// SentimentPosts serves the most positive posts, or the most negative ones with ?order=negative, ?limit= sets how many,
+// ?subreddit= and ?language= narrow them down
+func SentimentPosts(st store.Store, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, err := limitParam(r)
+		if err != nil {
+			writeError(w, r, logger, http.StatusBadRequest, err)
+			return
+		}
+		filter := postFilter(r)
+		var posts []socialmedia.Post
+		switch order := r.URL.Query().Get("order"); order {
+		case "", "positive":
+			posts, err = statistics.GetMostPositivePosts(st, filter, limit)
+		case "negative":
+			posts, err = statistics.GetMostNegativePosts(st, filter, limit)
+		default:
+			writeError(w, r, logger, http.StatusBadRequest, fmt.Errorf("order must be positive or negative, got %q", order))
+			return
+		}
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, append([]socialmedia.Post{}, posts...))
+	})
+}
+
+// SentimentAuthors serves the average sentiment of the authors with the most posts and comments, ?limit= sets how many
+func SentimentAuthors(st store.Store, logger *slog.Logger) http.Handler {
+	return limitedList(func(limit int) ([]socialmedia.AuthorSentiment, error) {
+		return statistics.GetAuthorSentiment(st, store.Filter{}, limit)
+	}, logger)
+}
+
+// Languages serves the number of posts per subreddit and detected language, ?subreddit= narrows it down to one subreddit
+func Languages(st store.Store, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		languages, err := statistics.GetLanguageStatistics(st, store.Filter{Subreddit: r.URL.Query().Get("subreddit")})
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, languages)
+	})
+}
+
+// postFilter reads the ?subreddit= and ?language= query parameters
+func postFilter(r *http.Request) store.Filter {
+	return store.Filter{Subreddit: r.URL.Query().Get("subreddit"), Language: r.URL.Query().Get("language")}
+}
+
+// Crossposts serves the originals crossposted most into the monitored subreddits, ?limit= sets how many
+func Crossposts(st store.Store, logger *slog.Logger) http.Handler {
+	return limitedList(st.GetMostCrossposted, logger)
+}
+
+// Feeds serves the pairs of subreddits posts moved between as crossposts or shared links, ?limit= sets how many
+func Feeds(st store.Store, logger *slog.Logger) http.Handler {
+	return limitedList(st.GetSubredditFeeds, logger)
+}
+
+// Reposts serves the links posted more than once with their posts, ?limit= sets how many
+func Reposts(st store.Store, logger *slog.Logger) http.Handler {
+	return limitedList(st.GetReposts, logger)
+}
+
+// RepostClusters serves the posts reposted most with their reposts, ?limit= sets how many
+func RepostClusters(st store.Store, logger *slog.Logger) http.Handler {
+	return limitedList(st.GetRepostClusters, logger)
+}
+
+// Bots serves the authors scored as suspected bots, the highest score first, ?limit= sets how many
+func Bots(st store.Store, logger *slog.Logger) http.Handler {
+	return limitedList(st.GetSuspectedBots, logger)
+}
+
+// AuthorScore serves how likely an author is a bot, the pattern must have an {author} wildcard
+func AuthorScore(st store.Store, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		author := r.PathValue("author")
+		score, err := st.GetAuthorScore(author)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, r, logger, http.StatusNotFound, fmt.Errorf("author %s was not scored yet", author))
+			return
+		}
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, score)
+	})
+}
+
+// limitedList serves the result of a store query that takes the ?limit= parameter
+func limitedList[T any](query func(limit int) ([]T, error), logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, err := limitParam(r)
+		if err != nil {
+			writeError(w, r, logger, http.StatusBadRequest, err)
+			return
+		}
+		list, err := query(limit)
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+}
+
+// WebhookDeliveries serves the webhook delivery log newest first, ?endpoint= and ?status= narrow it down
+func WebhookDeliveries(st store.Store, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, err := limitParam(r)
+		if err != nil {
+			writeError(w, r, logger, http.StatusBadRequest, err)
+			return
+		}
+		filter := store.DeliveryFilter{Endpoint: r.URL.Query().Get("endpoint"), Status: r.URL.Query().Get("status"), Limit: limit}
+		switch filter.Status {
+		case "", store.DeliveryPending, store.DeliveryDelivered, store.DeliveryFailed:
+		default:
+			writeError(w, r, logger, http.StatusBadRequest, fmt.Errorf("status must be one of %s, %s or %s, got %q",
+				store.DeliveryPending, store.DeliveryDelivered, store.DeliveryFailed, filter.Status))
+			return
+		}
+		deliveries, err := st.GetWebhookDeliveries(filter)
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		response := make([]DeliveryResponse, 0, len(deliveries))
+		for _, d := range deliveries {
+			response = append(response, DeliveryResponse{ID: d.ID, Endpoint: d.Endpoint, Event: d.Event, Status: d.Status,
+				Attempts: d.Attempts, NextAttempt: d.NextAttempt, LastError: d.LastError, ResponseStatus: d.ResponseStatus,
+				Created: d.Created, Updated: d.Updated, Payload: d.Payload})
+		}
+		writeJSON(w, http.StatusOK, response)
+	})
+}
+
+// Leaderboard serves the leading posts and authors, ?limit= sets how many of each
+func Leaderboard(st store.Store, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, err := limitParam(r)
+		if err != nil {
+			writeError(w, r, logger, http.StatusBadRequest, err)
+			return
+		}
+		posts, err := st.GetLeadingPosts(limit)
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		authors, err := st.GetLeadingAuthors(limit)
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, LeaderboardResponse{Posts: posts, Authors: authors})
+	})
+}
+
+// Subreddits serves the post, upvote and comment totals per subreddit
+func Subreddits(st store.Store, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subreddits, err := st.GetSubredditStatistics()
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, subreddits)
+	})
+}
+
+// Post serves a stored post with its score history, the pattern must have an {id} wildcard
+func Post(st store.Store, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		post, err := st.GetPost(id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, r, logger, http.StatusNotFound, fmt.Errorf("post %s not found", id))
+			return
+		}
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		history, err := st.GetPostHistory(id)
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, PostResponse{Post: post, History: history})
+	})
+}
+
+// Revisions serves the revisions of an edited post with line diffs between them
+func Revisions(st store.Store, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		_, err := st.GetPost(id)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			writeError(w, r, logger, http.StatusNotFound, fmt.Errorf("post %s not found", id))
+			return
+		}
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		revisions, err := st.GetPostRevisions(id)
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		response := RevisionsResponse{PostID: id, Revisions: make([]RevisionResponse, 0, len(revisions))}
+		for i, revision := range revisions {
+			entry := RevisionResponse{PostRevision: revision}
+			if i > 0 {
+				previous := revisions[i-1]
+				if previous.Title != revision.Title {
+					entry.TitleDiff = textdiff.Lines(previous.Title, revision.Title)
+				}
+				if previous.Body != revision.Body {
+					entry.BodyDiff = textdiff.Lines(previous.Body, revision.Body)
+				}
+			}
+			response.Revisions = append(response.Revisions, entry)
+		}
+		writeJSON(w, http.StatusOK, response)
+	})
+}
+
+// Ranks serves the posts that reached the first ?front= ranks of a subreddit listing, the longest stays first,
+// ?limit= sets how many. The pattern must have {subreddit} and {listing} wildcards.
+func Ranks(st store.Store, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listing, err := socialmedia.ParseListing(r.PathValue("listing"))
+		if err != nil {
+			writeError(w, r, logger, http.StatusBadRequest, err)
+			return
+		}
+		limit, err := limitParam(r)
+		if err != nil {
+			writeError(w, r, logger, http.StatusBadRequest, err)
+			return
+		}
+		front := defaultFront
+		if value := r.URL.Query().Get("front"); value != "" {
+			front, err = strconv.Atoi(value)
+			if err != nil || front < 1 {
+				writeError(w, r, logger, http.StatusBadRequest, fmt.Errorf("front must be a positive number, got %q", value))
+				return
+			}
+		}
+
+		history, err := st.GetListingHistory(r.PathValue("subreddit"), listing.String())
+		if err != nil {
+			writeError(w, r, logger, http.StatusInternalServerError, err)
+			return
+		}
+		if history.Polled.IsZero() {
+			writeError(w, r, logger, http.StatusNotFound,
+				fmt.Errorf("listing %s of %s was never polled", listing, r.PathValue("subreddit")))
+			return
+		}
+		stints := statistics.FrontPageStints(history, front)
+		response := RanksResponse{Subreddit: history.Subreddit, Listing: history.Listing, Front: front, Polled: history.Polled,
+			Posts: make([]RankedPost, 0, min(limit, len(stints)))}
+		for _, stint := range stints[:min(limit, len(stints))] {
+			ranked := RankedPost{ListingStint: stint}
+			post, err := st.GetPost(stint.PostID)
+			switch {
+			case err == nil:
+				ranked.Post = &post
+			case !errors.Is(err, gorm.ErrRecordNotFound):
+				writeError(w, r, logger, http.StatusInternalServerError, err)
+				return
+			}
+			response.Posts = append(response.Posts, ranked)
+		}
+		writeJSON(w, http.StatusOK, response)
+	})
+}
+
+// Events streams the ingestion events as server-sent events, the event name is the event type
+func Events(bus *events.Bus, logger *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, r, logger, http.StatusInternalServerError, errors.New("streaming is not supported"))
+			return
+		}
+		ch, unsubscribe := bus.Subscribe(sseBuffer)
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				_, err := fmt.Fprint(w, ": heartbeat\n\n")
+				if err != nil {
+					return
+				}
+			case e := <-ch:
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+				if err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	})
+}
@@ -0,0 +1,368 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/Valimere/donkey/db/dbtest"
+	"github.com/Valimere/donkey/events"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/statistics"
+	"github.com/Valimere/donkey/store"
+	"github.com/Valimere/donkey/textdiff"
+	"github.com/Valimere/donkey/trends"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func get(t *testing.T, handler http.Handler, pattern, target string, body any) int {
+	mux := http.NewServeMux()
+	mux.Handle(pattern, handler)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if body != nil {
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), body))
+	}
+	return rec.Code
+}
+
+func TestLeaderboard(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "1", Author: "a", UpVotes: 5, SubReddit: "music"}))
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "2", Author: "b", UpVotes: 9, SubReddit: "music"}))
+
+	var board LeaderboardResponse
+	code := get(t, Leaderboard(dbStore, testLogger), "GET /api/leaderboard", "/api/leaderboard?limit=1", &board)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, board.Posts, 1)
+	assert.Equal(t, "2", board.Posts[0].PostID)
+	assert.Len(t, board.Authors, 1)
+
+	var errBody errorResponse
+	code = get(t, Leaderboard(dbStore, testLogger), "GET /api/leaderboard", "/api/leaderboard?limit=x", &errBody)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Contains(t, errBody.Error, "limit")
+}
+
+func TestSubreddits(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "1", Author: "a", UpVotes: 5, SubReddit: "music"}))
+
+	var subreddits []socialmedia.SubredditStatistic
+	code := get(t, Subreddits(dbStore, testLogger), "GET /api/subreddits", "/api/subreddits", &subreddits)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []socialmedia.SubredditStatistic{{Subreddit: "music", TotalPosts: 1, TotalUpvotes: 5}}, subreddits)
+}
+
+func TestPost(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	post := &socialmedia.Post{PostID: "1", Author: "a", UpVotes: 5}
+	assert.NoError(t, dbStore.SavePost(post))
+	post.UpVotes = 8
+	_, err := dbStore.UpdatePostScore(post)
+	assert.NoError(t, err)
+
+	var body PostResponse
+	code := get(t, Post(dbStore, testLogger), "GET /api/posts/{id}", "/api/posts/1", &body)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 8, body.Post.UpVotes)
+	assert.Len(t, body.History, 2)
+
+	code = get(t, Post(dbStore, testLogger), "GET /api/posts/{id}", "/api/posts/missing", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestRevisions(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	post := &socialmedia.Post{PostID: "1", Author: "a", Title: "Donkey", Body: "v1 is out\nenjoy", UpVotes: 3}
+	assert.NoError(t, dbStore.SavePost(post))
+	var body RevisionsResponse
+	code := get(t, Revisions(dbStore, testLogger), "GET /api/posts/{id}/revisions", "/api/posts/1/revisions", &body)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, body.Revisions)
+
+	post.Body, post.UpVotes = "v2 is out\nenjoy", 500
+	edited, err := dbStore.RecordPostRevision(post, time.Now())
+	assert.NoError(t, err)
+	assert.True(t, edited)
+
+	code = get(t, Revisions(dbStore, testLogger), "GET /api/posts/{id}/revisions", "/api/posts/1/revisions", &body)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, body.Revisions, 2)
+	assert.Empty(t, body.Revisions[0].BodyDiff)
+	assert.Equal(t, 500, body.Revisions[1].UpVotes)
+	assert.Empty(t, body.Revisions[1].TitleDiff)
+	assert.Equal(t, "- v1 is out\n+ v2 is out\n  enjoy\n", textdiff.String(body.Revisions[1].BodyDiff))
+
+	code = get(t, Revisions(dbStore, testLogger), "GET /api/posts/{id}/revisions", "/api/posts/missing/revisions", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestRanks(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "1", Author: "a", SubReddit: "music"}))
+	start := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	_, err := dbStore.RecordListingRanks("music", "top:day", []string{"1", "2"}, start)
+	assert.NoError(t, err)
+	_, err = dbStore.RecordListingRanks("music", "top:day", []string{"2"}, start.Add(time.Hour))
+	assert.NoError(t, err)
+
+	var body RanksResponse
+	code := get(t, Ranks(dbStore, testLogger), "GET /api/ranks/{subreddit}/{listing}", "/api/ranks/music/top:day?front=1", &body)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, body.Posts, 2)
+	assert.Equal(t, "1", body.Posts[0].PostID)
+	assert.Equal(t, time.Hour, body.Posts[0].Duration)
+	assert.Equal(t, "a", body.Posts[0].Post.Author)
+	assert.True(t, body.Posts[1].Current)
+	assert.Nil(t, body.Posts[1].Post)
+
+	code = get(t, Ranks(dbStore, testLogger), "GET /api/ranks/{subreddit}/{listing}", "/api/ranks/music/best", nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code = get(t, Ranks(dbStore, testLogger), "GET /api/ranks/{subreddit}/{listing}", "/api/ranks/music/hot", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestEvents(t *testing.T) {
+	bus := events.NewBus()
+	server := httptest.NewServer(Events(bus, testLogger))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// the handler subscribes before sending the headers, so the event can't get lost
+	bus.Publish(events.Event{Type: events.PostIngested, Subreddit: "music", Post: &socialmedia.Post{PostID: "1"}})
+
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "event: post_ingested\n", line)
+	line, err = reader.ReadString('\n')
+	assert.NoError(t, err)
+	var e events.Event
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e))
+	if assert.NotNil(t, e.Post) {
+		assert.Equal(t, "1", e.Post.PostID)
+	}
+}
+
+func TestRising(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	created := time.Now().Add(-10 * time.Minute)
+	for i, upvotes := range []int{10, 20, 30, 600} {
+		assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: strconv.Itoa(i + 1), Author: "a", SubReddit: "music",
+			UpVotes: upvotes, Created: created}))
+	}
+	opts := statistics.RisingOptions{Window: time.Hour, MaxAge: time.Hour, MinRatio: 3, MinBaseline: 0.5}
+
+	var body []socialmedia.PostVelocity
+	code := get(t, Rising(dbStore, opts, testLogger), "GET /api/rising", "/api/rising", &body)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, body, 1)
+	assert.Equal(t, "4", body[0].PostID)
+	assert.InDelta(t, 60, body[0].UpvotesPerMinute, 1)
+
+	opts.MinRatio = 100
+	code = get(t, Rising(dbStore, opts, testLogger), "GET /api/rising", "/api/rising", &body)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, body)
+}
+
+func TestRemovals(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "1", Author: "a", SubReddit: "music"}))
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "2", Author: "a", SubReddit: "music"}))
+	_, err := dbStore.UpdatePostState(&socialmedia.Post{PostID: "2", State: socialmedia.PostRemoved}, time.Now())
+	assert.NoError(t, err)
+
+	var body []socialmedia.RemovalStatistic
+	code := get(t, Removals(dbStore, testLogger), "GET /api/removals", "/api/removals", &body)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, body, 1)
+	assert.Equal(t, 1, body[0].Removed)
+	assert.Equal(t, 0.5, body[0].RemovalRate)
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	now := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	queued, err := dbStore.EnqueueWebhookDeliveries("", []store.WebhookDelivery{
+		{Endpoint: "chat", URL: "http://chat", Event: "post.new", Payload: []byte(`{"type":"post.new"}`), Status: store.DeliveryPending, NextAttempt: now},
+		{Endpoint: "ops", URL: "http://ops", Event: "post.new", Payload: []byte(`{"type":"post.new"}`), Status: store.DeliveryPending, NextAttempt: now},
+	})
+	assert.NoError(t, err)
+	assert.True(t, queued)
+
+	var body []DeliveryResponse
+	code := get(t, WebhookDeliveries(dbStore, testLogger), "GET /api/webhooks/deliveries", "/api/webhooks/deliveries?endpoint=ops&status=pending", &body)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, body, 1)
+	assert.Equal(t, "ops", body[0].Endpoint)
+	assert.JSONEq(t, `{"type":"post.new"}`, string(body[0].Payload))
+
+	code = get(t, WebhookDeliveries(dbStore, testLogger), "GET /api/webhooks/deliveries", "/api/webhooks/deliveries?status=lost", nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestCrosspostGraph(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	parent := &socialmedia.CrosspostParent{PostID: "o", Subreddit: "golang"}
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "1", Author: "a", SubReddit: "music", CrosspostParent: parent}))
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "2", Author: "a", SubReddit: "music", URL: "https://example.com/a"}))
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "3", Author: "b", SubReddit: "golang", URL: "https://example.com/a/"}))
+
+	var crossposts []socialmedia.CrosspostStatistic
+	code := get(t, Crossposts(dbStore, testLogger), "GET /api/crossposts", "/api/crossposts", &crossposts)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, crossposts, 1)
+	assert.Equal(t, []string{"music"}, crossposts[0].Subreddits)
+
+	var feeds []socialmedia.SubredditFeed
+	code = get(t, Feeds(dbStore, testLogger), "GET /api/crossposts/feeds", "/api/crossposts/feeds?limit=1", &feeds)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []socialmedia.SubredditFeed{{From: "golang", To: "music", Crossposts: 1}}, feeds)
+
+	var reposts []socialmedia.Repost
+	code = get(t, Reposts(dbStore, testLogger), "GET /api/reposts", "/api/reposts", &reposts)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, reposts, 1)
+	assert.Equal(t, "example.com/a", reposts[0].URL)
+	assert.Len(t, reposts[0].Posts, 2)
+
+	var errBody errorResponse
+	code = get(t, Reposts(dbStore, testLogger), "GET /api/reposts", "/api/reposts?limit=x", &errBody)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestRepostClusters(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	title := "My cat sleeping on the keyboard while I try to work"
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "1", Author: "a", SubReddit: "cats", Title: title}))
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "2", Author: "b", SubReddit: "aww", Title: "[OC] " + title}))
+
+	var clusters []socialmedia.RepostCluster
+	code := get(t, RepostClusters(dbStore, testLogger), "GET /api/reposts/clusters", "/api/reposts/clusters", &clusters)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, clusters, 1)
+	assert.Equal(t, "1", clusters[0].Original.PostID)
+	assert.Len(t, clusters[0].Reposts, 1)
+	assert.Equal(t, []string{"aww", "cats"}, clusters[0].Subreddits)
+}
+
+func TestBots(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	now := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, dbStore.SaveAuthorScores([]socialmedia.AuthorScore{
+		{Author: "RemindMeBot", Score: 1, Bot: true, Posts: 2, Cadence: -1, RepeatedTitles: -1, Account: -1, Name: 1, Scored: now},
+		{Author: "gopher", Score: 0.1, Posts: 6, Cadence: 0.25, RepeatedTitles: 0, Account: -1, Scored: now},
+	}))
+
+	var body []socialmedia.AuthorScore
+	code := get(t, Bots(dbStore, testLogger), "GET /api/bots", "/api/bots", &body)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, body, 1) {
+		assert.Equal(t, "RemindMeBot", body[0].Author)
+	}
+
+	var score socialmedia.AuthorScore
+	code = get(t, AuthorScore(dbStore, testLogger), "GET /api/bots/{author}", "/api/bots/gopher", &score)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 0.25, score.Cadence)
+	assert.False(t, score.Bot)
+
+	var errBody errorResponse
+	code = get(t, AuthorScore(dbStore, testLogger), "GET /api/bots/{author}", "/api/bots/nobody", &errBody)
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Contains(t, errBody.Error, "nobody")
+}
+
+func TestTrending(t *testing.T) {
+	tracker := trends.New(trends.Options{Window: time.Hour, Baseline: 24 * time.Hour, MaxPhrase: 3, MinCount: 2})
+	tracker.Add(socialmedia.Post{PostID: "1", SubReddit: "movies", Title: "Dune Part Two trailer", Created: time.Now()})
+	tracker.Add(socialmedia.Post{PostID: "2", SubReddit: "movies", Title: "Dune Part Two review", Created: time.Now()})
+
+	var body []socialmedia.TrendingTerm
+	code := get(t, Trending(tracker, testLogger), "GET /api/trending", "/api/trending?subreddit=movies", &body)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, body, 1)
+	assert.Equal(t, "dune part two", body[0].Term)
+
+	code = get(t, Trending(tracker, testLogger), "GET /api/trending", "/api/trending?subreddit=golang", &body)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, body)
+}
+
+func TestSentiment(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	created := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "1", Author: "a", SubReddit: "music", Title: "What a wonderful album", Created: created}))
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "2", Author: "b", SubReddit: "music", Title: "This album is terrible", Created: created}))
+
+	var averages []socialmedia.SentimentStatistic
+	code := get(t, Sentiment(dbStore, testLogger), "GET /api/sentiment", "/api/sentiment?period=1h", &averages)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, averages, 1) {
+		assert.Equal(t, created, averages[0].Start)
+		assert.Equal(t, 1, averages[0].Positive)
+		assert.Equal(t, 1, averages[0].Negative)
+	}
+	var errBody errorResponse
+	code = get(t, Sentiment(dbStore, testLogger), "GET /api/sentiment", "/api/sentiment?period=soon", &errBody)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	var posts []socialmedia.Post
+	code = get(t, SentimentPosts(dbStore, testLogger), "GET /api/sentiment/posts", "/api/sentiment/posts?order=negative", &posts)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, posts, 1) {
+		assert.Equal(t, "2", posts[0].PostID)
+		assert.Less(t, posts[0].Sentiment, 0.0)
+	}
+	code = get(t, SentimentPosts(dbStore, testLogger), "GET /api/sentiment/posts", "/api/sentiment/posts?order=newest", &errBody)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	var authors []socialmedia.AuthorSentiment
+	code = get(t, SentimentAuthors(dbStore, testLogger), "GET /api/sentiment/authors", "/api/sentiment/authors?limit=1", &authors)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, authors, 1)
+}
+
+func TestLanguages(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "1", Author: "a", SubReddit: "movies", Title: "What do you think about the new trailer?"}))
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "2", Author: "a", SubReddit: "movies", Title: "Was haltet ihr von dem neuen Trailer?"}))
+	assert.NoError(t, dbStore.SavePost(&socialmedia.Post{PostID: "3", Author: "a", SubReddit: "music", Title: "Which album should I listen to first?"}))
+
+	var body []socialmedia.LanguageStatistic
+	code := get(t, Languages(dbStore, testLogger), "GET /api/languages", "/api/languages?subreddit=movies", &body)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, body, 2) {
+		assert.Equal(t, "de", body[0].Language)
+		assert.Equal(t, 0.5, body[0].Share)
+	}
+
+	var averages []socialmedia.SentimentStatistic
+	code = get(t, Sentiment(dbStore, testLogger), "GET /api/sentiment", "/api/sentiment?language=de", &averages)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, averages, 1) {
+		assert.Equal(t, "movies", averages[0].Subreddit)
+		assert.Equal(t, 1, averages[0].Posts)
+	}
+}
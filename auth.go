@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Valimere/donkey/config"
+	"github.com/Valimere/donkey/socialmedia"
+	"gorm.io/gorm"
+	"time"
+)
+
+const authDescription = `Manages the reddit OAuth token stored in the database.
+
+Subcommands:
+  login   run the browser authorization flow and store a new token
+  status  show whether the stored token is usable and when it expires
+  revoke  revoke the stored token at reddit and delete it from the database`
+
+func authCommand(cfg *config.Config, args []string) error {
+	fs := newFlagSet("auth", "login|status|revoke [flags]", authDescription)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	switch fs.Arg(0) {
+	case "login":
+		return authLogin(cfg, fs.Args()[1:])
+	case "status":
+		return authStatus(cfg, fs.Args()[1:])
+	case "revoke":
+		return authRevoke(cfg, fs.Args()[1:])
+	default:
+		fmt.Fprintf(fs.Output(), "donkey auth: unknown subcommand %q\n\n", fs.Arg(0))
+		fs.Usage()
+		return errUsage
+	}
+}
+
+func authLogin(cfg *config.Config, args []string) error {
+	fs := newFlagSet("auth login", "[flags]",
+		"Runs the browser authorization flow and stores the new token, replacing any existing one.")
+	addStorageFlags(fs, cfg)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+
+	dbStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = newAuthorizedClient(dbStore, cfg, true)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Login successful, token stored.")
+	return nil
+}
+
+func authStatus(cfg *config.Config, args []string) error {
+	fs := newFlagSet("auth status", "[flags]", "Shows whether the stored token is usable and when it expires.")
+	addStorageFlags(fs, cfg)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+
+	dbStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	token, err := dbStore.GetToken()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		fmt.Println("No token stored, run \"donkey auth login\".")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read token: %w", err)
+	}
+
+	state := "valid"
+	if !token.Valid() {
+		state = "expired"
+	}
+	fmt.Printf("Token:         %s\n", state)
+	fmt.Printf("Expires:       %s (%s)\n", token.Expiry.Local().Format(time.RFC1123), time.Until(token.Expiry).Round(time.Second))
+	fmt.Printf("Refresh token: %t\n", token.RefreshToken != "")
+	return nil
+}
+
+func authRevoke(cfg *config.Config, args []string) error {
+	fs := newFlagSet("auth revoke", "[flags]",
+		"Revokes the stored token at reddit and deletes it from the database.")
+	localOnly := fs.Bool("local", false, "only delete the stored token, do not contact reddit")
+	addStorageFlags(fs, cfg)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+
+	dbStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	token, err := dbStore.GetToken()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		fmt.Println("No token stored, nothing to revoke.")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read token: %w", err)
+	}
+
+	if !*localOnly {
+		err = cfg.ValidateReddit()
+		if err != nil {
+			return fmt.Errorf("invalid configuration:\n%w", err)
+		}
+		smClient := socialmedia.NewClientWithToken(token, clientOptions(cfg))
+		err = smClient.RevokeToken(context.Background(), token)
+		if err != nil {
+			return fmt.Errorf("failed to revoke token at reddit (use -local to only delete it): %w", err)
+		}
+	}
+	err = dbStore.DeleteTokens()
+	if err != nil {
+		return fmt.Errorf("failed to delete stored token: %w", err)
+	}
+	fmt.Println("Token revoked.")
+	return nil
+}
@@ -0,0 +1,184 @@
+// Package authors fetches the reddit profiles of the authors, their account age, karma and status, in the background
+// and caches them in the store. Profiles are fetched from a low priority queue only while the rate limit budget is spare,
+// so they never hold up the ingestion.
+package authors
+
+import (
+	"context"
+	"errors"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"gorm.io/gorm"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Options configures an Enricher, the values usually come from config.AuthorsConfig
+type Options struct {
+	// Interval is how often the leading authors are queued
+	Interval time.Duration
+	// Top is how many of the leading authors are queued
+	Top int
+	// TTL is how long a cached profile is used before it is fetched again
+	TTL time.Duration
+	// QueueSize bounds the queue, further authors are dropped until there is room
+	QueueSize int
+	// Reserve is the share of reddit's rate limit budget of a period left to the ingestion, from 0 to 1
+	Reserve float64
+}
+
+// pollInterval is how often the enricher checks whether the budget is spare while authors are queued
+const pollInterval = time.Second
+
+// Client is the part of socialmedia.Client the enricher uses
+type Client interface {
+	FetchAccount(ctx context.Context, name string) (socialmedia.Account, error)
+	Spare(reserve float64) bool
+}
+
+// Enricher caches the profiles of the queued authors. A nil *Enricher ignores them.
+type Enricher struct {
+	store  store.Store
+	client Client
+	opts   Options
+	logger *slog.Logger
+	// Now returns the current time, it is replaced in tests
+	Now func() time.Time
+
+	mu     sync.Mutex
+	queue  []string
+	queued map[string]bool
+}
+
+func New(st store.Store, client Client, opts Options, logger *slog.Logger) *Enricher {
+	return &Enricher{store: st, client: client, opts: opts, logger: logger, Now: time.Now, queued: map[string]bool{}}
+}
+
+// Stale reports whether the profile is missing or older than the TTL
+func (e *Enricher) Stale(account *socialmedia.Account) bool {
+	return account == nil || e.Now().Sub(account.Fetched) >= e.opts.TTL
+}
+
+// Enqueue queues the authors to fetch their profiles in order, deleted authors and the ones already queued are skipped
+// and the others are dropped while the queue is full
+func (e *Enricher) Enqueue(names ...string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, name := range names {
+		if name == "" || name == socialmedia.DeletedAuthor || e.queued[name] {
+			continue
+		}
+		if len(e.queue) >= e.opts.QueueSize {
+			e.logger.Debug("author queue is full", "author", name)
+			return
+		}
+		e.queue = append(e.queue, name)
+		e.queued[name] = true
+	}
+}
+
+// Queued returns the number of authors waiting for their profile
+func (e *Enricher) Queued() int {
+	if e == nil {
+		return 0
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.queue)
+}
+
+func (e *Enricher) pop() (string, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.queue) == 0 {
+		return "", false
+	}
+	name := e.queue[0]
+	e.queue = slices.Delete(e.queue, 0, 1)
+	delete(e.queued, name)
+	return name, true
+}
+
+// Run queues the leading authors with stale profiles every Interval and fetches the queued profiles while the budget
+// is spare, until ctx is done
+func (e *Enricher) Run(ctx context.Context) {
+	leaders := time.NewTicker(e.opts.Interval)
+	defer leaders.Stop()
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	e.queueLeaders(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-leaders.C:
+			e.queueLeaders(ctx)
+		case <-poll.C:
+			if e.Queued() > 0 && e.client.Spare(e.opts.Reserve) {
+				e.fetchNext(ctx)
+			}
+		}
+	}
+}
+
+// queueLeaders queues the leading authors whose profile is stale
+func (e *Enricher) queueLeaders(ctx context.Context) {
+	leaders, err := e.store.GetLeadingAuthors(e.opts.Top)
+	if err != nil {
+		e.logger.ErrorContext(ctx, "loading the leading authors failed", "error", err)
+		return
+	}
+	for _, leader := range leaders {
+		if e.Stale(leader.Account) {
+			e.Enqueue(leader.Author)
+		}
+	}
+}
+
+// fetchNext fetches and caches the profile of the next queued author, unless it was cached since it was queued.
+// Leaders whose fetch failed are queued again with the next leaders.
+func (e *Enricher) fetchNext(ctx context.Context) {
+	name, found := e.pop()
+	if !found {
+		return
+	}
+	cached, err := e.store.GetAccount(name)
+	switch {
+	case err == nil && !e.Stale(&cached):
+		return
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		e.logger.ErrorContext(ctx, "loading the cached profile failed", "author", name, "error", err)
+		return
+	}
+	account, err := e.client.FetchAccount(ctx, name)
+	if err != nil {
+		e.logger.WarnContext(ctx, "fetching the profile failed", "author", name, "error", err)
+		return
+	}
+	err = e.store.SaveAccount(account)
+	if err != nil {
+		e.logger.ErrorContext(ctx, "caching the profile failed", "author", name, "error", err)
+		return
+	}
+	e.logger.DebugContext(ctx, "profile cached", "author", name, "suspended", account.Suspended, "not_found", account.NotFound)
+}
+
+// Fetch waits until the budget is spare and fetches the profile of the author without caching it,
+// so other low priority fetches share the budget with the queue
+func (e *Enricher) Fetch(ctx context.Context, name string) (socialmedia.Account, error) {
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	for !e.client.Spare(e.opts.Reserve) {
+		select {
+		case <-ctx.Done():
+			return socialmedia.Account{}, ctx.Err()
+		case <-poll.C:
+		}
+	}
+	return e.client.FetchAccount(ctx, name)
+}
@@ -0,0 +1,114 @@
+package authors
+
+import (
+	"context"
+	"errors"
+	"github.com/Valimere/donkey/db/dbtest"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+var testOptions = Options{Interval: time.Minute, Top: 10, TTL: 24 * time.Hour, QueueSize: 3, Reserve: 0.2}
+
+// fakeClient returns an account fetched now for every name but "broken"
+type fakeClient struct {
+	now     time.Time
+	spare   bool
+	fetched []string
+}
+
+func (c *fakeClient) FetchAccount(ctx context.Context, name string) (socialmedia.Account, error) {
+	c.fetched = append(c.fetched, name)
+	if name == "broken" {
+		return socialmedia.Account{}, errors.New("bad gateway")
+	}
+	return socialmedia.Account{Name: name, Created: c.now.AddDate(-1, 0, 0), LinkKarma: 1, Fetched: c.now}, nil
+}
+
+func (c *fakeClient) Spare(reserve float64) bool {
+	return c.spare
+}
+
+func TestEnqueue(t *testing.T) {
+	e := New(nil, &fakeClient{}, testOptions, testLogger)
+	e.Enqueue("a", "", socialmedia.DeletedAuthor, "b", "a", "c", "d")
+	assert.Equal(t, []string{"a", "b", "c"}, e.queue)
+
+	name, found := e.pop()
+	assert.True(t, found)
+	assert.Equal(t, "a", name)
+	// popped authors can be queued again
+	e.Enqueue("a", "b")
+	assert.Equal(t, []string{"b", "c", "a"}, e.queue)
+	assert.Equal(t, 3, e.Queued())
+
+	var disabled *Enricher
+	disabled.Enqueue("a")
+	assert.Zero(t, disabled.Queued())
+}
+
+func TestFetchNext(t *testing.T) {
+	dbStore := dbtest.NewStore(t,
+		socialmedia.Post{PostID: "a", Author: "gopher", SubReddit: "golang"},
+		socialmedia.Post{PostID: "b", Author: "gopher", SubReddit: "golang"},
+		socialmedia.Post{PostID: "c", Author: "broken", SubReddit: "golang"},
+		socialmedia.Post{PostID: "d", Author: socialmedia.DeletedAuthor, SubReddit: "golang"})
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	client := &fakeClient{now: now}
+	e := New(dbStore, client, testOptions, testLogger)
+	e.Now = func() time.Time { return now }
+	e.queueLeaders(context.Background())
+	assert.Equal(t, 2, e.Queued())
+	e.fetchNext(context.Background())
+	e.fetchNext(context.Background())
+	e.fetchNext(context.Background())
+	assert.Equal(t, []string{"gopher", "broken"}, client.fetched)
+
+	leaders, err := dbStore.GetLeadingAuthors(10)
+	assert.NoError(t, err)
+	if assert.Len(t, leaders, 2) {
+		assert.Equal(t, "gopher", leaders[0].Author)
+		if assert.NotNil(t, leaders[0].Account) {
+			assert.Equal(t, 1, leaders[0].Account.LinkKarma)
+		}
+		assert.Nil(t, leaders[1].Account)
+	}
+
+	// the failed fetch is queued again, the cached profile only once it is stale
+	e.queueLeaders(context.Background())
+	assert.Equal(t, []string{"broken"}, e.queue)
+	now = now.Add(testOptions.TTL)
+	e.queueLeaders(context.Background())
+	assert.Equal(t, []string{"broken", "gopher"}, e.queue)
+
+	// a profile cached since the author was queued isn't fetched again
+	client.fetched = nil
+	assert.NoError(t, dbStore.SaveAccount(socialmedia.Account{Name: "gopher", Fetched: now}))
+	e.fetchNext(context.Background())
+	e.fetchNext(context.Background())
+	assert.Equal(t, []string{"broken"}, client.fetched)
+	assert.Zero(t, e.Queued())
+}
+
+func TestFetch(t *testing.T) {
+	client := &fakeClient{spare: true}
+	e := New(nil, client, testOptions, testLogger)
+	account, err := e.Fetch(context.Background(), "gopher")
+	assert.NoError(t, err)
+	assert.Equal(t, "gopher", account.Name)
+
+	// without spare budget it waits until ctx is done
+	client.spare = false
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = e.Fetch(ctx, "gopher")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, []string{"gopher"}, client.fetched)
+}
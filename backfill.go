@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Valimere/donkey/config"
+	"github.com/Valimere/donkey/health"
+	"github.com/Valimere/donkey/logging"
+	"log/slog"
+	"os/signal"
+	"syscall"
+)
+
+const backfillDescription = `Pages back through the /new listing of every subreddit, and the /top listings chosen with -top,
+and stores the posts created before the command started marked as backfilled. Reddit ends every listing
+after about 1000 posts. Posts that are already stored are skipped, only their scores are updated.
+
+Statistics and exports include backfilled posts unless -exclude-backfilled is given. "donkey run"
+purges the stored posts on start unless -purge=false, use "donkey run -backfill" to backfill and ingest together.`
+
+func backfillCommand(cfg *config.Config, args []string) error {
+	fs := newFlagSet("backfill", "[flags]", backfillDescription)
+	fs.Var((*listFlag)(&cfg.Subreddits), "r",
+		"comma-separated `list` of subreddits (subreddits, falls back to the \"donkey subreddits\" list, or \""+defaultSubreddit+"\")")
+	fs.IntVar(&cfg.Backfill.Limit, "limit", cfg.Backfill.Limit, "most posts fetched per listing (backfill.limit)")
+	fs.Var((*listFlag)(&cfg.Backfill.Top), "top", "comma-separated `list` of /top time filters to backfill too, i.e. \"day,week\" (backfill.top)")
+	addStorageFlags(fs, cfg)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+
+	dbInstance, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	subreddits, err := resolveSubreddits(cfg, dbInstance)
+	if err != nil {
+		return err
+	}
+	logger := logging.Component(slog.Default(), logging.ComponentScheduler)
+	session, err := dbInstance.StartSession(subreddits)
+	if err != nil {
+		return fmt.Errorf("failed to start the session: %w", err)
+	}
+	logger.Info("backfill started", "subreddits", subreddits, "session_id", session.ID)
+
+	client, err := newAuthorizedClient(dbInstance, cfg, false)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	in := &ingester{client: client, store: dbInstance, tracker: health.NewTracker(), logger: logger}
+	in.backfillAll(ctx, subreddits, backfillOptions{limit: cfg.Backfill.Limit, top: cfg.Backfill.Top})
+	if ctx.Err() != nil {
+		logger.Warn("backfill interrupted")
+	}
+	return nil
+}
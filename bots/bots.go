@@ -0,0 +1,283 @@
+// Package bots scores how likely authors are bots or spam accounts by the regularity of their posting cadence,
+// the titles they post to several subreddits, the age and karma of their account and known bot names.
+// The scores are heuristics, a human posting on a schedule may be suspected as well.
+package bots
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"gorm.io/gorm"
+	"log/slog"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Options configures a Scorer, the values usually come from config.BotsConfig
+type Options struct {
+	// Threshold is the score from which an author is a suspected bot
+	Threshold float64
+	// MinPosts is the least number of posts the cadence and repeated titles of an author are judged by,
+	// the accounts of authors with fewer posts aren't fetched either
+	MinPosts int
+	// AccountTTL is how long a fetched account is used before it is fetched again
+	AccountTTL time.Duration
+	// AccountsPerRun is the most accounts fetched per run, they share the rate limit with the ingestion
+	AccountsPerRun int
+}
+
+// the weights of the signals in the score, a known bot name scores 1 on its own
+const (
+	cadenceWeight = 0.4
+	titlesWeight  = 0.3
+	accountWeight = 0.3
+)
+
+const (
+	// newAccountAge is the age up to which accounts count as new, the younger the more suspicious
+	newAccountAge = 30 * 24 * time.Hour
+	// lowKarma is the link and comment karma up to which accounts count as low karma
+	lowKarma = 100
+)
+
+// Unknown is the value of a signal there was too little to judge by
+const Unknown = -1
+
+// botName matches the names ending in bot, i.e. RemindMeBot or stats_bot_2, and the ones starting with bot_ or bot-
+var botName = regexp.MustCompile(`(?i)(bot[-_]?\d*$|^bot[-_]|[-_]bot[-_])`)
+
+// knownBots are the lowercase names of the common bots that don't follow the patterns
+var knownBots = []string{"automoderator", "vredditdownloader", "savevideo", "stabbot", "twitterxcom", "sneakpeek"}
+
+// IsBotName reports whether the name follows a known bot pattern
+func IsBotName(name string) bool {
+	return botName.MatchString(name) || slices.Contains(knownBots, strings.ToLower(name))
+}
+
+// Score judges an author by the stored posts, in any order, and the account, which may be nil when it wasn't fetched.
+// The score is the weighted sum of the signals, unknown signals count as 0.
+func Score(author string, posts []socialmedia.Post, account *socialmedia.Account, now time.Time, opts Options) socialmedia.AuthorScore {
+	score := socialmedia.AuthorScore{
+		Author:         author,
+		Posts:          len(posts),
+		Cadence:        Unknown,
+		RepeatedTitles: Unknown,
+		Account:        Unknown,
+		Scored:         now,
+	}
+	if IsBotName(author) {
+		score.Name = 1
+	}
+	if len(posts) >= max(opts.MinPosts, 2) {
+		score.Cadence = cadence(posts)
+		score.RepeatedTitles = repeatedTitles(posts)
+	}
+	if account != nil {
+		score.Account = accountSignal(*account, now)
+	}
+
+	sum := 0.0
+	for _, signal := range []struct{ value, weight float64 }{
+		{score.Cadence, cadenceWeight},
+		{score.RepeatedTitles, titlesWeight},
+		{score.Account, accountWeight},
+	} {
+		if signal.value != Unknown {
+			sum += signal.value * signal.weight
+		}
+	}
+	// rounded so scores compare equal across platforms
+	score.Score = round(max(score.Name, sum))
+	score.Bot = score.Score >= opts.Threshold
+	return score
+}
+
+// cadence is 1 for posts at perfectly even intervals and falls to 0 as the coefficient of variation of the intervals
+// reaches 1, the variation of posts at random times
+func cadence(posts []socialmedia.Post) float64 {
+	created := make([]time.Time, 0, len(posts))
+	for _, post := range posts {
+		created = append(created, post.Created)
+	}
+	slices.SortFunc(created, time.Time.Compare)
+	intervals := make([]float64, 0, len(created)-1)
+	mean := 0.0
+	for i := 1; i < len(created); i++ {
+		interval := created[i].Sub(created[i-1]).Seconds()
+		intervals = append(intervals, interval)
+		mean += interval
+	}
+	mean /= float64(len(intervals))
+	if mean == 0 {
+		// every post at the same second
+		return 1
+	}
+	variance := 0.0
+	for _, interval := range intervals {
+		variance += (interval - mean) * (interval - mean)
+	}
+	deviation := math.Sqrt(variance / float64(len(intervals)))
+	return round(clamp(1 - deviation/mean))
+}
+
+// repeatedTitles is the share of the posts whose title, ignoring case and spacing, the author posted to another subreddit as well
+func repeatedTitles(posts []socialmedia.Post) float64 {
+	subreddits := make(map[string]map[string]bool)
+	for _, post := range posts {
+		title := normalizeTitle(post.Title)
+		if subreddits[title] == nil {
+			subreddits[title] = make(map[string]bool)
+		}
+		subreddits[title][strings.ToLower(post.SubReddit)] = true
+	}
+	repeated := 0
+	for _, post := range posts {
+		if len(subreddits[normalizeTitle(post.Title)]) > 1 {
+			repeated++
+		}
+	}
+	return round(float64(repeated) / float64(len(posts)))
+}
+
+func normalizeTitle(title string) string {
+	return strings.Join(strings.Fields(strings.ToLower(title)), " ")
+}
+
+// accountSignal averages how new the account is and how little karma it has, suspended accounts score 1
+// and the ones reddit doesn't know anymore are Unknown
+func accountSignal(account socialmedia.Account, now time.Time) float64 {
+	switch {
+	case account.NotFound:
+		return Unknown
+	case account.Suspended:
+		return 1
+	}
+	age := clamp(1 - now.Sub(account.Created).Hours()/newAccountAge.Hours())
+	karma := clamp(1 - float64(account.LinkKarma+account.CommentKarma)/lowKarma)
+	return round((age + karma) / 2)
+}
+
+func clamp(value float64) float64 {
+	return max(0, min(1, value))
+}
+
+func round(value float64) float64 {
+	return math.Round(value*10000) / 10000
+}
+
+// Scorer scores every author of the stored posts and stores the scores
+type Scorer struct {
+	store store.Store
+	// fetch returns the account of an author, nil scores without fetching accounts
+	fetch  func(ctx context.Context, name string) (socialmedia.Account, error)
+	opts   Options
+	logger *slog.Logger
+}
+
+func NewScorer(st store.Store, fetch func(ctx context.Context, name string) (socialmedia.Account, error), opts Options, logger *slog.Logger) *Scorer {
+	return &Scorer{store: st, fetch: fetch, opts: opts, logger: logger}
+}
+
+// Run scores the authors every interval until ctx is done
+func (s *Scorer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			scores, err := s.ScoreAll(ctx, now)
+			if err != nil {
+				s.logger.ErrorContext(ctx, "scoring the authors failed", "error", err)
+				continue
+			}
+			bots := 0
+			for _, score := range scores {
+				if score.Bot {
+					bots++
+				}
+			}
+			s.logger.DebugContext(ctx, "authors scored", "authors", len(scores), "bots", bots)
+		}
+	}
+}
+
+// ScoreAll scores the authors of the stored posts and stores the scores, deleted authors are left out.
+// The accounts of the authors with at least MinPosts posts come from the store, up to AccountsPerRun accounts
+// missing from it or older than AccountTTL are fetched first, the ones of the authors with the most posts first.
+func (s *Scorer) ScoreAll(ctx context.Context, now time.Time) ([]socialmedia.AuthorScore, error) {
+	byAuthor := make(map[string][]socialmedia.Post)
+	err := s.store.EachPost(store.Filter{}, func(post socialmedia.Post) error {
+		if post.Author != socialmedia.DeletedAuthor {
+			byAuthor[post.Author] = append(byAuthor[post.Author], post)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	authors := make([]string, 0, len(byAuthor))
+	for author := range byAuthor {
+		authors = append(authors, author)
+	}
+	slices.SortFunc(authors, func(a, b string) int {
+		return cmp.Or(cmp.Compare(len(byAuthor[b]), len(byAuthor[a])), cmp.Compare(a, b))
+	})
+
+	fetched := 0
+	scores := make([]socialmedia.AuthorScore, 0, len(authors))
+	for _, author := range authors {
+		posts := byAuthor[author]
+		var account *socialmedia.Account
+		if len(posts) >= s.opts.MinPosts && !IsBotName(author) {
+			account, err = s.account(ctx, author, now, &fetched)
+			if err != nil {
+				return nil, err
+			}
+		}
+		scores = append(scores, Score(author, posts, account, now, s.opts))
+	}
+	err = s.store.SaveAuthorScores(scores)
+	if err != nil {
+		return nil, err
+	}
+	return scores, nil
+}
+
+// account returns the stored account of the author, fetching it when it is missing or stale and the budget of the run
+// isn't used up. Failed fetches are logged and use up the rest of the budget, the stored account is used if there is one.
+func (s *Scorer) account(ctx context.Context, author string, now time.Time, fetched *int) (*socialmedia.Account, error) {
+	stored, err := s.store.GetAccount(author)
+	found := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if found && now.Sub(stored.Fetched) < s.opts.AccountTTL || s.fetch == nil || *fetched >= s.opts.AccountsPerRun {
+		if found {
+			return &stored, nil
+		}
+		return nil, nil
+	}
+
+	*fetched++
+	account, err := s.fetch(ctx, author)
+	if err != nil {
+		s.logger.WarnContext(ctx, "fetching the account failed", "author", author, "error", err)
+		*fetched = s.opts.AccountsPerRun
+		if found {
+			return &stored, nil
+		}
+		return nil, nil
+	}
+	err = s.store.SaveAccount(account)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
@@ -0,0 +1,124 @@
+package bots
+
+import (
+	"context"
+	"errors"
+	"github.com/Valimere/donkey/db/dbtest"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+var testOptions = Options{Threshold: 0.6, MinPosts: 4, AccountTTL: 24 * time.Hour, AccountsPerRun: 1}
+
+// postsEvery returns n posts of the author, one per interval, all titled the same in the subreddits taken in turn
+func postsEvery(author string, n int, interval time.Duration, subreddits ...string) []socialmedia.Post {
+	start := time.Date(2024, 4, 9, 0, 0, 0, 0, time.UTC)
+	var posts []socialmedia.Post
+	for i := range n {
+		posts = append(posts, socialmedia.Post{PostID: author + string(rune('a'+i)), Author: author, Title: "Free crypto giveaway",
+			SubReddit: subreddits[i%len(subreddits)], Created: start.Add(time.Duration(i) * interval)})
+	}
+	return posts
+}
+
+func TestIsBotName(t *testing.T) {
+	for _, name := range []string{"RemindMeBot", "stats_bot_2", "bot-helper", "AutoModerator", "sneakpeekbot", "the-bot-army"} {
+		assert.True(t, IsBotName(name), name)
+	}
+	for _, name := range []string{"gopher", "botanist", "robotics_fan", "bottle"} {
+		assert.False(t, IsBotName(name), name)
+	}
+}
+
+func TestScore(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	// a known name is enough
+	score := Score("RemindMeBot", nil, nil, now, testOptions)
+	assert.Equal(t, socialmedia.AuthorScore{Author: "RemindMeBot", Score: 1, Bot: true, Cadence: Unknown, RepeatedTitles: Unknown,
+		Account: Unknown, Name: 1, Scored: now}, score)
+
+	// too few posts to judge by
+	score = Score("gopher", postsEvery("gopher", 3, time.Hour, "golang", "programming"), nil, now, testOptions)
+	assert.Equal(t, float64(Unknown), score.Cadence)
+	assert.Zero(t, score.Score)
+
+	// posting the same title to two subreddits every hour on the dot
+	score = Score("spammer", postsEvery("spammer", 6, time.Hour, "golang", "programming"), nil, now, testOptions)
+	assert.Equal(t, 1.0, score.Cadence)
+	assert.Equal(t, 1.0, score.RepeatedTitles)
+	assert.Equal(t, 0.7, score.Score)
+	assert.True(t, score.Bot)
+
+	// irregular posts in one subreddit from an old account with plenty of karma
+	posts := postsEvery("gopher", 4, time.Hour, "golang")
+	posts[1].Created = posts[0].Created.Add(time.Minute)
+	posts[3].Created = posts[2].Created.Add(20 * time.Hour)
+	account := socialmedia.Account{Name: "gopher", Created: now.AddDate(-5, 0, 0), LinkKarma: 500, CommentKarma: 9000}
+	score = Score("gopher", posts, &account, now, testOptions)
+	assert.Less(t, score.Cadence, 0.2)
+	assert.Zero(t, score.RepeatedTitles)
+	assert.Zero(t, score.Account)
+	assert.False(t, score.Bot)
+
+	// new accounts without karma are suspicious, suspended ones more so
+	account = socialmedia.Account{Name: "fresh", Created: now.Add(-15 * 24 * time.Hour), LinkKarma: 10, CommentKarma: 40}
+	assert.Equal(t, 0.5, Score("fresh", nil, &account, now, testOptions).Account)
+	assert.Equal(t, 1.0, Score("fresh", nil, &socialmedia.Account{Suspended: true}, now, testOptions).Account)
+	assert.Equal(t, float64(Unknown), Score("fresh", nil, &socialmedia.Account{NotFound: true}, now, testOptions).Account)
+}
+
+func TestScoreAll(t *testing.T) {
+	posts := slices.Concat(
+		postsEvery("spammer", 6, time.Hour, "golang", "programming"),
+		postsEvery("newbie", 5, 3*time.Hour, "golang"),
+		postsEvery("RemindMeBot", 5, time.Minute, "golang"),
+		[]socialmedia.Post{{PostID: "d", Author: socialmedia.DeletedAuthor, SubReddit: "golang", Title: "Gone"}},
+	)
+	dbStore := dbtest.NewStore(t, posts...)
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	var fetched []string
+	fetch := func(ctx context.Context, name string) (socialmedia.Account, error) {
+		fetched = append(fetched, name)
+		if name == "newbie" {
+			return socialmedia.Account{}, errors.New("rate limited")
+		}
+		return socialmedia.Account{Name: name, Created: now, Fetched: now}, nil
+	}
+	opts := testOptions
+	opts.AccountsPerRun = 2
+	scorer := NewScorer(dbStore, fetch, opts, testLogger)
+	scores, err := scorer.ScoreAll(context.Background(), now)
+	assert.NoError(t, err)
+	// the bot names need no account and a failed fetch ends the run's fetching
+	assert.Equal(t, []string{"spammer", "newbie"}, fetched)
+	if assert.Len(t, scores, 3) {
+		assert.Equal(t, "spammer", scores[0].Author)
+		assert.Equal(t, 1.0, scores[0].Account)
+		assert.Equal(t, 1.0, scores[0].Score)
+		assert.Equal(t, "RemindMeBot", scores[1].Author)
+		assert.Equal(t, "newbie", scores[2].Author)
+		assert.Equal(t, float64(Unknown), scores[2].Account)
+		assert.False(t, scores[2].Bot)
+	}
+	bots, err := dbStore.GetSuspectedBots(10)
+	assert.NoError(t, err)
+	assert.Len(t, bots, 2)
+
+	// the cached account is used until it expires
+	fetched = nil
+	_, err = scorer.ScoreAll(context.Background(), now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"newbie"}, fetched)
+	_, err = scorer.ScoreAll(context.Background(), now.Add(48*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"newbie", "spammer", "newbie"}, fetched)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Valimere/donkey/config"
+	"os"
+)
+
+const configDescription = `Shows the effective configuration, resolved as defaults < config file < environment < flags.
+
+Subcommands:
+  print   print the effective configuration as YAML, secrets are masked`
+
+func configCommand(cfg *config.Config, args []string) error {
+	fs := newFlagSet("config", "print [flags]", configDescription)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 || fs.Arg(0) != "print" {
+		fs.Usage()
+		return errUsage
+	}
+	return configPrint(cfg, fs.Args()[1:])
+}
+
+func configPrint(cfg *config.Config, args []string) error {
+	fs := newFlagSet("config print", "[flags]",
+		"Prints the effective configuration as YAML, it can be used as a starting point for "+config.DefaultPath+".")
+	showSecrets := fs.Bool("show-secrets", false, "print reddit.client_secret instead of masking it")
+	fs.Var((*listFlag)(&cfg.Subreddits), "r", "comma-separated `list` of subreddits (subreddits)")
+	addStorageFlags(fs, cfg)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+
+	out, err := cfg.Marshal(*showSecrets)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	if err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,681 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/Valimere/donkey/alerts"
+	"github.com/Valimere/donkey/authors"
+	"github.com/Valimere/donkey/bots"
+	"github.com/Valimere/donkey/language"
+	"github.com/Valimere/donkey/logging"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/statistics"
+	"github.com/Valimere/donkey/trends"
+	"github.com/Valimere/donkey/webhooks"
+	"gopkg.in/yaml.v3"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPath is the config file read when no path is given and it exists in the working directory
+const DefaultPath = "donkey.yaml"
+
+// PathEnv names the environment variable that can point to the config file
+const PathEnv = "DONKEY_CONFIG"
+
+// DefaultTUILogFile receives the logs while the TUI owns the terminal and log.file is unset
+const DefaultTUILogFile = "donkey.log"
+
+const redacted = "********"
+
+// Config is the effective donkey configuration, resolved with the precedence defaults < file < env < flags.
+// Flags are applied by the subcommands which use the loaded values as their flag defaults.
+type Config struct {
+	// Path is the config file that was loaded, empty if there was none
+	Path       string          `yaml:"-"`
+	Subreddits []string        `yaml:"subreddits"`
+	Reddit     RedditConfig    `yaml:"reddit"`
+	Storage    StorageConfig   `yaml:"storage"`
+	RateLimit  RateLimitConfig `yaml:"rate_limit"`
+	HTTP       HTTPConfig      `yaml:"http"`
+	Report     ReportConfig    `yaml:"report"`
+	Listings   ListingsConfig  `yaml:"listings"`
+	Backfill   BackfillConfig  `yaml:"backfill"`
+	Rising     RisingConfig    `yaml:"rising"`
+	Refresh    RefreshConfig   `yaml:"refresh"`
+	Trending   TrendingConfig  `yaml:"trending"`
+	Bots       BotsConfig      `yaml:"bots"`
+	Authors    AuthorsConfig   `yaml:"authors"`
+	Log        LogConfig       `yaml:"log"`
+	Health     HealthConfig    `yaml:"health"`
+	Alerts     alerts.Config   `yaml:"alerts"`
+	Webhooks   webhooks.Config `yaml:"webhooks"`
+}
+
+type RedditConfig struct {
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	UserAgent    string `yaml:"user_agent"`
+}
+
+type StorageConfig struct {
+	// DSN is passed to the sqlite driver, a plain file path or a "file:" URI
+	DSN          string `yaml:"dsn"`
+	PurgeOnStart bool   `yaml:"purge_on_start"`
+}
+
+type RateLimitConfig struct {
+	RequestsPerMinute float64 `yaml:"requests_per_minute"`
+	Burst             int     `yaml:"burst"`
+}
+
+type HTTPConfig struct {
+	// CallbackListen is the address the OAuth callback server listens on
+	CallbackListen string `yaml:"callback_listen"`
+	// RedirectURL must match the redirect uri registered for the reddit app
+	RedirectURL string `yaml:"redirect_url"`
+	// APIListen is the address of the API server exposing the dashboard, REST api, /metrics and health checks
+	// during "donkey run", empty disables it
+	APIListen string `yaml:"api_listen"`
+}
+
+type ReportConfig struct {
+	OnExit bool `yaml:"on_exit"`
+	// Interval prints a leaderboard report periodically while ingesting, 0 disables it
+	Interval time.Duration `yaml:"interval"`
+	// Top is the number of posts and authors listed in the periodic report
+	Top int `yaml:"top"`
+	// TUI replaces the log output of "donkey run" with a full-screen dashboard
+	TUI bool `yaml:"tui"`
+	// ExcludeBackfilled leaves the posts fetched by a backfill out of the statistics
+	ExcludeBackfilled bool `yaml:"exclude_backfilled"`
+}
+
+type ListingsConfig struct {
+	// Default are the listings polled for subreddits without their own entry, i.e. new, hot, rising or top:day
+	Default []string `yaml:"default"`
+	// Subreddits sets the polled listings per subreddit
+	Subreddits map[string][]string `yaml:"subreddits"`
+}
+
+// For returns the listings polled for the subreddit, the subreddit names are compared case-insensitively
+func (l ListingsConfig) For(subreddit string) []string {
+	for name, listings := range l.Subreddits {
+		if strings.EqualFold(name, subreddit) {
+			return listings
+		}
+	}
+	return l.Default
+}
+
+type BackfillConfig struct {
+	// Enabled pages back through each subreddit's listings before "donkey run" starts polling
+	Enabled bool `yaml:"enabled"`
+	// Limit is the most posts fetched per listing, reddit stops listings at about 1000
+	Limit int `yaml:"limit"`
+	// Top lists the time filters of the /top listings to backfill as well, i.e. day or week
+	Top []string `yaml:"top"`
+}
+
+type RisingConfig struct {
+	// Window is how far back the upvote velocity of a post is measured
+	Window time.Duration `yaml:"window"`
+	// MaxAge leaves older posts off the rising leaderboard and out of the subreddit baselines
+	MaxAge time.Duration `yaml:"max_age"`
+	// MinRatio is how many times as fast as the median post of its subreddit a rising post gains upvotes
+	MinRatio float64 `yaml:"min_ratio"`
+	// MinBaseline is the least subreddit baseline in upvotes per minute
+	MinBaseline float64 `yaml:"min_baseline"`
+	// Interval is how often "donkey run" looks for posts entering the rising leaderboard, 0 disables it
+	Interval time.Duration `yaml:"interval"`
+}
+
+// Options returns the settings of the rising leaderboard
+func (r RisingConfig) Options() statistics.RisingOptions {
+	return statistics.RisingOptions{Window: r.Window, MaxAge: r.MaxAge, MinRatio: r.MinRatio, MinBaseline: r.MinBaseline}
+}
+
+type RefreshConfig struct {
+	// Interval is how often "donkey run" fetches the stored posts again to notice deleted and removed ones, 0 disables it
+	Interval time.Duration `yaml:"interval"`
+	// MaxAge is how long after their creation posts are refreshed
+	MaxAge time.Duration `yaml:"max_age"`
+	// Limit is the most posts refreshed per interval, they are fetched 100 per request
+	Limit int `yaml:"limit"`
+}
+
+type TrendingConfig struct {
+	// Window is the current window, terms trend when they appear in more of its posts than the baseline suggests
+	Window time.Duration `yaml:"window"`
+	// Baseline is how long before the window the usual frequency of the terms is measured
+	Baseline time.Duration `yaml:"baseline"`
+	// MaxPhrase is the longest phrase counted in words
+	MaxPhrase int `yaml:"max_phrase"`
+	// MinCount is the least number of posts of the window a term must appear in to trend
+	MinCount int `yaml:"min_count"`
+	// Languages limits the counted posts to these ISO 639-1 codes, i.e. en, all posts are counted if empty
+	Languages []string `yaml:"languages"`
+}
+
+// Options returns the settings of the trending terms
+func (t TrendingConfig) Options() trends.Options {
+	return trends.Options{Window: t.Window, Baseline: t.Baseline, MaxPhrase: t.MaxPhrase, MinCount: t.MinCount, Languages: t.Languages}
+}
+
+type BotsConfig struct {
+	// Interval is how often "donkey run" scores the authors of the stored posts, 0 disables it
+	Interval time.Duration `yaml:"interval"`
+	// Threshold is the score from 0 to 1 from which an author is a suspected bot
+	Threshold float64 `yaml:"threshold"`
+	// MinPosts is the least number of posts the posting cadence and repeated titles of an author are judged by
+	MinPosts int `yaml:"min_posts"`
+	// AccountsPerRun is the most accounts fetched per interval, 0 scores without the account age and karma
+	AccountsPerRun int `yaml:"accounts_per_run"`
+	// Exclude leaves the suspected bots out of the author leaderboards
+	Exclude bool `yaml:"exclude"`
+}
+
+// Options returns the settings of the author scoring, the cached accounts expire after accountTTL
+func (b BotsConfig) Options(accountTTL time.Duration) bots.Options {
+	return bots.Options{Threshold: b.Threshold, MinPosts: b.MinPosts, AccountTTL: accountTTL, AccountsPerRun: b.AccountsPerRun}
+}
+
+type AuthorsConfig struct {
+	// Interval is how often "donkey run" queues the leading authors to fetch their /user/{name}/about.json, 0 disables it
+	Interval time.Duration `yaml:"interval"`
+	// Top is how many of the leading authors are queued
+	Top int `yaml:"top"`
+	// TTL is how long a fetched profile is used before it is fetched again
+	TTL time.Duration `yaml:"ttl"`
+	// QueueSize bounds the authors waiting for their profile
+	QueueSize int `yaml:"queue_size"`
+	// Reserve is the share of reddit's rate limit budget left to the ingestion, profiles are only fetched while more remains
+	Reserve float64 `yaml:"reserve"`
+}
+
+// Options returns the settings of the author profiles
+func (a AuthorsConfig) Options() authors.Options {
+	return authors.Options{Interval: a.Interval, Top: a.Top, TTL: a.TTL, QueueSize: a.QueueSize, Reserve: a.Reserve}
+}
+
+type LogConfig struct {
+	// Level is one of debug, info, warn or error
+	Level string `yaml:"level"`
+	// Format is text or json
+	Format string `yaml:"format"`
+	// DumpRequests logs every outgoing HTTP request, independent of the level
+	DumpRequests bool `yaml:"dump_requests"`
+	// File appends the logs to a file instead of stderr, the TUI defaults it to DefaultTUILogFile
+	File string `yaml:"file"`
+}
+
+type HealthConfig struct {
+	// FetchThreshold is how long a subreddit may go without a successful fetch before /healthz and /readyz fail
+	FetchThreshold time.Duration `yaml:"fetch_threshold"`
+	// TokenExpiryMargin fails /readyz when the OAuth token expires within it
+	TokenExpiryMargin time.Duration `yaml:"token_expiry_margin"`
+}
+
+// Default returns the configuration used when nothing else is set
+func Default() *Config {
+	return &Config{
+		Storage: StorageConfig{
+			DSN:          "donkey.db",
+			PurgeOnStart: true,
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerMinute: 60,
+			Burst:             1,
+		},
+		HTTP: HTTPConfig{
+			CallbackListen: ":8080",
+			RedirectURL:    "http://localhost:8080/callback",
+			APIListen:      "localhost:9090",
+		},
+		Report: ReportConfig{
+			OnExit: true,
+			Top:    5,
+		},
+		Listings: ListingsConfig{
+			Default: []string{"new"},
+		},
+		Backfill: BackfillConfig{
+			Limit: 1000,
+		},
+		Rising: RisingConfig{
+			Window:      time.Hour,
+			MaxAge:      24 * time.Hour,
+			MinRatio:    3,
+			MinBaseline: 0.5,
+			Interval:    time.Minute,
+		},
+		Refresh: RefreshConfig{
+			Interval: 10 * time.Minute,
+			MaxAge:   24 * time.Hour,
+			Limit:    500,
+		},
+		Trending: TrendingConfig{
+			Window:    time.Hour,
+			Baseline:  24 * time.Hour,
+			MaxPhrase: 3,
+			MinCount:  3,
+		},
+		Bots: BotsConfig{
+			Interval:       10 * time.Minute,
+			Threshold:      0.6,
+			MinPosts:       5,
+			AccountsPerRun: 10,
+		},
+		Authors: AuthorsConfig{
+			Interval:  time.Minute,
+			Top:       25,
+			TTL:       7 * 24 * time.Hour,
+			QueueSize: 1000,
+			Reserve:   0.2,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Health: HealthConfig{
+			FetchThreshold:    2 * time.Minute,
+			TokenExpiryMargin: 5 * time.Minute,
+		},
+		Alerts: alerts.Config{
+			RateLimit:   alerts.DefaultRateLimit,
+			DedupWindow: alerts.DefaultDedupWindow,
+		},
+		Webhooks: webhooks.Config{
+			MaxAttempts:  webhooks.DefaultMaxAttempts,
+			RetryBackoff: webhooks.DefaultRetryBackoff,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the config file at path and the environment.
+// An empty path falls back to $DONKEY_CONFIG and then to DefaultPath, the latter is skipped if it doesn't exist.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv(PathEnv)
+		explicit = path != ""
+	}
+	if !explicit {
+		path = DefaultPath
+	}
+
+	f, err := os.Open(path)
+	switch {
+	case err == nil:
+		defer f.Close()
+		err = cfg.decode(f)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %w", path, err)
+		}
+		cfg.Path = path
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+		// no config file is fine, defaults and env still apply
+	default:
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+
+	err = cfg.applyEnv(os.LookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// decode overlays the YAML document on top of the current values, unknown keys are rejected
+func (c *Config) decode(r io.Reader) error {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	err := decoder.Decode(c)
+	if errors.Is(err, io.EOF) {
+		// empty file
+		return nil
+	}
+	return err
+}
+
+type envVar struct {
+	name   string
+	key    string
+	target any
+}
+
+// envVars lists every environment variable and the config key it overrides
+func (c *Config) envVars() []envVar {
+	return []envVar{
+		{"REDDIT_CLIENT_ID", "reddit.client_id", &c.Reddit.ClientID},
+		{"REDDIT_SECRET", "reddit.client_secret", &c.Reddit.ClientSecret},
+		{"REDDIT_USER_AGENT", "reddit.user_agent", &c.Reddit.UserAgent},
+		{"DONKEY_SUBREDDITS", "subreddits", &c.Subreddits},
+		{"DONKEY_DB_DSN", "storage.dsn", &c.Storage.DSN},
+		{"DONKEY_PURGE_ON_START", "storage.purge_on_start", &c.Storage.PurgeOnStart},
+		{"DONKEY_RATE_LIMIT_RPM", "rate_limit.requests_per_minute", &c.RateLimit.RequestsPerMinute},
+		{"DONKEY_RATE_LIMIT_BURST", "rate_limit.burst", &c.RateLimit.Burst},
+		{"DONKEY_HTTP_CALLBACK_LISTEN", "http.callback_listen", &c.HTTP.CallbackListen},
+		{"DONKEY_HTTP_REDIRECT_URL", "http.redirect_url", &c.HTTP.RedirectURL},
+		{"DONKEY_HTTP_API_LISTEN", "http.api_listen", &c.HTTP.APIListen},
+		{"DONKEY_REPORT_ON_EXIT", "report.on_exit", &c.Report.OnExit},
+		{"DONKEY_REPORT_INTERVAL", "report.interval", &c.Report.Interval},
+		{"DONKEY_REPORT_TOP", "report.top", &c.Report.Top},
+		{"DONKEY_REPORT_TUI", "report.tui", &c.Report.TUI},
+		{"DONKEY_REPORT_EXCLUDE_BACKFILLED", "report.exclude_backfilled", &c.Report.ExcludeBackfilled},
+		{"DONKEY_LISTINGS", "listings.default", &c.Listings.Default},
+		{"DONKEY_BACKFILL_ENABLED", "backfill.enabled", &c.Backfill.Enabled},
+		{"DONKEY_BACKFILL_LIMIT", "backfill.limit", &c.Backfill.Limit},
+		{"DONKEY_BACKFILL_TOP", "backfill.top", &c.Backfill.Top},
+		{"DONKEY_RISING_WINDOW", "rising.window", &c.Rising.Window},
+		{"DONKEY_RISING_MAX_AGE", "rising.max_age", &c.Rising.MaxAge},
+		{"DONKEY_RISING_MIN_RATIO", "rising.min_ratio", &c.Rising.MinRatio},
+		{"DONKEY_RISING_MIN_BASELINE", "rising.min_baseline", &c.Rising.MinBaseline},
+		{"DONKEY_RISING_INTERVAL", "rising.interval", &c.Rising.Interval},
+		{"DONKEY_REFRESH_INTERVAL", "refresh.interval", &c.Refresh.Interval},
+		{"DONKEY_REFRESH_MAX_AGE", "refresh.max_age", &c.Refresh.MaxAge},
+		{"DONKEY_REFRESH_LIMIT", "refresh.limit", &c.Refresh.Limit},
+		{"DONKEY_TRENDING_WINDOW", "trending.window", &c.Trending.Window},
+		{"DONKEY_TRENDING_BASELINE", "trending.baseline", &c.Trending.Baseline},
+		{"DONKEY_TRENDING_MAX_PHRASE", "trending.max_phrase", &c.Trending.MaxPhrase},
+		{"DONKEY_TRENDING_MIN_COUNT", "trending.min_count", &c.Trending.MinCount},
+		{"DONKEY_TRENDING_LANGUAGES", "trending.languages", &c.Trending.Languages},
+		{"DONKEY_BOTS_INTERVAL", "bots.interval", &c.Bots.Interval},
+		{"DONKEY_BOTS_THRESHOLD", "bots.threshold", &c.Bots.Threshold},
+		{"DONKEY_BOTS_MIN_POSTS", "bots.min_posts", &c.Bots.MinPosts},
+		{"DONKEY_BOTS_ACCOUNTS_PER_RUN", "bots.accounts_per_run", &c.Bots.AccountsPerRun},
+		{"DONKEY_BOTS_EXCLUDE", "bots.exclude", &c.Bots.Exclude},
+		{"DONKEY_AUTHORS_INTERVAL", "authors.interval", &c.Authors.Interval},
+		{"DONKEY_AUTHORS_TOP", "authors.top", &c.Authors.Top},
+		{"DONKEY_AUTHORS_TTL", "authors.ttl", &c.Authors.TTL},
+		{"DONKEY_AUTHORS_QUEUE_SIZE", "authors.queue_size", &c.Authors.QueueSize},
+		{"DONKEY_AUTHORS_RESERVE", "authors.reserve", &c.Authors.Reserve},
+		{"DONKEY_LOG_LEVEL", "log.level", &c.Log.Level},
+		{"DONKEY_LOG_FORMAT", "log.format", &c.Log.Format},
+		{"DONKEY_LOG_DUMP_REQUESTS", "log.dump_requests", &c.Log.DumpRequests},
+		{"DONKEY_LOG_FILE", "log.file", &c.Log.File},
+		{"DONKEY_HEALTH_FETCH_THRESHOLD", "health.fetch_threshold", &c.Health.FetchThreshold},
+		{"DONKEY_HEALTH_TOKEN_EXPIRY_MARGIN", "health.token_expiry_margin", &c.Health.TokenExpiryMargin},
+		{"DONKEY_ALERTS_RATE_LIMIT", "alerts.rate_limit", &c.Alerts.RateLimit},
+		{"DONKEY_ALERTS_DEDUP_WINDOW", "alerts.dedup_window", &c.Alerts.DedupWindow},
+		{"DONKEY_WEBHOOKS_QUIET_AFTER", "webhooks.quiet_after", &c.Webhooks.QuietAfter},
+		{"DONKEY_WEBHOOKS_MAX_ATTEMPTS", "webhooks.max_attempts", &c.Webhooks.MaxAttempts},
+		{"DONKEY_WEBHOOKS_RETRY_BACKOFF", "webhooks.retry_backoff", &c.Webhooks.RetryBackoff},
+	}
+}
+
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	for _, env := range c.envVars() {
+		value, ok := lookup(env.name)
+		if !ok {
+			continue
+		}
+		err := setValue(env.target, value)
+		if err != nil {
+			return fmt.Errorf("environment variable %s (%s): %w", env.name, env.key, err)
+		}
+	}
+	return nil
+}
+
+// setValue parses value into the type target points to
+func setValue(target any, value string) error {
+	switch t := target.(type) {
+	case *string:
+		*t = value
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		*t = b
+	case *int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*t = i
+	case *float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*t = f
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		*t = d
+	case *[]string:
+		*t = SplitList(value)
+	default:
+		return fmt.Errorf("unsupported type %T", target)
+	}
+	return nil
+}
+
+// SplitList splits a comma-separated list, trimming spaces and dropping empty entries
+func SplitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Validate checks the values every subcommand depends on, errors name the offending key
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Storage.DSN == "" {
+		invalid("storage.dsn", "must not be empty")
+	}
+	if c.RateLimit.RequestsPerMinute <= 0 {
+		invalid("rate_limit.requests_per_minute", "must be greater than 0, got %v", c.RateLimit.RequestsPerMinute)
+	}
+	if c.RateLimit.Burst < 1 {
+		invalid("rate_limit.burst", "must be at least 1, got %d", c.RateLimit.Burst)
+	}
+	if c.HTTP.CallbackListen == "" {
+		invalid("http.callback_listen", "must not be empty")
+	}
+	if u, err := url.Parse(c.HTTP.RedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+		invalid("http.redirect_url", "must be an absolute URL, got %q", c.HTTP.RedirectURL)
+	}
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		invalid("log.level", "%s", err)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		invalid("log.format", "must be text or json, got %q", c.Log.Format)
+	}
+	if c.Report.Interval < 0 {
+		invalid("report.interval", "must not be negative, got %s", c.Report.Interval)
+	}
+	if c.Report.Top < 1 {
+		invalid("report.top", "must be at least 1, got %d", c.Report.Top)
+	}
+	if len(c.Listings.Default) == 0 {
+		invalid("listings.default", "must not be empty")
+	}
+	for i, listing := range c.Listings.Default {
+		if _, err := socialmedia.ParseListing(listing); err != nil {
+			invalid(fmt.Sprintf("listings.default[%d]", i), "%s", err)
+		}
+	}
+	for _, subreddit := range slices.Sorted(maps.Keys(c.Listings.Subreddits)) {
+		if len(c.Listings.Subreddits[subreddit]) == 0 {
+			invalid("listings.subreddits."+subreddit, "must not be empty")
+		}
+		for i, listing := range c.Listings.Subreddits[subreddit] {
+			if _, err := socialmedia.ParseListing(listing); err != nil {
+				invalid(fmt.Sprintf("listings.subreddits.%s[%d]", subreddit, i), "%s", err)
+			}
+		}
+	}
+	if c.Backfill.Limit < 1 {
+		invalid("backfill.limit", "must be at least 1, got %d", c.Backfill.Limit)
+	}
+	for i, t := range c.Backfill.Top {
+		if !slices.Contains(socialmedia.TimeFilters, t) {
+			invalid(fmt.Sprintf("backfill.top[%d]", i), "must be one of %s, got %q", strings.Join(socialmedia.TimeFilters, ", "), t)
+		}
+	}
+	if c.Rising.Window <= 0 {
+		invalid("rising.window", "must be greater than 0, got %s", c.Rising.Window)
+	}
+	if c.Rising.MaxAge <= 0 {
+		invalid("rising.max_age", "must be greater than 0, got %s", c.Rising.MaxAge)
+	}
+	if c.Rising.MinRatio <= 0 {
+		invalid("rising.min_ratio", "must be greater than 0, got %v", c.Rising.MinRatio)
+	}
+	if c.Rising.MinBaseline <= 0 {
+		invalid("rising.min_baseline", "must be greater than 0, got %v", c.Rising.MinBaseline)
+	}
+	if c.Rising.Interval < 0 {
+		invalid("rising.interval", "must not be negative, got %s", c.Rising.Interval)
+	}
+	if c.Refresh.Interval < 0 {
+		invalid("refresh.interval", "must not be negative, got %s", c.Refresh.Interval)
+	}
+	if c.Refresh.MaxAge <= 0 {
+		invalid("refresh.max_age", "must be greater than 0, got %s", c.Refresh.MaxAge)
+	}
+	if c.Refresh.Limit < 1 {
+		invalid("refresh.limit", "must be at least 1, got %d", c.Refresh.Limit)
+	}
+	if c.Trending.Window <= 0 {
+		invalid("trending.window", "must be greater than 0, got %s", c.Trending.Window)
+	}
+	if c.Trending.Baseline < c.Trending.Window {
+		invalid("trending.baseline", "must be at least the window of %s, got %s", c.Trending.Window, c.Trending.Baseline)
+	}
+	if c.Trending.MaxPhrase < 1 {
+		invalid("trending.max_phrase", "must be at least 1, got %d", c.Trending.MaxPhrase)
+	}
+	if c.Trending.MinCount < 1 {
+		invalid("trending.min_count", "must be at least 1, got %d", c.Trending.MinCount)
+	}
+	for i, code := range c.Trending.Languages {
+		if code != language.Unknown && !slices.Contains(language.Languages(), code) {
+			invalid(fmt.Sprintf("trending.languages[%d]", i), "must be one of %s or %s, got %q",
+				strings.Join(language.Languages(), ", "), language.Unknown, code)
+		}
+	}
+	if c.Bots.Interval < 0 {
+		invalid("bots.interval", "must not be negative, got %s", c.Bots.Interval)
+	}
+	if c.Bots.Threshold <= 0 || c.Bots.Threshold > 1 {
+		invalid("bots.threshold", "must be greater than 0 and at most 1, got %v", c.Bots.Threshold)
+	}
+	if c.Bots.MinPosts < 2 {
+		invalid("bots.min_posts", "must be at least 2, got %d", c.Bots.MinPosts)
+	}
+	if c.Bots.AccountsPerRun < 0 {
+		invalid("bots.accounts_per_run", "must not be negative, got %d", c.Bots.AccountsPerRun)
+	}
+	if c.Authors.Interval < 0 {
+		invalid("authors.interval", "must not be negative, got %s", c.Authors.Interval)
+	}
+	if c.Authors.Top < 1 {
+		invalid("authors.top", "must be at least 1, got %d", c.Authors.Top)
+	}
+	if c.Authors.TTL <= 0 {
+		invalid("authors.ttl", "must be greater than 0, got %s", c.Authors.TTL)
+	}
+	if c.Authors.QueueSize < 1 {
+		invalid("authors.queue_size", "must be at least 1, got %d", c.Authors.QueueSize)
+	}
+	if c.Authors.Reserve < 0 || c.Authors.Reserve >= 1 {
+		invalid("authors.reserve", "must be at least 0 and less than 1, got %v", c.Authors.Reserve)
+	}
+	if c.Health.FetchThreshold <= 0 {
+		invalid("health.fetch_threshold", "must be greater than 0, got %s", c.Health.FetchThreshold)
+	}
+	if c.Health.TokenExpiryMargin < 0 {
+		invalid("health.token_expiry_margin", "must not be negative, got %s", c.Health.TokenExpiryMargin)
+	}
+	errs = append(errs, sectionErrors("alerts", c.Alerts.Validate())...)
+	errs = append(errs, sectionErrors("webhooks", c.Webhooks.Validate())...)
+	for i, subreddit := range c.Subreddits {
+		if strings.TrimSpace(subreddit) == "" || strings.ContainsAny(subreddit, " /") {
+			invalid(fmt.Sprintf("subreddits[%d]", i), "invalid subreddit name %q", subreddit)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sectionErrors prefixes each of the joined errors of a section's validation with the section key
+func sectionErrors(section string, err error) []error {
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{fmt.Errorf("%s.%w", section, err)}
+	}
+	var errs []error
+	for _, err := range joined.Unwrap() {
+		errs = append(errs, fmt.Errorf("%s.%w", section, err))
+	}
+	return errs
+}
+
+// ValidateReddit checks the credentials needed by subcommands that talk to reddit
+func (c *Config) ValidateReddit() error {
+	var errs []error
+	if c.Reddit.ClientID == "" {
+		errs = append(errs, errors.New("reddit.client_id: is required (config file or REDDIT_CLIENT_ID)"))
+	}
+	if c.Reddit.ClientSecret == "" {
+		errs = append(errs, errors.New("reddit.client_secret: is required (config file or REDDIT_SECRET)"))
+	}
+	if c.Reddit.UserAgent == "" {
+		errs = append(errs, errors.New("reddit.user_agent: is required (config file or REDDIT_USER_AGENT)"))
+	}
+	return errors.Join(errs...)
+}
+
+// Marshal renders the configuration as YAML, secrets are masked unless showSecrets is set
+func (c *Config) Marshal(showSecrets bool) ([]byte, error) {
+	out := *c
+	if !showSecrets && out.Reddit.ClientSecret != "" {
+		out.Reddit.ClientSecret = redacted
+	}
+	if !showSecrets {
+		out.Webhooks.Endpoints = slices.Clone(out.Webhooks.Endpoints)
+		for i := range out.Webhooks.Endpoints {
+			if out.Webhooks.Endpoints[i].Secret != "" {
+				out.Webhooks.Endpoints[i].Secret = redacted
+			}
+		}
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	err := encoder.Encode(&out)
+	if err != nil {
+		return nil, err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"github.com/Valimere/donkey/webhooks"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// clearEnv unsets every variable Load reads so the developer's environment doesn't leak into the tests
+func clearEnv(t *testing.T) {
+	for _, env := range Default().envVars() {
+		t.Setenv(env.name, "")
+		os.Unsetenv(env.name)
+	}
+	t.Setenv(PathEnv, "")
+	os.Unsetenv(PathEnv)
+}
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "donkey.yaml")
+	err := os.WriteFile(path, []byte(content), 0o600)
+	assert.NoError(t, err)
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Chdir(t.TempDir())
+	clearEnv(t)
+
+	cfg, err := Load("")
+	assert.NoError(t, err)
+	assert.Equal(t, Default(), cfg)
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `
+subreddits: [music, movies]
+storage:
+  dsn: file.db
+rate_limit:
+  requests_per_minute: 30
+reddit:
+  client_id: from-file
+`)
+	t.Setenv("REDDIT_CLIENT_ID", "from-env")
+	t.Setenv("DONKEY_RATE_LIMIT_BURST", "5")
+
+	cfg, err := Load(path)
+	assert.NoError(t, err)
+	// file overrides defaults
+	assert.Equal(t, []string{"music", "movies"}, cfg.Subreddits)
+	assert.Equal(t, "file.db", cfg.Storage.DSN)
+	assert.Equal(t, float64(30), cfg.RateLimit.RequestsPerMinute)
+	// values missing from the file keep their default
+	assert.True(t, cfg.Storage.PurgeOnStart)
+	assert.Equal(t, ":8080", cfg.HTTP.CallbackListen)
+	// env overrides file and defaults
+	assert.Equal(t, "from-env", cfg.Reddit.ClientID)
+	assert.Equal(t, 5, cfg.RateLimit.Burst)
+}
+
+func TestLoadMissingExplicitFile(t *testing.T) {
+	clearEnv(t)
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, "storage:\n  dns: typo.db\n")
+
+	_, err := Load(path)
+	assert.ErrorContains(t, err, "field dns not found")
+}
+
+func TestLoadInvalidEnv(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("DONKEY_RATE_LIMIT_RPM", "fast")
+
+	_, err := Load(writeConfig(t, ""))
+	assert.ErrorContains(t, err, "DONKEY_RATE_LIMIT_RPM (rate_limit.requests_per_minute)")
+}
+
+func TestValidateNamesKeys(t *testing.T) {
+	cfg := Default()
+	cfg.RateLimit.RequestsPerMinute = 0
+	cfg.HTTP.RedirectURL = "localhost/callback"
+	cfg.Subreddits = []string{"music", "r/movies"}
+	cfg.Backfill.Top = []string{"day", "fortnight"}
+	cfg.Listings.Subreddits = map[string][]string{"music": {"hot", "hot:day"}}
+	cfg.Rising.MinBaseline = 0
+	cfg.Trending.MinCount = 0
+	cfg.Trending.Languages = []string{"en", "english"}
+	cfg.Bots.Threshold = 1.5
+	cfg.Authors.Reserve = 1
+
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.ErrorContains(t, err, "rate_limit.requests_per_minute")
+	assert.ErrorContains(t, err, "http.redirect_url")
+	assert.ErrorContains(t, err, "subreddits[1]")
+	assert.NotContains(t, err.Error(), "subreddits[0]")
+	assert.ErrorContains(t, err, "backfill.top[1]")
+	assert.NotContains(t, err.Error(), "backfill.top[0]")
+	assert.ErrorContains(t, err, "listings.subreddits.music[1]")
+	assert.ErrorContains(t, err, "rising.min_baseline")
+	assert.ErrorContains(t, err, "trending.min_count")
+	assert.ErrorContains(t, err, "trending.languages[1]")
+	assert.NotContains(t, err.Error(), "trending.languages[0]")
+	assert.ErrorContains(t, err, "bots.threshold")
+	assert.ErrorContains(t, err, "authors.reserve")
+
+	err = cfg.ValidateReddit()
+	assert.ErrorContains(t, err, "reddit.client_id")
+}
+
+func TestMarshalMasksSecret(t *testing.T) {
+	cfg := Default()
+	cfg.Reddit.ClientSecret = "hunter2"
+	cfg.Webhooks.Endpoints = []webhooks.Endpoint{{Name: "chat", URL: "https://example.com", Secret: "swordfish"}}
+
+	out, err := cfg.Marshal(false)
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(string(out), "hunter2"))
+	assert.False(t, strings.Contains(string(out), "swordfish"))
+	assert.Equal(t, "hunter2", cfg.Reddit.ClientSecret)
+	assert.Equal(t, "swordfish", cfg.Webhooks.Endpoints[0].Secret)
+
+	out, err = cfg.Marshal(true)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), "hunter2")
+	assert.Contains(t, string(out), "swordfish")
+}
+
+func TestListingsFor(t *testing.T) {
+	listings := ListingsConfig{
+		Default:    []string{"new"},
+		Subreddits: map[string][]string{"Music": {"hot", "top:day"}},
+	}
+	assert.Equal(t, []string{"hot", "top:day"}, listings.For("music"))
+	assert.Equal(t, []string{"new"}, listings.For("movies"))
+}
@@ -0,0 +1,21 @@
+// Package dashboard is the web dashboard served by "donkey run", a static page reading the REST and SSE endpoints
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the dashboard assets, it is meant to be mounted at "/"
+func Handler() http.Handler {
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		// the embedded directory is fixed at compile time
+		panic(err)
+	}
+	return http.FileServerFS(assets)
+}
@@ -0,0 +1,214 @@
+// donkey dashboard, reads the REST endpoints and refreshes on the server-sent ingestion events
+"use strict";
+
+const TOP = 10;
+const VELOCITY_POSTS = 5;
+const ACTIVITY_MINUTES = 30;
+const FEED_SIZE = 50;
+const REFRESH_DELAY = 2000;
+const POLL_INTERVAL = 30000;
+const COLORS = ["#ff4500", "#0079d3", "#1f9d55", "#9b59b6", "#e6a700"];
+
+// new posts per subreddit and minute, counted from the event stream since the page was opened
+const activity = new Map();
+
+const $ = (id) => document.getElementById(id);
+
+function el(tag, attrs = {}, ...children) {
+  const node = document.createElement(tag);
+  for (const [key, value] of Object.entries(attrs)) {
+    node.setAttribute(key, value);
+  }
+  for (const child of children) {
+    node.append(child instanceof Node ? child : document.createTextNode(String(child)));
+  }
+  return node;
+}
+
+function svg(tag, attrs = {}) {
+  const node = document.createElementNS("http://www.w3.org/2000/svg", tag);
+  for (const [key, value] of Object.entries(attrs)) {
+    node.setAttribute(key, value);
+  }
+  return node;
+}
+
+async function getJSON(url) {
+  const response = await fetch(url, { cache: "no-store" });
+  if (!response.ok && response.status !== 503) {
+    throw new Error(`${url}: ${response.status}`);
+  }
+  return response.json();
+}
+
+function postLink(post) {
+  return el("a", { href: `https://redd.it/${post.PostID}`, target: "_blank", rel: "noopener" }, post.Title);
+}
+
+function renderLeaderboard(board) {
+  $("posts").replaceChildren(...board.posts.map((post, i) => el("tr", {},
+    el("td", {}, i + 1),
+    el("td", { class: "num" }, post.UpVotes),
+    el("td", { class: "num" }, post.NumComments),
+    el("td", {}, `r/${post.SubReddit}`),
+    el("td", { class: "title" }, postLink(post)),
+  )));
+  $("authors").replaceChildren(...board.authors.map((author, i) => el("tr", {},
+    el("td", {}, i + 1),
+    el("td", {}, author.Author),
+    el("td", { class: "num" }, author.TotalPosts),
+    el("td", { class: "num" }, author.TotalUpvotes),
+    el("td", { class: "num" }, author.TotalComments),
+  )));
+}
+
+function renderVelocity(histories) {
+  const chart = $("velocity");
+  const width = 800, height = 260, pad = 36;
+  const points = histories.flatMap((h) => h.history.map((s) => ({ t: Date.parse(s.Time), v: s.UpVotes })));
+  chart.replaceChildren();
+  $("velocity-legend").replaceChildren();
+  if (points.length === 0) {
+    const empty = svg("text", { x: width / 2, y: height / 2, "text-anchor": "middle" });
+    empty.textContent = "waiting for posts…";
+    chart.append(empty);
+    return;
+  }
+
+  const minT = Math.min(...points.map((p) => p.t));
+  const maxT = Math.max(Date.now(), ...points.map((p) => p.t));
+  const maxV = Math.max(1, ...points.map((p) => p.v));
+  const x = (t) => pad + ((t - minT) / Math.max(1, maxT - minT)) * (width - 2 * pad);
+  const y = (v) => height - pad - (v / maxV) * (height - 2 * pad);
+
+  chart.append(svg("line", { class: "axis", x1: pad, y1: height - pad, x2: width - pad, y2: height - pad }));
+  chart.append(svg("line", { class: "axis", x1: pad, y1: pad, x2: pad, y2: height - pad }));
+  for (const [value, label] of [[0, "0"], [maxV, String(maxV)]]) {
+    const text = svg("text", { x: pad - 6, y: y(value) + 4, "text-anchor": "end" });
+    text.textContent = label;
+    chart.append(text);
+  }
+  for (const [t, anchor] of [[minT, "start"], [maxT, "end"]]) {
+    const text = svg("text", { x: x(t), y: height - pad + 16, "text-anchor": anchor });
+    text.textContent = new Date(t).toLocaleTimeString();
+    chart.append(text);
+  }
+
+  histories.forEach((h, i) => {
+    const color = COLORS[i % COLORS.length];
+    // the score holds until the next snapshot, so the line extends to now
+    const series = h.history.map((s) => [Date.parse(s.Time), s.UpVotes]);
+    if (series.length > 0) {
+      series.push([maxT, series[series.length - 1][1]]);
+    }
+    chart.append(svg("polyline", {
+      stroke: color,
+      points: series.map(([t, v]) => `${x(t).toFixed(1)},${y(v).toFixed(1)}`).join(" "),
+    }));
+    $("velocity-legend").append(el("li", {}, el("i", { style: `background:${color}` }),
+      `${h.post.UpVotes}↑ r/${h.post.SubReddit} ${h.post.Title.slice(0, 60)}`));
+  });
+}
+
+function currentMinute() {
+  return Math.floor(Date.now() / 60000);
+}
+
+function sparkline(subreddit) {
+  const counts = activity.get(subreddit) || new Map();
+  const now = currentMinute();
+  const values = [];
+  for (let minute = now - ACTIVITY_MINUTES + 1; minute <= now; minute++) {
+    values.push(counts.get(minute) || 0);
+  }
+  const peak = Math.max(1, ...values);
+  return el("div", { class: "spark", title: `${values.reduce((a, b) => a + b, 0)} new posts` },
+    ...values.map((v) => el("span", { style: `height:${(v / peak) * 100}%` })));
+}
+
+function renderSubreddits(subreddits) {
+  $("subreddits").replaceChildren(...subreddits.map((s) => el("tr", {},
+    el("td", {}, `r/${s.Subreddit}`),
+    el("td", { class: "num" }, s.TotalPosts),
+    el("td", { class: "num" }, s.TotalUpvotes),
+    el("td", { class: "num" }, s.TotalComments),
+    el("td", {}, sparkline(s.Subreddit)),
+  )));
+}
+
+function renderHealth(report) {
+  const badge = $("status");
+  badge.textContent = report.status === "ok" ? "healthy" : "unhealthy";
+  badge.className = `badge ${report.status}`;
+  $("health").replaceChildren(...report.checks.map((check) => el("tr", {},
+    el("td", {}, check.name),
+    el("td", { class: check.status }, check.status),
+    el("td", { class: "title" }, check.message || ""),
+  )));
+}
+
+async function refresh() {
+  try {
+    const [board, subreddits, health] = await Promise.all([
+      getJSON(`api/leaderboard?limit=${TOP}`),
+      getJSON("api/subreddits"),
+      getJSON("readyz"),
+    ]);
+    renderLeaderboard(board);
+    renderSubreddits(subreddits);
+    renderHealth(health);
+    const histories = await Promise.all(board.posts.slice(0, VELOCITY_POSTS)
+      .map((post) => getJSON(`api/posts/${encodeURIComponent(post.PostID)}`)));
+    renderVelocity(histories);
+    $("updated").textContent = `updated ${new Date().toLocaleTimeString()}`;
+  } catch (err) {
+    $("updated").textContent = `update failed: ${err.message}`;
+  }
+}
+
+// scheduleRefresh coalesces bursts of events into a single refresh
+let pending = null;
+function scheduleRefresh() {
+  if (pending === null) {
+    pending = setTimeout(() => {
+      pending = null;
+      refresh();
+    }, REFRESH_DELAY);
+  }
+}
+
+function addToFeed(post) {
+  const feed = $("feed");
+  const created = post.Created ? new Date(post.Created) : new Date();
+  feed.prepend(el("li", {},
+    el("time", {}, created.toLocaleTimeString()),
+    `r/${post.SubReddit} · ${post.Author} · `,
+    postLink(post)));
+  while (feed.children.length > FEED_SIZE) {
+    feed.lastChild.remove();
+  }
+}
+
+function connect() {
+  const stream = new EventSource("api/events");
+  stream.addEventListener("post_ingested", (msg) => {
+    const event = JSON.parse(msg.data);
+    const counts = activity.get(event.subreddit) || new Map();
+    counts.set(currentMinute(), (counts.get(currentMinute()) || 0) + 1);
+    activity.set(event.subreddit, counts);
+    addToFeed(event.post);
+    scheduleRefresh();
+  });
+  stream.addEventListener("post_updated", scheduleRefresh);
+  stream.addEventListener("fetch_failed", scheduleRefresh);
+  // EventSource reconnects by itself, the badge shows the gap
+  stream.onerror = () => {
+    $("status").textContent = "disconnected";
+    $("status").className = "badge fail";
+  };
+  stream.onopen = refresh;
+}
+
+refresh();
+connect();
+setInterval(refresh, POLL_INTERVAL);
@@ -1,23 +1,37 @@
 package db
 
 import (
+	"cmp"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/Valimere/donkey/language"
+	"github.com/Valimere/donkey/logging"
+	"github.com/Valimere/donkey/metrics"
+	"github.com/Valimere/donkey/sentiment"
+	"github.com/Valimere/donkey/simhash"
 	"github.com/Valimere/donkey/socialmedia"
 	"github.com/Valimere/donkey/store"
 	"golang.org/x/oauth2"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
-	"log"
-	"os"
+	"log/slog"
+	"maps"
+	"slices"
 	"strings"
 	"time"
 )
 
 type DbStore struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Logger *slog.Logger
+	// Metrics is optional, write latencies are recorded when set
+	Metrics *metrics.Metrics
+	// SessionID tags the saved posts and comments, StartSession sets it
+	SessionID uint
+	// ExcludeBots leaves the authors scored as suspected bots out of the author leaderboards
+	ExcludeBots bool
 }
 
 // Ensure DBStore implements store.Store
@@ -36,8 +50,177 @@ type Post struct {
 	Author      string
 	Subreddit   string
 	Title       string
+	Body        string
 	UpVotes     int
 	NumComments int
+	Created     time.Time `gorm:"index"`
+	SessionID   uint      `gorm:"index"`
+	Backfilled  bool
+	Flair       string
+
+	Score          int
+	UpvoteRatio    float64
+	Permalink      string
+	URL            string
+	Domain         string `gorm:"index"`
+	IsSelf         bool
+	Over18         bool
+	Spoiler        bool
+	Stickied       bool
+	Locked         bool
+	AuthorFlair    string
+	AuthorFullname string
+	NumCrossposts  int
+	Gilded         int
+	TotalAwards    int
+	Distinguished  string
+	MediaType      string
+
+	State       string `gorm:"default:active;index"`
+	RemovedBy   string
+	Disappeared time.Time
+	// Checked is when the post was last refreshed
+	Checked time.Time `gorm:"index"`
+	// ContentHash identifies the current title and body, it is empty for posts stored before it was introduced
+	ContentHash string
+	Edited      time.Time
+	RepostOf    string `gorm:"index"`
+	// Sentiment and Language are NULL only for posts stored before they were introduced until Migrate sets them
+	Sentiment float64
+	Language  string `gorm:"index"`
+}
+
+// PostRevision represents the schema for the "post_revisions" table, the versions of the edited posts
+type PostRevision struct {
+	ID          uint   `gorm:"primarykey"`
+	PostID      string `gorm:"uniqueIndex:idx_post_revision"`
+	Revision    int    `gorm:"uniqueIndex:idx_post_revision"`
+	Title       string
+	Body        string
+	ContentHash string
+	Edited      time.Time
+	Seen        time.Time
+	UpVotes     int
+	NumComments int
+}
+
+// Crosspost represents the schema for the "crossposts" table, the stored crossposts with their originals
+type Crosspost struct {
+	ID                  uint   `gorm:"primarykey"`
+	PostID              string `gorm:"uniqueIndex"`
+	Subreddit           string
+	Created             time.Time
+	ParentID            string `gorm:"index"`
+	ParentSubreddit     string
+	ParentAuthor        string
+	ParentTitle         string
+	ParentURL           string
+	ParentCreated       time.Time
+	ParentNumCrossposts int
+}
+
+// PostLink represents the schema for the "post_links" table, the normalized links of the stored link posts
+type PostLink struct {
+	ID        uint   `gorm:"primarykey"`
+	PostID    string `gorm:"uniqueIndex"`
+	URL       string `gorm:"index"`
+	Subreddit string
+	Created   time.Time
+}
+
+// PostFingerprint represents the schema for the "post_fingerprints" table, the SimHash of the title and body of the stored posts.
+// The fingerprint is split into bands, near-duplicates share at least one of them.
+type PostFingerprint struct {
+	ID          uint   `gorm:"primarykey"`
+	PostID      string `gorm:"uniqueIndex"`
+	Fingerprint int64
+	Band0       uint16 `gorm:"index"`
+	Band1       uint16 `gorm:"index"`
+	Band2       uint16 `gorm:"index"`
+	Band3       uint16 `gorm:"index"`
+	Band4       uint16 `gorm:"index"`
+	Band5       uint16 `gorm:"index"`
+	Band6       uint16 `gorm:"index"`
+}
+
+// Comment represents the schema for the "comments" table
+type Comment struct {
+	gorm.Model
+	CommentID string `gorm:"unique"`
+	PostID    string `gorm:"index"`
+	ParentID  string
+	Author    string
+	Subreddit string
+	Body      string
+	UpVotes   int
+	Created   time.Time `gorm:"index"`
+	SessionID uint      `gorm:"index"`
+	Sentiment float64
+}
+
+// ImportCheckpoint represents the schema for the "import_checkpoints" table, the progress of archive imports
+type ImportCheckpoint struct {
+	gorm.Model
+	Source string `gorm:"uniqueIndex"`
+	Size   int64
+	Line   int64
+	Done   bool
+}
+
+// Session represents the schema for the "sessions" table, one row per "donkey run"
+type Session struct {
+	gorm.Model
+	// Subreddits is the comma-separated list of subreddits ingested during the session
+	Subreddits string
+}
+
+// PostSnapshot represents the schema for the "post_snapshots" table, the score history of the posts
+type PostSnapshot struct {
+	ID          uint   `gorm:"primarykey"`
+	PostID      string `gorm:"index"`
+	UpVotes     int
+	NumComments int
+	CreatedAt   time.Time
+}
+
+// ListingRank represents the schema for the "listing_ranks" table, the rank changes of posts in the subreddit listings
+type ListingRank struct {
+	ID        uint   `gorm:"primarykey"`
+	Subreddit string `gorm:"index:idx_listing_ranks_listing"`
+	Listing   string `gorm:"index:idx_listing_ranks_listing"`
+	PostID    string `gorm:"index:idx_listing_ranks_listing"`
+	// Rank is the 1-based position in the listing, 0 when the post left it
+	Rank int
+	Time time.Time
+}
+
+// ListingPoll represents the schema for the "listing_polls" table, when each subreddit listing was fetched last
+type ListingPoll struct {
+	ID        uint   `gorm:"primarykey"`
+	Subreddit string `gorm:"uniqueIndex:idx_listing_polls_listing"`
+	Listing   string `gorm:"uniqueIndex:idx_listing_polls_listing"`
+	Polled    time.Time
+}
+
+// WebhookDelivery represents the schema for the "webhook_deliveries" table, the webhook queue and delivery log
+type WebhookDelivery struct {
+	gorm.Model
+	Endpoint       string `gorm:"index"`
+	URL            string
+	Event          string
+	EventKey       string `gorm:"index"`
+	Payload        string
+	Status         string    `gorm:"index:idx_webhook_deliveries_due"`
+	NextAttempt    time.Time `gorm:"index:idx_webhook_deliveries_due"`
+	Attempts       int
+	LastError      string
+	ResponseStatus int
+}
+
+// Subreddit represents the schema for the "subreddits" table, the persisted list of subreddits to ingest
+type Subreddit struct {
+	gorm.Model
+	Name string `gorm:"uniqueIndex"`
 }
 
 // AuthorStatistic represents the schema for the "author_statistics" table
@@ -49,37 +232,118 @@ type AuthorStatistic struct {
 	TotalComments int
 }
 
-var db *gorm.DB
+// Author represents the schema for the "authors" table, the cached reddit profiles of the authors
+type Author struct {
+	ID           uint   `gorm:"primarykey"`
+	Name         string `gorm:"uniqueIndex"`
+	Created      time.Time
+	LinkKarma    int
+	CommentKarma int
+	IsMod        bool
+	IsGold       bool
+	Suspended    bool
+	NotFound     bool
+	Fetched      time.Time `gorm:"index"`
+}
 
-func InitDB(debugFlag bool) (*gorm.DB, error) {
-	var err error
-	var logLevel logger.LogLevel
+// AuthorScore represents the schema for the "author_scores" table, how likely each author is a bot
+type AuthorScore struct {
+	ID             uint   `gorm:"primarykey"`
+	Author         string `gorm:"uniqueIndex"`
+	Score          float64
+	Bot            bool `gorm:"index"`
+	Posts          int
+	Cadence        float64
+	RepeatedTitles float64
+	Account        float64
+	Name           float64
+	Scored         time.Time
+}
 
-	if debugFlag {
-		logLevel = logger.Info
-	} else {
-		logLevel = logger.Silent
+// InitDB opens the database and migrates it to the current schema
+func InitDB(dsn string, logger *slog.Logger) (*gorm.DB, error) {
+	db, err := Open(dsn, logger)
+	if err != nil {
+		return nil, err
 	}
-	newLogger := logger.New(
-		log.New(os.Stdout, "\r\n", log.LstdFlags),
-		logger.Config{
-			SlowThreshold: time.Second,
-			LogLevel:      logLevel,
-		})
-	db, err = gorm.Open(sqlite.Open("donkey.db"), &gorm.Config{Logger: newLogger})
+	err = Migrate(db)
 	if err != nil {
-		log.Fatalf("Error while connecting to the database: %s", err)
+		return nil, err
 	}
+	return db, nil
+}
 
-	err = db.AutoMigrate(&Token{}, &Post{}, &AuthorStatistic{})
+// Open connects to the sqlite database at dsn without touching the schema,
+// SQL statements are logged at debug level through logger
+func Open(dsn string, logger *slog.Logger) (*gorm.DB, error) {
+	gormLogger := &logging.GormLogger{
+		Logger:        logging.Component(logger, logging.ComponentStore),
+		SlowThreshold: time.Second,
+	}
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: gormLogger})
 	if err != nil {
-		log.Fatalf("Error while migrating the database: %s", err)
+		return nil, fmt.Errorf("error while connecting to the database: %w", err)
 	}
-
 	return db, nil
 }
 
+// Migrate creates or updates all tables used by DbStore
+func Migrate(db *gorm.DB) error {
+	err := db.AutoMigrate(&Token{}, &Post{}, &AuthorStatistic{}, &Subreddit{}, &PostSnapshot{}, &Comment{}, &Session{}, &ImportCheckpoint{},
+		&ListingRank{}, &ListingPoll{}, &WebhookDelivery{}, &PostRevision{}, &Crosspost{}, &PostLink{}, &PostFingerprint{},
+		&Author{}, &AuthorScore{})
+	if err != nil {
+		return fmt.Errorf("error while migrating the database: %w", err)
+	}
+	err = analyzeContent(db)
+	if err != nil {
+		return fmt.Errorf("error while analyzing the content of the stored posts: %w", err)
+	}
+	return nil
+}
+
+// analyzeContent scores the sentiment and detects the language of the posts and comments stored before they were,
+// it does nothing once all are analyzed
+func analyzeContent(db *gorm.DB) error {
+	var posts []Post
+	query := db.Select("id, title, body").Where("sentiment IS NULL OR language IS NULL")
+	err := query.FindInBatches(&posts, eachBatchSize, func(*gorm.DB, int) error {
+		for _, post := range posts {
+			text := post.Title + "\n" + post.Body
+			err := db.Model(&Post{}).Where("id = ?", post.ID).
+				Updates(map[string]any{"sentiment": sentiment.Score(text), "language": language.Detect(text)}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+	var comments []Comment
+	return db.Select("id, body").Where("sentiment IS NULL").FindInBatches(&comments, eachBatchSize, func(*gorm.DB, int) error {
+		for _, comment := range comments {
+			err := db.Model(&Comment{}).Where("id = ?", comment.ID).Update("sentiment", sentiment.Score(comment.Body)).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// Ping checks that the database can still be reached
+func (s *DbStore) Ping(ctx context.Context) error {
+	sqlDB, err := s.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
 func (s *DbStore) SaveToken(token *oauth2.Token) error {
+	defer s.observeWrite("save_token", time.Now())
 	data, err := json.Marshal(token)
 	if err != nil {
 		return err
@@ -112,6 +376,23 @@ func (s *DbStore) GetToken() (*oauth2.Token, error) {
 	return &oauthToken, nil
 }
 
+// observeWrite records the latency of a write started at start, meant to be deferred
+func (s *DbStore) observeWrite(operation string, start time.Time) {
+	s.Metrics.ObserveStoreWrite(operation, time.Since(start))
+}
+
+func (s *DbStore) logger() *slog.Logger {
+	if s.Logger == nil {
+		return logging.Component(nil, logging.ComponentStore)
+	}
+	return s.Logger
+}
+
+// DeleteTokens removes every stored token so the next run has to authorize again
+func (s *DbStore) DeleteTokens() error {
+	return s.DB.Exec("DELETE FROM tokens").Error
+}
+
 func (s *DbStore) TransformToDBPost(p *socialmedia.Post) *Post {
 	return &Post{
 		Model:       gorm.Model{},
@@ -119,100 +400,473 @@ func (s *DbStore) TransformToDBPost(p *socialmedia.Post) *Post {
 		Author:      p.Author,
 		Subreddit:   p.SubReddit,
 		Title:       p.Title,
+		Body:        p.Body,
 		UpVotes:     p.UpVotes,
 		NumComments: p.NumComments,
+		Created:     p.Created,
+		SessionID:   s.SessionID,
+		Backfilled:  p.Backfilled,
+		Flair:       p.Flair,
+
+		Score:          p.Score,
+		UpvoteRatio:    p.UpvoteRatio,
+		Permalink:      p.Permalink,
+		URL:            p.URL,
+		Domain:         p.Domain,
+		IsSelf:         p.IsSelf,
+		Over18:         p.Over18,
+		Spoiler:        p.Spoiler,
+		Stickied:       p.Stickied,
+		Locked:         p.Locked,
+		AuthorFlair:    p.AuthorFlair,
+		AuthorFullname: p.AuthorFullname,
+		NumCrossposts:  p.NumCrossposts,
+		Gilded:         p.Gilded,
+		TotalAwards:    p.TotalAwards,
+		Distinguished:  p.Distinguished,
+		MediaType:      p.MediaType,
+		State:          cmp.Or(p.State, socialmedia.PostActive),
+		RemovedBy:      p.RemovedBy,
+		Disappeared:    p.Disappeared,
+		ContentHash:    p.ContentHash(),
+		Edited:         p.Edited,
+		RepostOf:       p.RepostOf,
+		Sentiment:      p.Sentiment,
+		Language:       p.Language,
+	}
+}
+
+func (s *DbStore) TransformFromDBPost(p *Post) socialmedia.Post {
+	return socialmedia.Post{
+		PostID:      p.PostID,
+		Title:       p.Title,
+		Body:        p.Body,
+		Author:      p.Author,
+		NumComments: p.NumComments,
+		UpVotes:     p.UpVotes,
+		Created:     p.Created,
+		SubReddit:   p.Subreddit,
+		Backfilled:  p.Backfilled,
+		Flair:       p.Flair,
+
+		Score:          p.Score,
+		UpvoteRatio:    p.UpvoteRatio,
+		Permalink:      p.Permalink,
+		URL:            p.URL,
+		Domain:         p.Domain,
+		IsSelf:         p.IsSelf,
+		Over18:         p.Over18,
+		Spoiler:        p.Spoiler,
+		Stickied:       p.Stickied,
+		Locked:         p.Locked,
+		AuthorFlair:    p.AuthorFlair,
+		AuthorFullname: p.AuthorFullname,
+		NumCrossposts:  p.NumCrossposts,
+		Gilded:         p.Gilded,
+		TotalAwards:    p.TotalAwards,
+		Distinguished:  p.Distinguished,
+		MediaType:      p.MediaType,
+		State:          p.State,
+		RemovedBy:      p.RemovedBy,
+		Disappeared:    p.Disappeared,
+		Edited:         p.Edited,
+		RepostOf:       p.RepostOf,
+		Sentiment:      p.Sentiment,
+		Language:       p.Language,
 	}
 }
 
+// SavePost stores a new post with the sentiment and language of its title and body, which are set on the post as well,
+// its first snapshot, links and repost cluster, and updates its author's statistic. Everything is written in one transaction,
+// so a post is never stored without the rest. It returns store.ErrDuplicatePost if the post is already stored.
 func (s *DbStore) SavePost(p *socialmedia.Post) error {
+	defer s.observeWrite("save_post", time.Now())
+	p.Sentiment = sentiment.Score(p.Title + "\n" + p.Body)
+	p.Language = language.Detect(p.Title + "\n" + p.Body)
 	dbPost := s.TransformToDBPost(p)
-	result := s.DB.Save(dbPost)
-	if result.Error != nil {
-		// no need to print sqlite post is not unique info
-		if strings.Contains(result.Error.Error(), "UNIQUE constraint failed") {
-			return nil
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		txStore := *s
+		txStore.DB = tx
+		err := tx.Save(dbPost).Error
+		if err != nil {
+			// no need to print sqlite post is not unique info
+			if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+				return store.ErrDuplicatePost
+			}
+			return err
 		}
-		return result.Error
+		err = txStore.saveSnapshot(p)
+		if err != nil {
+			return err
+		}
+		err = txStore.saveLinks(p)
+		if err != nil {
+			return err
+		}
+		err = txStore.markRepost(p)
+		if err != nil {
+			return err
+		}
+		return txStore.SaveAuthorStatistic(p) // tightly coupling the two but is efficient for our current use case
+	})
+	if err != nil {
+		return err
+	}
+	s.logger().Info("new post found", "post_id", p.PostID, "upvotes", p.UpVotes, "comments", p.NumComments,
+		"author", p.Author, "subreddit", p.SubReddit, "title", p.Title)
+	return nil
+}
+
+// UpdatePostScore stores the current score, flair, awards and the other listing fields reddit changes over the life
+// of an already stored post and adds a snapshot to its history when the upvotes or comments moved,
+// nothing is written and false is returned when none of them changed. It returns gorm.ErrRecordNotFound for unknown posts.
+func (s *DbStore) UpdatePostScore(p *socialmedia.Post) (bool, error) {
+	defer s.observeWrite("update_post_score", time.Now())
+	var dbPost Post
+	err := s.DB.Where("post_id = ?", p.PostID).First(&dbPost).Error
+	if err != nil {
+		return false, err
 	}
-	return s.SaveAuthorStatistic(p) // tightly coupling the two but is efficient for our current use case
+	stored := s.TransformFromDBPost(&dbPost)
+	current := listingFields(p)
+	if maps.Equal(listingFields(&stored), current) {
+		return false, nil
+	}
+	return true, s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&dbPost).Updates(current).Error
+		if err != nil || (stored.UpVotes == p.UpVotes && stored.NumComments == p.NumComments) {
+			return err
+		}
+		txStore := *s
+		txStore.DB = tx
+		return txStore.saveSnapshot(p)
+	})
 }
 
-func (s *DbStore) SaveAuthorStatistic(p *socialmedia.Post) error {
-	var dbAuthorStatistic AuthorStatistic
+// listingFields are the columns of the fields of a post that change while it is on the listing
+func listingFields(p *socialmedia.Post) map[string]any {
+	return map[string]any{
+		"up_votes": p.UpVotes, "num_comments": p.NumComments, "score": p.Score, "upvote_ratio": p.UpvoteRatio,
+		"flair": p.Flair, "author_flair": p.AuthorFlair, "over18": p.Over18, "spoiler": p.Spoiler,
+		"stickied": p.Stickied, "locked": p.Locked, "num_crossposts": p.NumCrossposts, "gilded": p.Gilded,
+		"total_awards": p.TotalAwards, "distinguished": p.Distinguished,
+	}
+}
+
+// UpdatePostState records that the post was seen at seen and, the first time it is seen deleted or removed, its state,
+// the removal category and the time it disappeared, which are set on the post as well. The stored content is kept.
+// It returns whether the state changed and gorm.ErrRecordNotFound for unknown posts.
+func (s *DbStore) UpdatePostState(p *socialmedia.Post, seen time.Time) (bool, error) {
+	defer s.observeWrite("update_post_state", time.Now())
+	var dbPost Post
+	err := s.DB.Where("post_id = ?", p.PostID).First(&dbPost).Error
+	if err != nil {
+		return false, err
+	}
+	if dbPost.State != socialmedia.PostActive || p.State == socialmedia.PostActive || p.State == "" {
+		return false, s.DB.Model(&dbPost).Update("checked", seen).Error
+	}
+	err = s.DB.Model(&dbPost).Updates(map[string]any{"state": p.State, "removed_by": p.RemovedBy, "disappeared": seen, "checked": seen}).Error
+	if err != nil {
+		return false, err
+	}
+	p.Disappeared = seen
+	return true, nil
+}
+
+// RecordPostRevision stores the title and body of the post as a new revision when they differ from the stored ones
+// and makes them the current content of the post with its sentiment and language, the first edit stores the original as revision 1 as well.
+// Deleted and removed posts are left alone since reddit replaces their content.
+// It returns whether a revision was stored and gorm.ErrRecordNotFound for unknown posts.
+func (s *DbStore) RecordPostRevision(p *socialmedia.Post, seen time.Time) (bool, error) {
+	defer s.observeWrite("record_post_revision", time.Now())
+	var dbPost Post
+	err := s.DB.Where("post_id = ?", p.PostID).First(&dbPost).Error
+	if err != nil {
+		return false, err
+	}
+	if dbPost.State != socialmedia.PostActive || p.State != "" && p.State != socialmedia.PostActive {
+		return false, nil
+	}
+	stored := s.TransformFromDBPost(&dbPost)
+	storedHash := cmp.Or(dbPost.ContentHash, stored.ContentHash())
+	hash := p.ContentHash()
+	if hash == storedHash {
+		return false, nil
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		var last PostRevision
+		err := tx.Where("post_id = ?", p.PostID).Order("revision desc").Limit(1).Find(&last).Error
+		if err != nil {
+			return err
+		}
+		if last.Revision == 0 {
+			// the original was seen when the post was saved, with the score of its first snapshot
+			var first PostSnapshot
+			err = tx.Where("post_id = ?", p.PostID).Order("id asc").Limit(1).Find(&first).Error
+			if err != nil {
+				return err
+			}
+			last = PostRevision{PostID: p.PostID, Revision: 1, Title: dbPost.Title, Body: dbPost.Body, ContentHash: storedHash,
+				Edited: dbPost.Edited, Seen: dbPost.CreatedAt, UpVotes: first.UpVotes, NumComments: first.NumComments}
+			err = tx.Create(&last).Error
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.Create(&PostRevision{PostID: p.PostID, Revision: last.Revision + 1, Title: p.Title, Body: p.Body, ContentHash: hash,
+			Edited: p.Edited, Seen: seen, UpVotes: p.UpVotes, NumComments: p.NumComments}).Error
+		if err != nil {
+			return err
+		}
+		p.Sentiment = sentiment.Score(p.Title + "\n" + p.Body)
+		p.Language = language.Detect(p.Title + "\n" + p.Body)
+		return tx.Model(&dbPost).Updates(map[string]any{"title": p.Title, "body": p.Body, "content_hash": hash, "edited": p.Edited,
+			"sentiment": p.Sentiment, "language": p.Language}).Error
+	})
+	return err == nil, err
+}
+
+// GetPostRevisions returns the revisions of a post, oldest first, it is empty for posts that were never edited
+func (s *DbStore) GetPostRevisions(postID string) ([]socialmedia.PostRevision, error) {
+	var dbRevisions []PostRevision
+	err := s.DB.Where("post_id = ?", postID).Order("revision asc").Find(&dbRevisions).Error
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]socialmedia.PostRevision, 0, len(dbRevisions))
+	for _, r := range dbRevisions {
+		revisions = append(revisions, socialmedia.PostRevision{PostID: r.PostID, Revision: r.Revision, Title: r.Title, Body: r.Body,
+			Edited: r.Edited, Seen: r.Seen, UpVotes: r.UpVotes, NumComments: r.NumComments})
+	}
+	return revisions, nil
+}
+
+// GetPostsToRefresh returns the IDs of up to limit active posts created since createdSince, the ones refreshed longest ago first
+func (s *DbStore) GetPostsToRefresh(createdSince time.Time, limit int) ([]string, error) {
+	var postIDs []string
+	err := s.DB.Model(&Post{}).
+		Where("state = ? AND created >= ?", socialmedia.PostActive, createdSince).
+		Order("checked asc, created desc").
+		Limit(limit).
+		Pluck("post_id", &postIDs).Error
+	if err != nil {
+		return nil, err
+	}
+	return postIDs, nil
+}
 
-	// Start a transaction
-	tx := s.DB.Begin()
-	if tx.Error != nil {
-		return tx.Error
+func (s *DbStore) saveSnapshot(p *socialmedia.Post) error {
+	return s.DB.Create(&PostSnapshot{PostID: p.PostID, UpVotes: p.UpVotes, NumComments: p.NumComments}).Error
+}
+
+// saveLinks records the original of a crosspost and the link of a link post
+func (s *DbStore) saveLinks(p *socialmedia.Post) error {
+	if parent := p.CrosspostParent; parent != nil {
+		err := s.DB.Create(&Crosspost{PostID: p.PostID, Subreddit: p.SubReddit, Created: p.Created, ParentID: parent.PostID,
+			ParentSubreddit: parent.Subreddit, ParentAuthor: parent.Author, ParentTitle: parent.Title, ParentURL: parent.URL,
+			ParentCreated: parent.Created, ParentNumCrossposts: parent.NumCrossposts}).Error
+		if err != nil {
+			return err
+		}
+	}
+	if sharedURL := p.SharedURL(); sharedURL != "" {
+		return s.DB.Create(&PostLink{PostID: p.PostID, URL: sharedURL, Subreddit: p.SubReddit, Created: p.Created}).Error
 	}
+	return nil
+}
 
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+// markRepost puts the post into the cluster of the earlier posts sharing its link or with a near-duplicate title and body,
+// RepostOf of every post of the cluster is set to the earliest of them. Clusters that the post connects are merged.
+// Crossposts are no reposts.
+func (s *DbStore) markRepost(p *socialmedia.Post) error {
+	if p.CrosspostParent != nil {
+		return nil
+	}
+	var matches []string
+	if sharedURL := p.SharedURL(); sharedURL != "" {
+		err := s.DB.Model(&PostLink{}).Where("url = ? AND post_id <> ?", sharedURL, p.PostID).Pluck("post_id", &matches).Error
+		if err != nil {
+			return err
+		}
+	}
+	text := p.Title
+	if p.State == "" || p.State == socialmedia.PostActive {
+		text += "\n" + p.Body
+	}
+	if fingerprint := simhash.Fingerprint(text); fingerprint != 0 {
+		duplicates, err := s.nearDuplicates(fingerprint)
+		if err != nil {
+			return err
+		}
+		matches = append(matches, duplicates...)
+		bands := simhash.Split(fingerprint)
+		err = s.DB.Create(&PostFingerprint{PostID: p.PostID, Fingerprint: int64(fingerprint), Band0: bands[0], Band1: bands[1],
+			Band2: bands[2], Band3: bands[3], Band4: bands[4], Band5: bands[5], Band6: bands[6]}).Error
+		if err != nil {
+			return err
 		}
-	}()
+	}
+	if len(matches) == 0 {
+		return nil
+	}
 
-	// Check if the author statistic already exists
-	result := tx.Where("author = ?", p.Author).First(&dbAuthorStatistic)
+	var matched []Post
+	err := s.DB.Select("post_id, repost_of").Where("post_id IN ?", matches).Find(&matched).Error
+	if err != nil {
+		return err
+	}
+	rootIDs := []string{p.PostID}
+	for _, m := range matched {
+		rootIDs = append(rootIDs, cmp.Or(m.RepostOf, m.PostID))
+	}
+	var roots []Post
+	err = s.DB.Select("post_id, created").Where("post_id IN ?", rootIDs).Order("created asc, id asc").Limit(1).Find(&roots).Error
+	if err != nil || len(roots) == 0 {
+		return err
+	}
+	root := roots[0].PostID
+	err = s.DB.Model(&Post{}).
+		Where("post_id <> ? AND (post_id IN ? OR repost_of IN ?)", root, rootIDs, rootIDs).
+		Update("repost_of", root).Error
+	if err != nil {
+		return err
+	}
+	if root != p.PostID {
+		p.RepostOf = root
+	}
+	return nil
+}
 
-	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-		dbAuthorStatistic = AuthorStatistic{
-			Author:        p.Author,
-			TotalPosts:    1,
-			TotalUpvotes:  p.UpVotes,
-			TotalComments: p.NumComments,
+// nearDuplicates returns the IDs of the posts whose fingerprint is at most simhash.MaxDistance from fingerprint
+func (s *DbStore) nearDuplicates(fingerprint uint64) ([]string, error) {
+	bands := simhash.Split(fingerprint)
+	var candidates []PostFingerprint
+	err := s.DB.Where("band0 = ? OR band1 = ? OR band2 = ? OR band3 = ? OR band4 = ? OR band5 = ? OR band6 = ?",
+		bands[0], bands[1], bands[2], bands[3], bands[4], bands[5], bands[6]).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+	var postIDs []string
+	for _, candidate := range candidates {
+		if simhash.Distance(fingerprint, uint64(candidate.Fingerprint)) <= simhash.MaxDistance {
+			postIDs = append(postIDs, candidate.PostID)
 		}
-		fmt.Printf("New Post found, PostID: %s, Upvotes: %4d Comments: %4d, Author: %24s, Subreddit %12s, Title: %24s\n",
-			p.PostID, p.UpVotes, p.NumComments, p.Author, p.SubReddit, p.Title)
-		result = tx.Create(&dbAuthorStatistic)
-	} else if result.Error != nil {
-		tx.Rollback()
-		return result.Error
-	} else {
-		dbAuthorStatistic.TotalPosts++
-		dbAuthorStatistic.TotalUpvotes += p.UpVotes
-		dbAuthorStatistic.TotalComments += p.NumComments
-		result = tx.Save(&dbAuthorStatistic)
 	}
+	return postIDs, nil
+}
 
-	if result.Error != nil {
-		tx.Rollback()
-		return result.Error
+// GetPost returns a stored post with the original if it is a crosspost, gorm.ErrRecordNotFound if it is unknown
+func (s *DbStore) GetPost(postID string) (socialmedia.Post, error) {
+	var dbPost Post
+	err := s.DB.Where("post_id = ?", postID).First(&dbPost).Error
+	if err != nil {
+		return socialmedia.Post{}, err
+	}
+	post := s.TransformFromDBPost(&dbPost)
+	var crossposts []Crosspost
+	err = s.DB.Where("post_id = ?", postID).Limit(1).Find(&crossposts).Error
+	if err != nil {
+		return socialmedia.Post{}, err
+	}
+	if len(crossposts) > 0 {
+		parent := crossposts[0].parent()
+		post.CrosspostParent = &parent
 	}
+	return post, nil
+}
+
+// GetPostHistory returns the score snapshots of a post, oldest first
+func (s *DbStore) GetPostHistory(postID string) ([]socialmedia.PostSnapshot, error) {
+	var dbSnapshots []PostSnapshot
+	err := s.DB.Where("post_id = ?", postID).Order("created_at asc, id asc").Find(&dbSnapshots).Error
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]socialmedia.PostSnapshot, 0, len(dbSnapshots))
+	for _, snapshot := range dbSnapshots {
+		snapshots = append(snapshots, socialmedia.PostSnapshot{
+			PostID:      snapshot.PostID,
+			UpVotes:     snapshot.UpVotes,
+			NumComments: snapshot.NumComments,
+			Time:        snapshot.CreatedAt,
+		})
+	}
+	return snapshots, nil
+}
 
-	return tx.Commit().Error
+// SaveAuthorStatistic adds the post to its author's statistic in a transaction, a savepoint when called within SavePost's
+func (s *DbStore) SaveAuthorStatistic(p *socialmedia.Post) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		var dbAuthorStatistic AuthorStatistic
+		// Check if the author statistic already exists
+		result := tx.Where("author = ?", p.Author).First(&dbAuthorStatistic)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			dbAuthorStatistic = AuthorStatistic{
+				Author:        p.Author,
+				TotalPosts:    1,
+				TotalUpvotes:  p.UpVotes,
+				TotalComments: p.NumComments,
+			}
+			return tx.Create(&dbAuthorStatistic).Error
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		dbAuthorStatistic.TotalPosts++
+		dbAuthorStatistic.TotalUpvotes += p.UpVotes
+		dbAuthorStatistic.TotalComments += p.NumComments
+		return tx.Save(&dbAuthorStatistic).Error
+	})
 }
 
+// ClearPosts deletes the posts together with their snapshots and comments
 func (s *DbStore) ClearPosts() error {
-	return s.DB.Exec("DELETE FROM posts").Error
+	for _, table := range []string{"post_snapshots", "post_revisions", "crossposts", "post_links", "post_fingerprints", "listing_ranks", "listing_polls", "comments", "posts"} {
+		err := s.DB.Exec("DELETE FROM " + table).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
+// ClearAuthorStatistics deletes the author statistics and scores, the cached accounts are kept
 func (s *DbStore) ClearAuthorStatistics() error {
-	return s.DB.Exec("DELETE FROM author_statistics").Error
+	for _, table := range []string{"author_statistics", "author_scores"} {
+		err := s.DB.Exec("DELETE FROM " + table).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *DbStore) GetTopPoster() ([]socialmedia.AuthorStatistic, error) {
-	var topPosters []socialmedia.AuthorStatistic
-	var firstTopPoster socialmedia.AuthorStatistic
+	var topPosters []AuthorStatistic
+	var firstTopPoster AuthorStatistic
 
 	// First, retrieve the maximum total posts (highest poster)
-	err := s.DB.Order("total_posts desc").First(&firstTopPoster).Error
+	err := s.excludeBots(s.DB.Where("author <> ?", socialmedia.DeletedAuthor)).Order("total_posts desc").First(&firstTopPoster).Error
 	if err != nil {
 		return nil, err
 	}
 
 	// Find all autheors with the same maximum total posts (i.e. ties)
-	err = s.DB.Where("total_posts = ?", firstTopPoster.TotalPosts).Find(&topPosters).Error
+	err = s.excludeBots(s.DB.Where("total_posts = ? AND author <> ?", firstTopPoster.TotalPosts, socialmedia.DeletedAuthor)).Find(&topPosters).Error
 	if err != nil {
 		return nil, err
 	}
 
-	return topPosters, nil
+	return s.fromDBAuthorStatistics(topPosters)
 
 }
 func (s *DbStore) GetTopPosts() ([]socialmedia.Post, error) {
-	var posts []socialmedia.Post
-	var postWithMostUps socialmedia.Post
+	var dbPosts []Post
+	var postWithMostUps Post
 
 	// First, retrieve the post with the most upvotes
 	err := s.DB.Order("up_votes desc").First(&postWithMostUps).Error
@@ -221,9 +875,874 @@ func (s *DbStore) GetTopPosts() ([]socialmedia.Post, error) {
 	}
 
 	// Find all posts with the same number of upvotes in case there are multiple
-	err = s.DB.Where("up_votes = ?", postWithMostUps.UpVotes).Find(&posts).Error
+	err = s.DB.Where("up_votes = ?", postWithMostUps.UpVotes).Find(&dbPosts).Error
 	if err != nil {
 		return nil, err
 	}
+	posts := make([]socialmedia.Post, 0, len(dbPosts))
+	for _, dbPost := range dbPosts {
+		posts = append(posts, s.TransformFromDBPost(&dbPost))
+	}
 	return posts, nil
 }
+
+// GetLeadingPosts returns up to limit posts with the most upvotes, comments break ties
+func (s *DbStore) GetLeadingPosts(limit int) ([]socialmedia.Post, error) {
+	var dbPosts []Post
+	err := s.DB.Order("up_votes desc, num_comments desc, id asc").Limit(limit).Find(&dbPosts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]socialmedia.Post, 0, len(dbPosts))
+	for i := range dbPosts {
+		posts = append(posts, s.TransformFromDBPost(&dbPosts[i]))
+	}
+	return posts, nil
+}
+
+// GetLeadingAuthors returns up to limit authors with the most posts, upvotes break ties. Deleted authors are left out,
+// as are the suspected bots when ExcludeBots is set.
+func (s *DbStore) GetLeadingAuthors(limit int) ([]socialmedia.AuthorStatistic, error) {
+	var authors []AuthorStatistic
+	err := s.excludeBots(s.DB.Where("author <> ?", socialmedia.DeletedAuthor)).
+		Order("total_posts desc, total_upvotes desc, author asc").Limit(limit).Find(&authors).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.fromDBAuthorStatistics(authors)
+}
+
+// excludeBots leaves the suspected bots out of the query on a table with an author column when ExcludeBots is set
+func (s *DbStore) excludeBots(query *gorm.DB) *gorm.DB {
+	if !s.ExcludeBots {
+		return query
+	}
+	return query.Where("author NOT IN (?)", s.DB.Model(&AuthorScore{}).Select("author").Where("bot = ?", true))
+}
+
+// GetSubredditStatistics aggregates the stored posts per subreddit, busiest first
+func (s *DbStore) GetSubredditStatistics() ([]socialmedia.SubredditStatistic, error) {
+	var subreddits []socialmedia.SubredditStatistic
+	err := s.DB.Model(&Post{}).
+		Select("subreddit, count(*) as total_posts, sum(up_votes) as total_upvotes, sum(num_comments) as total_comments").
+		Group("subreddit").
+		Order("total_posts desc, subreddit asc").
+		Scan(&subreddits).Error
+	if err != nil {
+		return nil, err
+	}
+	return subreddits, nil
+}
+
+// GetPosts returns every stored post ordered by the time it was saved
+func (s *DbStore) GetPosts() ([]socialmedia.Post, error) {
+	var dbPosts []Post
+	err := s.DB.Order("created_at asc").Find(&dbPosts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	posts := make([]socialmedia.Post, 0, len(dbPosts))
+	for i := range dbPosts {
+		posts = append(posts, s.TransformFromDBPost(&dbPosts[i]))
+	}
+	return posts, nil
+}
+
+// GetSubreddits returns the persisted subreddit names in the order they were added
+func (s *DbStore) GetSubreddits() ([]string, error) {
+	var names []string
+	err := s.DB.Model(&Subreddit{}).Order("id asc").Pluck("name", &names).Error
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// AddSubreddit persists a subreddit name, adding an existing name is not an error
+func (s *DbStore) AddSubreddit(name string) error {
+	var existing Subreddit
+	err := s.DB.Where("name = ? COLLATE NOCASE", name).First(&existing).Error
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return s.DB.Create(&Subreddit{Name: name}).Error
+}
+
+// RemoveSubreddit deletes a persisted subreddit name, it returns gorm.ErrRecordNotFound if it was never added
+func (s *DbStore) RemoveSubreddit(name string) error {
+	result := s.DB.Unscoped().Where("name = ? COLLATE NOCASE", name).Delete(&Subreddit{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// StartSession records a new session and tags everything saved from now on with it
+func (s *DbStore) StartSession(subreddits []string) (store.Session, error) {
+	dbSession := &Session{Subreddits: strings.Join(subreddits, ",")}
+	err := s.DB.Create(dbSession).Error
+	if err != nil {
+		return store.Session{}, err
+	}
+	s.SessionID = dbSession.ID
+	return transformFromDBSession(dbSession), nil
+}
+
+// GetSessions returns every session, oldest first
+func (s *DbStore) GetSessions() ([]store.Session, error) {
+	var dbSessions []Session
+	err := s.DB.Order("id asc").Find(&dbSessions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]store.Session, 0, len(dbSessions))
+	for i := range dbSessions {
+		sessions = append(sessions, transformFromDBSession(&dbSessions[i]))
+	}
+	return sessions, nil
+}
+
+func transformFromDBSession(session *Session) store.Session {
+	var subreddits []string
+	if session.Subreddits != "" {
+		subreddits = strings.Split(session.Subreddits, ",")
+	}
+	return store.Session{ID: session.ID, Started: session.CreatedAt, Subreddits: subreddits}
+}
+
+// SaveComment stores a new comment with the sentiment of its body, which is set on the comment as well,
+// it returns store.ErrDuplicateComment if the comment is already stored
+func (s *DbStore) SaveComment(c *socialmedia.Comment) error {
+	defer s.observeWrite("save_comment", time.Now())
+	c.Sentiment = sentiment.Score(c.Body)
+	err := s.DB.Create(&Comment{
+		CommentID: c.CommentID,
+		PostID:    c.PostID,
+		ParentID:  c.ParentID,
+		Author:    c.Author,
+		Subreddit: c.SubReddit,
+		Body:      c.Body,
+		UpVotes:   c.UpVotes,
+		Created:   c.Created,
+		SessionID: s.SessionID,
+		Sentiment: c.Sentiment,
+	}).Error
+	if err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		return store.ErrDuplicateComment
+	}
+	return err
+}
+
+// eachBatchSize is how many rows the Each* methods load at a time
+const eachBatchSize = 500
+
+// filterColumns names the columns a store.Filter is applied to
+type filterColumns struct {
+	subreddit, time, session, backfilled, language, over18, stickied, mediaType, domain string
+}
+
+// postColumns are the columns of the posts table
+var postColumns = filterColumns{subreddit: "subreddit", time: "created", session: "session_id", backfilled: "backfilled",
+	language: "language", over18: "over18", stickied: "stickied", mediaType: "media_type", domain: "domain"}
+
+// postOnly is the part of the filter only the posts table holds the columns for
+func postOnly(filter store.Filter) store.Filter {
+	return store.Filter{ExcludeBackfilled: filter.ExcludeBackfilled, Language: filter.Language, Over18: filter.Over18,
+		Stickied: filter.Stickied, MediaType: filter.MediaType, Domain: filter.Domain}
+}
+
+// applyFilter adds the conditions of the filter to the query, times are compared with julianday
+// since sqlite stores them as text which may carry different utc offsets
+func applyFilter(query *gorm.DB, filter store.Filter, columns filterColumns) *gorm.DB {
+	if filter.Subreddit != "" {
+		query = query.Where(columns.subreddit+" = ? COLLATE NOCASE", filter.Subreddit)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("julianday("+columns.time+") >= julianday(?)", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("julianday("+columns.time+") < julianday(?)", filter.Until)
+	}
+	if filter.SessionID != 0 {
+		query = query.Where(columns.session+" = ?", filter.SessionID)
+	}
+	if filter.ExcludeBackfilled && columns.backfilled != "" {
+		query = query.Where(columns.backfilled+" = ?", false)
+	}
+	if filter.Language != "" && columns.language != "" {
+		query = query.Where(columns.language+" = ?", filter.Language)
+	}
+	if filter.Over18 != nil && columns.over18 != "" {
+		query = query.Where(columns.over18+" = ?", *filter.Over18)
+	}
+	if filter.Stickied != nil && columns.stickied != "" {
+		query = query.Where(columns.stickied+" = ?", *filter.Stickied)
+	}
+	if filter.MediaType != "" && columns.mediaType != "" {
+		query = query.Where(columns.mediaType+" = ?", filter.MediaType)
+	}
+	if filter.Domain != "" && columns.domain != "" {
+		query = query.Where(columns.domain+" = ? COLLATE NOCASE", filter.Domain)
+	}
+	return query
+}
+
+// EachPost calls fn for every post matching the filter in the order they were saved, loading them in batches
+func (s *DbStore) EachPost(filter store.Filter, fn func(socialmedia.Post) error) error {
+	var batch []Post
+	query := applyFilter(s.DB, filter, postColumns)
+	return query.FindInBatches(&batch, eachBatchSize, func(*gorm.DB, int) error {
+		for i := range batch {
+			err := fn(s.TransformFromDBPost(&batch[i]))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// EachPostSnapshot calls fn for every snapshot matching the filter in the order they were taken,
+// the subreddit and session are the ones of the snapshot's post
+func (s *DbStore) EachPostSnapshot(filter store.Filter, fn func(socialmedia.PostSnapshot) error) error {
+	var batch []PostSnapshot
+	query := s.DB.Model(&PostSnapshot{})
+	posts := postOnly(filter)
+	posts.Subreddit, posts.SessionID = filter.Subreddit, filter.SessionID
+	if posts != (store.Filter{}) {
+		query = query.Where("post_snapshots.post_id IN (?)", applyFilter(s.DB.Model(&Post{}).Select("post_id"), posts, postColumns))
+	}
+	query = applyFilter(query, store.Filter{Since: filter.Since, Until: filter.Until}, filterColumns{time: "post_snapshots.created_at"})
+	return query.FindInBatches(&batch, eachBatchSize, func(*gorm.DB, int) error {
+		for _, snapshot := range batch {
+			err := fn(socialmedia.PostSnapshot{
+				PostID:      snapshot.PostID,
+				UpVotes:     snapshot.UpVotes,
+				NumComments: snapshot.NumComments,
+				Time:        snapshot.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// EachComment calls fn for every comment matching the filter in the order they were saved,
+// the language, flags, media type and domain are the ones of the comment's post
+func (s *DbStore) EachComment(filter store.Filter, fn func(socialmedia.Comment) error) error {
+	var batch []Comment
+	query := applyFilter(s.DB, filter, filterColumns{subreddit: "subreddit", time: "created", session: "session_id"})
+	// the backfill only leaves out posts and snapshots
+	posts := postOnly(filter)
+	posts.ExcludeBackfilled = false
+	if posts != (store.Filter{}) {
+		query = query.Where("post_id IN (?)", applyFilter(s.DB.Model(&Post{}).Select("post_id"), posts, postColumns))
+	}
+	return query.FindInBatches(&batch, eachBatchSize, func(*gorm.DB, int) error {
+		for _, comment := range batch {
+			err := fn(socialmedia.Comment{
+				CommentID: comment.CommentID,
+				PostID:    comment.PostID,
+				ParentID:  comment.ParentID,
+				Author:    comment.Author,
+				Body:      comment.Body,
+				UpVotes:   comment.UpVotes,
+				Created:   comment.Created,
+				SubReddit: comment.Subreddit,
+				Sentiment: comment.Sentiment,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// GetAuthorStatistics aggregates the posts matching the filter per author, most posts first.
+// Unlike the author_statistics table the upvotes and comments are the current ones of the posts. Deleted authors are left out,
+// as are the suspected bots when ExcludeBots is set.
+func (s *DbStore) GetAuthorStatistics(filter store.Filter) ([]socialmedia.AuthorStatistic, error) {
+	var authors []AuthorStatistic
+	query := applyFilter(s.DB.Model(&Post{}), filter, postColumns).
+		Select("author, count(*) as total_posts, sum(up_votes) as total_upvotes, sum(num_comments) as total_comments").
+		Where("author <> ?", socialmedia.DeletedAuthor).
+		Group("author").
+		Order("total_posts desc, total_upvotes desc, author asc")
+	err := s.excludeBots(query).Scan(&authors).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.fromDBAuthorStatistics(authors)
+}
+
+// GetImportCheckpoint returns the checkpoint of the source, an empty checkpoint if it was never imported
+func (s *DbStore) GetImportCheckpoint(source string) (store.ImportCheckpoint, error) {
+	var checkpoint ImportCheckpoint
+	err := s.DB.Where("source = ?", source).First(&checkpoint).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return store.ImportCheckpoint{Source: source}, nil
+	}
+	if err != nil {
+		return store.ImportCheckpoint{}, err
+	}
+	return store.ImportCheckpoint{Source: checkpoint.Source, Size: checkpoint.Size, Line: checkpoint.Line, Done: checkpoint.Done}, nil
+}
+
+// SaveImportCheckpoint creates or replaces the checkpoint of its source
+func (s *DbStore) SaveImportCheckpoint(c store.ImportCheckpoint) error {
+	var checkpoint ImportCheckpoint
+	err := s.DB.Where("source = ?", c.Source).First(&checkpoint).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	checkpoint.Source, checkpoint.Size, checkpoint.Line, checkpoint.Done = c.Source, c.Size, c.Line, c.Done
+	return s.DB.Save(&checkpoint).Error
+}
+
+// RecordListingRanks stores the ranks of a fetched listing page, postIDs in listing order, and when it was polled.
+// Only changes are written: posts that are new to the listing or moved, and posts that left it with rank 0.
+// It returns the number of changes.
+func (s *DbStore) RecordListingRanks(subreddit, listing string, postIDs []string, polled time.Time) (int, error) {
+	defer s.observeWrite("record_listing_ranks", time.Now())
+	current, err := s.currentListingRanks(subreddit, listing)
+	if err != nil {
+		return 0, err
+	}
+
+	var changes []ListingRank
+	for i, postID := range postIDs {
+		rank, found := current[postID]
+		delete(current, postID)
+		if found && rank == i+1 {
+			continue
+		}
+		changes = append(changes, ListingRank{Subreddit: subreddit, Listing: listing, PostID: postID, Rank: i + 1, Time: polled})
+	}
+	for _, postID := range slices.Sorted(maps.Keys(current)) {
+		changes = append(changes, ListingRank{Subreddit: subreddit, Listing: listing, PostID: postID, Rank: 0, Time: polled})
+	}
+
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if len(changes) > 0 {
+			err := tx.Create(&changes).Error
+			if err != nil {
+				return err
+			}
+		}
+		var poll ListingPoll
+		return tx.Where(ListingPoll{Subreddit: subreddit, Listing: listing}).
+			Assign(ListingPoll{Polled: polled}).
+			FirstOrCreate(&poll).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(changes), nil
+}
+
+// currentListingRanks maps the posts that are on the listing to their latest rank
+func (s *DbStore) currentListingRanks(subreddit, listing string) (map[string]int, error) {
+	var latest []ListingRank
+	err := s.DB.Where("id IN (?)",
+		s.DB.Model(&ListingRank{}).Select("max(id)").
+			Where("subreddit = ? AND listing = ?", subreddit, listing).
+			Group("post_id")).
+		Where("rank > 0").
+		Find(&latest).Error
+	if err != nil {
+		return nil, err
+	}
+	ranks := make(map[string]int, len(latest))
+	for _, rank := range latest {
+		ranks[rank.PostID] = rank.Rank
+	}
+	return ranks, nil
+}
+
+// GetListingHistory returns the rank changes of a subreddit listing in the order they were recorded,
+// the subreddit is compared case-insensitively. A listing that was never polled has no ranks and a zero Polled.
+func (s *DbStore) GetListingHistory(subreddit, listing string) (socialmedia.ListingHistory, error) {
+	history := socialmedia.ListingHistory{Subreddit: subreddit, Listing: listing}
+	var poll ListingPoll
+	err := s.DB.Where("subreddit = ? COLLATE NOCASE AND listing = ?", subreddit, listing).First(&poll).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return history, nil
+	}
+	if err != nil {
+		return history, err
+	}
+	history.Subreddit, history.Polled = poll.Subreddit, poll.Polled
+
+	var batch []ListingRank
+	err = s.DB.Where("subreddit = ? AND listing = ?", poll.Subreddit, listing).
+		FindInBatches(&batch, eachBatchSize, func(*gorm.DB, int) error {
+			for _, rank := range batch {
+				history.Ranks = append(history.Ranks, socialmedia.ListingRank{PostID: rank.PostID, Rank: rank.Rank, Time: rank.Time})
+			}
+			return nil
+		}).Error
+	return history, err
+}
+
+func (c Crosspost) parent() socialmedia.CrosspostParent {
+	return socialmedia.CrosspostParent{PostID: c.ParentID, Subreddit: c.ParentSubreddit, Author: c.ParentAuthor, Title: c.ParentTitle,
+		URL: c.ParentURL, Created: c.ParentCreated, NumCrossposts: c.ParentNumCrossposts}
+}
+
+// GetMostCrossposted returns up to limit originals with the most stored crossposts, the ones reddit reports more crossposts for
+// first on a tie. The details of an original are the ones of its latest crosspost.
+func (s *DbStore) GetMostCrossposted(limit int) ([]socialmedia.CrosspostStatistic, error) {
+	var counts []struct {
+		ParentID   string
+		Crossposts int
+		Subreddits string
+	}
+	err := s.DB.Model(&Crosspost{}).
+		Select("parent_id, COUNT(*) AS crossposts, GROUP_CONCAT(DISTINCT subreddit) AS subreddits").
+		Group("parent_id").
+		Order("crossposts desc, MAX(parent_num_crossposts) desc, parent_id").
+		Limit(limit).
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	parentIDs := make([]string, 0, len(counts))
+	for _, count := range counts {
+		parentIDs = append(parentIDs, count.ParentID)
+	}
+	var crossposts []Crosspost
+	err = s.DB.Where("parent_id IN ?", parentIDs).Order("id asc").Find(&crossposts).Error
+	if err != nil {
+		return nil, err
+	}
+	parents := make(map[string]socialmedia.CrosspostParent, len(counts))
+	for _, crosspost := range crossposts {
+		parent := crosspost.parent()
+		parent.NumCrossposts = max(parent.NumCrossposts, parents[parent.PostID].NumCrossposts)
+		parents[parent.PostID] = parent
+	}
+
+	statistics := make([]socialmedia.CrosspostStatistic, 0, len(counts))
+	for _, count := range counts {
+		subreddits := strings.Split(count.Subreddits, ",")
+		slices.Sort(subreddits)
+		statistics = append(statistics, socialmedia.CrosspostStatistic{CrosspostParent: parents[count.ParentID],
+			Crossposts: count.Crossposts, Subreddits: subreddits})
+	}
+	return statistics, nil
+}
+
+// GetSubredditFeeds returns up to limit pairs of subreddits where posts moved from one to the other, the busiest first.
+// Crossposts count for the subreddit of the original, shared links for the subreddit the link was posted in first.
+func (s *DbStore) GetSubredditFeeds(limit int) ([]socialmedia.SubredditFeed, error) {
+	type feedCount struct {
+		From  string
+		To    string
+		Count int
+	}
+	var crossposts, sharedLinks []feedCount
+	err := s.DB.Model(&Crosspost{}).
+		Select(`parent_subreddit AS "from", subreddit AS "to", COUNT(*) AS count`).
+		Where("parent_subreddit <> subreddit").
+		Group("parent_subreddit, subreddit").
+		Scan(&crossposts).Error
+	if err != nil {
+		return nil, err
+	}
+	err = s.DB.Raw(`SELECT f.subreddit AS "from", l.subreddit AS "to", COUNT(*) AS count
+		FROM post_links l
+		JOIN post_links f ON f.post_id = (SELECT o.post_id FROM post_links o WHERE o.url = l.url ORDER BY o.created, o.id LIMIT 1)
+		WHERE l.post_id <> f.post_id AND l.subreddit <> f.subreddit
+		GROUP BY f.subreddit, l.subreddit`).
+		Scan(&sharedLinks).Error
+	if err != nil {
+		return nil, err
+	}
+
+	feeds := make(map[[2]string]*socialmedia.SubredditFeed)
+	feed := func(count feedCount) *socialmedia.SubredditFeed {
+		key := [2]string{count.From, count.To}
+		if feeds[key] == nil {
+			feeds[key] = &socialmedia.SubredditFeed{From: count.From, To: count.To}
+		}
+		return feeds[key]
+	}
+	for _, count := range crossposts {
+		feed(count).Crossposts = count.Count
+	}
+	for _, count := range sharedLinks {
+		feed(count).SharedLinks = count.Count
+	}
+	result := make([]socialmedia.SubredditFeed, 0, len(feeds))
+	for _, f := range feeds {
+		result = append(result, *f)
+	}
+	slices.SortFunc(result, func(a, b socialmedia.SubredditFeed) int {
+		return cmp.Or(
+			cmp.Compare(b.Crossposts+b.SharedLinks, a.Crossposts+a.SharedLinks),
+			cmp.Compare(a.From, b.From),
+			cmp.Compare(a.To, b.To),
+		)
+	})
+	return result[:min(limit, len(result))], nil
+}
+
+// GetRepostClusters returns up to limit posts with their reposts, the most reposted first and the most recently reposted on a tie
+func (s *DbStore) GetRepostClusters(limit int) ([]socialmedia.RepostCluster, error) {
+	var roots []string
+	err := s.DB.Model(&Post{}).
+		Where("repost_of <> ''").
+		Group("repost_of").
+		Order("COUNT(*) desc, MAX(created) desc, repost_of").
+		Limit(limit).
+		Pluck("repost_of", &roots).Error
+	if err != nil {
+		return nil, err
+	}
+	var dbPosts []Post
+	err = s.DB.Where("post_id IN ? OR repost_of IN ?", roots, roots).Order("created asc, id asc").Find(&dbPosts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := make(map[string]*socialmedia.RepostCluster, len(roots))
+	for _, root := range roots {
+		clusters[root] = &socialmedia.RepostCluster{}
+	}
+	for _, dbPost := range dbPosts {
+		post := s.TransformFromDBPost(&dbPost)
+		if post.RepostOf == "" {
+			clusters[post.PostID].Original = post
+		} else {
+			clusters[post.RepostOf].Reposts = append(clusters[post.RepostOf].Reposts, post)
+		}
+		if cluster := clusters[cmp.Or(post.RepostOf, post.PostID)]; !slices.Contains(cluster.Subreddits, post.SubReddit) {
+			cluster.Subreddits = append(cluster.Subreddits, post.SubReddit)
+		}
+	}
+	result := make([]socialmedia.RepostCluster, 0, len(roots))
+	for _, root := range roots {
+		slices.Sort(clusters[root].Subreddits)
+		result = append(result, *clusters[root])
+	}
+	return result, nil
+}
+
+// GetReposts returns up to limit links posted more than once, the most posted first and the most recently posted on a tie
+func (s *DbStore) GetReposts(limit int) ([]socialmedia.Repost, error) {
+	var urls []string
+	err := s.DB.Model(&PostLink{}).
+		Group("url").
+		Having("COUNT(*) > 1").
+		Order("COUNT(*) desc, MAX(created) desc, url").
+		Limit(limit).
+		Pluck("url", &urls).Error
+	if err != nil {
+		return nil, err
+	}
+	var links []PostLink
+	err = s.DB.Where("url IN ?", urls).Order("created asc, id asc").Find(&links).Error
+	if err != nil {
+		return nil, err
+	}
+	postIDs := make([]string, 0, len(links))
+	for _, link := range links {
+		postIDs = append(postIDs, link.PostID)
+	}
+	var dbPosts []Post
+	err = s.DB.Where("post_id IN ?", postIDs).Find(&dbPosts).Error
+	if err != nil {
+		return nil, err
+	}
+	posts := make(map[string]socialmedia.Post, len(dbPosts))
+	for _, dbPost := range dbPosts {
+		posts[dbPost.PostID] = s.TransformFromDBPost(&dbPost)
+	}
+
+	byURL := make(map[string][]socialmedia.Post, len(urls))
+	for _, link := range links {
+		if post, found := posts[link.PostID]; found {
+			byURL[link.URL] = append(byURL[link.URL], post)
+		}
+	}
+	reposts := make([]socialmedia.Repost, 0, len(urls))
+	for _, u := range urls {
+		reposts = append(reposts, socialmedia.Repost{URL: u, Posts: byURL[u]})
+	}
+	return reposts, nil
+}
+
+// GetAccount returns the cached profile of the user, names are compared case-insensitively.
+// gorm.ErrRecordNotFound is returned when it was never fetched.
+func (s *DbStore) GetAccount(name string) (socialmedia.Account, error) {
+	var author Author
+	err := s.DB.Where("name = ? COLLATE NOCASE", name).First(&author).Error
+	if err != nil {
+		return socialmedia.Account{}, err
+	}
+	return author.account(), nil
+}
+
+// SaveAccount caches the profile of a user, replacing the one fetched before
+func (s *DbStore) SaveAccount(a socialmedia.Account) error {
+	defer s.observeWrite("save_account", time.Now())
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("name = ? COLLATE NOCASE", a.Name).Delete(&Author{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&Author{
+			Name:         a.Name,
+			Created:      a.Created,
+			LinkKarma:    a.LinkKarma,
+			CommentKarma: a.CommentKarma,
+			IsMod:        a.IsMod,
+			IsGold:       a.IsGold,
+			Suspended:    a.Suspended,
+			NotFound:     a.NotFound,
+			Fetched:      a.Fetched,
+		}).Error
+	})
+}
+
+func (a Author) account() socialmedia.Account {
+	return socialmedia.Account{
+		Name:         a.Name,
+		Created:      a.Created,
+		LinkKarma:    a.LinkKarma,
+		CommentKarma: a.CommentKarma,
+		IsMod:        a.IsMod,
+		IsGold:       a.IsGold,
+		Suspended:    a.Suspended,
+		NotFound:     a.NotFound,
+		Fetched:      a.Fetched,
+	}
+}
+
+// fromDBAuthorStatistics converts the author statistics, joined with the cached profiles of the authors
+func (s *DbStore) fromDBAuthorStatistics(rows []AuthorStatistic) ([]socialmedia.AuthorStatistic, error) {
+	names := make([]string, 0, len(rows))
+	for _, row := range rows {
+		names = append(names, strings.ToLower(row.Author))
+	}
+	accounts := make(map[string]socialmedia.Account, len(rows))
+	for batch := range slices.Chunk(names, eachBatchSize) {
+		var authors []Author
+		err := s.DB.Where("lower(name) IN ?", batch).Find(&authors).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, author := range authors {
+			accounts[strings.ToLower(author.Name)] = author.account()
+		}
+	}
+
+	statistics := make([]socialmedia.AuthorStatistic, 0, len(rows))
+	for _, row := range rows {
+		statistic := socialmedia.AuthorStatistic{
+			Author:        row.Author,
+			TotalPosts:    row.TotalPosts,
+			TotalUpvotes:  row.TotalUpvotes,
+			TotalComments: row.TotalComments,
+		}
+		if account, found := accounts[strings.ToLower(row.Author)]; found {
+			statistic.Account = &account
+		}
+		statistics = append(statistics, statistic)
+	}
+	return statistics, nil
+}
+
+// SaveAuthorScores stores the scores, replacing the previous scores of the same authors
+func (s *DbStore) SaveAuthorScores(scores []socialmedia.AuthorScore) error {
+	defer s.observeWrite("save_author_scores", time.Now())
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		for batch := range slices.Chunk(scores, eachBatchSize) {
+			authors := make([]string, 0, len(batch))
+			rows := make([]AuthorScore, 0, len(batch))
+			for _, score := range batch {
+				authors = append(authors, score.Author)
+				rows = append(rows, AuthorScore{
+					Author:         score.Author,
+					Score:          score.Score,
+					Bot:            score.Bot,
+					Posts:          score.Posts,
+					Cadence:        score.Cadence,
+					RepeatedTitles: score.RepeatedTitles,
+					Account:        score.Account,
+					Name:           score.Name,
+					Scored:         score.Scored,
+				})
+			}
+			err := tx.Where("author IN ?", authors).Delete(&AuthorScore{}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Create(&rows).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetAuthorScore returns the stored score of the author, gorm.ErrRecordNotFound is returned when it wasn't scored yet
+func (s *DbStore) GetAuthorScore(author string) (socialmedia.AuthorScore, error) {
+	var score AuthorScore
+	err := s.DB.Where("author = ?", author).First(&score).Error
+	if err != nil {
+		return socialmedia.AuthorScore{}, err
+	}
+	return fromDBAuthorScore(score), nil
+}
+
+// GetSuspectedBots returns up to limit authors scored as suspected bots, the highest score first and the most posts on a tie
+func (s *DbStore) GetSuspectedBots(limit int) ([]socialmedia.AuthorScore, error) {
+	var rows []AuthorScore
+	err := s.DB.Where("bot = ?", true).Order("score desc, posts desc, author asc").Limit(limit).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	scores := make([]socialmedia.AuthorScore, 0, len(rows))
+	for _, row := range rows {
+		scores = append(scores, fromDBAuthorScore(row))
+	}
+	return scores, nil
+}
+
+func fromDBAuthorScore(score AuthorScore) socialmedia.AuthorScore {
+	return socialmedia.AuthorScore{
+		Author:         score.Author,
+		Score:          score.Score,
+		Bot:            score.Bot,
+		Posts:          score.Posts,
+		Cadence:        score.Cadence,
+		RepeatedTitles: score.RepeatedTitles,
+		Account:        score.Account,
+		Name:           score.Name,
+		Scored:         score.Scored,
+	}
+}
+
+// EnqueueWebhookDeliveries queues the deliveries of one event. An event with a key is only queued once,
+// false is returned without writing anything when its key was queued before.
+func (s *DbStore) EnqueueWebhookDeliveries(eventKey string, deliveries []store.WebhookDelivery) (bool, error) {
+	defer s.observeWrite("enqueue_webhook_deliveries", time.Now())
+	queued := false
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if eventKey != "" {
+			var count int64
+			err := tx.Model(&WebhookDelivery{}).Where("event_key = ?", eventKey).Count(&count).Error
+			if err != nil || count > 0 {
+				return err
+			}
+		}
+		dbDeliveries := make([]WebhookDelivery, 0, len(deliveries))
+		for _, d := range deliveries {
+			d.EventKey = eventKey
+			dbDeliveries = append(dbDeliveries, toDBDelivery(d))
+		}
+		if len(dbDeliveries) > 0 {
+			err := tx.Create(&dbDeliveries).Error
+			if err != nil {
+				return err
+			}
+		}
+		queued = true
+		return nil
+	})
+	return queued, err
+}
+
+// DueWebhookDeliveries returns up to limit pending deliveries whose next attempt is due, the most overdue first
+func (s *DbStore) DueWebhookDeliveries(now time.Time, limit int) ([]store.WebhookDelivery, error) {
+	var dbDeliveries []WebhookDelivery
+	err := s.DB.Where("status = ? AND julianday(next_attempt) <= julianday(?)", store.DeliveryPending, now).
+		Order("next_attempt asc, id asc").Limit(limit).Find(&dbDeliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return fromDBDeliveries(dbDeliveries), nil
+}
+
+// UpdateWebhookDelivery stores the outcome of a delivery attempt
+func (s *DbStore) UpdateWebhookDelivery(d store.WebhookDelivery) error {
+	defer s.observeWrite("update_webhook_delivery", time.Now())
+	return s.DB.Model(&WebhookDelivery{Model: gorm.Model{ID: d.ID}}).Updates(map[string]any{
+		"status":          d.Status,
+		"attempts":        d.Attempts,
+		"next_attempt":    d.NextAttempt,
+		"last_error":      d.LastError,
+		"response_status": d.ResponseStatus,
+	}).Error
+}
+
+// GetWebhookDeliveries returns the delivery log matching the filter, the newest first
+func (s *DbStore) GetWebhookDeliveries(filter store.DeliveryFilter) ([]store.WebhookDelivery, error) {
+	query := s.DB.Order("id desc")
+	if filter.Endpoint != "" {
+		query = query.Where("endpoint = ?", filter.Endpoint)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	var dbDeliveries []WebhookDelivery
+	err := query.Find(&dbDeliveries).Error
+	if err != nil {
+		return nil, err
+	}
+	return fromDBDeliveries(dbDeliveries), nil
+}
+
+func toDBDelivery(d store.WebhookDelivery) WebhookDelivery {
+	return WebhookDelivery{
+		Endpoint:       d.Endpoint,
+		URL:            d.URL,
+		Event:          d.Event,
+		EventKey:       d.EventKey,
+		Payload:        string(d.Payload),
+		Status:         d.Status,
+		NextAttempt:    d.NextAttempt,
+		Attempts:       d.Attempts,
+		LastError:      d.LastError,
+		ResponseStatus: d.ResponseStatus,
+	}
+}
+
+func fromDBDeliveries(dbDeliveries []WebhookDelivery) []store.WebhookDelivery {
+	deliveries := make([]store.WebhookDelivery, 0, len(dbDeliveries))
+	for _, d := range dbDeliveries {
+		deliveries = append(deliveries, store.WebhookDelivery{
+			ID:             d.ID,
+			Endpoint:       d.Endpoint,
+			URL:            d.URL,
+			Event:          d.Event,
+			EventKey:       d.EventKey,
+			Payload:        []byte(d.Payload),
+			Status:         d.Status,
+			Attempts:       d.Attempts,
+			NextAttempt:    d.NextAttempt,
+			LastError:      d.LastError,
+			ResponseStatus: d.ResponseStatus,
+			Created:        d.CreatedAt,
+			Updated:        d.UpdatedAt,
+		})
+	}
+	return deliveries
+}
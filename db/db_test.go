@@ -1,7 +1,10 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"github.com/Valimere/donkey/socialmedia"
+	storepkg "github.com/Valimere/donkey/store"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/oauth2"
 	"log"
@@ -28,7 +31,7 @@ func setupTestDB() *gorm.DB {
 	if err != nil {
 		log.Fatalf("Could not open db: %v", err)
 	}
-	if err := db.AutoMigrate(&Token{}, &Post{}, &AuthorStatistic{}); err != nil {
+	if err := Migrate(db); err != nil {
 		log.Fatalf("Could not migrate db: %v", err)
 	}
 	return db
@@ -38,6 +41,27 @@ func clearTables(db *gorm.DB) {
 	db.Exec("DELETE FROM tokens")
 	db.Exec("DELETE FROM posts")
 	db.Exec("DELETE FROM author_statistics")
+	db.Exec("DELETE FROM subreddits")
+	db.Exec("DELETE FROM post_snapshots")
+	db.Exec("DELETE FROM comments")
+	db.Exec("DELETE FROM sessions")
+	db.Exec("DELETE FROM import_checkpoints")
+	db.Exec("DELETE FROM listing_ranks")
+	db.Exec("DELETE FROM listing_polls")
+	db.Exec("DELETE FROM webhook_deliveries")
+	db.Exec("DELETE FROM post_revisions")
+	db.Exec("DELETE FROM crossposts")
+	db.Exec("DELETE FROM post_links")
+	db.Exec("DELETE FROM post_fingerprints")
+	db.Exec("DELETE FROM authors")
+	db.Exec("DELETE FROM author_scores")
+}
+
+func TestPing(t *testing.T) {
+	db := setupTestDB()
+
+	store := DbStore{DB: db}
+	assert.NoError(t, store.Ping(context.Background()))
 }
 
 func TestSaveToken(t *testing.T) {
@@ -86,10 +110,68 @@ func TestSavePost(t *testing.T) {
 		Title:       "Test Post",
 		UpVotes:     100,
 		NumComments: 10,
+		Score:       100,
+		UpvoteRatio: 0.93,
+		Permalink:   "/r/test_sub/comments/1/test_post/",
+		URL:         "https://i.redd.it/donkey.png",
+		Domain:      "i.redd.it",
+		Spoiler:     true,
+		AuthorFlair: "regular",
+		TotalAwards: 2,
+		MediaType:   socialmedia.MediaImage,
+		State:       socialmedia.PostActive,
 	}
 
 	err := store.SavePost(post)
 	assert.NoError(t, err)
+	stored, err := store.GetPost("1")
+	assert.NoError(t, err)
+	assert.Equal(t, *post, stored)
+}
+
+func TestSaveDuplicatePost(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	post := &socialmedia.Post{PostID: "1", Author: "test_user", UpVotes: 10}
+
+	assert.NoError(t, store.SavePost(post))
+	assert.ErrorIs(t, store.SavePost(post), storepkg.ErrDuplicatePost)
+
+	// the author statistic is only counted once
+	topPosters, err := store.GetTopPoster()
+	assert.NoError(t, err)
+	assert.Len(t, topPosters, 1)
+	assert.Equal(t, 1, topPosters[0].TotalPosts)
+}
+
+func TestSavePostAtomic(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	post := &socialmedia.Post{PostID: "1", Author: "a", Title: "Donkey", URL: "https://go.dev/blog", Domain: "go.dev"}
+
+	// a failed follow-up write leaves nothing behind, so the post isn't taken for a duplicate later
+	assert.NoError(t, db.Migrator().DropTable(&AuthorStatistic{}))
+	assert.Error(t, store.SavePost(post))
+	_, err := store.GetPost("1")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	for _, model := range []any{&PostSnapshot{}, &PostLink{}, &PostFingerprint{}} {
+		var count int64
+		assert.NoError(t, db.Model(model).Count(&count).Error)
+		assert.Zero(t, count)
+	}
+
+	assert.NoError(t, Migrate(db))
+	assert.NoError(t, store.SavePost(post))
+	var statistics int64
+	assert.NoError(t, db.Model(&AuthorStatistic{}).Count(&statistics).Error)
+	assert.Equal(t, int64(1), statistics)
+	var links int64
+	assert.NoError(t, db.Model(&PostLink{}).Count(&links).Error)
+	assert.Equal(t, int64(1), links)
 }
 
 func TestClearPosts(t *testing.T) {
@@ -161,3 +243,763 @@ func TestGetTopPost(t *testing.T) {
 	assert.Equal(t, expectedPost.PostID, topPosts[0].PostID)
 	assert.Equal(t, expectedPost.UpVotes, topPosts[0].UpVotes)
 }
+
+func TestDeleteTokens(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	store.SaveToken(&oauth2.Token{AccessToken: "access-token"})
+
+	err := store.DeleteTokens()
+	assert.NoError(t, err)
+
+	_, err = store.GetToken()
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestGetPosts(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	store.SavePost(&socialmedia.Post{PostID: "1", Author: "a", SubReddit: "music", UpVotes: 5})
+	store.SavePost(&socialmedia.Post{PostID: "2", Author: "b", SubReddit: "movies", UpVotes: 7})
+
+	posts, err := store.GetPosts()
+	assert.NoError(t, err)
+	assert.Len(t, posts, 2)
+	assert.Equal(t, "1", posts[0].PostID)
+	assert.Equal(t, "music", posts[0].SubReddit)
+	assert.Equal(t, 7, posts[1].UpVotes)
+}
+
+func TestSubreddits(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	assert.NoError(t, store.AddSubreddit("music"))
+	assert.NoError(t, store.AddSubreddit("movies"))
+	// adding the same subreddit again, in any case, is a no-op
+	assert.NoError(t, store.AddSubreddit("Music"))
+
+	subreddits, err := store.GetSubreddits()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"music", "movies"}, subreddits)
+
+	assert.NoError(t, store.RemoveSubreddit("MUSIC"))
+	assert.ErrorIs(t, store.RemoveSubreddit("music"), gorm.ErrRecordNotFound)
+
+	subreddits, err = store.GetSubreddits()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"movies"}, subreddits)
+
+	// a removed subreddit can be added again
+	assert.NoError(t, store.AddSubreddit("music"))
+}
+
+func TestLeaderboards(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	store.SavePost(&socialmedia.Post{PostID: "1", Author: "a", SubReddit: "music", UpVotes: 5, NumComments: 1})
+	store.SavePost(&socialmedia.Post{PostID: "2", Author: "b", SubReddit: "music", UpVotes: 50, NumComments: 2})
+	store.SavePost(&socialmedia.Post{PostID: "3", Author: "a", SubReddit: "movies", UpVotes: 20, NumComments: 3})
+
+	posts, err := store.GetLeadingPosts(2)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 2)
+	assert.Equal(t, "2", posts[0].PostID)
+	assert.Equal(t, "3", posts[1].PostID)
+
+	authors, err := store.GetLeadingAuthors(10)
+	assert.NoError(t, err)
+	assert.Len(t, authors, 2)
+	assert.Equal(t, "a", authors[0].Author)
+	assert.Equal(t, 2, authors[0].TotalPosts)
+	assert.Equal(t, 25, authors[0].TotalUpvotes)
+
+	subreddits, err := store.GetSubredditStatistics()
+	assert.NoError(t, err)
+	assert.Equal(t, []socialmedia.SubredditStatistic{
+		{Subreddit: "music", TotalPosts: 2, TotalUpvotes: 55, TotalComments: 3},
+		{Subreddit: "movies", TotalPosts: 1, TotalUpvotes: 20, TotalComments: 3},
+	}, subreddits)
+}
+
+func TestPostHistory(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	post := &socialmedia.Post{PostID: "1", Author: "test_user", UpVotes: 1}
+	assert.NoError(t, store.SavePost(post))
+
+	// an unchanged score doesn't add a snapshot
+	changed, err := store.UpdatePostScore(post)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	post.UpVotes, post.NumComments = 5, 2
+	changed, err = store.UpdatePostScore(post)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	history, err := store.GetPostHistory("1")
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, 1, history[0].UpVotes)
+	assert.Equal(t, 5, history[1].UpVotes)
+	assert.Equal(t, 2, history[1].NumComments)
+
+	stored, err := store.GetPost("1")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, stored.UpVotes)
+
+	// the other listing fields are refreshed as well, without a snapshot while the upvotes and comments stay
+	post.Score, post.UpvoteRatio, post.Flair, post.Over18, post.Stickied, post.Locked = 4, 0.8, "solved", true, true, true
+	post.TotalAwards, post.Gilded, post.NumCrossposts, post.Distinguished = 2, 1, 3, "moderator"
+	changed, err = store.UpdatePostScore(post)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	stored, err = store.GetPost("1")
+	assert.NoError(t, err)
+	post.State = socialmedia.PostActive
+	assert.Equal(t, *post, stored)
+	history, err = store.GetPostHistory("1")
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	_, err = store.UpdatePostScore(&socialmedia.Post{PostID: "2"})
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestSessions(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	first, err := store.StartSession([]string{"music", "movies"})
+	assert.NoError(t, err)
+	assert.NoError(t, store.SavePost(&socialmedia.Post{PostID: "1", Author: "a"}))
+	second, err := store.StartSession([]string{"music"})
+	assert.NoError(t, err)
+	assert.NoError(t, store.SavePost(&socialmedia.Post{PostID: "2", Author: "a"}))
+
+	sessions, err := store.GetSessions()
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, []string{"music", "movies"}, sessions[0].Subreddits)
+
+	var ids []string
+	err = store.EachPost(storepkg.Filter{SessionID: first.ID}, func(p socialmedia.Post) error {
+		ids = append(ids, p.PostID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+	assert.NotEqual(t, first.ID, second.ID)
+}
+
+func TestEachPostFilter(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	base := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	posts := []socialmedia.Post{
+		{PostID: "1", Author: "a", SubReddit: "music", Created: base},
+		// the same instant as an hour later in utc, stored with a different offset
+		{PostID: "2", Author: "b", SubReddit: "Music", Created: base.Add(time.Hour).In(time.FixedZone("EDT", -4*3600))},
+		{PostID: "3", Author: "a", SubReddit: "movies", Created: base.Add(2 * time.Hour)},
+	}
+	for i := range posts {
+		assert.NoError(t, store.SavePost(&posts[i]))
+	}
+
+	collect := func(filter storepkg.Filter) []string {
+		var ids []string
+		err := store.EachPost(filter, func(p socialmedia.Post) error {
+			ids = append(ids, p.PostID)
+			return nil
+		})
+		assert.NoError(t, err)
+		return ids
+	}
+	assert.Equal(t, []string{"1", "2", "3"}, collect(storepkg.Filter{}))
+	assert.Equal(t, []string{"1", "2"}, collect(storepkg.Filter{Subreddit: "music"}))
+	assert.Equal(t, []string{"2", "3"}, collect(storepkg.Filter{Since: base.Add(30 * time.Minute)}))
+	assert.Equal(t, []string{"2"}, collect(storepkg.Filter{Since: base.Add(time.Hour), Until: base.Add(2 * time.Hour)}))
+
+	stopped := errors.New("stop")
+	err := store.EachPost(storepkg.Filter{}, func(socialmedia.Post) error { return stopped })
+	assert.ErrorIs(t, err, stopped)
+
+	authors, err := store.GetAuthorStatistics(storepkg.Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", authors[0].Author)
+	assert.Equal(t, 2, authors[0].TotalPosts)
+}
+
+func TestEachPostSnapshot(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	assert.NoError(t, store.SavePost(&socialmedia.Post{PostID: "1", Author: "a", SubReddit: "music"}))
+	assert.NoError(t, store.SavePost(&socialmedia.Post{PostID: "2", Author: "a", SubReddit: "movies"}))
+
+	var ids []string
+	err := store.EachPostSnapshot(storepkg.Filter{Subreddit: "movies"}, func(s socialmedia.PostSnapshot) error {
+		ids = append(ids, s.PostID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids)
+}
+
+func TestExcludeBackfilled(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	assert.NoError(t, store.SavePost(&socialmedia.Post{PostID: "1", Author: "a", SubReddit: "music", Backfilled: true}))
+	assert.NoError(t, store.SavePost(&socialmedia.Post{PostID: "2", Author: "b", SubReddit: "music"}))
+
+	post, err := store.GetPost("1")
+	assert.NoError(t, err)
+	assert.True(t, post.Backfilled)
+
+	var ids []string
+	err = store.EachPost(storepkg.Filter{ExcludeBackfilled: true}, func(p socialmedia.Post) error {
+		ids = append(ids, p.PostID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids)
+
+	ids = nil
+	err = store.EachPostSnapshot(storepkg.Filter{ExcludeBackfilled: true}, func(s socialmedia.PostSnapshot) error {
+		ids = append(ids, s.PostID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids)
+
+	authors, err := store.GetAuthorStatistics(storepkg.Filter{ExcludeBackfilled: true})
+	assert.NoError(t, err)
+	assert.Len(t, authors, 1)
+	assert.Equal(t, "b", authors[0].Author)
+}
+
+func TestListingFilter(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	posts := []socialmedia.Post{
+		{PostID: "1", Author: "a", SubReddit: "pics", Over18: true, MediaType: socialmedia.MediaImage, Domain: "i.redd.it"},
+		{PostID: "2", Author: "b", SubReddit: "pics", Stickied: true, IsSelf: true, MediaType: socialmedia.MediaSelf, Domain: "self.pics"},
+		{PostID: "3", Author: "b", SubReddit: "pics", MediaType: socialmedia.MediaVideo, Domain: "youtube.com"},
+	}
+	for i := range posts {
+		assert.NoError(t, store.SavePost(&posts[i]))
+	}
+	assert.NoError(t, store.SaveComment(&socialmedia.Comment{CommentID: "c1", PostID: "1", Author: "b", SubReddit: "pics"}))
+	assert.NoError(t, store.SaveComment(&socialmedia.Comment{CommentID: "c3", PostID: "3", Author: "a", SubReddit: "pics"}))
+
+	yes, no := true, false
+	collect := func(filter storepkg.Filter) []string {
+		var ids []string
+		err := store.EachPost(filter, func(p socialmedia.Post) error {
+			ids = append(ids, p.PostID)
+			return nil
+		})
+		assert.NoError(t, err)
+		return ids
+	}
+	assert.Equal(t, []string{"1"}, collect(storepkg.Filter{Over18: &yes}))
+	assert.Equal(t, []string{"2", "3"}, collect(storepkg.Filter{Over18: &no}))
+	assert.Equal(t, []string{"2"}, collect(storepkg.Filter{Stickied: &yes}))
+	assert.Equal(t, []string{"1", "3"}, collect(storepkg.Filter{Stickied: &no}))
+	assert.Equal(t, []string{"3"}, collect(storepkg.Filter{MediaType: socialmedia.MediaVideo}))
+	assert.Equal(t, []string{"3"}, collect(storepkg.Filter{Domain: "YouTube.com"}))
+	assert.Empty(t, collect(storepkg.Filter{Over18: &yes, Domain: "youtube.com"}))
+
+	var snapshots []string
+	err := store.EachPostSnapshot(storepkg.Filter{Over18: &no, Stickied: &no}, func(s socialmedia.PostSnapshot) error {
+		snapshots = append(snapshots, s.PostID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"3"}, snapshots)
+	var comments []string
+	err = store.EachComment(storepkg.Filter{MediaType: socialmedia.MediaImage}, func(c socialmedia.Comment) error {
+		comments = append(comments, c.CommentID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1"}, comments)
+
+	authors, err := store.GetAuthorStatistics(storepkg.Filter{Over18: &no})
+	assert.NoError(t, err)
+	assert.Len(t, authors, 1)
+	assert.Equal(t, "b", authors[0].Author)
+}
+
+func TestSaveComment(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	comment := &socialmedia.Comment{CommentID: "c1", PostID: "1", Author: "a", Body: "hi", SubReddit: "music"}
+	assert.NoError(t, store.SaveComment(comment))
+	assert.ErrorIs(t, store.SaveComment(comment), storepkg.ErrDuplicateComment)
+
+	var comments []socialmedia.Comment
+	err := store.EachComment(storepkg.Filter{Subreddit: "music"}, func(c socialmedia.Comment) error {
+		comments = append(comments, c)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, comments, 1)
+	assert.Equal(t, "hi", comments[0].Body)
+}
+
+func TestImportCheckpoint(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	checkpoint, err := store.GetImportCheckpoint("RS_2024-01.zst")
+	assert.NoError(t, err)
+	assert.Equal(t, storepkg.ImportCheckpoint{Source: "RS_2024-01.zst"}, checkpoint)
+
+	checkpoint.Size, checkpoint.Line = 100, 10
+	assert.NoError(t, store.SaveImportCheckpoint(checkpoint))
+	checkpoint.Line, checkpoint.Done = 20, true
+	assert.NoError(t, store.SaveImportCheckpoint(checkpoint))
+
+	stored, err := store.GetImportCheckpoint("RS_2024-01.zst")
+	assert.NoError(t, err)
+	assert.Equal(t, checkpoint, stored)
+}
+
+func TestListingRanks(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	start := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	changes, err := store.RecordListingRanks("music", "hot", []string{"a", "b", "c"}, start)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, changes)
+
+	// unchanged ranks are not written again
+	changes, err = store.RecordListingRanks("music", "hot", []string{"a", "b", "c"}, start.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, changes)
+
+	// c climbs, b drops, a leaves the listing
+	changes, err = store.RecordListingRanks("music", "hot", []string{"c", "b"}, start.Add(2*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, changes)
+
+	history, err := store.GetListingHistory("Music", "hot")
+	assert.NoError(t, err)
+	assert.Equal(t, "music", history.Subreddit)
+	assert.True(t, history.Polled.Equal(start.Add(2*time.Minute)))
+	assert.Len(t, history.Ranks, 5)
+	assert.Equal(t, "c", history.Ranks[3].PostID)
+	assert.Equal(t, 1, history.Ranks[3].Rank)
+	assert.Equal(t, "a", history.Ranks[4].PostID)
+	assert.Equal(t, 0, history.Ranks[4].Rank)
+
+	// a returning post is recorded again
+	changes, err = store.RecordListingRanks("music", "hot", []string{"c", "b", "a"}, start.Add(3*time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, changes)
+
+	history, err = store.GetListingHistory("music", "top:day")
+	assert.NoError(t, err)
+	assert.Empty(t, history.Ranks)
+	assert.True(t, history.Polled.IsZero())
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	now := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	deliveries := []storepkg.WebhookDelivery{
+		{Endpoint: "a", URL: "http://a", Event: "post.upvotes", Payload: []byte(`{}`), Status: storepkg.DeliveryPending, NextAttempt: now},
+		{Endpoint: "b", URL: "http://b", Event: "post.upvotes", Payload: []byte(`{}`), Status: storepkg.DeliveryPending, NextAttempt: now.Add(time.Hour)},
+	}
+	queued, err := store.EnqueueWebhookDeliveries("post.upvotes:1:100", deliveries)
+	assert.NoError(t, err)
+	assert.True(t, queued)
+	// the same event is only queued once
+	queued, err = store.EnqueueWebhookDeliveries("post.upvotes:1:100", deliveries)
+	assert.NoError(t, err)
+	assert.False(t, queued)
+
+	due, err := store.DueWebhookDeliveries(now, 10)
+	assert.NoError(t, err)
+	assert.Len(t, due, 1)
+	assert.Equal(t, "a", due[0].Endpoint)
+	assert.Equal(t, "post.upvotes:1:100", due[0].EventKey)
+
+	due[0].Status, due[0].Attempts, due[0].ResponseStatus = storepkg.DeliveryDelivered, 1, 200
+	assert.NoError(t, store.UpdateWebhookDelivery(due[0]))
+	due, err = store.DueWebhookDeliveries(now.Add(2*time.Hour), 10)
+	assert.NoError(t, err)
+	assert.Len(t, due, 1)
+	assert.Equal(t, "b", due[0].Endpoint)
+
+	log, err := store.GetWebhookDeliveries(storepkg.DeliveryFilter{Status: storepkg.DeliveryDelivered})
+	assert.NoError(t, err)
+	assert.Len(t, log, 1)
+	assert.Equal(t, 200, log[0].ResponseStatus)
+	assert.Equal(t, []byte(`{}`), log[0].Payload)
+
+	log, err = store.GetWebhookDeliveries(storepkg.DeliveryFilter{Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "b", log[0].Endpoint)
+}
+
+func TestUpdatePostState(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	created := time.Now().Add(-time.Hour)
+	store.SavePost(&socialmedia.Post{PostID: "1", Author: "a", Body: "original", Created: created})
+	store.SavePost(&socialmedia.Post{PostID: "2", Author: "b", Created: created})
+	store.SavePost(&socialmedia.Post{PostID: "3", Author: "c", Created: created.Add(-48 * time.Hour)})
+
+	seen := time.Now()
+	changed, err := store.UpdatePostState(&socialmedia.Post{PostID: "2", State: socialmedia.PostActive}, seen)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	// posts refreshed longest ago come first
+	postIDs, err := store.GetPostsToRefresh(created.Add(-time.Minute), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, postIDs)
+
+	removed := &socialmedia.Post{PostID: "1", Author: socialmedia.DeletedAuthor, Body: "[removed]", State: socialmedia.PostRemoved, RemovedBy: "moderator"}
+	changed, err = store.UpdatePostState(removed, seen)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, seen, removed.Disappeared)
+	post, err := store.GetPost("1")
+	assert.NoError(t, err)
+	assert.Equal(t, socialmedia.PostRemoved, post.State)
+	assert.Equal(t, "moderator", post.RemovedBy)
+	assert.Equal(t, "original", post.Body)
+	assert.Equal(t, "a", post.Author)
+
+	// the first disappearance is kept
+	changed, err = store.UpdatePostState(&socialmedia.Post{PostID: "1", State: socialmedia.PostDeleted}, seen.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+	postIDs, err = store.GetPostsToRefresh(created.Add(-time.Minute), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, postIDs)
+
+	_, err = store.UpdatePostState(&socialmedia.Post{PostID: "missing", State: socialmedia.PostDeleted}, seen)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestDeletedAuthorsLeftOut(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	store.SavePost(&socialmedia.Post{PostID: "1", Author: socialmedia.DeletedAuthor, SubReddit: "music", UpVotes: 5})
+	store.SavePost(&socialmedia.Post{PostID: "2", Author: socialmedia.DeletedAuthor, SubReddit: "music", UpVotes: 5})
+	store.SavePost(&socialmedia.Post{PostID: "3", Author: "a", SubReddit: "music", UpVotes: 1})
+
+	top, err := store.GetTopPoster()
+	assert.NoError(t, err)
+	assert.Equal(t, []socialmedia.AuthorStatistic{{Author: "a", TotalPosts: 1, TotalUpvotes: 1}}, top)
+	leading, err := store.GetLeadingAuthors(10)
+	assert.NoError(t, err)
+	assert.Equal(t, top, leading)
+	authors, err := store.GetAuthorStatistics(storepkg.Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, top, authors)
+}
+
+func TestBotsLeftOut(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	store.SavePost(&socialmedia.Post{PostID: "1", Author: "RemindMeBot", SubReddit: "music"})
+	store.SavePost(&socialmedia.Post{PostID: "2", Author: "RemindMeBot", SubReddit: "music"})
+	store.SavePost(&socialmedia.Post{PostID: "3", Author: "a", SubReddit: "music", UpVotes: 1})
+	scored := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, store.SaveAuthorScores([]socialmedia.AuthorScore{
+		{Author: "RemindMeBot", Score: 1, Bot: true, Posts: 2, Name: 1, Scored: scored},
+		{Author: "a", Score: 0.2, Posts: 1, Scored: scored},
+	}))
+
+	leading, err := store.GetLeadingAuthors(10)
+	assert.NoError(t, err)
+	assert.Len(t, leading, 2)
+
+	store.ExcludeBots = true
+	top, err := store.GetTopPoster()
+	assert.NoError(t, err)
+	assert.Equal(t, []socialmedia.AuthorStatistic{{Author: "a", TotalPosts: 1, TotalUpvotes: 1}}, top)
+	leading, err = store.GetLeadingAuthors(10)
+	assert.NoError(t, err)
+	assert.Equal(t, top, leading)
+	authors, err := store.GetAuthorStatistics(storepkg.Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, top, authors)
+
+	// a new score replaces the previous one
+	assert.NoError(t, store.SaveAuthorScores([]socialmedia.AuthorScore{{Author: "RemindMeBot", Score: 0.3, Posts: 2, Scored: scored}}))
+	score, err := store.GetAuthorScore("RemindMeBot")
+	assert.NoError(t, err)
+	assert.False(t, score.Bot)
+	bots, err := store.GetSuspectedBots(10)
+	assert.NoError(t, err)
+	assert.Empty(t, bots)
+	_, err = store.GetAuthorScore("nobody")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	account := socialmedia.Account{Name: "Gopher", Created: scored.AddDate(-3, 0, 0), LinkKarma: 10, CommentKarma: 20, Fetched: scored}
+	assert.NoError(t, store.SaveAccount(account))
+	account.CommentKarma = 30
+	assert.NoError(t, store.SaveAccount(account))
+	cached, err := store.GetAccount("gopher")
+	assert.NoError(t, err)
+	assert.Equal(t, 30, cached.CommentKarma)
+	assert.True(t, cached.Created.Equal(account.Created))
+	_, err = store.GetAccount("nobody")
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestPostRevisions(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	post := &socialmedia.Post{PostID: "1", Author: "a", Title: "Donkey", Body: "first", UpVotes: 1, State: socialmedia.PostActive}
+	store.SavePost(post)
+	// posts stored before the content hash was introduced are compared by their content
+	db.Model(&Post{}).Where("post_id = ?", "1").Update("content_hash", "")
+
+	seen := time.Now()
+	edited, err := store.RecordPostRevision(post, seen)
+	assert.NoError(t, err)
+	assert.False(t, edited)
+
+	post.Body, post.UpVotes, post.Edited = "second", 40, seen.Add(-time.Minute).Truncate(time.Second)
+	edited, err = store.RecordPostRevision(post, seen)
+	assert.NoError(t, err)
+	assert.True(t, edited)
+	post.Body = "third"
+	edited, err = store.RecordPostRevision(post, seen.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, edited)
+
+	revisions, err := store.GetPostRevisions("1")
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 3)
+	assert.Equal(t, "first", revisions[0].Body)
+	assert.Equal(t, 1, revisions[0].UpVotes)
+	assert.Equal(t, 2, revisions[1].Revision)
+	assert.Equal(t, "second", revisions[1].Body)
+	assert.Equal(t, 40, revisions[1].UpVotes)
+	assert.True(t, post.Edited.Equal(revisions[1].Edited))
+	assert.Equal(t, "third", revisions[2].Body)
+	stored, err := store.GetPost("1")
+	assert.NoError(t, err)
+	assert.Equal(t, "third", stored.Body)
+
+	// removed posts have their content replaced, that is no edit
+	removed := *post
+	removed.Body, removed.State = "[removed]", socialmedia.PostRemoved
+	edited, err = store.RecordPostRevision(&removed, seen)
+	assert.NoError(t, err)
+	assert.False(t, edited)
+
+	revisions, err = store.GetPostRevisions("2")
+	assert.NoError(t, err)
+	assert.Empty(t, revisions)
+}
+
+func TestCrosspostGraph(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	start := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	original := &socialmedia.CrosspostParent{PostID: "o", Subreddit: "golang", Author: "gopher", Title: "Donkey v2", NumCrossposts: 2}
+	posts := []socialmedia.Post{
+		{PostID: "1", SubReddit: "programming", Author: "a", Created: start, CrosspostParent: original},
+		{PostID: "2", SubReddit: "rust", Author: "b", Created: start.Add(time.Minute),
+			CrosspostParent: &socialmedia.CrosspostParent{PostID: "o", Subreddit: "golang", NumCrossposts: 3}},
+		{PostID: "3", SubReddit: "golang", Author: "c", Created: start, URL: "https://www.example.com/article/?utm_source=x"},
+		{PostID: "4", SubReddit: "programming", Author: "d", Created: start.Add(time.Hour), URL: "http://example.com/article"},
+		{PostID: "5", SubReddit: "golang", Author: "e", Created: start.Add(2 * time.Hour), URL: "https://example.com/article#top"},
+		{PostID: "6", SubReddit: "golang", Author: "f", Created: start, IsSelf: true, URL: "https://www.reddit.com/r/golang/comments/6/"},
+	}
+	for _, post := range posts {
+		assert.NoError(t, store.SavePost(&post))
+	}
+
+	mostCrossposted, err := store.GetMostCrossposted(10)
+	assert.NoError(t, err)
+	assert.Len(t, mostCrossposted, 1)
+	assert.Equal(t, "o", mostCrossposted[0].PostID)
+	assert.Equal(t, 2, mostCrossposted[0].Crossposts)
+	assert.Equal(t, 3, mostCrossposted[0].NumCrossposts)
+	assert.Equal(t, []string{"programming", "rust"}, mostCrossposted[0].Subreddits)
+
+	feeds, err := store.GetSubredditFeeds(10)
+	assert.NoError(t, err)
+	assert.Equal(t, []socialmedia.SubredditFeed{
+		{From: "golang", To: "programming", Crossposts: 1, SharedLinks: 1},
+		{From: "golang", To: "rust", Crossposts: 1},
+	}, feeds)
+
+	reposts, err := store.GetReposts(10)
+	assert.NoError(t, err)
+	assert.Len(t, reposts, 1)
+	assert.Equal(t, "example.com/article", reposts[0].URL)
+	assert.Len(t, reposts[0].Posts, 3)
+	assert.Equal(t, "3", reposts[0].Posts[0].PostID)
+
+	stored, err := store.GetPost("1")
+	assert.NoError(t, err)
+	assert.Equal(t, original, stored.CrosspostParent)
+	stored, err = store.GetPost("3")
+	assert.NoError(t, err)
+	assert.Nil(t, stored.CrosspostParent)
+}
+
+func TestRepostClusters(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	start := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	title := "My cat sleeping on the keyboard while I try to work"
+	posts := []*socialmedia.Post{
+		{PostID: "1", SubReddit: "cats", Author: "a", Created: start.Add(time.Hour), Title: title},
+		{PostID: "2", SubReddit: "aww", Author: "b", Created: start.Add(2 * time.Hour), Title: "[OC] " + title},
+		{PostID: "3", SubReddit: "golang", Author: "c", Created: start, Title: "What is your favourite mechanical keyboard for programming"},
+		{PostID: "4", SubReddit: "pics", Author: "d", Created: start.Add(3 * time.Hour), Title: "look", URL: "https://example.com/cat.jpg"},
+		{PostID: "5", SubReddit: "funny", Author: "e", Created: start.Add(4 * time.Hour), Title: title, URL: "https://example.com/cat.jpg"},
+	}
+	for _, post := range posts {
+		assert.NoError(t, store.SavePost(post))
+	}
+	assert.Empty(t, posts[0].RepostOf)
+	assert.Equal(t, "1", posts[1].RepostOf)
+	assert.Empty(t, posts[2].RepostOf)
+	assert.Empty(t, posts[3].RepostOf)
+	// shares the link of 4 and the title of 1, which merges their clusters
+	assert.Equal(t, "1", posts[4].RepostOf)
+
+	// an older post imported later becomes the original
+	imported := &socialmedia.Post{PostID: "6", SubReddit: "cats", Author: "f", Created: start.Add(-time.Hour), Title: title + "!"}
+	assert.NoError(t, store.SavePost(imported))
+	assert.Empty(t, imported.RepostOf)
+
+	clusters, err := store.GetRepostClusters(10)
+	assert.NoError(t, err)
+	assert.Len(t, clusters, 1)
+	assert.Equal(t, "6", clusters[0].Original.PostID)
+	var reposts []string
+	for _, repost := range clusters[0].Reposts {
+		reposts = append(reposts, repost.PostID)
+	}
+	assert.Equal(t, []string{"1", "2", "4", "5"}, reposts)
+	assert.Equal(t, []string{"aww", "cats", "funny", "pics"}, clusters[0].Subreddits)
+
+	stored, err := store.GetPost("4")
+	assert.NoError(t, err)
+	assert.Equal(t, "6", stored.RepostOf)
+}
+
+func TestLanguage(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	english := socialmedia.Post{PostID: "1", Author: "a", SubReddit: "movies", Title: "What do you think about the new trailer?"}
+	assert.NoError(t, store.SavePost(&english))
+	assert.Equal(t, "en", english.Language)
+	german := socialmedia.Post{PostID: "2", Author: "b", SubReddit: "movies", Title: "Was haltet ihr von dem neuen Trailer?"}
+	assert.NoError(t, store.SavePost(&german))
+	assert.Equal(t, "de", german.Language)
+	assert.NoError(t, store.SaveComment(&socialmedia.Comment{CommentID: "c1", PostID: "2", Author: "a", SubReddit: "movies", Body: "Gut"}))
+
+	var ids []string
+	err := store.EachPost(storepkg.Filter{Language: "de"}, func(p socialmedia.Post) error {
+		ids = append(ids, p.PostID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids)
+	var comments []string
+	err = store.EachComment(storepkg.Filter{Language: "de"}, func(c socialmedia.Comment) error {
+		comments = append(comments, c.CommentID)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c1"}, comments)
+
+	// posts stored before the language and sentiment were are analyzed by the migration
+	assert.NoError(t, db.Exec("UPDATE posts SET language = NULL, sentiment = NULL WHERE post_id = ?", "2").Error)
+	assert.NoError(t, db.Exec("UPDATE comments SET sentiment = NULL").Error)
+	assert.NoError(t, Migrate(db))
+	post, err := store.GetPost("2")
+	assert.NoError(t, err)
+	assert.Equal(t, "de", post.Language)
+	var sentiment float64
+	assert.NoError(t, db.Raw("SELECT sentiment FROM comments WHERE comment_id = ?", "c1").Scan(&sentiment).Error)
+	assert.Equal(t, 0.0, sentiment)
+	var unanalyzed int64
+	assert.NoError(t, db.Model(&Comment{}).Where("sentiment IS NULL").Count(&unanalyzed).Error)
+	assert.Zero(t, unanalyzed)
+}
+
+func TestLeadersCarryProfiles(t *testing.T) {
+	db := setupTestDB()
+	defer clearTables(db)
+
+	store := DbStore{DB: db}
+	store.SavePost(&socialmedia.Post{PostID: "1", Author: "Gopher", SubReddit: "golang", UpVotes: 3})
+	store.SavePost(&socialmedia.Post{PostID: "2", Author: "newbie", SubReddit: "golang", UpVotes: 1})
+	fetched := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, store.SaveAccount(socialmedia.Account{Name: "gopher", Created: fetched.AddDate(-3, 0, 0), LinkKarma: 10,
+		CommentKarma: 20, Fetched: fetched}))
+
+	top, err := store.GetTopPoster()
+	assert.NoError(t, err)
+	if assert.Len(t, top, 2) {
+		if assert.NotNil(t, top[0].Account) {
+			assert.Equal(t, 20, top[0].Account.CommentKarma)
+		}
+		assert.Nil(t, top[1].Account)
+	}
+
+	assert.NoError(t, store.SaveAccount(socialmedia.Account{Name: "newbie", Suspended: true, IsGold: true, Fetched: fetched}))
+	leading, err := store.GetLeadingAuthors(10)
+	assert.NoError(t, err)
+	if assert.Len(t, leading, 2) && assert.NotNil(t, leading[1].Account) {
+		assert.True(t, leading[1].Account.Suspended)
+		assert.True(t, leading[1].Account.IsGold)
+	}
+	authors, err := store.GetAuthorStatistics(storepkg.Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, leading, authors)
+}
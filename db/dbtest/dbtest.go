@@ -0,0 +1,30 @@
+// Package dbtest provides the stores the tests of the other packages run against
+package dbtest
+
+import (
+	"github.com/Valimere/donkey/db"
+	"github.com/Valimere/donkey/socialmedia"
+	"testing"
+)
+
+// NewStore returns a store on an in-memory database of the test's own holding the posts,
+// the database is dropped when the test ends
+func NewStore(t testing.TB, posts ...socialmedia.Post) *db.DbStore {
+	t.Helper()
+	gormDB, err := db.InitDB("file:"+t.Name()+"?mode=memory&cache=shared", nil)
+	if err != nil {
+		t.Fatalf("could not open db: %v", err)
+	}
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		t.Fatalf("could not open db: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+	dbStore := &db.DbStore{DB: gormDB}
+	for i := range posts {
+		if err := dbStore.SavePost(&posts[i]); err != nil {
+			t.Fatalf("could not save post %s: %v", posts[i].PostID, err)
+		}
+	}
+	return dbStore
+}
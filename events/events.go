@@ -0,0 +1,89 @@
+package events
+
+import (
+	"github.com/Valimere/donkey/socialmedia"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	// PostIngested is published for every new post written to the store
+	PostIngested Type = "post_ingested"
+	// PostUpdated is published when a post is seen again, Post carries its current score
+	PostUpdated Type = "post_updated"
+	// PostEdited is published when the title or body of a post changed, Post carries the new revision
+	PostEdited Type = "post_edited"
+	// PostRemoved is published when a post is first seen deleted or removed, Post carries its State
+	PostRemoved Type = "post_removed"
+	// PostRising is published when a post enters the rising leaderboard, Velocity carries the post and its velocity
+	PostRising Type = "post_rising"
+	// FetchCompleted is published after every successful listing fetch, it carries the rate limit state
+	FetchCompleted Type = "fetch_completed"
+	// FetchFailed is published when a listing fetch fails, Err holds the reason
+	FetchFailed Type = "fetch_failed"
+)
+
+// Event is a single ingestion event, only the fields relevant to its Type are set
+type Event struct {
+	Type      Type                         `json:"type"`
+	Time      time.Time                    `json:"time"`
+	Subreddit string                       `json:"subreddit,omitempty"`
+	Post      *socialmedia.Post            `json:"post,omitempty"`
+	Velocity  *socialmedia.PostVelocity    `json:"velocity,omitempty"`
+	RateLimit *socialmedia.RateLimitStatus `json:"rate_limit,omitempty"`
+	Err       string                       `json:"error,omitempty"`
+}
+
+// Bus fans events out to subscribers without ever blocking the publisher,
+// a subscriber that falls behind misses events instead of slowing ingestion down.
+// A nil *Bus is valid and drops everything.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[int]chan Event
+	nextID int
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[int]chan Event{}}
+}
+
+// Subscribe returns a channel receiving events published from now on and a function to unsubscribe,
+// buffer is how many events may queue up before new ones are dropped for this subscriber
+func (b *Bus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = ch
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers the event to every subscriber with room in its buffer, Time defaults to now
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
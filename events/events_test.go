@@ -0,0 +1,44 @@
+package events
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	bus := NewBus()
+	first, unsubscribeFirst := bus.Subscribe(1)
+	second, unsubscribeSecond := bus.Subscribe(1)
+	defer unsubscribeSecond()
+
+	bus.Publish(Event{Type: FetchCompleted, Subreddit: "music"})
+
+	e := <-first
+	assert.Equal(t, FetchCompleted, e.Type)
+	assert.False(t, e.Time.IsZero())
+	assert.Equal(t, "music", (<-second).Subreddit)
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+	_, open := <-first
+	assert.False(t, open)
+	bus.Publish(Event{Type: FetchCompleted})
+	assert.Len(t, second, 1)
+}
+
+func TestPublishNeverBlocks(t *testing.T) {
+	bus := NewBus()
+	ch, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+
+	bus.Publish(Event{Type: PostIngested, Subreddit: "first"})
+	bus.Publish(Event{Type: PostIngested, Subreddit: "dropped"})
+
+	assert.Equal(t, "first", (<-ch).Subreddit)
+	assert.Len(t, ch, 0)
+}
+
+func TestNilBus(t *testing.T) {
+	var bus *Bus
+	assert.NotPanics(t, func() { bus.Publish(Event{Type: PostIngested}) })
+}
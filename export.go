@@ -0,0 +1,230 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Valimere/donkey/config"
+	"github.com/Valimere/donkey/export"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+const exportDescription = `Writes stored data as CSV, JSON Lines or Parquet, the table defaults to posts.
+
+Tables:
+  posts      the stored posts with their current upvotes and comments
+  authors    posts, upvotes and comments per author, aggregated from the matching posts
+  snapshots  the score history of the posts
+  comments   the stored comments
+  sessions   one row per "donkey run", their ids can be passed to -session
+
+Times for -since and -until are RFC 3339 ("2024-04-09T16:00:00Z"), a date ("2024-04-09")
+or a duration before now ("24h").`
+
+// exportTables maps the table names to a function streaming the rows matching the filter into the writer
+var exportTables = map[string]struct {
+	table export.Table
+	write func(dbStore store.Store, filter store.Filter, w export.Writer) error
+}{
+	"posts": {export.PostsTable, func(dbStore store.Store, filter store.Filter, w export.Writer) error {
+		return dbStore.EachPost(filter, func(post socialmedia.Post) error {
+			return w.Write(export.PostRow(post))
+		})
+	}},
+	"authors": {export.AuthorsTable, func(dbStore store.Store, filter store.Filter, w export.Writer) error {
+		authors, err := dbStore.GetAuthorStatistics(filter)
+		if err != nil {
+			return err
+		}
+		for _, author := range authors {
+			err = w.Write(export.AuthorRow(author))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	"snapshots": {export.SnapshotsTable, func(dbStore store.Store, filter store.Filter, w export.Writer) error {
+		return dbStore.EachPostSnapshot(filter, func(snapshot socialmedia.PostSnapshot) error {
+			return w.Write(export.SnapshotRow(snapshot))
+		})
+	}},
+	"comments": {export.CommentsTable, func(dbStore store.Store, filter store.Filter, w export.Writer) error {
+		return dbStore.EachComment(filter, func(comment socialmedia.Comment) error {
+			return w.Write(export.CommentRow(comment))
+		})
+	}},
+	"sessions": {export.SessionsTable, func(dbStore store.Store, _ store.Filter, w export.Writer) error {
+		sessions, err := dbStore.GetSessions()
+		if err != nil {
+			return err
+		}
+		for _, session := range sessions {
+			err = w.Write(export.SessionRow(session))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+}
+
+// optionalBoolFlag parses a true or false value, target stays nil when the flag isn't given
+func optionalBoolFlag(target **bool) func(string) error {
+	return func(value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("expected true or false")
+		}
+		*target = &b
+		return nil
+	}
+}
+
+// addPostFilterFlags adds the flags selecting the posts by their listing fields
+func addPostFilterFlags(fs *flag.FlagSet, filter *store.Filter, verb string) {
+	fs.Func("over18", verb+" the posts marked NSFW when true, the others when false", optionalBoolFlag(&filter.Over18))
+	fs.Func("stickied", verb+" the stickied posts when true, the others when false", optionalBoolFlag(&filter.Stickied))
+	fs.Func("media", verb+" the posts of this media type: self, link, image, video, gallery or embed", func(value string) error {
+		switch value {
+		case socialmedia.MediaSelf, socialmedia.MediaLink, socialmedia.MediaImage, socialmedia.MediaVideo,
+			socialmedia.MediaGallery, socialmedia.MediaEmbed:
+			filter.MediaType = value
+			return nil
+		}
+		return errors.New("expected self, link, image, video, gallery or embed")
+	})
+	fs.StringVar(&filter.Domain, "domain", "", verb+" the posts linking to this domain, i.e. youtube.com")
+}
+
+// timeFlag parses the -since and -until values, durations are relative to now
+func timeFlag(target *time.Time, now time.Time) func(string) error {
+	return func(value string) error {
+		if d, err := time.ParseDuration(value); err == nil {
+			*target = now.Add(-d)
+			return nil
+		}
+		for _, layout := range []string{time.RFC3339, time.DateOnly} {
+			if t, err := time.Parse(layout, value); err == nil {
+				*target = t
+				return nil
+			}
+		}
+		return errors.New("expected an RFC 3339 time, a date or a duration")
+	}
+}
+
+func exportCommand(cfg *config.Config, args []string) error {
+	fs := newFlagSet("export", "[flags] [posts|authors|snapshots|comments|sessions]", exportDescription)
+	outputArg := fs.String("o", "-", "output file, \"-\" writes to stdout")
+	formatArg := fs.String("format", "", "csv, jsonl or parquet, defaults to the extension of -o or jsonl")
+	var filter store.Filter
+	fs.StringVar(&filter.Subreddit, "r", "", "only export this subreddit")
+	now := time.Now()
+	fs.Func("since", "only export data created at or after this time", timeFlag(&filter.Since, now))
+	fs.Func("until", "only export data created before this time", timeFlag(&filter.Until, now))
+	fs.BoolVar(&filter.ExcludeBackfilled, "exclude-backfilled", false, "leave out the posts fetched by a backfill and their snapshots")
+	fs.StringVar(&filter.Language, "language", "", "only export the posts detected in this language, i.e. en, and their snapshots and comments")
+	addPostFilterFlags(fs, &filter, "only export")
+	sessionArg := fs.String("session", "", "only export data saved during this session id, \"last\" for the latest session")
+	addStorageFlags(fs, cfg)
+
+	// flags may follow the table, i.e. "donkey export authors -r music"
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return flag.ErrHelp
+			}
+			return errUsage
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if err := parseFlags(fs, nil, cfg); err != nil {
+		return err
+	}
+	name := "posts"
+	if len(positional) > 0 {
+		name = positional[0]
+	}
+	table, found := exportTables[name]
+	if !found || len(positional) > 1 {
+		if found {
+			fmt.Fprintf(fs.Output(), "donkey export: unexpected argument %q\n\n", positional[1])
+		} else {
+			fmt.Fprintf(fs.Output(), "donkey export: unknown table %q\n\n", name)
+		}
+		fs.Usage()
+		return errUsage
+	}
+
+	format := export.JSONL
+	if *formatArg != "" {
+		var err error
+		format, err = export.ParseFormat(*formatArg)
+		if err != nil {
+			return err
+		}
+	} else if fromPath, ok := export.FormatFromPath(*outputArg); ok {
+		format = fromPath
+	}
+
+	dbStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	if *sessionArg != "" {
+		filter.SessionID, err = resolveSession(dbStore, *sessionArg)
+		if err != nil {
+			return err
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if *outputArg != "-" {
+		f, err := os.Create(*outputArg)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	w, err := export.NewWriter(format, table.table, out)
+	if err != nil {
+		return err
+	}
+	err = table.write(dbStore, filter, w)
+	if err != nil {
+		return fmt.Errorf("failed to export %s: %w", name, err)
+	}
+	return w.Close()
+}
+
+// resolveSession parses a session id, "last" is the latest session
+func resolveSession(dbStore store.Store, value string) (uint, error) {
+	if value != "last" {
+		id, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			return 0, fmt.Errorf("invalid session %q, expected an id or \"last\"", value)
+		}
+		return uint(id), nil
+	}
+	sessions, err := dbStore.GetSessions()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read sessions: %w", err)
+	}
+	if len(sessions) == 0 {
+		return 0, errors.New("no sessions stored yet")
+	}
+	return sessions[len(sessions)-1].ID, nil
+}
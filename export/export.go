@@ -0,0 +1,242 @@
+// Package export writes tables of donkey data as CSV, JSON Lines or Parquet
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	CSV     Format = "csv"
+	JSONL   Format = "jsonl"
+	Parquet Format = "parquet"
+)
+
+// Formats lists the supported formats
+var Formats = []Format{CSV, JSONL, Parquet}
+
+// ParseFormat accepts the format names and "json" or "ndjson" as aliases of jsonl
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "csv":
+		return CSV, nil
+	case "jsonl", "json", "ndjson":
+		return JSONL, nil
+	case "parquet":
+		return Parquet, nil
+	}
+	return "", fmt.Errorf("unknown format %q, use csv, jsonl or parquet", name)
+}
+
+// FormatFromPath guesses the format from the file extension, ok is false for unknown extensions
+func FormatFromPath(path string) (format Format, ok bool) {
+	format, err := ParseFormat(strings.TrimPrefix(filepath.Ext(path), "."))
+	return format, err == nil
+}
+
+type ColumnType int
+
+const (
+	String ColumnType = iota
+	Int
+	Float
+	Bool
+	// Time columns are written as RFC 3339 in UTC, or as a timestamp in Parquet, zero times are empty
+	Time
+)
+
+type Column struct {
+	Name string
+	Type ColumnType
+}
+
+// Table describes the columns of an export, the values of a row are in the same order
+type Table struct {
+	Name    string
+	Columns []Column
+}
+
+var (
+	PostsTable = Table{Name: "posts", Columns: []Column{
+		{"post_id", String}, {"subreddit", String}, {"author", String}, {"title", String}, {"body", String},
+		{"upvotes", Int}, {"num_comments", Int}, {"created", Time}, {"backfilled", Bool}, {"flair", String},
+		{"score", Int}, {"upvote_ratio", Float}, {"permalink", String}, {"url", String}, {"domain", String},
+		{"is_self", Bool}, {"over_18", Bool}, {"spoiler", Bool}, {"stickied", Bool}, {"locked", Bool},
+		{"author_flair", String}, {"author_fullname", String}, {"num_crossposts", Int}, {"gilded", Int},
+		{"total_awards", Int}, {"distinguished", String}, {"media_type", String},
+		{"state", String}, {"removed_by", String}, {"disappeared", Time}, {"edited", Time},
+		{"crosspost_parent", String}, {"repost_of", String}, {"sentiment", Float}, {"language", String},
+	}}
+	AuthorsTable = Table{Name: "authors", Columns: []Column{
+		{"author", String}, {"total_posts", Int}, {"total_upvotes", Int}, {"total_comments", Int},
+	}}
+	SnapshotsTable = Table{Name: "snapshots", Columns: []Column{
+		{"post_id", String}, {"upvotes", Int}, {"num_comments", Int}, {"time", Time},
+	}}
+	CommentsTable = Table{Name: "comments", Columns: []Column{
+		{"comment_id", String}, {"post_id", String}, {"parent_id", String}, {"subreddit", String},
+		{"author", String}, {"body", String}, {"upvotes", Int}, {"created", Time},
+	}}
+	SessionsTable = Table{Name: "sessions", Columns: []Column{
+		{"session_id", Int}, {"started", Time}, {"subreddits", String},
+	}}
+)
+
+func PostRow(p socialmedia.Post) []any {
+	var crosspostParent string
+	if p.CrosspostParent != nil {
+		crosspostParent = p.CrosspostParent.PostID
+	}
+	return []any{p.PostID, p.SubReddit, p.Author, p.Title, p.Body, p.UpVotes, p.NumComments, p.Created, p.Backfilled, p.Flair,
+		p.Score, p.UpvoteRatio, p.Permalink, p.URL, p.Domain,
+		p.IsSelf, p.Over18, p.Spoiler, p.Stickied, p.Locked,
+		p.AuthorFlair, p.AuthorFullname, p.NumCrossposts, p.Gilded,
+		p.TotalAwards, p.Distinguished, p.MediaType,
+		p.State, p.RemovedBy, p.Disappeared, p.Edited,
+		crosspostParent, p.RepostOf, p.Sentiment, p.Language}
+}
+
+func AuthorRow(a socialmedia.AuthorStatistic) []any {
+	return []any{a.Author, a.TotalPosts, a.TotalUpvotes, a.TotalComments}
+}
+
+func SnapshotRow(s socialmedia.PostSnapshot) []any {
+	return []any{s.PostID, s.UpVotes, s.NumComments, s.Time}
+}
+
+func CommentRow(c socialmedia.Comment) []any {
+	return []any{c.CommentID, c.PostID, c.ParentID, c.SubReddit, c.Author, c.Body, c.UpVotes, c.Created}
+}
+
+func SessionRow(s store.Session) []any {
+	return []any{int(s.ID), s.Started, strings.Join(s.Subreddits, ",")}
+}
+
+// Writer writes the rows of a table, Close must be called to flush the output, it doesn't close the underlying writer
+type Writer interface {
+	Write(row []any) error
+	Close() error
+}
+
+// NewWriter creates a writer for the table in the given format
+func NewWriter(format Format, table Table, w io.Writer) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(table, w)
+	case JSONL:
+		return &jsonlWriter{table: table, w: bufio.NewWriter(w)}, nil
+	case Parquet:
+		return newParquetWriter(table, w)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+func checkRow(table Table, row []any) error {
+	if len(row) != len(table.Columns) {
+		return fmt.Errorf("%s row has %d values, expected %d", table.Name, len(row), len(table.Columns))
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+type csvWriter struct {
+	table Table
+	w     *csv.Writer
+}
+
+func newCSVWriter(table Table, w io.Writer) (*csvWriter, error) {
+	cw := &csvWriter{table: table, w: csv.NewWriter(w)}
+	header := make([]string, 0, len(table.Columns))
+	for _, column := range table.Columns {
+		header = append(header, column.Name)
+	}
+	return cw, cw.w.Write(header)
+}
+
+func (cw *csvWriter) Write(row []any) error {
+	if err := checkRow(cw.table, row); err != nil {
+		return err
+	}
+	record := make([]string, len(row))
+	for i, value := range row {
+		switch v := value.(type) {
+		case string:
+			record[i] = v
+		case int:
+			record[i] = strconv.Itoa(v)
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'g', -1, 64)
+		case bool:
+			record[i] = strconv.FormatBool(v)
+		case time.Time:
+			record[i] = formatTime(v)
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+type jsonlWriter struct {
+	table Table
+	w     *bufio.Writer
+}
+
+// Write writes the row as an object with the keys in column order, zero times are null
+func (jw *jsonlWriter) Write(row []any) error {
+	if err := checkRow(jw.table, row); err != nil {
+		return err
+	}
+	var line bytes.Buffer
+	line.WriteByte('{')
+	for i, value := range row {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		key, _ := json.Marshal(jw.table.Columns[i].Name)
+		line.Write(key)
+		line.WriteByte(':')
+		if t, ok := value.(time.Time); ok {
+			if t.IsZero() {
+				value = nil
+			} else {
+				value = formatTime(t)
+			}
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		line.Write(data)
+	}
+	line.WriteString("}\n")
+	_, err := jw.w.Write(line.Bytes())
+	return err
+}
+
+func (jw *jsonlWriter) Close() error {
+	return jw.w.Flush()
+}
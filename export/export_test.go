@@ -0,0 +1,246 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"fmt"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+var created = time.Date(2024, 4, 9, 16, 58, 52, 0, time.FixedZone("EDT", -4*3600))
+
+func writeAll(t *testing.T, format Format, table Table, rows ...[]any) string {
+	var out bytes.Buffer
+	w, err := NewWriter(format, table, &out)
+	assert.NoError(t, err)
+	for _, row := range rows {
+		assert.NoError(t, w.Write(row))
+	}
+	assert.NoError(t, w.Close())
+	return out.String()
+}
+
+// readCSV returns the records of the output as maps of column name to value
+func readCSV(t *testing.T, out string) []map[string]string {
+	records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+	assert.NoError(t, err)
+	var rows []map[string]string
+	for _, record := range records[1:] {
+		row := map[string]string{}
+		for i, name := range records[0] {
+			row[name] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestCSV(t *testing.T) {
+	out := writeAll(t, CSV, PostsTable,
+		PostRow(socialmedia.Post{PostID: "1", SubReddit: "music", Author: "a", Title: "hello, world", UpVotes: 3, Created: created,
+			Backfilled: true, Flair: "news", Score: 2, UpvoteRatio: 0.75, Permalink: "/r/music/comments/1/hello_world/",
+			URL: "https://youtu.be/x", Domain: "youtu.be", Over18: true, Stickied: true, AuthorFlair: "fan", AuthorFullname: "t2_a",
+			NumCrossposts: 4, Gilded: 1, TotalAwards: 5, Distinguished: "moderator", MediaType: socialmedia.MediaVideo,
+			State: socialmedia.PostRemoved, RemovedBy: "moderator", Disappeared: created.Add(time.Hour), Edited: created.Add(time.Minute),
+			CrosspostParent: &socialmedia.CrosspostParent{PostID: "0"}, RepostOf: "0", Sentiment: -0.5, Language: "en"}),
+		PostRow(socialmedia.Post{PostID: "2"}))
+	assert.True(t, strings.HasPrefix(out, "post_id,subreddit,author,title,body,upvotes,num_comments,created,"))
+	assert.Contains(t, out, `"hello, world"`)
+
+	rows := readCSV(t, out)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, map[string]string{
+		"post_id": "1", "subreddit": "music", "author": "a", "title": "hello, world", "body": "", "upvotes": "3",
+		"num_comments": "0", "created": "2024-04-09T20:58:52Z", "backfilled": "true", "flair": "news",
+		"score": "2", "upvote_ratio": "0.75", "permalink": "/r/music/comments/1/hello_world/", "url": "https://youtu.be/x",
+		"domain": "youtu.be", "is_self": "false", "over_18": "true", "spoiler": "false", "stickied": "true", "locked": "false",
+		"author_flair": "fan", "author_fullname": "t2_a", "num_crossposts": "4", "gilded": "1", "total_awards": "5",
+		"distinguished": "moderator", "media_type": "video", "state": "removed", "removed_by": "moderator",
+		"disappeared": "2024-04-09T21:58:52Z", "edited": "2024-04-09T20:59:52Z", "crosspost_parent": "0", "repost_of": "0",
+		"sentiment": "-0.5", "language": "en",
+	}, rows[0])
+	assert.Equal(t, "2", rows[1]["post_id"])
+	assert.Equal(t, "", rows[1]["created"])
+	assert.Equal(t, "false", rows[1]["backfilled"])
+	assert.Equal(t, "0", rows[1]["upvote_ratio"])
+	assert.Equal(t, "", rows[1]["crosspost_parent"])
+	assert.Equal(t, "", rows[1]["disappeared"])
+}
+
+func TestJSONL(t *testing.T) {
+	out := writeAll(t, JSONL, SnapshotsTable,
+		SnapshotRow(socialmedia.PostSnapshot{PostID: "1", UpVotes: 3, Time: created}),
+		SnapshotRow(socialmedia.PostSnapshot{PostID: "2"}))
+	assert.Equal(t, `{"post_id":"1","upvotes":3,"num_comments":0,"time":"2024-04-09T20:58:52Z"}`+"\n"+
+		`{"post_id":"2","upvotes":0,"num_comments":0,"time":null}`+"\n", out)
+}
+
+func TestRowLength(t *testing.T) {
+	w, err := NewWriter(CSV, AuthorsTable, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Error(t, w.Write([]any{"a"}))
+}
+
+// thriftReader decodes thrift compact structs into maps of field id to value,
+// just enough to check the parquet metadata
+type thriftReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *thriftReader) varint() int64 {
+	v, n := binary.Varint(r.data[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.data[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *thriftReader) value(typ byte) any {
+	switch typ {
+	case thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := int(r.uvarint())
+		r.pos += n
+		return string(r.data[r.pos-n : r.pos])
+	case thriftList:
+		header := r.data[r.pos]
+		r.pos++
+		size, elemType := int(header>>4), header&0x0f
+		if size == 15 {
+			size = int(r.uvarint())
+		}
+		list := make([]any, size)
+		for i := range list {
+			list[i] = r.value(elemType)
+		}
+		return list
+	case thriftStruct:
+		fields := map[int16]any{}
+		var id int16
+		for {
+			header := r.data[r.pos]
+			r.pos++
+			if header == 0 {
+				return fields
+			}
+			if delta := int16(header >> 4); delta != 0 {
+				id += delta
+			} else {
+				id = int16(r.varint())
+			}
+			fields[id] = r.value(header & 0x0f)
+		}
+	}
+	panic(fmt.Sprintf("unexpected thrift type %d", typ))
+}
+
+func TestParquet(t *testing.T) {
+	out := []byte(writeAll(t, Parquet, SnapshotsTable,
+		SnapshotRow(socialmedia.PostSnapshot{PostID: "1", UpVotes: 3, NumComments: 2, Time: created}),
+		SnapshotRow(socialmedia.PostSnapshot{PostID: "22"})))
+
+	assert.Equal(t, "PAR1", string(out[:4]))
+	assert.Equal(t, "PAR1", string(out[len(out)-4:]))
+	metaLength := int(binary.LittleEndian.Uint32(out[len(out)-8:]))
+	meta := (&thriftReader{data: out[len(out)-8-metaLength : len(out)-8]}).value(thriftStruct).(map[int16]any)
+
+	assert.Equal(t, int64(2), meta[3], "num_rows")
+	schema := meta[2].([]any)
+	assert.Len(t, schema, 5)
+	assert.Equal(t, "schema", schema[0].(map[int16]any)[4])
+	assert.Equal(t, map[int16]any{1: int64(parquetInt64), 3: int64(parquetOptional), 4: "time", 6: int64(parquetTimestampMillis)}, schema[4])
+
+	rowGroups := meta[4].([]any)
+	assert.Len(t, rowGroups, 1)
+	chunks := rowGroups[0].(map[int16]any)[1].([]any)
+	assert.Len(t, chunks, 4)
+
+	// the post_id column holds the plain encoded strings
+	column := chunks[0].(map[int16]any)[3].(map[int16]any)
+	assert.Equal(t, []any{"post_id"}, column[3])
+	pages := &thriftReader{data: out, pos: int(column[9].(int64))}
+	header := pages.value(thriftStruct).(map[int16]any)
+	assert.Equal(t, int64(2), header[5].(map[int16]any)[1], "num_values")
+	page := out[pages.pos : pages.pos+int(header[3].(int64))]
+	assert.Equal(t, []byte{1, 0, 0, 0, '1', 2, 0, 0, 0, '2', '2'}, page)
+
+	// the time column has one defined and one null value
+	column = chunks[3].(map[int16]any)[3].(map[int16]any)
+	pages = &thriftReader{data: out, pos: int(column[9].(int64))}
+	header = pages.value(thriftStruct).(map[int16]any)
+	page = out[pages.pos : pages.pos+int(header[3].(int64))]
+	levels := []byte{4, 0, 0, 0, 1 << 1, 1, 1 << 1, 0}
+	assert.Equal(t, levels, page[:len(levels)])
+	assert.Equal(t, uint64(created.UnixMilli()), binary.LittleEndian.Uint64(page[len(levels):]))
+	assert.Len(t, page, len(levels)+8)
+}
+
+func TestParquetFloatBool(t *testing.T) {
+	table := Table{Name: "flags", Columns: []Column{{"ratio", Float}, {"flag", Bool}}}
+	var rows [][]any
+	for i := range 10 {
+		rows = append(rows, []any{float64(i) / 4, i%3 == 0})
+	}
+	out := []byte(writeAll(t, Parquet, table, rows...))
+	metaLength := int(binary.LittleEndian.Uint32(out[len(out)-8:]))
+	meta := (&thriftReader{data: out[len(out)-8-metaLength : len(out)-8]}).value(thriftStruct).(map[int16]any)
+
+	schema := meta[2].([]any)
+	assert.Equal(t, map[int16]any{1: int64(parquetDouble), 3: int64(parquetRequired), 4: "ratio"}, schema[1])
+	assert.Equal(t, map[int16]any{1: int64(parquetBoolean), 3: int64(parquetRequired), 4: "flag"}, schema[2])
+
+	page := func(chunk any) []byte {
+		column := chunk.(map[int16]any)[3].(map[int16]any)
+		pages := &thriftReader{data: out, pos: int(column[9].(int64))}
+		header := pages.value(thriftStruct).(map[int16]any)
+		return out[pages.pos : pages.pos+int(header[3].(int64))]
+	}
+	chunks := meta[4].([]any)[0].(map[int16]any)[1].([]any)
+
+	// doubles are plain little endian
+	ratios := page(chunks[0])
+	assert.Len(t, ratios, 10*8)
+	assert.Equal(t, 2.25, math.Float64frombits(binary.LittleEndian.Uint64(ratios[9*8:])))
+
+	// booleans are bit packed, the first row in the least significant bit: rows 0, 3, 6 and 9
+	assert.Equal(t, []byte{0b01001001, 0b00000010}, page(chunks[1]))
+}
+
+func TestParquetEmpty(t *testing.T) {
+	out := []byte(writeAll(t, Parquet, AuthorsTable))
+	metaLength := int(binary.LittleEndian.Uint32(out[len(out)-8:]))
+	assert.Equal(t, 4+metaLength+8, len(out))
+}
+
+func TestParquetTypes(t *testing.T) {
+	w, err := NewWriter(Parquet, AuthorsTable, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.Error(t, w.Write([]any{"a", "1", 2, 3}))
+
+	w, err = NewWriter(Parquet, PostsTable, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(PostRow(socialmedia.Post{PostID: "1", UpvoteRatio: 1, Over18: true})))
+	row := PostRow(socialmedia.Post{PostID: "2"})
+	row[11] = 1 // upvote_ratio
+	assert.Error(t, w.Write(row))
+}
+
+func TestFormatFromPath(t *testing.T) {
+	format, ok := FormatFromPath("posts.parquet")
+	assert.True(t, ok)
+	assert.Equal(t, Parquet, format)
+	_, ok = FormatFromPath("posts")
+	assert.False(t, ok)
+}
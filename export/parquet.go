@@ -0,0 +1,367 @@
+package export
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// The Parquet writer only covers what the export tables need: flat columns, PLAIN encoding, no compression,
+// one data page per column chunk. The metadata is encoded with the thrift compact protocol.
+
+var parquetMagic = []byte("PAR1")
+
+// parquetRowGroupSize is how many rows are buffered before a row group is written
+const parquetRowGroupSize = 50000
+
+// parquet physical types, converted types, repetition types and encodings from parquet.thrift
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetPlain = 0
+	parquetRLE   = 3
+)
+
+type parquetRowGroup struct {
+	numRows   int64
+	totalSize int64
+	columns   []parquetColumnChunk
+}
+
+type parquetColumnChunk struct {
+	numValues  int64
+	size       int64
+	pageOffset int64
+}
+
+type parquetWriter struct {
+	table     Table
+	w         *bufio.Writer
+	offset    int64
+	rows      [][]any
+	rowGroups []parquetRowGroup
+	numRows   int64
+}
+
+func newParquetWriter(table Table, w io.Writer) (*parquetWriter, error) {
+	pw := &parquetWriter{table: table, w: bufio.NewWriter(w)}
+	return pw, pw.write(parquetMagic)
+}
+
+func (pw *parquetWriter) write(data []byte) error {
+	n, err := pw.w.Write(data)
+	pw.offset += int64(n)
+	return err
+}
+
+func (pw *parquetWriter) Write(row []any) error {
+	if err := checkRow(pw.table, row); err != nil {
+		return err
+	}
+	for i, value := range row {
+		switch pw.table.Columns[i].Type {
+		case String:
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("column %s: expected a string, got %T", pw.table.Columns[i].Name, value)
+			}
+		case Int:
+			if _, ok := value.(int); !ok {
+				return fmt.Errorf("column %s: expected an int, got %T", pw.table.Columns[i].Name, value)
+			}
+		case Float:
+			if _, ok := value.(float64); !ok {
+				return fmt.Errorf("column %s: expected a float64, got %T", pw.table.Columns[i].Name, value)
+			}
+		case Bool:
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("column %s: expected a bool, got %T", pw.table.Columns[i].Name, value)
+			}
+		case Time:
+			if _, ok := value.(time.Time); !ok {
+				return fmt.Errorf("column %s: expected a time, got %T", pw.table.Columns[i].Name, value)
+			}
+		}
+	}
+	pw.rows = append(pw.rows, row)
+	if len(pw.rows) >= parquetRowGroupSize {
+		return pw.flushRowGroup()
+	}
+	return nil
+}
+
+// flushRowGroup writes the buffered rows as a row group, one column chunk after the other
+func (pw *parquetWriter) flushRowGroup() error {
+	if len(pw.rows) == 0 {
+		return nil
+	}
+	group := parquetRowGroup{numRows: int64(len(pw.rows))}
+	for i, column := range pw.table.Columns {
+		data := pw.encodeColumn(i, column)
+
+		var header thriftWriter
+		header.i32(1, 0) // DATA_PAGE
+		header.i32(2, int32(len(data)))
+		header.i32(3, int32(len(data)))
+		header.structBegin(5)
+		header.i32(1, int32(len(pw.rows)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.structEnd()
+		header.stop()
+
+		chunk := parquetColumnChunk{
+			numValues:  int64(len(pw.rows)),
+			size:       int64(len(header.buf) + len(data)),
+			pageOffset: pw.offset,
+		}
+		if err := pw.write(header.buf); err != nil {
+			return err
+		}
+		if err := pw.write(data); err != nil {
+			return err
+		}
+		group.columns = append(group.columns, chunk)
+		group.totalSize += chunk.size
+	}
+	pw.rowGroups = append(pw.rowGroups, group)
+	pw.numRows += group.numRows
+	pw.rows = pw.rows[:0]
+	return nil
+}
+
+// encodeColumn encodes the values of column i with PLAIN encoding, optional columns are preceded
+// by their definition levels in the RLE hybrid encoding with a bit width of 1, booleans are packed
+// into bits starting with the least significant one
+func (pw *parquetWriter) encodeColumn(i int, column Column) []byte {
+	var data []byte
+	if column.Type == Bool {
+		data = make([]byte, (len(pw.rows)+7)/8)
+		for j, row := range pw.rows {
+			if row[i].(bool) {
+				data[j/8] |= 1 << (j % 8)
+			}
+		}
+		return data
+	}
+	if column.Type == Time {
+		var levels []byte
+		for start := 0; start < len(pw.rows); {
+			defined := !pw.rows[start][i].(time.Time).IsZero()
+			end := start
+			for end < len(pw.rows) && !pw.rows[end][i].(time.Time).IsZero() == defined {
+				end++
+			}
+			levels = binary.AppendUvarint(levels, uint64(end-start)<<1)
+			if defined {
+				levels = append(levels, 1)
+			} else {
+				levels = append(levels, 0)
+			}
+			start = end
+		}
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(levels)))
+		data = append(data, levels...)
+	}
+	for _, row := range pw.rows {
+		switch v := row[i].(type) {
+		case string:
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(v)))
+			data = append(data, v...)
+		case int:
+			data = binary.LittleEndian.AppendUint64(data, uint64(v))
+		case float64:
+			data = binary.LittleEndian.AppendUint64(data, math.Float64bits(v))
+		case time.Time:
+			if !v.IsZero() {
+				data = binary.LittleEndian.AppendUint64(data, uint64(v.UnixMilli()))
+			}
+		}
+	}
+	return data
+}
+
+// Close writes the remaining rows and the footer
+func (pw *parquetWriter) Close() error {
+	if err := pw.flushRowGroup(); err != nil {
+		return err
+	}
+
+	var meta thriftWriter
+	meta.i32(1, 1)
+	meta.listBegin(2, thriftStruct, len(pw.table.Columns)+1)
+	meta.elemBegin()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(pw.table.Columns)))
+	meta.elemEnd()
+	for _, column := range pw.table.Columns {
+		physical, repetition := parquetColumnType(column)
+		meta.elemBegin()
+		meta.i32(1, physical)
+		meta.i32(3, repetition)
+		meta.binary(4, column.Name)
+		switch column.Type {
+		case String:
+			meta.i32(6, parquetUTF8)
+		case Time:
+			meta.i32(6, parquetTimestampMillis)
+		}
+		meta.elemEnd()
+	}
+	meta.i64(3, pw.numRows)
+	meta.listBegin(4, thriftStruct, len(pw.rowGroups))
+	for _, group := range pw.rowGroups {
+		meta.elemBegin()
+		meta.listBegin(1, thriftStruct, len(group.columns))
+		for i, chunk := range group.columns {
+			column := pw.table.Columns[i]
+			physical, _ := parquetColumnType(column)
+			meta.elemBegin()
+			meta.i64(2, chunk.pageOffset)
+			meta.structBegin(3)
+			meta.i32(1, physical)
+			meta.listBegin(2, thriftI32, 2)
+			meta.listI32(parquetPlain)
+			meta.listI32(parquetRLE)
+			meta.listBegin(3, thriftBinary, 1)
+			meta.listBinary(column.Name)
+			meta.i32(4, 0) // UNCOMPRESSED
+			meta.i64(5, chunk.numValues)
+			meta.i64(6, chunk.size)
+			meta.i64(7, chunk.size)
+			meta.i64(9, chunk.pageOffset)
+			meta.structEnd()
+			meta.elemEnd()
+		}
+		meta.i64(2, group.totalSize)
+		meta.i64(3, group.numRows)
+		meta.elemEnd()
+	}
+	meta.binary(6, "donkey")
+	meta.stop()
+
+	if err := pw.write(meta.buf); err != nil {
+		return err
+	}
+	if err := pw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(meta.buf)))); err != nil {
+		return err
+	}
+	if err := pw.write(parquetMagic); err != nil {
+		return err
+	}
+	return pw.w.Flush()
+}
+
+func parquetColumnType(column Column) (physical, repetition int32) {
+	switch column.Type {
+	case Int:
+		return parquetInt64, parquetRequired
+	case Float:
+		return parquetDouble, parquetRequired
+	case Bool:
+		return parquetBoolean, parquetRequired
+	case Time:
+		return parquetInt64, parquetOptional
+	default:
+		return parquetByteArray, parquetRequired
+	}
+}
+
+// thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter encodes thrift structs with the compact protocol, fields have to be written in ascending order
+// and the elements of a struct list are enclosed in elemBegin and elemEnd
+type thriftWriter struct {
+	buf    []byte
+	lastID int16
+	// parents holds the last field ids of the enclosing structs
+	parents []int16
+}
+
+func (t *thriftWriter) field(id int16, typ byte) {
+	if delta := id - t.lastID; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendVarint(t.buf, int64(id))
+	}
+	t.lastID = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.buf = binary.AppendVarint(t.buf, v)
+}
+
+func (t *thriftWriter) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.listBinary(s)
+}
+
+func (t *thriftWriter) structBegin(id int16) {
+	t.field(id, thriftStruct)
+	t.elemBegin()
+}
+
+func (t *thriftWriter) structEnd() {
+	t.elemEnd()
+}
+
+func (t *thriftWriter) elemBegin() {
+	t.parents = append(t.parents, t.lastID)
+	t.lastID = 0
+}
+
+func (t *thriftWriter) elemEnd() {
+	t.stop()
+	t.lastID = t.parents[len(t.parents)-1]
+	t.parents = t.parents[:len(t.parents)-1]
+}
+
+// stop ends the outermost struct
+func (t *thriftWriter) stop() {
+	t.buf = append(t.buf, 0)
+}
+
+func (t *thriftWriter) listBegin(id int16, elemType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf = append(t.buf, byte(size)<<4|elemType)
+	} else {
+		t.buf = append(t.buf, 0xf0|elemType)
+		t.buf = binary.AppendUvarint(t.buf, uint64(size))
+	}
+}
+
+func (t *thriftWriter) listI32(v int32) {
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thriftWriter) listBinary(s string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
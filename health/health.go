@@ -0,0 +1,246 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Valimere/donkey/socialmedia"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusFail Status = "fail"
+)
+
+// Result is the outcome of a single check
+type Result struct {
+	Name    string         `json:"name"`
+	Status  Status         `json:"status"`
+	Message string         `json:"message,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Report is the JSON body returned by the health endpoints, Status is ok only if every check is ok
+type Report struct {
+	Status Status    `json:"status"`
+	Time   time.Time `json:"time"`
+	Checks []Result  `json:"checks"`
+}
+
+// Check is a named probe, Run must respect the context deadline
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) Result
+}
+
+// Evaluate runs the checks concurrently and aggregates their results in the given order
+func Evaluate(ctx context.Context, checks []Check) Report {
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			result := check.Run(ctx)
+			result.Name = check.Name
+			results[i] = result
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Time: time.Now().UTC(), Checks: results}
+	for _, result := range results {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// Handler serves the report of the checks, answering 503 when any of them fails
+func Handler(timeout time.Duration, checks ...Check) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+
+		report := Evaluate(ctx, checks)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+func ok(message string, details map[string]any) Result {
+	return Result{Status: StatusOK, Message: message, Details: details}
+}
+
+func fail(message string, details map[string]any) Result {
+	return Result{Status: StatusFail, Message: message, Details: details}
+}
+
+// DatabaseCheck fails when the store can't be reached
+func DatabaseCheck(ping func(ctx context.Context) error) Check {
+	return Check{Name: "database", Run: func(ctx context.Context) Result {
+		err := ping(ctx)
+		if err != nil {
+			return fail(err.Error(), nil)
+		}
+		return ok("reachable", nil)
+	}}
+}
+
+// TokenCheck fails when the OAuth token is missing, expired or expires within margin
+func TokenCheck(expiry func() time.Time, margin time.Duration) Check {
+	return Check{Name: "token", Run: func(ctx context.Context) Result {
+		expiresAt := expiry()
+		if expiresAt.IsZero() {
+			return fail("no token", nil)
+		}
+		remaining := time.Until(expiresAt)
+		details := map[string]any{
+			"expires_at":        expiresAt.UTC(),
+			"remaining_seconds": int(remaining.Seconds()),
+		}
+		switch {
+		case remaining <= 0:
+			return fail("token expired", details)
+		case remaining < margin:
+			return fail(fmt.Sprintf("token expires within %s", margin), details)
+		}
+		return ok("valid", details)
+	}}
+}
+
+// FetchCheck fails when a subreddit has not been fetched successfully within threshold
+func FetchCheck(tracker *Tracker, threshold time.Duration) Check {
+	return Check{Name: "fetch", Run: func(ctx context.Context) Result {
+		now := tracker.now()
+		stale := []string{}
+		details := map[string]any{}
+		for _, fetch := range tracker.Fetches() {
+			last := fetch.LastSuccess
+			state := map[string]any{}
+			if !last.IsZero() {
+				state["last_success"] = last.UTC()
+			}
+			if fetch.LastError != "" {
+				state["last_error"] = fetch.LastError
+			}
+			// subreddits that never succeeded are measured from when they were first expected
+			since := last
+			if since.IsZero() {
+				since = fetch.Since
+			}
+			if now.Sub(since) > threshold {
+				stale = append(stale, fetch.Subreddit)
+				state["stale"] = true
+			}
+			details[fetch.Subreddit] = state
+		}
+		if len(details) == 0 {
+			return fail("no subreddits are being fetched", nil)
+		}
+		if len(stale) > 0 {
+			return fail(fmt.Sprintf("no successful fetch within %s for %v", threshold, stale), details)
+		}
+		return ok(fmt.Sprintf("all subreddits fetched within %s", threshold), details)
+	}}
+}
+
+// RateLimitCheck fails when the rate limit budget is exhausted and the period has not reset yet
+func RateLimitCheck(rateLimit func() socialmedia.RateLimitStatus) Check {
+	return Check{Name: "rate_limit", Run: func(ctx context.Context) Result {
+		rl := rateLimit()
+		if rl.Observed.IsZero() {
+			return ok("no response received yet", nil)
+		}
+		details := map[string]any{
+			"used":      rl.Used,
+			"remaining": rl.Remaining,
+			"reset_at":  rl.Reset.UTC(),
+		}
+		if rl.Remaining < 1 && time.Now().Before(rl.Reset) {
+			return fail("rate limit budget exhausted", details)
+		}
+		return ok("budget available", details)
+	}}
+}
+
+// SubredditFetch is the fetch state of one subreddit
+type SubredditFetch struct {
+	Subreddit   string
+	Since       time.Time
+	LastSuccess time.Time
+	LastError   string
+}
+
+// Tracker records the outcome of the fetches per subreddit, it is safe for concurrent use
+type Tracker struct {
+	mu      sync.Mutex
+	fetches map[string]*SubredditFetch
+	// Now is used instead of time.Now when set, for tests
+	Now func() time.Time
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{fetches: map[string]*SubredditFetch{}}
+}
+
+func (t *Tracker) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+func (t *Tracker) fetch(subreddit string) *SubredditFetch {
+	fetch, found := t.fetches[subreddit]
+	if !found {
+		fetch = &SubredditFetch{Subreddit: subreddit, Since: t.now()}
+		t.fetches[subreddit] = fetch
+	}
+	return fetch
+}
+
+// Expect registers subreddits so they are reported as stale if they are never fetched
+func (t *Tracker) Expect(subreddits ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, subreddit := range subreddits {
+		t.fetch(subreddit)
+	}
+}
+
+// RecordFetch records the outcome of a fetch, err is nil for a successful one
+func (t *Tracker) RecordFetch(subreddit string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fetch := t.fetch(subreddit)
+	if err != nil {
+		fetch.LastError = err.Error()
+		return
+	}
+	fetch.LastSuccess = t.now()
+	fetch.LastError = ""
+}
+
+// Fetches returns a copy of the fetch state ordered by subreddit
+func (t *Tracker) Fetches() []SubredditFetch {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fetches := make([]SubredditFetch, 0, len(t.fetches))
+	for _, fetch := range t.fetches {
+		fetches = append(fetches, *fetch)
+	}
+	sort.Slice(fetches, func(i, j int) bool { return fetches[i].Subreddit < fetches[j].Subreddit })
+	return fetches
+}
@@ -0,0 +1,98 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDatabaseCheck(t *testing.T) {
+	check := DatabaseCheck(func(ctx context.Context) error { return nil })
+	assert.Equal(t, StatusOK, check.Run(context.Background()).Status)
+
+	check = DatabaseCheck(func(ctx context.Context) error { return errors.New("disk I/O error") })
+	result := check.Run(context.Background())
+	assert.Equal(t, StatusFail, result.Status)
+	assert.Equal(t, "disk I/O error", result.Message)
+}
+
+func TestTokenCheck(t *testing.T) {
+	margin := 5 * time.Minute
+	expiry := time.Time{}
+	check := TokenCheck(func() time.Time { return expiry }, margin)
+
+	assert.Equal(t, StatusFail, check.Run(context.Background()).Status, "missing token")
+
+	expiry = time.Now().Add(-time.Minute)
+	assert.Equal(t, StatusFail, check.Run(context.Background()).Status, "expired token")
+
+	expiry = time.Now().Add(time.Minute)
+	assert.Equal(t, StatusFail, check.Run(context.Background()).Status, "token near expiry")
+
+	expiry = time.Now().Add(time.Hour)
+	assert.Equal(t, StatusOK, check.Run(context.Background()).Status)
+}
+
+func TestFetchCheck(t *testing.T) {
+	now := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker()
+	tracker.Now = func() time.Time { return now }
+	check := FetchCheck(tracker, time.Minute)
+
+	assert.Equal(t, StatusFail, check.Run(context.Background()).Status, "nothing expected yet")
+
+	tracker.Expect("music", "movies")
+	assert.Equal(t, StatusOK, check.Run(context.Background()).Status, "within the grace period")
+
+	now = now.Add(30 * time.Second)
+	tracker.RecordFetch("music", nil)
+	tracker.RecordFetch("movies", errors.New("503 Service Unavailable"))
+	now = now.Add(45 * time.Second)
+
+	result := check.Run(context.Background())
+	assert.Equal(t, StatusFail, result.Status)
+	assert.Contains(t, result.Message, "movies")
+	assert.NotContains(t, result.Message, "music")
+	assert.Equal(t, "503 Service Unavailable", result.Details["movies"].(map[string]any)["last_error"])
+
+	tracker.RecordFetch("movies", nil)
+	assert.Equal(t, StatusOK, check.Run(context.Background()).Status)
+}
+
+func TestRateLimitCheck(t *testing.T) {
+	status := socialmedia.RateLimitStatus{}
+	check := RateLimitCheck(func() socialmedia.RateLimitStatus { return status })
+	assert.Equal(t, StatusOK, check.Run(context.Background()).Status, "no response yet")
+
+	status = socialmedia.RateLimitStatus{Used: 600, Remaining: 0, Reset: time.Now().Add(time.Minute), Observed: time.Now()}
+	assert.Equal(t, StatusFail, check.Run(context.Background()).Status)
+
+	status.Reset = time.Now().Add(-time.Second)
+	assert.Equal(t, StatusOK, check.Run(context.Background()).Status, "period already reset")
+}
+
+func TestHandler(t *testing.T) {
+	passing := Check{Name: "passing", Run: func(ctx context.Context) Result { return ok("fine", nil) }}
+	failing := Check{Name: "failing", Run: func(ctx context.Context) Result { return fail("broken", nil) }}
+
+	rec := httptest.NewRecorder()
+	Handler(time.Second, passing).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	Handler(time.Second, passing, failing).ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var report Report
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	assert.Equal(t, StatusFail, report.Status)
+	assert.Len(t, report.Checks, 2)
+	assert.Equal(t, "passing", report.Checks[0].Name)
+	assert.Equal(t, StatusFail, report.Checks[1].Status)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Valimere/donkey/alerts"
+	"github.com/Valimere/donkey/config"
+	"github.com/Valimere/donkey/importer"
+	"github.com/Valimere/donkey/logging"
+	"log/slog"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const importDescription = `Imports Pushshift-style NDJSON dumps of submissions and comments, "-" reads stdin.
+Files compressed with zstd are detected automatically. Posts and comments that are already stored are skipped
+and the author statistics are updated for the new posts.
+
+An interrupted import resumes where it stopped when the same file is imported again,
+files that were imported completely are skipped unless -restart is given.`
+
+func importCommand(cfg *config.Config, args []string) error {
+	fs := newFlagSet("import", "[flags] file...", importDescription)
+	kindArg := fs.String("kind", "auto", "auto, submissions or comments, auto detects the kind of every line")
+	var subreddits listFlag
+	fs.Var(&subreddits, "r", "comma-separated `list` of subreddits to import, everything if empty")
+	restart := fs.Bool("restart", false, "ignore the progress of previous imports of the same files")
+	progressInterval := fs.Duration("progress", 5*time.Second, "how often the progress is logged, 0 disables it")
+	checkAlerts := fs.Bool("alerts", false, "evaluate the alert rules on the imported posts and comments")
+	addStorageFlags(fs, cfg)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintf(fs.Output(), "donkey import: at least one file is required\n\n")
+		fs.Usage()
+		return errUsage
+	}
+	kind, err := importer.ParseKind(*kindArg)
+	if err != nil {
+		return err
+	}
+
+	dbStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	// every imported post would be logged as "new post found"
+	dbStore.Logger = logging.MinLevel(dbStore.Logger, slog.LevelWarn)
+
+	var engine *alerts.Engine
+	if *checkAlerts {
+		engine, err = newAlertEngine(cfg)
+		if err != nil {
+			return err
+		}
+		defer engine.Close()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger := logging.Component(slog.Default(), logging.ComponentImporter)
+	for _, path := range fs.Args() {
+		fileLogger := logger.With("file", path)
+		im := &importer.Importer{
+			Store:            dbStore,
+			Logger:           fileLogger,
+			Kind:             kind,
+			Subreddits:       subreddits,
+			Restart:          *restart,
+			ProgressInterval: *progressInterval,
+			OnPost:           engine.CheckPost,
+			OnComment:        engine.CheckComment,
+			OnProgress: func(p importer.Progress) {
+				fileLogger.Info("import progress", "percent", fmt.Sprintf("%.1f", p.Percent()), "lines", p.Lines,
+					"posts", p.Posts, "comments", p.Comments, "duplicates", p.Duplicates,
+					"filtered", p.Filtered, "invalid", p.Invalid, "resumed", p.Resumed)
+			},
+		}
+		_, err = im.ImportFile(ctx, path)
+		if errors.Is(err, context.Canceled) {
+			fileLogger.Warn("import interrupted, run the same command again to resume")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %w", path, err)
+		}
+	}
+	return nil
+}
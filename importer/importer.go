@@ -0,0 +1,407 @@
+// Package importer loads Pushshift-style NDJSON dumps of submissions and comments into the store
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Kind string
+
+const (
+	// Auto detects the kind of every line, submissions have a title and comments a link_id
+	Auto        Kind = "auto"
+	Submissions Kind = "submissions"
+	Comments    Kind = "comments"
+)
+
+// ParseKind accepts the kind names and their singular forms
+func ParseKind(name string) (Kind, error) {
+	switch strings.ToLower(name) {
+	case "", "auto":
+		return Auto, nil
+	case "submissions", "submission", "posts":
+		return Submissions, nil
+	case "comments", "comment":
+		return Comments, nil
+	}
+	return "", fmt.Errorf("unknown kind %q, use auto, submissions or comments", name)
+}
+
+// defaultCheckpointEvery is how many lines are processed between two saved checkpoints
+const defaultCheckpointEvery = 10000
+
+// zstdMaxWindow allows the long windows the Pushshift dumps are compressed with
+const zstdMaxWindow = 1 << 31
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// Progress counts what an import did so far, Bytes and Size refer to the file as stored on disk
+type Progress struct {
+	Lines      int64
+	Posts      int64
+	Comments   int64
+	Duplicates int64
+	// Filtered lines belong to subreddits that weren't asked for
+	Filtered int64
+	// Invalid lines couldn't be parsed or saved
+	Invalid int64
+	// Resumed is the number of lines skipped because a previous import already processed them
+	Resumed int64
+	Bytes   int64
+	Size    int64
+}
+
+// Percent is how much of the file was read, 0 when the size is unknown
+func (p Progress) Percent() float64 {
+	if p.Size <= 0 {
+		return 0
+	}
+	return float64(p.Bytes) / float64(p.Size) * 100
+}
+
+type Importer struct {
+	Store  store.Store
+	Logger *slog.Logger
+	Kind   Kind
+	// Subreddits limits the import to these subreddits, empty imports everything
+	Subreddits []string
+	// Restart ignores the checkpoint of a previous import of the same file
+	Restart bool
+	// CheckpointEvery defaults to defaultCheckpointEvery
+	CheckpointEvery int
+	// OnProgress is called every ProgressInterval while importing and once at the end, from the importing goroutine
+	OnProgress       func(Progress)
+	ProgressInterval time.Duration
+	// OnPost and OnComment are called for every newly stored post and comment, from the importing goroutine
+	OnPost    func(socialmedia.Post)
+	OnComment func(socialmedia.Comment)
+}
+
+// ImportFile imports a dump file, "-" reads stdin, the logger is expected to identify the file. Files compressed with zstd are detected by their magic number.
+// Files are resumable, the number of processed lines is checkpointed in the store under the absolute path.
+func (im *Importer) ImportFile(ctx context.Context, path string) (Progress, error) {
+	var progress Progress
+	var in io.Reader = os.Stdin
+	source := ""
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return progress, err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return progress, err
+		}
+		progress.Size = info.Size()
+		in = f
+		source, err = filepath.Abs(path)
+		if err != nil {
+			return progress, err
+		}
+	}
+
+	counter := &countingReader{r: in}
+	buffered := bufio.NewReaderSize(counter, 1<<20)
+	r, err := decompress(buffered)
+	if err != nil {
+		return progress, fmt.Errorf("%s: %w", path, err)
+	}
+	defer r.Close()
+
+	checkpoint := store.ImportCheckpoint{Source: source, Size: progress.Size}
+	if source != "" && !im.Restart {
+		checkpoint, err = im.Store.GetImportCheckpoint(source)
+		if err != nil {
+			return progress, fmt.Errorf("failed to read the checkpoint: %w", err)
+		}
+		switch {
+		case checkpoint.Size != progress.Size:
+			if checkpoint.Line > 0 {
+				im.logger().Warn("file changed since the last import, starting over")
+			}
+			checkpoint = store.ImportCheckpoint{Source: source, Size: progress.Size}
+		case checkpoint.Done:
+			im.logger().Info("file was already imported, use restart to import it again")
+			return progress, nil
+		case checkpoint.Line > 0:
+			im.logger().Info("resuming import", "line", checkpoint.Line)
+		}
+	}
+
+	err = im.importLines(ctx, r, counter, &progress, &checkpoint)
+	progress.Bytes = counter.n
+	if source != "" {
+		saveErr := im.Store.SaveImportCheckpoint(checkpoint)
+		if saveErr != nil && err == nil {
+			err = fmt.Errorf("failed to save the checkpoint: %w", saveErr)
+		}
+	}
+	if im.OnProgress != nil {
+		im.OnProgress(progress)
+	}
+	return progress, err
+}
+
+func (im *Importer) importLines(ctx context.Context, r io.Reader, counter *countingReader, progress *Progress, checkpoint *store.ImportCheckpoint) error {
+	every := int64(im.CheckpointEvery)
+	if every <= 0 {
+		every = defaultCheckpointEvery
+	}
+	subreddits := map[string]bool{}
+	for _, subreddit := range im.Subreddits {
+		subreddits[strings.ToLower(subreddit)] = true
+	}
+
+	reader := bufio.NewReaderSize(r, 1<<20)
+	var line int64
+	lastReport := time.Now()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if im.OnProgress != nil && im.ProgressInterval > 0 && time.Since(lastReport) >= im.ProgressInterval {
+			progress.Bytes = counter.n
+			im.OnProgress(*progress)
+			lastReport = time.Now()
+		}
+		data, err := reader.ReadBytes('\n')
+		if len(data) > 0 {
+			line++
+			if line <= checkpoint.Line {
+				progress.Resumed++
+			} else {
+				progress.Lines++
+				im.importLine(bytes.TrimSpace(data), line, subreddits, progress)
+				checkpoint.Line = line
+				if checkpoint.Source != "" && line%every == 0 {
+					if saveErr := im.Store.SaveImportCheckpoint(*checkpoint); saveErr != nil {
+						return fmt.Errorf("failed to save the checkpoint: %w", saveErr)
+					}
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			checkpoint.Done = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// record holds the fields of submissions and comments in the dumps
+type record struct {
+	ID          string   `json:"id"`
+	Subreddit   string   `json:"subreddit"`
+	Author      string   `json:"author"`
+	Title       *string  `json:"title"`
+	Selftext    string   `json:"selftext"`
+	Body        string   `json:"body"`
+	LinkID      string   `json:"link_id"`
+	ParentID    string   `json:"parent_id"`
+	Score       int      `json:"score"`
+	NumComments int      `json:"num_comments"`
+	CreatedUTC  unixTime `json:"created_utc"`
+	Flair       *string  `json:"link_flair_text"`
+
+	UpvoteRatio    float64                `json:"upvote_ratio"`
+	Permalink      string                 `json:"permalink"`
+	URL            string                 `json:"url"`
+	Domain         string                 `json:"domain"`
+	IsSelf         bool                   `json:"is_self"`
+	Over18         bool                   `json:"over_18"`
+	Spoiler        bool                   `json:"spoiler"`
+	Stickied       bool                   `json:"stickied"`
+	Locked         bool                   `json:"locked"`
+	AuthorFlair    *string                `json:"author_flair_text"`
+	AuthorFullname string                 `json:"author_fullname"`
+	NumCrossposts  int                    `json:"num_crossposts"`
+	Gilded         int                    `json:"gilded"`
+	TotalAwards    int                    `json:"total_awards_received"`
+	Distinguished  *string                `json:"distinguished"`
+	PostHint       string                 `json:"post_hint"`
+	IsVideo        bool                   `json:"is_video"`
+	IsGallery      bool                   `json:"is_gallery"`
+	RemovedBy      *string                `json:"removed_by_category"`
+	Edited         socialmedia.EditedTime `json:"edited"`
+
+	CrosspostParentList socialmedia.CrosspostParentList `json:"crosspost_parent_list"`
+}
+
+func (im *Importer) importLine(data []byte, line int64, subreddits map[string]bool, progress *Progress) {
+	if len(data) == 0 {
+		return
+	}
+	var rec record
+	err := json.Unmarshal(data, &rec)
+	if err == nil && rec.ID == "" {
+		err = errors.New("missing id")
+	}
+	if err != nil {
+		progress.Invalid++
+		im.logger().Debug("skipping invalid line", "line", line, "error", err)
+		return
+	}
+	if len(subreddits) > 0 && !subreddits[strings.ToLower(rec.Subreddit)] {
+		progress.Filtered++
+		return
+	}
+
+	kind := im.Kind
+	if kind == Auto || kind == "" {
+		kind = Comments
+		if rec.Title != nil || rec.LinkID == "" {
+			kind = Submissions
+		}
+	}
+
+	if kind == Submissions {
+		post := socialmedia.Post{
+			PostID:      rec.ID,
+			Title:       deref(rec.Title),
+			Body:        rec.Selftext,
+			Author:      rec.Author,
+			NumComments: rec.NumComments,
+			UpVotes:     rec.Score,
+			Created:     time.Time(rec.CreatedUTC),
+			SubReddit:   rec.Subreddit,
+			Flair:       deref(rec.Flair),
+
+			Score:          rec.Score,
+			UpvoteRatio:    rec.UpvoteRatio,
+			Permalink:      rec.Permalink,
+			URL:            rec.URL,
+			Domain:         rec.Domain,
+			IsSelf:         rec.IsSelf,
+			Over18:         rec.Over18,
+			Spoiler:        rec.Spoiler,
+			Stickied:       rec.Stickied,
+			Locked:         rec.Locked,
+			AuthorFlair:    deref(rec.AuthorFlair),
+			AuthorFullname: rec.AuthorFullname,
+			NumCrossposts:  rec.NumCrossposts,
+			Gilded:         rec.Gilded,
+			TotalAwards:    rec.TotalAwards,
+			Distinguished:  deref(rec.Distinguished),
+			MediaType:      socialmedia.MediaTypeOf(rec.PostHint, rec.IsSelf, rec.IsVideo, rec.IsGallery),
+			State:          socialmedia.PostStateOf(rec.Selftext, deref(rec.RemovedBy)),
+			RemovedBy:      deref(rec.RemovedBy),
+			Edited:         time.Time(rec.Edited),
+
+			CrosspostParent: rec.CrosspostParentList.Parent(),
+		}
+
+		err = im.Store.SavePost(&post)
+		if errors.Is(err, store.ErrDuplicatePost) {
+			progress.Duplicates++
+			return
+		}
+		if err == nil {
+			progress.Posts++
+			if im.OnPost != nil {
+				im.OnPost(post)
+			}
+		}
+	} else {
+		comment := socialmedia.Comment{
+			CommentID: rec.ID,
+			PostID:    strings.TrimPrefix(rec.LinkID, "t3_"),
+			ParentID:  rec.ParentID,
+			Author:    rec.Author,
+			Body:      rec.Body,
+			UpVotes:   rec.Score,
+			Created:   time.Time(rec.CreatedUTC),
+			SubReddit: rec.Subreddit,
+		}
+		err = im.Store.SaveComment(&comment)
+		if errors.Is(err, store.ErrDuplicateComment) {
+			progress.Duplicates++
+			return
+		}
+		if err == nil {
+			progress.Comments++
+			if im.OnComment != nil {
+				im.OnComment(comment)
+			}
+		}
+	}
+	if err != nil {
+		progress.Invalid++
+		im.logger().Error("failed to save line", "line", line, "id", rec.ID, "error", err)
+	}
+}
+
+func (im *Importer) logger() *slog.Logger {
+	if im.Logger == nil {
+		return slog.Default()
+	}
+	return im.Logger
+}
+
+// decompress peeks at the first bytes and wraps the reader in a zstd decoder if they are the zstd magic number
+func decompress(r *bufio.Reader) (io.ReadCloser, error) {
+	magic, err := r.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if !bytes.Equal(magic, zstdMagic) {
+		return io.NopCloser(r), nil
+	}
+	decoder, err := zstd.NewReader(r, zstd.WithDecoderMaxWindow(zstdMaxWindow), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zstd stream: %w", err)
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// unixTime decodes the created_utc field, which is a number or a string of one depending on the dump
+type unixTime time.Time
+
+func (t *unixTime) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	if value == "" || value == "null" {
+		*t = unixTime{}
+		return nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid created_utc %s", data)
+	}
+	*t = unixTime(time.Unix(int64(seconds), 0).UTC())
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,143 @@
+package importer
+
+import (
+	"context"
+	"github.com/Valimere/donkey/db"
+	"github.com/Valimere/donkey/db/dbtest"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const dump = `{"id":"p1","subreddit":"music","author":"a","title":"first","selftext":"body","score":5,"num_comments":2,"created_utc":1712685532,"permalink":"/r/music/comments/p1/first/","is_self":true,"over_18":true,"author_flair_text":null,"distinguished":"moderator"}
+{"id":"c1","subreddit":"music","author":"b","body":"nice","link_id":"t3_p1","parent_id":"t3_p1","score":1,"created_utc":"1712685600"}
+not json
+{"id":"p2","subreddit":"movies","author":"a","title":"second","score":1,"created_utc":1712685532.0}
+{"id":"p1","subreddit":"music","author":"a","title":"first","score":5,"created_utc":1712685532}
+`
+
+// writeDump writes the dump to a file called name and returns the absolute path of the file
+func writeDump(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path, err := filepath.Abs(filepath.Join(t.TempDir(), name))
+	if err != nil {
+		t.Fatalf("could not resolve the dump path: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("could not write the dump: %v", err)
+	}
+	return path
+}
+
+func posts(t *testing.T, dbStore *db.DbStore) []socialmedia.Post {
+	var posts []socialmedia.Post
+	assert.NoError(t, dbStore.EachPost(store.Filter{}, func(p socialmedia.Post) error {
+		posts = append(posts, p)
+		return nil
+	}))
+	return posts
+}
+
+func TestImportFile(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	path := writeDump(t, "RS.ndjson", []byte(dump))
+
+	var reports int
+	im := &Importer{Store: dbStore, OnProgress: func(Progress) { reports++ }}
+	progress, err := im.ImportFile(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), progress.Lines)
+	assert.Equal(t, int64(2), progress.Posts)
+	assert.Equal(t, int64(1), progress.Comments)
+	assert.Equal(t, int64(1), progress.Duplicates)
+	assert.Equal(t, int64(1), progress.Invalid)
+	assert.Equal(t, float64(100), progress.Percent())
+	assert.Equal(t, 1, reports)
+
+	stored := posts(t, dbStore)
+	assert.Len(t, stored, 2)
+	assert.Equal(t, "body", stored[0].Body)
+	assert.Equal(t, time.Unix(1712685532, 0), stored[0].Created.Local())
+	assert.Equal(t, "https://www.reddit.com/r/music/comments/p1/first/", stored[0].Link())
+	assert.True(t, stored[0].Over18)
+	assert.Equal(t, socialmedia.MediaSelf, stored[0].MediaType)
+	assert.Equal(t, "moderator", stored[0].Distinguished)
+	assert.Equal(t, socialmedia.MediaLink, stored[1].MediaType)
+
+	var comments []socialmedia.Comment
+	assert.NoError(t, dbStore.EachComment(store.Filter{}, func(c socialmedia.Comment) error {
+		comments = append(comments, c)
+		return nil
+	}))
+	assert.Len(t, comments, 1)
+	assert.Equal(t, "p1", comments[0].PostID)
+
+	authors, err := dbStore.GetLeadingAuthors(1)
+	assert.NoError(t, err)
+	assert.Equal(t, socialmedia.AuthorStatistic{Author: "a", TotalPosts: 2, TotalUpvotes: 6, TotalComments: 2}, authors[0])
+
+	// the finished import isn't repeated
+	progress, err = im.ImportFile(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), progress.Lines)
+}
+
+func TestImportResume(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	path := writeDump(t, "RS.ndjson", []byte(dump))
+	assert.NoError(t, dbStore.SaveImportCheckpoint(store.ImportCheckpoint{Source: path, Size: int64(len(dump)), Line: 3}))
+
+	im := &Importer{Store: dbStore}
+	progress, err := im.ImportFile(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), progress.Resumed)
+	assert.Equal(t, int64(2), progress.Lines)
+	assert.Len(t, posts(t, dbStore), 2)
+
+	checkpoint, err := dbStore.GetImportCheckpoint(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), checkpoint.Line)
+	assert.True(t, checkpoint.Done)
+}
+
+func TestImportCancelled(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+	path := writeDump(t, "RS.ndjson", []byte(dump))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	im := &Importer{Store: dbStore}
+	_, err := im.ImportFile(ctx, path)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	checkpoint, err := dbStore.GetImportCheckpoint(path)
+	assert.NoError(t, err)
+	assert.False(t, checkpoint.Done)
+}
+
+func TestImportZstdAndFilter(t *testing.T) {
+	encoder, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+	dbStore := dbtest.NewStore(t)
+	path := writeDump(t, "RS.zst", encoder.EncodeAll([]byte(dump), nil))
+
+	im := &Importer{Store: dbStore, Subreddits: []string{"Movies"}, Kind: Submissions}
+	progress, err := im.ImportFile(context.Background(), path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), progress.Posts)
+	assert.Equal(t, int64(3), progress.Filtered)
+	assert.Equal(t, "p2", posts(t, dbStore)[0].PostID)
+}
+
+func TestParseKind(t *testing.T) {
+	kind, err := ParseKind("comment")
+	assert.NoError(t, err)
+	assert.Equal(t, Comments, kind)
+	_, err = ParseKind("videos")
+	assert.Error(t, err)
+}
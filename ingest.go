@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/Valimere/donkey/alerts"
+	"github.com/Valimere/donkey/events"
+	"github.com/Valimere/donkey/health"
+	"github.com/Valimere/donkey/logging"
+	"github.com/Valimere/donkey/metrics"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/statistics"
+	"github.com/Valimere/donkey/store"
+	"github.com/Valimere/donkey/trends"
+	"github.com/Valimere/donkey/webhooks"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ingestQueueSize bounds the posts waiting for the store, fetchers block once it is full
+const ingestQueueSize = 1000
+
+// fetchRetryDelay is how long a subreddit waits after a failed fetch before trying again
+const fetchRetryDelay = 10 * time.Second
+
+// backfillRetries is how often a failed backfill page is retried before its listing is given up
+const backfillRetries = 3
+
+// queueItem is a post to save or, when ranks is set, the ranks of a fetched listing page to record.
+// Refreshed posts were fetched again by their ID to notice whether they were deleted or removed.
+type queueItem struct {
+	post      socialmedia.Post
+	ranks     *listingRanks
+	refreshed bool
+}
+
+// listingRanks are the posts of a listing page in rank order
+type listingRanks struct {
+	subreddit string
+	listing   string
+	postIDs   []string
+	polled    time.Time
+}
+
+// ingester moves posts from the reddit client to the store, fetching every subreddit concurrently
+// while a single writer drains the queue since sqlite only allows one writer at a time
+type ingester struct {
+	client  *socialmedia.Client
+	store   store.Store
+	metrics *metrics.Metrics
+	tracker *health.Tracker
+	// bus receives the ingestion events, it may be nil
+	bus *events.Bus
+	// alerts evaluates the alert rules on new and updated posts, it may be nil
+	alerts *alerts.Engine
+	// webhooks queues the webhook events of new and updated posts, it may be nil
+	webhooks *webhooks.Dispatcher
+	// trending counts the terms of the new posts, it may be nil. It is fed by the writer rather than the bus,
+	// which drops events while a subscriber falls behind, so bursts aren't undercounted.
+	trending *trends.Tracker
+	// listings are polled per subreddit, subreddits without an entry poll new
+	listings map[string][]socialmedia.Listing
+	// backfill pages back through the listings of every subreddit before polling, nil skips it
+	backfill *backfillOptions
+	// refresh fetches the stored posts again while polling, nil skips it
+	refresh *refreshOptions
+	logger  *slog.Logger
+}
+
+// backfillOptions selects the listings a backfill pages through
+type backfillOptions struct {
+	// limit is the most posts fetched per listing
+	limit int
+	// top lists the time filters of the /top listings fetched after /new
+	top []string
+}
+
+// refreshOptions select the stored posts that are fetched again to notice the deleted and removed ones
+type refreshOptions struct {
+	interval time.Duration
+	// maxAge is how long after their creation posts are refreshed
+	maxAge time.Duration
+	// limit is the most posts refreshed per interval
+	limit int
+}
+
+// listings returns /new followed by the /top listings
+func (o backfillOptions) listings() []socialmedia.Listing {
+	listings := []socialmedia.Listing{{Sort: "new"}}
+	for _, t := range o.top {
+		listings = append(listings, socialmedia.Listing{Sort: "top", Time: t})
+	}
+	return listings
+}
+
+// fetchAndPrint fetches posts from the subreddits and saves them, it runs until the process exits
+func (in *ingester) fetchAndPrint(subreddits []string) {
+	queue := make(chan queueItem, ingestQueueSize)
+	var wg sync.WaitGroup
+
+	for _, subreddit := range subreddits {
+		wg.Add(1)
+		go func(subreddit string) {
+			defer wg.Done()
+			if in.backfill != nil {
+				in.backfillSubreddit(context.Background(), subreddit, *in.backfill, queue)
+			}
+			in.fetchSubreddit(subreddit, queue)
+		}(subreddit)
+	}
+	if in.refresh != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			in.refreshPosts(context.Background(), *in.refresh, queue)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(queue)
+	}()
+
+	in.savePosts(queue)
+}
+
+// refreshPosts fetches the stored posts again every opts.interval until ctx is done and queues them as refreshed
+func (in *ingester) refreshPosts(ctx context.Context, opts refreshOptions, queue chan<- queueItem) {
+	ticker := time.NewTicker(opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			in.refreshBatch(ctx, opts, now, queue)
+		}
+	}
+}
+
+// refreshBatch fetches up to opts.limit active posts created within opts.maxAge, the ones refreshed longest ago first
+func (in *ingester) refreshBatch(ctx context.Context, opts refreshOptions, now time.Time, queue chan<- queueItem) {
+	postIDs, err := in.store.GetPostsToRefresh(now.Add(-opts.maxAge), opts.limit)
+	if err != nil {
+		in.logger.ErrorContext(ctx, "failed to load the posts to refresh", "error", err)
+		return
+	}
+	refreshed := 0
+	for batch := range slices.Chunk(postIDs, socialmedia.MaxListingLimit) {
+		resp, err := in.client.FetchInfo(ctx, batch)
+		if err != nil {
+			in.logger.ErrorContext(ctx, "refreshing posts failed", "refreshed", refreshed, "error", err)
+			return
+		}
+		for _, post := range resp.Posts {
+			queue <- queueItem{post: post, refreshed: true}
+			in.metrics.SetQueueDepth(len(queue))
+		}
+		refreshed += len(resp.Posts)
+	}
+	in.logger.DebugContext(ctx, "posts refreshed", "posts", refreshed)
+}
+
+// backfillAll backfills the subreddits concurrently and saves their posts, it returns once every listing is done
+func (in *ingester) backfillAll(ctx context.Context, subreddits []string, opts backfillOptions) {
+	queue := make(chan queueItem, ingestQueueSize)
+	var wg sync.WaitGroup
+
+	for _, subreddit := range subreddits {
+		wg.Add(1)
+		go func(subreddit string) {
+			defer wg.Done()
+			in.backfillSubreddit(ctx, subreddit, opts, queue)
+		}(subreddit)
+	}
+	go func() {
+		wg.Wait()
+		close(queue)
+	}()
+
+	in.savePosts(queue)
+}
+
+// backfillSubreddit pages back through the subreddit's listings up to opts.limit posts each
+// and queues the posts created before the program started, marked as backfilled.
+// A page that still fails after backfillRetries gives up the rest of its listing.
+func (in *ingester) backfillSubreddit(ctx context.Context, subreddit string, opts backfillOptions, queue chan<- queueItem) {
+	ctx = logging.WithAttrs(ctx, slog.String("subreddit", subreddit))
+	for _, listing := range opts.listings() {
+		fetched, queued := 0, 0
+		for fetched < opts.limit {
+			listing.Limit = min(opts.limit-fetched, socialmedia.MaxListingLimit)
+			resp, err := in.fetchBackfillPage(ctx, subreddit, listing)
+			if err != nil {
+				in.logger.ErrorContext(ctx, "backfill stopped", "listing", listing.Sort, "t", listing.Time,
+					"fetched", fetched, "error", err)
+				break
+			}
+			for _, post := range resp.Posts {
+				fetched++
+				if post.Created.After(in.client.ProgramStartTime) {
+					// polling picks up the posts created since the start
+					continue
+				}
+				post.Backfilled = true
+				queue <- queueItem{post: post}
+				queued++
+				in.metrics.SetQueueDepth(len(queue))
+			}
+			if resp.After == "" || len(resp.Posts) == 0 {
+				break
+			}
+			listing.After = resp.After
+		}
+		in.logger.InfoContext(ctx, "backfill done", "listing", listing.Sort, "t", listing.Time,
+			"fetched", fetched, "queued", queued)
+	}
+}
+
+// fetchBackfillPage fetches one page of a backfill listing, retrying failures after fetchRetryDelay
+func (in *ingester) fetchBackfillPage(ctx context.Context, subreddit string, listing socialmedia.Listing) (socialmedia.RedditResponse, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := in.client.FetchListing(ctx, subreddit, listing)
+		in.tracker.RecordFetch(subreddit, err)
+		if err == nil {
+			rateLimit := in.client.RateLimitStatus()
+			in.bus.Publish(events.Event{Type: events.FetchCompleted, Subreddit: subreddit, RateLimit: &rateLimit})
+			return resp, nil
+		}
+		in.bus.Publish(events.Event{Type: events.FetchFailed, Subreddit: subreddit, Err: err.Error()})
+		if attempt > backfillRetries || ctx.Err() != nil {
+			return socialmedia.RedditResponse{}, err
+		}
+		in.logger.WarnContext(ctx, "fetching backfill page failed", "error", err, "retry_in", fetchRetryDelay)
+		select {
+		case <-ctx.Done():
+			return socialmedia.RedditResponse{}, ctx.Err()
+		case <-time.After(fetchRetryDelay):
+		}
+	}
+}
+
+// fetchSubreddit polls the first page of the subreddit's listings in turn, failed fetches are retried after
+// fetchRetryDelay and show up in the health checks
+func (in *ingester) fetchSubreddit(subreddit string, queue chan<- queueItem) {
+	ctx := logging.WithAttrs(context.Background(), slog.String("subreddit", subreddit))
+	listings := in.listings[subreddit]
+	if len(listings) == 0 {
+		listings = []socialmedia.Listing{{Sort: "new"}}
+	}
+	for {
+		for _, listing := range listings {
+			listing.Limit = socialmedia.MaxListingLimit
+			err := in.fetchListing(ctx, subreddit, listing, queue)
+			if err != nil {
+				in.logger.ErrorContext(ctx, "fetching posts failed", "listing", listing.String(), "error", err, "retry_in", fetchRetryDelay)
+				time.Sleep(fetchRetryDelay)
+			}
+		}
+	}
+}
+
+// fetchListing fetches one page of a listing. From new it queues the posts created after the program started,
+// from the other listings every post, the older ones marked as backfilled, followed by their ranks.
+func (in *ingester) fetchListing(ctx context.Context, subreddit string, listing socialmedia.Listing, queue chan<- queueItem) error {
+	resp, err := in.client.FetchListing(ctx, subreddit, listing)
+	in.tracker.RecordFetch(subreddit, err)
+	if err != nil {
+		in.bus.Publish(events.Event{Type: events.FetchFailed, Subreddit: subreddit, Err: err.Error()})
+		return err
+	}
+	polled := time.Now()
+	rateLimit := in.client.RateLimitStatus()
+	in.bus.Publish(events.Event{Type: events.FetchCompleted, Subreddit: subreddit, RateLimit: &rateLimit})
+
+	ranked := listing.Sort != "new"
+	postIDs := make([]string, 0, len(resp.Posts))
+	for _, post := range resp.Posts {
+		postIDs = append(postIDs, post.PostID)
+		if !post.Created.After(in.client.ProgramStartTime) {
+			if !ranked {
+				continue
+			}
+			post.Backfilled = true
+		}
+		queue <- queueItem{post: post}
+		in.metrics.SetQueueDepth(len(queue))
+	}
+	if ranked {
+		// the rank in new is only the age of the post
+		queue <- queueItem{ranks: &listingRanks{subreddit: subreddit, listing: listing.String(), postIDs: postIDs, polled: polled}}
+	}
+	return nil
+}
+
+// savePosts drains the queue into the store until it is closed
+func (in *ingester) savePosts(queue <-chan queueItem) {
+	for item := range queue {
+		in.metrics.SetQueueDepth(len(queue))
+		if item.ranks != nil {
+			in.recordRanks(item.ranks)
+			continue
+		}
+		post := item.post
+		ctx := logging.WithAttrs(context.Background(),
+			slog.String("subreddit", post.SubReddit), slog.String("post_id", post.PostID))
+
+		err := statistics.SaveUniquePost(in.store, &post)
+		switch {
+		case errors.Is(err, store.ErrDuplicatePost):
+			in.metrics.DuplicateSkipped(post.SubReddit)
+			if item.refreshed || post.State != socialmedia.PostActive {
+				in.updateState(ctx, post)
+			}
+			in.recordRevision(ctx, post)
+			// posts are seen again while they are on the listing, which builds their score history
+			changed, err := in.store.UpdatePostScore(&post)
+			if err != nil {
+				in.logger.ErrorContext(ctx, "failed to update post score", "error", err)
+				break
+			}
+			if !changed {
+				break
+			}
+			updated := post
+			in.bus.Publish(events.Event{Type: events.PostUpdated, Subreddit: post.SubReddit, Post: &updated})
+			// score thresholds may be crossed now
+			in.alerts.CheckPost(post)
+			in.webhooks.PostUpdated(post)
+		case err != nil:
+			in.logger.ErrorContext(ctx, "failed to save post", "error", err)
+		default:
+			in.metrics.PostIngested(post.SubReddit)
+			published := post
+			in.bus.Publish(events.Event{Type: events.PostIngested, Subreddit: post.SubReddit, Post: &published})
+			in.alerts.CheckPost(post)
+			in.webhooks.PostIngested(post)
+			in.trending.Add(post)
+		}
+		in.logger.DebugContext(ctx, "post seen", "comments", post.NumComments,
+			"author", post.Author, "title", post.Title)
+	}
+}
+
+// updateState records that the post was seen and publishes it when it was seen deleted or removed for the first time
+func (in *ingester) updateState(ctx context.Context, post socialmedia.Post) {
+	changed, err := in.store.UpdatePostState(&post, time.Now())
+	if err != nil {
+		in.logger.ErrorContext(ctx, "failed to update post state", "error", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	in.logger.InfoContext(ctx, "post disappeared", "state", post.State, "removed_by", post.RemovedBy,
+		"after", post.Disappeared.Sub(post.Created).Round(time.Second))
+	gone := post
+	in.bus.Publish(events.Event{Type: events.PostRemoved, Subreddit: post.SubReddit, Post: &gone})
+}
+
+// recordRevision stores a revision when the title or body of the post changed and publishes the edited post
+func (in *ingester) recordRevision(ctx context.Context, post socialmedia.Post) {
+	edited, err := in.store.RecordPostRevision(&post, time.Now())
+	if err != nil {
+		in.logger.ErrorContext(ctx, "failed to record post revision", "error", err)
+		return
+	}
+	if !edited {
+		return
+	}
+	in.logger.InfoContext(ctx, "post edited", "upvotes", post.UpVotes, "comments", post.NumComments, "edited", post.Edited)
+	published := post
+	in.bus.Publish(events.Event{Type: events.PostEdited, Subreddit: post.SubReddit, Post: &published})
+}
+
+// recordRanks stores the ranks of a listing page
+func (in *ingester) recordRanks(ranks *listingRanks) {
+	ctx := logging.WithAttrs(context.Background(), slog.String("subreddit", ranks.subreddit))
+	changes, err := in.store.RecordListingRanks(ranks.subreddit, ranks.listing, ranks.postIDs, ranks.polled)
+	if err != nil {
+		in.logger.ErrorContext(ctx, "failed to record listing ranks", "listing", ranks.listing, "error", err)
+		return
+	}
+	in.logger.DebugContext(ctx, "listing ranks recorded", "listing", ranks.listing, "changes", changes)
+}
@@ -0,0 +1,221 @@
+// Package language detects the language of post titles and bodies offline. Latin script languages are told apart by
+// a character trigram model trained on the texts embedded from the corpus directory, short posts written for it and
+// the vimtutor lessons of Vim in corpus/vimtutor, other scripts by their alphabet.
+// Detection is deterministic, the same text always gets the same language.
+package language
+
+import (
+	"cmp"
+	"embed"
+	"errors"
+	"io/fs"
+	"math"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Unknown is the language of texts too short or too mixed to tell, the ISO 639 code for undetermined
+const Unknown = "und"
+
+// MinLetters is how many letters a text needs for its language to be detected
+const MinLetters = 12
+
+// smoothing is added to the count of every trigram, so trigrams missing from a corpus don't rule its language out
+const smoothing = 0.05
+
+// minMargin is how much more likely per trigram the best language has to be than the runner-up
+const minMargin = 0.03
+
+//go:embed corpus/*.txt corpus/vimtutor/*.txt
+var corpusFiles embed.FS
+
+// exercisePrefix starts the exercise lines of the vimtutor lessons, which are misspelled on purpose
+const exercisePrefix = "--->"
+
+// model holds the trigram counts of one language
+type model struct {
+	language string
+	counts   map[string]float64
+	total    float64
+}
+
+// models are trained once from the embedded corpus, one file per ISO 639-1 code and its vimtutor lessons if there are any
+var models = func() []model {
+	entries, err := corpusFiles.ReadDir("corpus")
+	if err != nil {
+		panic("reading the embedded corpus: " + err.Error())
+	}
+	var trained []model
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		text, err := corpusFiles.ReadFile(path.Join("corpus", entry.Name()))
+		if err != nil {
+			panic("reading the embedded corpus: " + err.Error())
+		}
+		lessons, err := corpusFiles.ReadFile(path.Join("corpus", "vimtutor", entry.Name()))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			panic("reading the embedded corpus: " + err.Error())
+		}
+		m := model{language: strings.TrimSuffix(entry.Name(), ".txt"), counts: map[string]float64{}}
+		for _, trigram := range trigrams(string(text) + "\n" + withoutExercises(string(lessons))) {
+			m.counts[trigram]++
+			m.total++
+		}
+		trained = append(trained, m)
+	}
+	return trained
+}()
+
+// withoutExercises drops the exercise lines of the vimtutor lessons
+func withoutExercises(lessons string) string {
+	lines := strings.Split(lessons, "\n")
+	lines = slices.DeleteFunc(lines, func(line string) bool {
+		return strings.HasPrefix(strings.TrimSpace(line), exercisePrefix)
+	})
+	return strings.Join(lines, "\n")
+}
+
+// scripts maps the scripts written by a single language of those detected to it
+var scripts = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Thai, "th"},
+}
+
+// Languages returns the codes of the languages Detect knows, in order
+func Languages() []string {
+	var languages []string
+	for _, m := range models {
+		languages = append(languages, m.language)
+	}
+	for _, s := range scripts {
+		languages = append(languages, s.language)
+	}
+	slices.Sort(languages)
+	return slices.Compact(languages)
+}
+
+// Detect returns the ISO 639-1 code of the language of text, Unknown when it has fewer than MinLetters letters
+// or no language is clearly more likely than the others. Links, subreddit and user names are ignored.
+func Detect(text string) string {
+	text = clean(text)
+	letters, latin := 0, 0
+	byScript := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				byScript[s.language]++
+				break
+			}
+		}
+	}
+	if letters < MinLetters {
+		return Unknown
+	}
+	if latin*2 < letters {
+		return scriptLanguage(byScript, letters)
+	}
+	return classify(text)
+}
+
+// scriptLanguage returns the language of the script most letters are written in, Japanese when there is any kana
+// since Japanese is written in Han characters as well
+func scriptLanguage(byScript map[string]int, letters int) string {
+	if byScript["ja"] > 0 {
+		return "ja"
+	}
+	best, count := Unknown, 0
+	for _, s := range scripts {
+		if byScript[s.language] > count {
+			best, count = s.language, byScript[s.language]
+		}
+	}
+	if count*2 < letters {
+		return Unknown
+	}
+	return best
+}
+
+// classify returns the most likely of the trained languages for text, by the naive Bayes probability of its trigrams
+func classify(text string) string {
+	grams := trigrams(text)
+	if len(grams) == 0 {
+		return Unknown
+	}
+	type score struct {
+		language string
+		logP     float64
+	}
+	scores := make([]score, 0, len(models))
+	for _, m := range models {
+		vocabulary := float64(len(m.counts))
+		logP := 0.0
+		for _, trigram := range grams {
+			logP += math.Log((m.counts[trigram] + smoothing) / (m.total + smoothing*vocabulary))
+		}
+		scores = append(scores, score{language: m.language, logP: logP})
+	}
+	slices.SortFunc(scores, func(a, b score) int {
+		return cmp.Or(cmp.Compare(b.logP, a.logP), cmp.Compare(a.language, b.language))
+	})
+	if len(scores) > 1 && (scores[0].logP-scores[1].logP)/float64(len(grams)) < minMargin {
+		return Unknown
+	}
+	return scores[0].language
+}
+
+// clean drops the links and the subreddit and user names of text
+func clean(text string) string {
+	fields := strings.Fields(text)
+	kept := fields[:0]
+	for _, field := range fields {
+		lower := strings.ToLower(field)
+		name := strings.TrimPrefix(lower, "/")
+		if strings.Contains(lower, "://") || strings.HasPrefix(lower, "www.") || strings.HasPrefix(name, "r/") || strings.HasPrefix(name, "u/") {
+			continue
+		}
+		kept = append(kept, field)
+	}
+	return strings.Join(kept, " ")
+}
+
+// trigrams returns the character trigrams of the lowercase words of text, each word padded with a space on both sides
+// so the trigrams at the start and end of words count as well
+func trigrams(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\'' && r != '’'
+	})
+	var grams []string
+	for _, word := range words {
+		runes := []rune(" " + strings.Trim(word, "'’") + " ")
+		if len(runes) < 3 {
+			continue
+		}
+		for i := 0; i+3 <= len(runes); i++ {
+			grams = append(grams, string(runes[i:i+3]))
+		}
+	}
+	return grams
+}
@@ -0,0 +1,85 @@
+package language
+
+import (
+	"bufio"
+	"github.com/stretchr/testify/assert"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// minAccuracy is the share of the held-out titles Detect has to get right, overall and for every language
+const minAccuracy = 0.9
+
+func TestDetect(t *testing.T) {
+	for text, language := range map[string]string{
+		"What do you think about the new trailer for the movie?":  "en",
+		"Was haltet ihr von dem neuen Trailer zum Film?":          "de",
+		"Que pensez-vous de la nouvelle bande-annonce du film ?":  "fr",
+		"¿Qué os parece el nuevo tráiler de la película?":         "es",
+		"Cosa ne pensate del nuovo trailer del film?":             "it",
+		"O que vocês acharam do novo trailer do filme?":           "pt",
+		"Wat vinden jullie van de nieuwe trailer van de film?":    "nl",
+		"Vad tycker ni om den nya trailern till filmen?":          "sv",
+		"Hilfe, mein Rechner startet nicht mehr":                  "de",
+		"Just finished my first marathon, feeling great":          "en",
+		"Что вы думаете о новом трейлере?":                        "ru",
+		"新しい予告編についてどう思いますか":                                       "ja",
+		"你们觉得新的预告片怎么样":                                            "zh",
+		"Help":                                                    Unknown,
+		"https://www.example.com/some/very/long/path r/movies":    Unknown,
+		"Mon ordinateur ne démarre plus https://example.com/aide": "fr",
+	} {
+		assert.Equal(t, language, Detect(text), text)
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	languages := Languages()
+	assert.Contains(t, languages, "en")
+	assert.Contains(t, languages, "ja")
+	assert.IsNonDecreasing(t, languages)
+	assert.NotContains(t, languages, Unknown)
+}
+
+func TestHeldOutAccuracy(t *testing.T) {
+	file, err := os.Open("testdata/heldout.tsv")
+	if err != nil {
+		t.Fatalf("could not open the held-out titles: %v", err)
+	}
+	defer file.Close()
+
+	total := make(map[string]int)
+	correct := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		language, title, found := strings.Cut(line, "\t")
+		if !found {
+			t.Fatalf("malformed line %q", line)
+		}
+		total[language]++
+		if detected := Detect(title); detected == language {
+			correct[language]++
+		} else {
+			t.Logf("%s: detected %s for %q", language, detected, title)
+		}
+	}
+	assert.NoError(t, scanner.Err())
+
+	all, allCorrect := 0, 0
+	for _, language := range slices.Sorted(maps.Keys(total)) {
+		n := total[language]
+		all += n
+		allCorrect += correct[language]
+		accuracy := float64(correct[language]) / float64(n)
+		t.Logf("%s: %d of %d (%.0f%%)", language, correct[language], n, accuracy*100)
+		assert.GreaterOrEqual(t, accuracy, minAccuracy, language)
+	}
+	assert.GreaterOrEqual(t, float64(allCorrect)/float64(all), minAccuracy)
+}
@@ -0,0 +1,53 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// GormLogger routes GORM's logging through slog, SQL traces are logged at debug level
+type GormLogger struct {
+	Logger        *slog.Logger
+	SlowThreshold time.Duration
+}
+
+var _ logger.Interface = &GormLogger{}
+
+// LogMode is a no-op, the slog handler level decides what is written
+func (g *GormLogger) LogMode(logger.LogLevel) logger.Interface {
+	return g
+}
+
+func (g *GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	g.Logger.InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (g *GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	g.Logger.WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (g *GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	g.Logger.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (g *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && !strings.Contains(err.Error(), "UNIQUE constraint failed"):
+		// missing records and duplicate posts are expected, they fall through to the debug trace
+		sql, rows := fc()
+		g.Logger.ErrorContext(ctx, "query failed", "error", err, "sql", sql, "rows", rows, "elapsed", elapsed)
+	case g.SlowThreshold > 0 && elapsed > g.SlowThreshold:
+		sql, rows := fc()
+		g.Logger.WarnContext(ctx, "slow query", "sql", sql, "rows", rows, "elapsed", elapsed)
+	case g.Logger.Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		g.Logger.DebugContext(ctx, "query", "sql", sql, "rows", rows, "elapsed", elapsed)
+	}
+}
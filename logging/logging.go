@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Component names used across donkey, every component logger carries one as the "component" field
+const (
+	ComponentClient    = "client"
+	ComponentScheduler = "scheduler"
+	ComponentStore     = "store"
+	ComponentAPI       = "api"
+	ComponentImporter  = "importer"
+	ComponentAlerts    = "alerts"
+	ComponentWebhooks  = "webhooks"
+	ComponentBots      = "bots"
+	ComponentAuthors   = "authors"
+)
+
+// Options controls the root logger
+type Options struct {
+	// Level is one of debug, info, warn or error
+	Level string
+	// Format is text or json
+	Format string
+}
+
+// ParseLevel maps the level names accepted in the configuration to a slog.Level
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	err := l.UnmarshalText([]byte(level))
+	if err != nil {
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", level)
+	}
+	return l, nil
+}
+
+// New creates the root logger writing to w, records include the fields stored in the context with WithAttrs
+func New(w io.Writer, opts Options) (*slog.Logger, error) {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+	handlerOpts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(opts.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q, expected text or json", opts.Format)
+	}
+	return slog.New(&contextHandler{Handler: handler}), nil
+}
+
+// Component returns a child logger for one part of donkey
+func Component(logger *slog.Logger, name string) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With("component", name)
+}
+
+// MinLevel returns a logger dropping the records below level, on top of the level of logger itself
+func MinLevel(logger *slog.Logger, level slog.Level) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return slog.New(&minLevelHandler{Handler: logger.Handler(), level: level})
+}
+
+type minLevelHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (h *minLevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level && h.Handler.Enabled(ctx, level)
+}
+
+func (h *minLevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &minLevelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *minLevelHandler) WithGroup(name string) slog.Handler {
+	return &minLevelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+type ctxKey struct{}
+
+// WithAttrs returns a context carrying fields such as subreddit, post_id or request_id,
+// they are added to every record logged with that context
+func WithAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	existing, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	merged := make([]slog.Attr, 0, len(existing)+len(attrs))
+	merged = append(merged, existing...)
+	merged = append(merged, attrs...)
+	return context.WithValue(ctx, ctxKey{}, merged)
+}
+
+// Attrs returns the fields stored in the context with WithAttrs
+func Attrs(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(ctxKey{}).([]slog.Attr)
+	return attrs
+}
+
+// contextHandler adds the context fields to each record before passing it on
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs := Attrs(ctx); len(attrs) > 0 {
+		r = r.Clone()
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"testing"
+)
+
+func TestContextAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Level: "info", Format: "json"})
+	assert.NoError(t, err)
+
+	ctx := WithAttrs(context.Background(), slog.String("subreddit", "music"))
+	ctx = WithAttrs(ctx, slog.String("post_id", "abc"))
+	Component(logger, ComponentScheduler).InfoContext(ctx, "post seen")
+
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "post seen", record["msg"])
+	assert.Equal(t, "scheduler", record["component"])
+	assert.Equal(t, "music", record["subreddit"])
+	assert.Equal(t, "abc", record["post_id"])
+}
+
+func TestLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Level: "warn", Format: "text"})
+	assert.NoError(t, err)
+
+	logger.Info("hidden")
+	assert.Zero(t, buf.Len())
+	logger.Warn("shown")
+	assert.Contains(t, buf.String(), "msg=shown")
+}
+
+func TestInvalidOptions(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, Options{Level: "loud", Format: "text"})
+	assert.Error(t, err)
+	_, err = New(&bytes.Buffer{}, Options{Level: "info", Format: "xml"})
+	assert.Error(t, err)
+}
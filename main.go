@@ -2,172 +2,266 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/Valimere/donkey/config"
 	"github.com/Valimere/donkey/db"
+	"github.com/Valimere/donkey/logging"
 	"github.com/Valimere/donkey/socialmedia"
-	"github.com/Valimere/donkey/statistics"
 	"github.com/Valimere/donkey/store"
-	"log"
+	"io"
+	"log/slog"
 	"os"
-	"os/signal"
+	"strconv"
 	"strings"
-	"sync"
-	"syscall"
 	"time"
 )
 
+// command is a single donkey subcommand, run receives the arguments following the subcommand name
+type command struct {
+	name    string
+	summary string
+	run     func(cfg *config.Config, args []string) error
+}
+
+var commands = []*command{
+	{name: "run", summary: "authorize if needed, then ingest posts and print statistics on ctl + c", run: runCommand},
+	{name: "auth", summary: "manage the reddit OAuth token (login, status, revoke)", run: authCommand},
+	{name: "stats", summary: "print statistics from an existing database without contacting reddit", run: statsCommand},
+	{name: "ranks", summary: "print the posts that reached the front of a listing and how long they stayed", run: ranksCommand},
+	{name: "backfill", summary: "store the posts created before now by paging back through /new and /top", run: backfillCommand},
+	{name: "export", summary: "write posts, authors, snapshots, comments or sessions as csv, jsonl or parquet", run: exportCommand},
+	{name: "import", summary: "import Pushshift-style NDJSON dumps of submissions and comments", run: importCommand},
+	{name: "subreddits", summary: "manage the persisted list of subreddits (list, add, remove)", run: subredditsCommand},
+	{name: "migrate", summary: "create or update the database schema", run: migrateCommand},
+	{name: "config", summary: "show the effective configuration", run: configCommand},
+}
+
+// errUsage is returned by a subcommand when its arguments are invalid and usage has already been printed
+var errUsage = errors.New("invalid usage")
+
 // handleFatalErrors is a helper function to make error handling more uniform
-func handleFatalErrors(err error, msg string) {
+func handleFatalErrors(logger *slog.Logger, err error, msg string, args ...any) {
 	if err != nil {
-		log.Fatalf("%s: %s", msg, err)
+		logger.Error(msg, append(args, "error", err)...)
+		os.Exit(1)
 	}
 }
 
-// parseSubreddits : Clean up the subreddits input
-func parseSubreddits(subredditsArg *string) []string {
-	// Split the subredditsArg into a slice of uncleanSubreddits
-	uncleanSubreddits := strings.Split(*subredditsArg, ",")
-
-	// Create a new slice for the cleaned subreddits
-	var subreddits []string
-	for _, subreddit := range uncleanSubreddits {
-		subreddit = strings.TrimSpace(subreddit)
-		if subreddit != "" {
-			subreddits = append(subreddits, subreddit)
+// newFlagSet creates a flag set for a subcommand with a help text describing it
+func newFlagSet(name, args, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet("donkey "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		out := fs.Output()
+		fmt.Fprintf(out, "Usage: donkey %s %s\n\n%s\n", name, args, description)
+		hasFlags := false
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintf(out, "\nFlags:\n")
+			fs.PrintDefaults()
 		}
 	}
-	log.Printf("Subreddits chosen: %v\n", subreddits)
-	return subreddits
-}
-
-// Fetch and print posts from a single subreddit
-func fetchAndPrint(client *socialmedia.Client, subreddits []string, dbStore store.Store) {
-	var wg sync.WaitGroup
-
-	for _, subreddit := range subreddits {
-		wg.Add(1)
-		go func(subreddit string) {
-			defer wg.Done()
-			var after string
-			for {
-				resp, err := client.FetchPosts(context.Background(), subreddit, socialmedia.PaginationOptions{After: after})
-				handleFatalErrors(err, fmt.Sprintf("Error fetching posts for subreddit: %s", subreddit))
-				for _, post := range resp.Posts {
-					if post.Created.After(client.ProgramStartTime) {
-						err := statistics.SaveUniquePost(dbStore, &post)
-						if err != nil {
-							log.Printf("Failed to save post statistic error:%s\n", err)
-						}
-						if client.Debug {
-							fmt.Printf("Post PostID: %s, NumComments:%4d, Subreddit: %12s, Author:%24s, Title: %s\n",
-								post.PostID, post.NumComments, post.SubReddit, post.Author, post.Title)
-						}
-					}
-
-				}
-				after = resp.After
-			}
-		}(subreddit)
-	}
-	wg.Wait()
-
-}
-
-func printStatisticsAndExit(dbStore store.Store) {
-	authorStatistics, err := statistics.GetTopPoster(dbStore)
-	if err != nil {
-		fmt.Printf("Error getting author statistics: %s\n", err)
-		os.Exit(1)
-		return
+	return fs
+}
+
+// listFlag is a flag.Value for comma-separated lists, i.e. "Askreddit, music"
+type listFlag []string
+
+func (l *listFlag) String() string {
+	if l == nil {
+		return ""
 	}
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = config.SplitList(value)
+	return nil
+}
+
+// debugFlag is a boolean flag that switches the log level to debug
+type debugFlag struct {
+	level *string
+}
+
+func (d debugFlag) IsBoolFlag() bool { return true }
 
-	fmt.Printf("\n\nAuthor Statistics:\n")
-	for _, authorStatistic := range authorStatistics {
-		fmt.Printf("Author: %s, PostsCount: %d\n", authorStatistic.Author, authorStatistic.TotalPosts)
+func (d debugFlag) String() string {
+	if d.level == nil {
+		return "false"
 	}
-	postStatistics, err := statistics.GetTopPosts(dbStore)
+	return strconv.FormatBool(*d.level == "debug")
+}
+
+func (d debugFlag) Set(value string) error {
+	enabled, err := strconv.ParseBool(value)
 	if err != nil {
-		fmt.Printf("Error in getting post statistics %s\n", err)
-		os.Exit(1)
-		return
+		return err
 	}
-	fmt.Printf("\n\nPost Statistics:\n")
-	for _, postStatistic := range postStatistics {
-		fmt.Printf("Post PostID: %8s, UpVotes: %4d, Comments: %4d, Author: %24s\n",
-			postStatistic.PostID, postStatistic.UpVotes, postStatistic.NumComments, postStatistic.Author)
+	if enabled {
+		*d.level = "debug"
 	}
+	return nil
+}
+
+// addStorageFlags registers the flags shared by every subcommand that opens the database,
+// the loaded configuration provides the defaults so explicitly set flags take precedence over it
+func addStorageFlags(fs *flag.FlagSet, cfg *config.Config) {
+	fs.StringVar(&cfg.Storage.DSN, "db", cfg.Storage.DSN, "sqlite database path or DSN (storage.dsn)")
+	fs.Var(debugFlag{level: &cfg.Log.Level}, "debug", "shorthand for -log-level debug")
+	fs.StringVar(&cfg.Log.Level, "log-level", cfg.Log.Level, "debug, info, warn or error (log.level)")
+	fs.StringVar(&cfg.Log.Format, "log-format", cfg.Log.Format, "text or json (log.format)")
+	fs.BoolVar(&cfg.Log.DumpRequests, "dump-requests", cfg.Log.DumpRequests, "log every outgoing HTTP request (log.dump_requests)")
+	fs.StringVar(&cfg.Log.File, "log-file", cfg.Log.File, "append logs to this file instead of stderr (log.file)")
+}
 
-	os.Exit(0)
+// setupLogging replaces the default logger, which the log package also writes through, with the configured one
+func setupLogging(cfg *config.Config) error {
+	var out io.Writer = os.Stderr
+	if cfg.Log.File != "" {
+		// the file stays open for the lifetime of the process
+		f, err := os.OpenFile(cfg.Log.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = f
+	}
+	logger, err := logging.New(out, logging.Options{Level: cfg.Log.Level, Format: cfg.Log.Format})
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
 }
 
-func clearStatistics(dbStore store.Store) {
-	// Clear all rows in the AuthorStatistic table.
-	err := dbStore.ClearAuthorStatistics()
+// parseFlags parses the subcommand flags into cfg, validates the result and sets up logging,
+// parse failures map to errUsage since the flag set already reported them
+func parseFlags(fs *flag.FlagSet, args []string, cfg *config.Config) error {
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return flag.ErrHelp
+	}
 	if err != nil {
-		// Log the error
-		log.Println("Error clearing author_statistics:", err)
+		return errUsage
 	}
-	err = dbStore.ClearPosts()
+	err = cfg.Validate()
 	if err != nil {
-		log.Println("error clearing posts:", err)
+		return fmt.Errorf("invalid configuration:\n%w", err)
 	}
+	return setupLogging(cfg)
 }
 
-func main() {
-	subredditsArg := flag.String("r", "Askreddit", "comma-separated list of subreddits i.e. \"Askreddit, music\"")
-	debugFlag := flag.Bool("debug", false, "enable debug mode")
-	flag.Parse()
+// clientOptions maps the configuration onto the reddit client options
+func clientOptions(cfg *config.Config) socialmedia.Options {
+	return socialmedia.Options{
+		ClientID:          cfg.Reddit.ClientID,
+		ClientSecret:      cfg.Reddit.ClientSecret,
+		UserAgent:         cfg.Reddit.UserAgent,
+		RedirectURL:       cfg.HTTP.RedirectURL,
+		CallbackListen:    cfg.HTTP.CallbackListen,
+		RequestsPerMinute: cfg.RateLimit.RequestsPerMinute,
+		Burst:             cfg.RateLimit.Burst,
+		DumpRequests:      cfg.Log.DumpRequests,
+		Logger:            slog.Default(),
+	}
+}
 
-	// Initialize db connection and create store
-	dbInstance, err := db.InitDB(*debugFlag)
+// openStore initializes the db connection and wraps it in a store
+func openStore(cfg *config.Config) (*db.DbStore, error) {
+	dbInstance, err := db.InitDB(cfg.Storage.DSN, slog.Default())
 	if err != nil {
-		handleFatalErrors(err, "Failed to initialize database: ")
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
+	return &db.DbStore{DB: dbInstance, Logger: logging.Component(slog.Default(), logging.ComponentStore), ExcludeBots: cfg.Bots.Exclude}, nil
+}
 
-	var dbStore store.Store = &db.DbStore{DB: dbInstance}
-	clearStatistics(dbStore)
+// newAuthorizedClient returns a client using the stored token, running the browser OAuth flow
+// when there is no usable token or when forceLogin is set
+func newAuthorizedClient(dbStore store.Store, cfg *config.Config, forceLogin bool) (*socialmedia.Client, error) {
+	err := cfg.ValidateReddit()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
 
 	// Check if a token exists in the database
 	dbToken, err := dbStore.GetToken()
 	if err != nil {
 		if err.Error() == "record not found" {
-			log.Println("No existing token found in the database. Requesting a new one.")
+			slog.Info("no existing token found in the database, requesting a new one")
 		} else {
-			log.Fatalf("Unexpected error retrieving token from the store: %v\n", err)
+			return nil, fmt.Errorf("unexpected error retrieving token from the store: %w", err)
 		}
 	}
 
-	// Create a channel to listen for OS signals, print statistics on ctl + c
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		<-sigs
-		printStatisticsAndExit(dbStore)
-	}()
-
-	subreddits := parseSubreddits(subredditsArg)
+	if !forceLogin && dbToken.Valid() && !dbToken.Expiry.Before(time.Now()) {
+		// If the token exists, and it has not expired, use it
+		return socialmedia.NewClientWithToken(dbToken, clientOptions(cfg)), nil
+	}
 
-	var smClient *socialmedia.Client
+	smClient := socialmedia.NewClient(clientOptions(cfg))
+	err = smClient.StartServer(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("error in server: %w", err)
+	}
 
-	if dbToken.Valid() && !dbToken.Expiry.Before(time.Now()) {
-		// If the token exists, and it has not expired, use it
-		smClient = socialmedia.NewClientWithToken(dbToken, *debugFlag)
-	} else {
-		smClient = socialmedia.NewClient(*debugFlag)
+	token, err := smClient.ExchangeAuthCode(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange auth code: %w", err)
+	}
+	slog.Info("token received", "expiry", token.Expiry)
 
-		serverErr := smClient.StartServer(context.Background())
-		handleFatalErrors(serverErr, "Error in server")
+	err = dbStore.SaveToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save the token: %w", err)
+	}
+	return smClient, nil
+}
 
-		token, err := smClient.ExchangeAuthCode(context.Background())
-		handleFatalErrors(err, "Failed to exchange auth code")
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: donkey [-config file] <command> [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-11s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nRun \"donkey <command> -h\" for the flags of a command.\n\nGlobal flags:\n")
+	flag.PrintDefaults()
+}
 
-		log.Printf("token received: %s", token.AccessToken)
+func main() {
+	configPath := flag.String("config", "", "config file, defaults to $"+config.PathEnv+" or "+config.DefaultPath+" when it exists")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
 
-		err = dbStore.SaveToken(token)
-		handleFatalErrors(err, "Failed to save the token")
+	name := flag.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "donkey: %s\n", err)
+			os.Exit(1)
+		}
+		err = cmd.run(cfg, flag.Args()[1:])
+		switch {
+		case err == nil:
+			os.Exit(0)
+		case errors.Is(err, flag.ErrHelp):
+			os.Exit(0)
+		case errors.Is(err, errUsage):
+			os.Exit(2)
+		default:
+			fmt.Fprintf(os.Stderr, "donkey %s: %s\n", name, err)
+			os.Exit(1)
+		}
 	}
 
-	fetchAndPrint(smClient, subreddits, dbStore)
+	fmt.Fprintf(flag.CommandLine.Output(), "donkey: unknown command %q\n\n", name)
+	flag.Usage()
+	os.Exit(2)
 }
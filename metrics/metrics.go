@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "donkey"
+
+// Metrics holds the ingestion collectors, a nil *Metrics is valid and records nothing
+// so components can be used without instrumentation, i.e. in tests or offline subcommands
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests           *prometheus.CounterVec
+	requestDuration    *prometheus.HistogramVec
+	rateLimitUsed      prometheus.Gauge
+	rateLimitRemaining prometheus.Gauge
+	rateLimitReset     prometheus.Gauge
+	postsIngested      *prometheus.CounterVec
+	duplicatesSkipped  *prometheus.CounterVec
+	storeWriteDuration *prometheus.HistogramVec
+	queueDepth         prometheus.Gauge
+	tokenExpiry        prometheus.Gauge
+}
+
+// New creates the collectors and registers them, together with the Go and process collectors, on a new registry
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reddit_requests_total",
+			Help:      "Reddit API requests by subreddit and HTTP status code, code is \"error\" when no response was received.",
+		}, []string{"subreddit", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "reddit_request_duration_seconds",
+			Help:      "Latency of reddit API requests, excluding the time spent waiting on the rate limiter.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"subreddit"}),
+		rateLimitUsed: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "reddit_ratelimit_used",
+			Help:      "Requests used in the current rate limit period, from the X-Ratelimit-Used header.",
+		}),
+		rateLimitRemaining: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "reddit_ratelimit_remaining",
+			Help:      "Requests remaining in the current rate limit period, from the X-Ratelimit-Remaining header.",
+		}),
+		rateLimitReset: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "reddit_ratelimit_reset_seconds",
+			Help:      "Seconds until the rate limit period resets, from the X-Ratelimit-Reset header.",
+		}),
+		postsIngested: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "posts_ingested_total",
+			Help:      "New posts stored by subreddit.",
+		}, []string{"subreddit"}),
+		duplicatesSkipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "posts_duplicates_skipped_total",
+			Help:      "Posts skipped because they were already stored, by subreddit.",
+		}, []string{"subreddit"}),
+		storeWriteDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "store_write_duration_seconds",
+			Help:      "Latency of store writes by operation.",
+			Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation"}),
+		queueDepth: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "ingest_queue_depth",
+			Help:      "Posts fetched and waiting to be written to the store.",
+		}),
+		tokenExpiry: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "oauth_token_expiry_timestamp_seconds",
+			Help:      "Unix time the reddit OAuth token expires at.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestDuration,
+		m.rateLimitUsed, m.rateLimitRemaining, m.rateLimitReset,
+		m.postsIngested, m.duplicatesSkipped,
+		m.storeWriteDuration, m.queueDepth, m.tokenExpiry,
+	)
+	return m
+}
+
+// Handler serves the registry in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// Registry exposes the underlying registry, mostly for tests
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// ObserveRequest records a reddit request, a code of 0 means no response was received
+func (m *Metrics) ObserveRequest(subreddit string, code int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	label := "error"
+	if code != 0 {
+		label = strconv.Itoa(code)
+	}
+	m.requests.WithLabelValues(subreddit, label).Inc()
+	m.requestDuration.WithLabelValues(subreddit).Observe(duration.Seconds())
+}
+
+// ObserveRateLimit records the rate limit headers of the latest response
+func (m *Metrics) ObserveRateLimit(used, remaining, reset float64) {
+	if m == nil {
+		return
+	}
+	m.rateLimitUsed.Set(used)
+	m.rateLimitRemaining.Set(remaining)
+	m.rateLimitReset.Set(reset)
+}
+
+func (m *Metrics) PostIngested(subreddit string) {
+	if m == nil {
+		return
+	}
+	m.postsIngested.WithLabelValues(subreddit).Inc()
+}
+
+func (m *Metrics) DuplicateSkipped(subreddit string) {
+	if m == nil {
+		return
+	}
+	m.duplicatesSkipped.WithLabelValues(subreddit).Inc()
+}
+
+// ObserveStoreWrite records how long a store write took, operation names the table or method
+func (m *Metrics) ObserveStoreWrite(operation string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.storeWriteDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+func (m *Metrics) SetQueueDepth(depth int) {
+	if m == nil {
+		return
+	}
+	m.queueDepth.Set(float64(depth))
+}
+
+func (m *Metrics) SetTokenExpiry(expiry time.Time) {
+	if m == nil || expiry.IsZero() {
+		return
+	}
+	m.tokenExpiry.Set(float64(expiry.Unix()))
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNilMetricsIsNoop(t *testing.T) {
+	var m *Metrics
+	assert.NotPanics(t, func() {
+		m.ObserveRequest("music", 200, time.Second)
+		m.ObserveRateLimit(1, 599, 60)
+		m.PostIngested("music")
+		m.DuplicateSkipped("music")
+		m.ObserveStoreWrite("save_post", time.Millisecond)
+		m.SetQueueDepth(3)
+		m.SetTokenExpiry(time.Now())
+	})
+}
+
+func TestObserve(t *testing.T) {
+	m := New()
+	m.ObserveRequest("music", 200, 100*time.Millisecond)
+	m.ObserveRequest("music", 200, 100*time.Millisecond)
+	m.ObserveRequest("music", 0, time.Second)
+	m.ObserveRateLimit(17, 583, 68)
+	m.PostIngested("movies")
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(m.requests.WithLabelValues("music", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.requests.WithLabelValues("music", "error")))
+	assert.Equal(t, float64(583), testutil.ToFloat64(m.rateLimitRemaining))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.postsIngested.WithLabelValues("movies")))
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, rec.Code)
+	assert.Contains(t, rec.Body.String(), `donkey_reddit_requests_total{code="200",subreddit="music"} 2`)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Valimere/donkey/config"
+	"github.com/Valimere/donkey/db"
+	"log/slog"
+)
+
+func migrateCommand(cfg *config.Config, args []string) error {
+	fs := newFlagSet("migrate", "[flags]",
+		"Creates the database if it doesn't exist and migrates it to the current schema.")
+	addStorageFlags(fs, cfg)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+
+	dbInstance, err := db.Open(cfg.Storage.DSN, slog.Default())
+	if err != nil {
+		return err
+	}
+	err = db.Migrate(dbInstance)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Database is up to date.")
+	return nil
+}
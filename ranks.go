@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Valimere/donkey/config"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/statistics"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const ranksDescription = `Prints the posts that reached the front of a subreddit listing and how long they stayed there,
+the longest stays first. The listing defaults to hot and has to be polled by "donkey run", see listings.default
+and listings.subreddits in the config file or "donkey run -listings". A * marks the posts still at the front.`
+
+func ranksCommand(cfg *config.Config, args []string) error {
+	fs := newFlagSet("ranks", "[flags] subreddit [listing]", ranksDescription)
+	front := fs.Int("front", 25, "ranks that count as the front of the listing")
+	limit := fs.Int("n", 10, "number of posts printed")
+	addStorageFlags(fs, cfg)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 || *front < 1 || *limit < 1 {
+		fs.Usage()
+		return errUsage
+	}
+	subreddit := strings.TrimPrefix(fs.Arg(0), "r/")
+	listing := socialmedia.Listing{Sort: "hot"}
+	if fs.NArg() == 2 {
+		var err error
+		listing, err = socialmedia.ParseListing(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+	}
+
+	dbStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	history, err := dbStore.GetListingHistory(subreddit, listing.String())
+	if err != nil {
+		return fmt.Errorf("failed to load the ranks: %w", err)
+	}
+	if history.Polled.IsZero() {
+		fmt.Printf("r/%s %s was never polled.\n", subreddit, listing)
+		return nil
+	}
+
+	stints := statistics.FrontPageStints(history, *front)
+	fmt.Printf("Posts that reached the top %d of r/%s %s, last polled %s:\n",
+		*front, history.Subreddit, listing, history.Polled.Local().Format(time.DateTime))
+	for i, stint := range stints[:min(*limit, len(stints))] {
+		title := ""
+		post, err := dbStore.GetPost(stint.PostID)
+		switch {
+		case err == nil:
+			title = truncate(post.Title, reportTitleWidth)
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return fmt.Errorf("failed to load post %s: %w", stint.PostID, err)
+		}
+		current := ""
+		if stint.Current {
+			current = "*"
+		}
+		fmt.Printf("%3d. %8s Best: %3d Reached: %s Stayed: %9s%1s %s\n",
+			i+1, stint.PostID, stint.BestRank, stint.Reached.Local().Format(time.DateTime),
+			stint.Duration.Round(time.Minute), current, title)
+	}
+	if len(stints) == 0 {
+		fmt.Println("None yet.")
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/statistics"
+	"github.com/Valimere/donkey/store"
+	"github.com/Valimere/donkey/trends"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// reportTitleWidth truncates post titles so each leaderboard entry stays on one line
+const reportTitleWidth = 60
+
+// runPeriodicReports prints a leaderboard report with the trending terms every interval until ctx is done
+func runPeriodicReports(ctx context.Context, out io.Writer, dbStore store.Store, client *socialmedia.Client, trending *trends.Tracker,
+	interval time.Duration, top int, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous *statistics.Report
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			report, err := statistics.BuildReport(dbStore, top, previous, client.RateLimitStatus(), now)
+			if err != nil {
+				logger.Error("building report failed", "error", err)
+				continue
+			}
+			printReport(out, report, previous != nil)
+			printTrending(out, "Trending:\n", trending, top)
+			previous = report
+		}
+	}
+}
+
+// printReport writes a compact leaderboard, movements are only shown when there is a previous report to compare to
+func printReport(out io.Writer, report *statistics.Report, hasPrevious bool) {
+	rateLimit := "rate limit unknown"
+	if report.RateLimitUtilization >= 0 {
+		rateLimit = fmt.Sprintf("rate limit %.0f%% used", report.RateLimitUtilization*100)
+	}
+	rate := ""
+	if hasPrevious {
+		rate = fmt.Sprintf(", %+.1f/min", report.IngestionRate)
+	}
+	fmt.Fprintf(out, "\n== Report %s, posts: %d%s, %s ==\n",
+		report.Time.Format(time.TimeOnly), report.TotalPosts, rate, rateLimit)
+
+	fmt.Fprintf(out, "Top posts:\n")
+	for i, post := range report.TopPosts {
+		fmt.Fprintf(out, "%3d. %s %8s UpVotes: %5d Comments: %4d %-16s %s\n",
+			i+1, movement(report.PostRanks[i], hasPrevious), post.PostID, post.UpVotes, post.NumComments,
+			"r/"+post.SubReddit, truncate(post.Title, reportTitleWidth))
+	}
+
+	fmt.Fprintf(out, "Top authors:\n")
+	for i, author := range report.TopAuthors {
+		fmt.Fprintf(out, "%3d. %s %-24s Posts: %4d UpVotes: %5d %s\n",
+			i+1, movement(report.AuthorRanks[i], hasPrevious), author.Author, author.TotalPosts, author.TotalUpvotes,
+			accountSummary(author.Account, report.Time))
+	}
+
+	fmt.Fprintf(out, "Subreddits:\n")
+	for _, subreddit := range report.Subreddits {
+		delta := ""
+		if hasPrevious {
+			delta = fmt.Sprintf(" (%+d)", report.SubredditDeltas[subreddit.Subreddit])
+		}
+		fmt.Fprintf(out, "     %-20s Posts: %5d%s\n", "r/"+subreddit.Subreddit, subreddit.TotalPosts, delta)
+	}
+}
+
+// printTrending writes the header and up to top trending terms of every subreddit that has any,
+// nothing when no subreddit has trending terms. It returns whether it wrote anything.
+func printTrending(out io.Writer, header string, trending *trends.Tracker, top int) bool {
+	printed := false
+	for _, subreddit := range trending.Subreddits() {
+		terms := trending.Trending(subreddit, top)
+		if len(terms) == 0 {
+			continue
+		}
+		if !printed {
+			fmt.Fprint(out, header)
+			printed = true
+		}
+		list := make([]string, 0, len(terms))
+		for _, term := range terms {
+			list = append(list, fmt.Sprintf("%s (%d, x%.1f)", term.Term, term.Count, term.Score))
+		}
+		fmt.Fprintf(out, "     %-20s %s\n", "r/"+subreddit, strings.Join(list, ", "))
+	}
+	return printed
+}
+
+// movement renders a rank change as a fixed width marker: [new], [ +2], [ -1] or [  =]
+func movement(change statistics.RankChange, hasPrevious bool) string {
+	switch {
+	case !hasPrevious:
+		return "     "
+	case change.New():
+		return "[new]"
+	case change.Movement() == 0:
+		return "[  =]"
+	default:
+		return fmt.Sprintf("[%+3d]", change.Movement())
+	}
+}
+
+// accountSummary describes the cached profile of an author, "-" until it is fetched
+func accountSummary(account *socialmedia.Account, now time.Time) string {
+	switch {
+	case account == nil:
+		return "-"
+	case account.NotFound:
+		return "deleted"
+	case account.Suspended:
+		return "suspended"
+	}
+	age := now.Sub(account.Created)
+	summary := fmt.Sprintf("%dd", int(age.Hours()/24))
+	if age >= 365*24*time.Hour {
+		summary = fmt.Sprintf("%dy", int(age.Hours()/24/365))
+	}
+	summary += fmt.Sprintf(" karma %d/%d", account.LinkKarma, account.CommentKarma)
+	if account.IsMod {
+		summary += " mod"
+	}
+	if account.IsGold {
+		summary += " gold"
+	}
+	return summary
+}
+
+func truncate(s string, width int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	return string(runes[:width-1]) + "…"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Valimere/donkey/events"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/statistics"
+	"github.com/Valimere/donkey/store"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// watchRising computes the rising leaderboard every interval until ctx is done
+// and publishes the posts entering it, the posts rising at the first check included
+func watchRising(ctx context.Context, dbStore store.Store, bus *events.Bus, opts statistics.RisingOptions,
+	interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous []socialmedia.PostVelocity
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			rising, err := statistics.GetRising(dbStore, now, opts)
+			if err != nil {
+				logger.Error("computing the rising posts failed", "error", err)
+				continue
+			}
+			for _, velocity := range statistics.NewlyRising(previous, rising) {
+				logger.Info("post is rising", "post_id", velocity.PostID, "subreddit", velocity.SubReddit,
+					"upvotes_per_minute", velocity.UpvotesPerMinute, "ratio", velocity.Ratio)
+				entered := velocity
+				bus.Publish(events.Event{Type: events.PostRising, Time: now, Subreddit: velocity.SubReddit, Velocity: &entered})
+			}
+			previous = rising
+		}
+	}
+}
+
+// printRising writes the rising leaderboard, up to top posts
+func printRising(out io.Writer, rising []socialmedia.PostVelocity, top int) {
+	fmt.Fprintf(out, "\n\nRising Posts:\n")
+	if len(rising) == 0 {
+		fmt.Fprintf(out, "No post is rising.\n")
+		return
+	}
+	for _, velocity := range rising[:min(top, len(rising))] {
+		fmt.Fprintf(out, "Post PostID: %8s, UpVotes/min: %6.1f, Comments/min: %5.1f, x%4.1f the r/%s baseline, Age: %s\n",
+			velocity.PostID, velocity.UpvotesPerMinute, velocity.CommentsPerMinute, velocity.Ratio, velocity.SubReddit,
+			velocity.Age.Round(time.Minute))
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/Valimere/donkey/alerts"
+	"github.com/Valimere/donkey/api"
+	"github.com/Valimere/donkey/authors"
+	"github.com/Valimere/donkey/bots"
+	"github.com/Valimere/donkey/config"
+	"github.com/Valimere/donkey/dashboard"
+	"github.com/Valimere/donkey/events"
+	"github.com/Valimere/donkey/health"
+	"github.com/Valimere/donkey/logging"
+	"github.com/Valimere/donkey/metrics"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"github.com/Valimere/donkey/trends"
+	"github.com/Valimere/donkey/tui"
+	"github.com/Valimere/donkey/webhooks"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const defaultSubreddit = "Askreddit"
+
+// healthCheckTimeout bounds how long /healthz and /readyz wait for their checks
+const healthCheckTimeout = 5 * time.Second
+
+func clearStatistics(dbStore store.Store, logger *slog.Logger) {
+	// Clear all rows in the AuthorStatistic table.
+	err := dbStore.ClearAuthorStatistics()
+	if err != nil {
+		// Log the error
+		logger.Error("clearing author_statistics failed", "error", err)
+	}
+	err = dbStore.ClearPosts()
+	if err != nil {
+		logger.Error("clearing posts failed", "error", err)
+	}
+}
+
+// resolveSubreddits prefers the configured subreddits (-r, DONKEY_SUBREDDITS or the config file),
+// then the persisted list and finally the default subreddit
+func resolveSubreddits(cfg *config.Config, dbStore store.Store) ([]string, error) {
+	if len(cfg.Subreddits) > 0 {
+		return cfg.Subreddits, nil
+	}
+	subreddits, err := dbStore.GetSubreddits()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load subreddits: %w", err)
+	}
+	if len(subreddits) == 0 {
+		subreddits = []string{defaultSubreddit}
+	}
+	return subreddits, nil
+}
+
+// resolveListings parses the listings polled for each subreddit
+func resolveListings(cfg *config.Config, subreddits []string) (map[string][]socialmedia.Listing, error) {
+	listings := make(map[string][]socialmedia.Listing, len(subreddits))
+	for _, subreddit := range subreddits {
+		for _, name := range cfg.Listings.For(subreddit) {
+			listing, err := socialmedia.ParseListing(name)
+			if err != nil {
+				return nil, fmt.Errorf("listings of %s: %w", subreddit, err)
+			}
+			listings[subreddit] = append(listings[subreddit], listing)
+		}
+	}
+	return listings, nil
+}
+
+// newAlertEngine starts the alert engine, stdout sinks are muted while the terminal dashboard is shown
+func newAlertEngine(cfg *config.Config) (*alerts.Engine, error) {
+	logger := logging.Component(slog.Default(), logging.ComponentAlerts)
+	var out io.Writer = os.Stdout
+	if cfg.Report.TUI {
+		out = io.Discard
+	}
+	engine, err := alerts.NewEngine(cfg.Alerts, out, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the alerts: %w", err)
+	}
+	if cfg.Report.TUI && engine.Rules() > 0 {
+		logger.Warn("stdout alert sinks are muted while the dashboard is shown")
+	}
+	return engine, nil
+}
+
+// reloadAlerts reloads the alert rules and sinks from the config file on SIGHUP, invalid changes are logged and ignored
+func reloadAlerts(engine *alerts.Engine, path string, logger *slog.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		cfg, err := config.Load(path)
+		if err == nil {
+			err = engine.Reload(cfg.Alerts)
+		}
+		if err != nil {
+			logger.Error("reloading the alert rules failed", "error", err)
+		}
+	}
+}
+
+func runCommand(cfg *config.Config, args []string) error {
+	fs := newFlagSet("run", "[flags]",
+		"Authorizes with reddit if there is no valid token, purges the previous run's data and ingests new posts\n"+
+			"from the chosen subreddits until ctl + c, then prints the statistics.")
+	fs.Var((*listFlag)(&cfg.Subreddits), "r",
+		"comma-separated `list` of subreddits i.e. \"Askreddit, music\" (subreddits, falls back to the \"donkey subreddits\" list, or \""+defaultSubreddit+"\")")
+	fs.Var((*listFlag)(&cfg.Listings.Default), "listings",
+		"comma-separated `list` of listings polled for subreddits without their own, i.e. \"new, hot, top:day\" (listings.default)")
+	fs.StringVar(&cfg.HTTP.APIListen, "api-listen", cfg.HTTP.APIListen, "address serving the dashboard, REST api, /metrics and health checks, empty disables it (http.api_listen)")
+	fs.DurationVar(&cfg.Report.Interval, "report-interval", cfg.Report.Interval, "print a leaderboard report every interval, 0 disables it (report.interval)")
+	fs.IntVar(&cfg.Report.Top, "report-top", cfg.Report.Top, "posts and authors listed in the periodic report (report.top)")
+	fs.BoolVar(&cfg.Report.TUI, "tui", cfg.Report.TUI, "show a full-screen dashboard instead of the log output (report.tui)")
+	fs.BoolVar(&cfg.Backfill.Enabled, "backfill", cfg.Backfill.Enabled,
+		"page back through /new and the backfill.top listings before polling, storing older posts as backfilled (backfill.enabled)")
+	fs.BoolVar(&cfg.Report.ExcludeBackfilled, "exclude-backfilled", cfg.Report.ExcludeBackfilled,
+		"leave the backfilled posts out of the statistics printed on exit (report.exclude_backfilled)")
+	fs.BoolVar(&cfg.Bots.Exclude, "exclude-bots", cfg.Bots.Exclude, "leave the authors scored as suspected bots out of the author leaderboards (bots.exclude)")
+	fs.BoolVar(&cfg.Storage.PurgeOnStart, "purge", cfg.Storage.PurgeOnStart, "delete the previous run's posts and statistics on start (storage.purge_on_start)")
+	addStorageFlags(fs, cfg)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+	if cfg.Report.TUI && cfg.Log.File == "" {
+		// logs written to the terminal would corrupt the dashboard
+		cfg.Log.File = config.DefaultTUILogFile
+		if err := setupLogging(cfg); err != nil {
+			return err
+		}
+	}
+
+	m := metrics.New()
+	dbInstance, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	dbInstance.Metrics = m
+	var dbStore store.Store = dbInstance
+
+	logger := logging.Component(slog.Default(), logging.ComponentScheduler)
+	if cfg.Storage.PurgeOnStart {
+		clearStatistics(dbStore, logger)
+	}
+
+	subreddits, err := resolveSubreddits(cfg, dbStore)
+	if err != nil {
+		return err
+	}
+	listings, err := resolveListings(cfg, subreddits)
+	if err != nil {
+		return err
+	}
+	logger.Info("subreddits chosen", "subreddits", subreddits)
+	session, err := dbInstance.StartSession(subreddits)
+	if err != nil {
+		return fmt.Errorf("failed to start the session: %w", err)
+	}
+	logger.Info("session started", "session_id", session.ID)
+
+	engine, err := newAlertEngine(cfg)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+	go reloadAlerts(engine, cfg.Path, logger)
+
+	var dispatcher *webhooks.Dispatcher
+	if len(cfg.Webhooks.Endpoints) > 0 {
+		dispatcher = webhooks.New(dbStore, cfg.Webhooks, logging.Component(slog.Default(), logging.ComponentWebhooks))
+		dispatcher.Watch(subreddits...)
+		go dispatcher.Run(context.Background())
+	}
+
+	tracker := health.NewTracker()
+	tracker.Expect(subreddits...)
+	// the client is created after the api server starts so the health checks can report a pending login
+	var smClient atomic.Pointer[socialmedia.Client]
+	bus := events.NewBus()
+	if cfg.Rising.Interval > 0 {
+		go watchRising(context.Background(), dbStore, bus, cfg.Rising.Options(), cfg.Rising.Interval, logger)
+	}
+	// the terms of the stored posts are counted on start, the ingester counts the new ones as it saves them
+	trending := trends.New(cfg.Trending.Options())
+	if err := trending.Seed(dbStore); err != nil {
+		logger.Error("counting the terms of the stored posts failed", "error", err)
+	}
+
+	if cfg.HTTP.APIListen != "" {
+		server := api.NewServer(cfg.HTTP.APIListen, slog.Default())
+		server.Handle("GET /metrics", m.Handler())
+
+		database := health.DatabaseCheck(dbStore.Ping)
+		fetch := health.FetchCheck(tracker, cfg.Health.FetchThreshold)
+		token := health.TokenCheck(func() time.Time {
+			if c := smClient.Load(); c != nil && c.Token != nil {
+				return c.Token.Expiry
+			}
+			return time.Time{}
+		}, cfg.Health.TokenExpiryMargin)
+		rateLimit := health.RateLimitCheck(func() socialmedia.RateLimitStatus {
+			if c := smClient.Load(); c != nil {
+				return c.RateLimitStatus()
+			}
+			return socialmedia.RateLimitStatus{}
+		})
+		server.Handle("GET /healthz", health.Handler(healthCheckTimeout, database, fetch))
+		server.Handle("GET /readyz", health.Handler(healthCheckTimeout, database, token, fetch, rateLimit))
+
+		server.Handle("GET /api/leaderboard", api.Leaderboard(dbStore, server.Logger))
+		server.Handle("GET /api/subreddits", api.Subreddits(dbStore, server.Logger))
+		server.Handle("GET /api/posts/{id}", api.Post(dbStore, server.Logger))
+		server.Handle("GET /api/posts/{id}/revisions", api.Revisions(dbStore, server.Logger))
+		server.Handle("GET /api/ranks/{subreddit}/{listing}", api.Ranks(dbStore, server.Logger))
+		server.Handle("GET /api/rising", api.Rising(dbStore, cfg.Rising.Options(), server.Logger))
+		server.Handle("GET /api/removals", api.Removals(dbStore, server.Logger))
+		server.Handle("GET /api/trending", api.Trending(trending, server.Logger))
+		server.Handle("GET /api/sentiment", api.Sentiment(dbStore, server.Logger))
+		server.Handle("GET /api/sentiment/posts", api.SentimentPosts(dbStore, server.Logger))
+		server.Handle("GET /api/sentiment/authors", api.SentimentAuthors(dbStore, server.Logger))
+		server.Handle("GET /api/languages", api.Languages(dbStore, server.Logger))
+		server.Handle("GET /api/crossposts", api.Crossposts(dbStore, server.Logger))
+		server.Handle("GET /api/crossposts/feeds", api.Feeds(dbStore, server.Logger))
+		server.Handle("GET /api/reposts", api.Reposts(dbStore, server.Logger))
+		server.Handle("GET /api/reposts/clusters", api.RepostClusters(dbStore, server.Logger))
+		server.Handle("GET /api/bots", api.Bots(dbStore, server.Logger))
+		server.Handle("GET /api/bots/{author}", api.AuthorScore(dbStore, server.Logger))
+		server.Handle("GET /api/events", api.Events(bus, server.Logger))
+		server.Handle("GET /api/webhooks/deliveries", api.WebhookDeliveries(dbStore, server.Logger))
+		server.Handle("GET /", dashboard.Handler())
+
+		err = server.Start()
+		if err != nil {
+			return fmt.Errorf("failed to start the api server: %w", err)
+		}
+	}
+
+	// Create a channel to listen for OS signals, print statistics on ctl + c
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-sigs
+		// deliver the pending alerts
+		engine.Close()
+		if !cfg.Report.OnExit {
+			os.Exit(0)
+		}
+		err := printStatistics(dbStore, statisticsFilter(cfg))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+
+	client, err := newAuthorizedClient(dbStore, cfg, false)
+	if err != nil {
+		return err
+	}
+	client.Metrics = m
+	m.SetTokenExpiry(client.Token.Expiry)
+	smClient.Store(client)
+
+	// the profiles of the leading authors are fetched only while the rate limit budget is spare,
+	// the bot scorer waits for spare budget the same way
+	fetchAccount := client.FetchAccount
+	if cfg.Authors.Interval > 0 {
+		enricher := authors.New(dbStore, client, cfg.Authors.Options(), logging.Component(slog.Default(), logging.ComponentAuthors))
+		go enricher.Run(context.Background())
+		fetchAccount = enricher.Fetch
+	}
+	if cfg.Bots.Interval > 0 {
+		scorer := bots.NewScorer(dbStore, fetchAccount, cfg.Bots.Options(cfg.Authors.TTL), logging.Component(slog.Default(), logging.ComponentBots))
+		go scorer.Run(context.Background(), cfg.Bots.Interval)
+	}
+
+	in := &ingester{client: client, store: dbStore, metrics: m, tracker: tracker, bus: bus, alerts: engine, webhooks: dispatcher, trending: trending, listings: listings, logger: logger}
+	if cfg.Backfill.Enabled {
+		in.backfill = &backfillOptions{limit: cfg.Backfill.Limit, top: cfg.Backfill.Top}
+	}
+	if cfg.Refresh.Interval > 0 {
+		in.refresh = &refreshOptions{interval: cfg.Refresh.Interval, maxAge: cfg.Refresh.MaxAge, limit: cfg.Refresh.Limit}
+	}
+	if !cfg.Report.TUI {
+		if cfg.Report.Interval > 0 {
+			go runPeriodicReports(context.Background(), os.Stdout, dbStore, client, trending, cfg.Report.Interval, cfg.Report.Top, logger)
+		}
+		in.fetchAndPrint(subreddits)
+		return nil
+	}
+
+	// the dashboard owns the terminal from here on, signals close it so the statistics print on a clean screen
+	signal.Stop(sigs)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if cfg.Report.Interval > 0 {
+		logger.Warn("periodic reports are disabled while the dashboard is shown")
+	}
+	go in.fetchAndPrint(subreddits)
+	err = tui.Run(ctx, bus, subreddits)
+	if err != nil {
+		return fmt.Errorf("dashboard failed: %w", err)
+	}
+	if cfg.Report.OnExit {
+		return printStatistics(dbStore, statisticsFilter(cfg))
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Package sentiment scores the sentiment of post titles, bodies and comments with an embedded lexicon in the style of VADER.
+// Scoring is local and deterministic, the same text always gets the same score.
+package sentiment
+
+import (
+	_ "embed"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Scores of at least Positive are positive, of at most Negative negative and neutral in between
+const (
+	Positive = 0.05
+	Negative = -0.05
+)
+
+//go:embed lexicon.txt
+var lexiconFile string
+
+// lexicon maps the lowercase words and emoticons to their valence from -4 to 4
+var lexicon = func() map[string]float64 {
+	words := make(map[string]float64)
+	for _, line := range strings.Split(lexiconFile, "\n") {
+		word, value, found := strings.Cut(strings.TrimSpace(line), "\t")
+		if !found || strings.HasPrefix(word, "#") {
+			continue
+		}
+		valence, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			// the embedded lexicon is fixed at compile time
+			panic("invalid valence of " + word + " in the lexicon: " + value)
+		}
+		words[word] = valence
+	}
+	return words
+}()
+
+const (
+	// boost is added to the valence of a word following a booster such as "very" and subtracted after a dampener such as "slightly"
+	boost = 0.293
+	// capsBoost is added to the valence of a word written in capitals in an otherwise lowercase text
+	capsBoost = 0.733
+	// negation scales the valence of a word following a negation such as "not"
+	negation = -0.74
+	// exclamationBoost is added per exclamation mark, up to maxExclamations
+	exclamationBoost = 0.292
+	maxExclamations  = 4
+	// alpha normalizes the sum of the valences into a score between -1 and 1
+	alpha = 15
+)
+
+var boosters = set("absolutely amazingly completely considerably decidedly deeply enormously entirely especially exceptionally " +
+	"extremely fabulously greatly highly hugely incredibly intensely majorly particularly purely quite really remarkably so " +
+	"substantially thoroughly totally tremendously truly unbelievably unusually utterly very")
+
+var dampeners = set("almost barely hardly kinda marginally occasionally partly scarcely slightly somewhat sorta")
+
+var negations = set("not no never none nobody nothing neither nor nowhere cannot cant dont doesnt didnt isnt arent wasnt " +
+	"werent wont wouldnt shouldnt couldnt hasnt havent hadnt aint without")
+
+func set(words string) map[string]bool {
+	m := make(map[string]bool)
+	for _, word := range strings.Fields(words) {
+		m[word] = true
+	}
+	return m
+}
+
+// token is a word of the text with its original spelling
+type token struct {
+	word string
+	caps bool
+}
+
+// tokenize splits text into lowercase words and emoticons. Contractions keep their negation, "don't" becomes dont,
+// and lose their other endings, "it's" becomes it.
+func tokenize(text string) []token {
+	var tokens []token
+	for _, field := range strings.Fields(strings.ReplaceAll(text, "’", "'")) {
+		if _, emoticon := lexicon[strings.ToLower(field)]; emoticon && !isWord(field) {
+			tokens = append(tokens, token{word: strings.ToLower(field)})
+			continue
+		}
+		if strings.Contains(field, "://") {
+			continue
+		}
+		words := strings.FieldsFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+		})
+		for _, word := range words {
+			word = strings.Trim(word, "'")
+			lower := strings.ToLower(word)
+			if before, _, found := strings.Cut(lower, "'"); found {
+				if strings.HasSuffix(lower, "n't") {
+					lower = strings.ReplaceAll(lower, "'", "")
+				} else {
+					lower = before
+				}
+			}
+			if lower == "" {
+				continue
+			}
+			tokens = append(tokens, token{word: lower, caps: len(word) > 1 && strings.ToUpper(word) == word && isWord(word)})
+		}
+	}
+	return tokens
+}
+
+func isWord(s string) bool {
+	return strings.IndexFunc(s, unicode.IsLetter) >= 0
+}
+
+// Score returns the compound sentiment of text between -1, most negative, and 1, most positive, 0 for neutral texts.
+// Words following a booster, written in capitals or followed by exclamation marks count more, a negation up to
+// three words before a word turns its valence around and the words after a "but" outweigh the ones before.
+func Score(text string) float64 {
+	tokens := tokenize(text)
+	// capitals only emphasize a word when the rest of the text isn't shouted as well
+	mixedCase := false
+	for _, t := range tokens {
+		if isWord(t.word) && !t.caps {
+			mixedCase = true
+			break
+		}
+	}
+
+	valences := make([]float64, len(tokens))
+	butIndex := -1
+	for i, t := range tokens {
+		if t.word == "but" && butIndex < 0 {
+			butIndex = i
+		}
+		valence, found := lexicon[t.word]
+		if !found || boosters[t.word] || dampeners[t.word] {
+			continue
+		}
+		if t.caps && mixedCase {
+			valence += math.Copysign(capsBoost, valence)
+		}
+		for distance := 1; distance <= 3 && i-distance >= 0; distance++ {
+			previous := tokens[i-distance]
+			// the effect of boosters fades with the distance
+			fade := 1 - 0.05*float64(distance-1)
+			switch {
+			case boosters[previous.word]:
+				valence += math.Copysign(boost*fade, valence)
+			case dampeners[previous.word]:
+				valence -= math.Copysign(boost*fade, valence)
+			case negations[previous.word]:
+				valence *= negation
+			}
+		}
+		valences[i] = valence
+	}
+
+	sum := 0.0
+	for i, valence := range valences {
+		switch {
+		case butIndex < 0:
+		case i < butIndex:
+			valence *= 0.5
+		case i > butIndex:
+			valence *= 1.5
+		}
+		sum += valence
+	}
+	if sum != 0 {
+		exclamations := min(strings.Count(text, "!"), maxExclamations)
+		sum += math.Copysign(float64(exclamations)*exclamationBoost, sum)
+	}
+
+	score := sum / math.Sqrt(sum*sum+alpha)
+	// rounded so scores compare equal across platforms
+	return math.Round(max(-1, min(1, score))*10000) / 10000
+}
+
+// Label names the score positive, negative or neutral
+func Label(score float64) string {
+	switch {
+	case score >= Positive:
+		return "positive"
+	case score <= Negative:
+		return "negative"
+	default:
+		return "neutral"
+	}
+}
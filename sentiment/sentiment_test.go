@@ -0,0 +1,34 @@
+package sentiment
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestScore(t *testing.T) {
+	assert.Zero(t, Score(""))
+	assert.Zero(t, Score("Nolan's new movie is out"))
+	assert.Equal(t, 0.6369, Score("I love this movie"))
+	assert.Equal(t, Score("I love this movie"), Score("I love this movie"))
+	assert.Equal(t, "positive", Label(Score("I love this movie")))
+
+	// negations turn the valence around
+	assert.Less(t, Score("I don't love this movie"), Negative)
+	assert.Less(t, Score("I don’t love this movie"), Negative)
+	assert.Greater(t, Score("not bad at all"), Positive)
+
+	// boosters, capitals and exclamation marks emphasize
+	assert.Greater(t, Score("The movie was very good"), Score("The movie was good"))
+	assert.Less(t, Score("The movie was slightly good"), Score("The movie was good"))
+	assert.Greater(t, Score("The movie was GOOD"), Score("The movie was good"))
+	assert.Equal(t, Score("THE MOVIE WAS GOOD"), Score("the movie was good"))
+	assert.Greater(t, Score("The movie was good!!!"), Score("The movie was good"))
+
+	// what follows a but outweighs what comes before
+	assert.Less(t, Score("The movie was good but the ending was terrible"), Negative)
+	assert.Greater(t, Score("The ending was terrible but the movie was good"), Positive)
+
+	assert.Equal(t, "negative", Label(Score("This is the worst :(")))
+	assert.Equal(t, "neutral", Label(Score("He'll be there at https://example.com/great")))
+	assert.LessOrEqual(t, Score("great great great great great great great great great great"), 1.0)
+}
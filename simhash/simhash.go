@@ -0,0 +1,76 @@
+// Package simhash fingerprints post titles and bodies so that near-duplicates have fingerprints a few bits apart
+package simhash
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// MaxDistance is the largest Hamming distance between the fingerprints of near-duplicates
+const MaxDistance = 6
+
+// MinWords is how many words a text needs for a fingerprint, shorter texts have too few features to tell them apart
+const MinWords = 4
+
+// Bands is the number of parts a fingerprint is split into for the lookups, fingerprints at most MaxDistance apart
+// share at least one band since the differing bits can fall into MaxDistance bands only
+const Bands = MaxDistance + 1
+
+// bandBits is the size of a band, the bits left over are in no band
+const bandBits = 64 / Bands
+
+// shingle is the length of the character sequences hashed as features, short enough for titles of a few words
+const shingle = 3
+
+// Fingerprint returns the SimHash of the character shingles of text, ignoring case, punctuation and whitespace.
+// It returns 0 for texts with fewer than MinWords words.
+func Fingerprint(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) < MinWords {
+		return 0
+	}
+
+	var weights [64]int
+	add := func(feature string) {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(feature))
+		sum := h.Sum64()
+		for bit := range weights {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	normalized := []rune(strings.Join(words, " "))
+	for i := 0; i+shingle <= len(normalized); i++ {
+		add(string(normalized[i : i+shingle]))
+	}
+
+	var fingerprint uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint
+}
+
+// Distance is the number of bits two fingerprints differ in
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Split returns the bands of a fingerprint, the lowest bits first
+func Split(fingerprint uint64) [Bands]uint16 {
+	var bands [Bands]uint16
+	for i := range bands {
+		bands[i] = uint16(fingerprint>>(i*bandBits)) & (1<<bandBits - 1)
+	}
+	return bands
+}
@@ -0,0 +1,33 @@
+package simhash
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	title := "Donkey v2 released: a reddit scraper written in Go"
+	assert.Equal(t, Fingerprint(title), Fingerprint("Donkey v2 released - a Reddit scraper written in Go!"))
+	assert.LessOrEqual(t, Distance(Fingerprint(title), Fingerprint("Donkey v2 is released: a reddit scraper written in Go")), MaxDistance)
+	assert.Greater(t, Distance(Fingerprint(title), Fingerprint("What is your favourite mechanical keyboard for programming")), MaxDistance)
+	assert.Greater(t, Distance(Fingerprint("How do I center a div in css"), Fingerprint("Where can I find a good tutorial for css grid")), MaxDistance)
+	assert.Zero(t, Fingerprint("How to center"))
+}
+
+func TestSplit(t *testing.T) {
+	assert.Equal(t, [Bands]uint16{1, 0, 0, 0, 0, 0, 0}, Split(1))
+	assert.Equal(t, [Bands]uint16{0, 1, 0, 0, 0, 0, 0}, Split(1<<bandBits))
+	assert.Equal(t, [Bands]uint16{511, 511, 511, 511, 511, 511, 511}, Split(^uint64(0)))
+
+	// fingerprints at most MaxDistance apart share a band
+	a := uint64(0x0123456789abcdef)
+	b := a ^ (1 | 1<<10 | 1<<20 | 1<<30 | 1<<40 | 1<<50)
+	bandsA, bandsB := Split(a), Split(b)
+	shared := 0
+	for i := range bandsA {
+		if bandsA[i] == bandsB[i] {
+			shared++
+		}
+	}
+	assert.Equal(t, 1, shared)
+}
@@ -0,0 +1,123 @@
+package socialmedia
+
+import (
+	"net/url"
+	"strings"
+	"time"
+)
+
+// CrosspostParent is the original post a crosspost was made from
+type CrosspostParent struct {
+	PostID    string
+	Subreddit string
+	Author    string
+	Title     string
+	URL       string
+	Created   time.Time
+	// NumCrossposts is the number of crossposts of the original reddit reported when the crosspost was seen
+	NumCrossposts int
+}
+
+// CrosspostParentList decodes reddit's crosspost_parent_list, the posts a crosspost was made from with the original first
+type CrosspostParentList []struct {
+	ID            string  `json:"id"`
+	Subreddit     string  `json:"subreddit"`
+	Author        string  `json:"author"`
+	Title         string  `json:"title"`
+	URL           string  `json:"url"`
+	CreatedUTC    float64 `json:"created_utc"`
+	NumCrossposts int     `json:"num_crossposts"`
+}
+
+// Parent returns the original post of the list, nil if the post is no crosspost
+func (l CrosspostParentList) Parent() *CrosspostParent {
+	if len(l) == 0 || l[0].ID == "" {
+		return nil
+	}
+	return &CrosspostParent{
+		PostID:        l[0].ID,
+		Subreddit:     l[0].Subreddit,
+		Author:        l[0].Author,
+		Title:         l[0].Title,
+		URL:           l[0].URL,
+		Created:       time.Unix(int64(l[0].CreatedUTC), 0).UTC(),
+		NumCrossposts: l[0].NumCrossposts,
+	}
+}
+
+// SharedURL returns the normalized link of a link post, empty for self posts, crossposts and links to reddit posts
+// which are crossposts in all but name
+func (p Post) SharedURL() string {
+	if p.IsSelf || p.CrosspostParent != nil {
+		return ""
+	}
+	normalized := NormalizeURL(p.URL)
+	host, _, _ := strings.Cut(normalized, "/")
+	if strings.HasSuffix(host, "reddit.com") && strings.Contains(normalized, "/comments/") {
+		return ""
+	}
+	return normalized
+}
+
+// NormalizeURL reduces a link to the form that tells whether two links point to the same page: without the scheme,
+// the www. and m. host prefixes, the fragment, tracking parameters and a trailing slash. It returns an empty string for
+// links that are not http or https.
+func NormalizeURL(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	host = strings.TrimPrefix(host, "m.")
+
+	query := u.Query()
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") || key == "fbclid" || key == "gclid" || key == "ref" || key == "si" {
+			query.Del(key)
+		}
+	}
+	if host == "youtu.be" && len(u.Path) > 1 {
+		// short links of the same video
+		host = "youtube.com"
+		query.Set("v", strings.TrimPrefix(u.Path, "/"))
+		u.Path, u.RawPath = "/watch", ""
+	}
+
+	normalized := host + strings.TrimSuffix(u.EscapedPath(), "/")
+	if len(query) > 0 {
+		// sorted by key
+		normalized += "?" + query.Encode()
+	}
+	return normalized
+}
+
+// CrosspostStatistic is an original post with the crossposts of it seen in the monitored subreddits
+type CrosspostStatistic struct {
+	CrosspostParent
+	// Crossposts counts the stored crossposts, Subreddits are the subreddits they were made in
+	Crossposts int
+	Subreddits []string
+}
+
+// SubredditFeed counts the posts that moved from one subreddit to another, as crossposts or as links posted in From first
+type SubredditFeed struct {
+	From        string
+	To          string
+	Crossposts  int
+	SharedLinks int
+}
+
+// RepostCluster is a post with its reposts, the posts sharing its link or a near-duplicate title and body, oldest first
+type RepostCluster struct {
+	Original Post
+	Reposts  []Post
+	// Subreddits are the subreddits of the original and the reposts
+	Subreddits []string
+}
+
+// Repost is a link posted more than once, Posts holds the posts sharing it oldest first
+type Repost struct {
+	URL   string
+	Posts []Post
+}
@@ -0,0 +1,34 @@
+package socialmedia
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	assert.Equal(t, "example.com/a/b", NormalizeURL("https://www.Example.com/a/b/"))
+	assert.Equal(t, "example.com/a", NormalizeURL("http://m.example.com/a#comments"))
+	assert.Equal(t, "example.com/a?id=1&page=2", NormalizeURL("https://example.com/a?page=2&utm_source=reddit&id=1"))
+	assert.Equal(t, "youtube.com/watch?v=abc", NormalizeURL("https://youtu.be/abc?si=xyz"))
+	assert.Equal(t, "youtube.com/watch?v=abc", NormalizeURL("https://www.youtube.com/watch?v=abc"))
+	assert.Empty(t, NormalizeURL("/r/golang/comments/a/"))
+	assert.Empty(t, NormalizeURL("mailto:gopher@example.com"))
+}
+
+func TestSharedURL(t *testing.T) {
+	assert.Equal(t, "example.com/a", Post{URL: "https://example.com/a"}.SharedURL())
+	assert.Empty(t, Post{URL: "https://www.reddit.com/r/golang/comments/a/donkey/", IsSelf: true}.SharedURL())
+	assert.Empty(t, Post{URL: "https://www.reddit.com/r/golang/comments/a/donkey/"}.SharedURL())
+	assert.Empty(t, Post{URL: "https://example.com/a", CrosspostParent: &CrosspostParent{PostID: "a"}}.SharedURL())
+}
+
+func TestCrosspostParentList(t *testing.T) {
+	var list CrosspostParentList
+	assert.NoError(t, json.Unmarshal([]byte(`[{"id":"a","subreddit":"golang","author":"gopher","title":"Donkey v2",
+"url":"https://v.redd.it/xyz","created_utc":1712685532.0,"num_crossposts":4}]`), &list))
+	assert.Equal(t, &CrosspostParent{PostID: "a", Subreddit: "golang", Author: "gopher", Title: "Donkey v2", URL: "https://v.redd.it/xyz",
+		Created: time.Unix(1712685532, 0).UTC(), NumCrossposts: 4}, list.Parent())
+	assert.Nil(t, CrosspostParentList(nil).Parent())
+}
@@ -1,47 +1,84 @@
 package socialmedia
 
 import (
+	"cmp"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"github.com/Valimere/donkey/logging"
+	"github.com/Valimere/donkey/metrics"
 	"golang.org/x/time/rate"
+	"log/slog"
 	"net/http/httputil"
 	"net/url"
-	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"fmt"
 	"golang.org/x/oauth2"
 	"io"
-	"log"
 	"net/http"
 )
 
 const (
-	redirectURL = "http://localhost:8080/callback"
-	authURL     = "https://www.reddit.com/api/v1/authorize"
-	tokenURL    = "https://www.reddit.com/api/v1/access_token"
-	authScope   = "read"
+	authURL   = "https://www.reddit.com/api/v1/authorize"
+	tokenURL  = "https://www.reddit.com/api/v1/access_token"
+	revokeURL = "https://www.reddit.com/api/v1/revoke_token"
+	authScope = "read"
 )
 
-var (
-	clientID     = os.Getenv("REDDIT_CLIENT_ID")
-	clientSecret = os.Getenv("REDDIT_SECRET")
-	userAgent    = os.Getenv("REDDIT_USER_AGENT")
-)
+// Options configures a Client, the values usually come from config.Config
+type Options struct {
+	ClientID     string
+	ClientSecret string
+	UserAgent    string
+	// RedirectURL must match the redirect uri registered for the reddit app
+	RedirectURL string
+	// CallbackListen is the address the OAuth callback server listens on, i.e. ":8080"
+	CallbackListen    string
+	RequestsPerMinute float64
+	Burst             int
+	// DumpRequests logs every outgoing HTTP request
+	DumpRequests bool
+	Logger       *slog.Logger
+	// Metrics is optional, requests and rate limit headers are recorded when set
+	Metrics *metrics.Metrics
+}
 
 type Client struct {
 	OAuthConfig      *oauth2.Config
 	AuthorizationURL string
-	AuthCode         string
-	RateLimiter      *rate.Limiter
+	// AuthCode is set by the callback server, read it with authCode while StartServer may be running
+	AuthCode    string
+	RateLimiter *rate.Limiter
+	// ServerErr is the error the callback server stopped with, set by StartServer
 	ServerErr        error
 	Token            *oauth2.Token
-	Port             int
+	CallbackListen   string
 	Throttle         <-chan time.Time
 	HttpClient       *http.Client
 	Context          context.Context
-	Debug            bool
+	Logger           *slog.Logger
+	Metrics          *metrics.Metrics
 	ProgramStartTime time.Time
+
+	// mu guards rateLimit and AuthCode
+	mu        sync.Mutex
+	rateLimit RateLimitStatus
+}
+
+// RateLimitStatus is the rate limit state reported by reddit's response headers
+type RateLimitStatus struct {
+	Used      float64
+	Remaining float64
+	// Reset is when the current rate limit period ends
+	Reset time.Time
+	// Observed is when the headers were received, zero if no response was seen yet
+	Observed time.Time
 }
 
 type redditResponse struct {
@@ -58,6 +95,31 @@ type redditResponse struct {
 				UpVotes     int     `json:"ups"`
 				CreatedUTC  float64 `json:"created_utc"`
 				Subreddit   string  `json:"subreddit"`
+				Flair       string  `json:"link_flair_text"`
+
+				Score          int        `json:"score"`
+				UpvoteRatio    float64    `json:"upvote_ratio"`
+				Permalink      string     `json:"permalink"`
+				URL            string     `json:"url"`
+				Domain         string     `json:"domain"`
+				IsSelf         bool       `json:"is_self"`
+				Over18         bool       `json:"over_18"`
+				Spoiler        bool       `json:"spoiler"`
+				Stickied       bool       `json:"stickied"`
+				Locked         bool       `json:"locked"`
+				AuthorFlair    string     `json:"author_flair_text"`
+				AuthorFullname string     `json:"author_fullname"`
+				NumCrossposts  int        `json:"num_crossposts"`
+				Gilded         int        `json:"gilded"`
+				TotalAwards    int        `json:"total_awards_received"`
+				Distinguished  string     `json:"distinguished"`
+				PostHint       string     `json:"post_hint"`
+				IsVideo        bool       `json:"is_video"`
+				IsGallery      bool       `json:"is_gallery"`
+				RemovedBy      string     `json:"removed_by_category"`
+				Edited         EditedTime `json:"edited"`
+
+				CrosspostParentList CrosspostParentList `json:"crosspost_parent_list"`
 			} `json:"data"`
 		} `json:"children"`
 	} `json:"data"`
@@ -72,29 +134,37 @@ func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 }
 
 type dumpTransport struct {
-	transport *Transport
-	Debug     bool
+	transport    *Transport
+	DumpRequests bool
+	Logger       *slog.Logger
 }
 
 func (d *dumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	// Add User-Agent Header to request
 	req.Header.Add("User-Agent", d.transport.UserAgent)
 
-	if d.Debug {
+	if d.DumpRequests {
 		dump, err := httputil.DumpRequestOut(req, false)
 		if err != nil {
 			return nil, err
 		}
-		log.Printf("HTTP Request:\n%s\n", dump)
+		d.Logger.InfoContext(req.Context(), "http request", "dump", string(dump))
 	}
 	return d.transport.RoundTrip(req)
 }
 
-func getOAuthConfig() *oauth2.Config {
+// newRequestID returns a short random id used to correlate the log lines of one reddit request
+func newRequestID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func getOAuthConfig(opts Options) *oauth2.Config {
 	return &oauth2.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURL:  redirectURL,
+		ClientID:     opts.ClientID,
+		ClientSecret: opts.ClientSecret,
+		RedirectURL:  opts.RedirectURL,
 		Scopes:       []string{authScope},
 		Endpoint: oauth2.Endpoint{
 			AuthURL:  authURL,
@@ -103,67 +173,71 @@ func getOAuthConfig() *oauth2.Config {
 	}
 }
 
-func NewClient(debugFlag bool) *Client {
-	limiter := rate.NewLimiter(rate.Every(time.Minute/60), 1)
+func NewClient(opts Options) *Client {
+	logger := logging.Component(opts.Logger, logging.ComponentClient)
+	limiter := rate.NewLimiter(rate.Every(time.Duration(float64(time.Minute)/opts.RequestsPerMinute)), opts.Burst)
 	httpClient := &http.Client{
 		Transport: &dumpTransport{
 			transport: &Transport{
-				UserAgent: userAgent,
+				UserAgent: opts.UserAgent,
 			},
-			Debug: debugFlag,
+			DumpRequests: opts.DumpRequests,
+			Logger:       logger,
 		},
 	}
 	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
 	return &Client{
-		OAuthConfig:      getOAuthConfig(),
+		OAuthConfig:      getOAuthConfig(opts),
 		HttpClient:       httpClient,
-		Port:             8080,
+		CallbackListen:   opts.CallbackListen,
 		RateLimiter:      limiter,
 		Throttle:         time.Tick(time.Second),
 		Context:          ctx,
-		Debug:            debugFlag,
+		Logger:           logger,
+		Metrics:          opts.Metrics,
 		ProgramStartTime: time.Now(),
 	}
 }
 
-func NewClientWithToken(token *oauth2.Token, debugFlag bool) *Client {
-	limiter := rate.NewLimiter(rate.Every(time.Minute/60), 1)
-	httpClient := &http.Client{
-		Transport: &dumpTransport{
-			transport: &Transport{
-				UserAgent: userAgent,
-			},
-			Debug: debugFlag,
-		},
-	}
-	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
-	return &Client{
-		OAuthConfig:      getOAuthConfig(),
-		Token:            token,
-		HttpClient:       httpClient,
-		Port:             8080,
-		RateLimiter:      limiter,
-		Throttle:         time.Tick(time.Second),
-		Context:          ctx,
-		Debug:            debugFlag,
-		ProgramStartTime: time.Now(),
-	}
+func NewClientWithToken(token *oauth2.Token, opts Options) *Client {
+	c := NewClient(opts)
+	c.Token = token
+	return c
 }
 
 func (c *Client) StartServer(ctx context.Context) error {
-	log.Printf("Starting http server on port %d", c.Port)
+	c.Logger.Info("starting callback server", "addr", c.CallbackListen)
 	c.AuthorizationURL = c.OAuthConfig.AuthCodeURL("state", oauth2.AccessTypeOffline)
 
-	http.HandleFunc("/callback", c.callbackHandler)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/callback", c.callbackHandler)
+	// the server's error is handed over on a channel instead of being written to c from its goroutine
+	serverErr := make(chan error, 1)
 	go func() {
-		log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", c.Port), nil))
+		serverErr <- http.ListenAndServe(c.CallbackListen, mux)
 	}()
 
 	fmt.Printf("Go to the following link in your browser:\n%s\n", c.AuthorizationURL)
-	for c.AuthCode == "" && c.ServerErr == nil {
-		time.Sleep(100 * time.Millisecond)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for c.authCode() == "" {
+		select {
+		case err := <-serverErr:
+			c.ServerErr = err
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
 	}
-	return c.ServerErr
+	return nil
+}
+
+// authCode returns the authorization code received by the callback server, empty until it arrives
+func (c *Client) authCode() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.AuthCode
 }
 
 func processRedditResponse(resp *http.Response) (RedditResponse, error) {
@@ -174,8 +248,11 @@ func processRedditResponse(resp *http.Response) (RedditResponse, error) {
 	}
 	err = json.Unmarshal(body, &jsonData)
 	if err != nil {
-		log.Printf("\nUnparsable: \n%s\n", body)
-		return RedditResponse{}, err
+		const maxBody = 512
+		if len(body) > maxBody {
+			body = body[:maxBody]
+		}
+		return RedditResponse{}, fmt.Errorf("unparsable response %q: %w", body, err)
 	}
 	rr := RedditResponse{
 		Before: jsonData.Data.Before,
@@ -192,6 +269,30 @@ func processRedditResponse(resp *http.Response) (RedditResponse, error) {
 			UpVotes:     child.Data.UpVotes,
 			Created:     createdTime,
 			SubReddit:   child.Data.Subreddit,
+			Flair:       child.Data.Flair,
+
+			Score:          child.Data.Score,
+			UpvoteRatio:    child.Data.UpvoteRatio,
+			Permalink:      child.Data.Permalink,
+			URL:            child.Data.URL,
+			Domain:         child.Data.Domain,
+			IsSelf:         child.Data.IsSelf,
+			Over18:         child.Data.Over18,
+			Spoiler:        child.Data.Spoiler,
+			Stickied:       child.Data.Stickied,
+			Locked:         child.Data.Locked,
+			AuthorFlair:    child.Data.AuthorFlair,
+			AuthorFullname: child.Data.AuthorFullname,
+			NumCrossposts:  child.Data.NumCrossposts,
+			Gilded:         child.Data.Gilded,
+			TotalAwards:    child.Data.TotalAwards,
+			Distinguished:  child.Data.Distinguished,
+			MediaType:      MediaTypeOf(child.Data.PostHint, child.Data.IsSelf, child.Data.IsVideo, child.Data.IsGallery),
+			State:          PostStateOf(child.Data.SelfText, child.Data.RemovedBy),
+			RemovedBy:      child.Data.RemovedBy,
+			Edited:         time.Time(child.Data.Edited),
+
+			CrosspostParent: child.Data.CrosspostParentList.Parent(),
 		})
 	}
 	return rr, nil
@@ -202,53 +303,271 @@ type PaginationOptions struct {
 	After  string
 }
 
-// FetchPosts retrieves the latest posts from a subreddit using the Reddit API.
-// It makes a GET request to the subreddit's "new" endpoint and returns a RedditResponse object containing the posts.
-// The method utilizes the client's Throttle channel to throttle requests.
-// The method requires the subreddit name as the first argument and supports optional PaginationOptions.
+// MaxListingLimit is the most posts reddit returns per listing page
+const MaxListingLimit = 100
+
+// Sorts are the subreddit listings
+var Sorts = []string{"new", "hot", "rising", "top", "controversial"}
+
+// TimeFilters are the values of the t parameter of the top and controversial listings
+var TimeFilters = []string{"hour", "day", "week", "month", "year", "all"}
+
+// Listing selects a subreddit listing such as new or top and one page of it
+type Listing struct {
+	// Sort is the listing name, new if empty
+	Sort string
+	// Time is the time filter of the top and controversial listings, i.e. day or week
+	Time string
+	// Limit is the page size, reddit's default of 25 if 0 and at most 100
+	Limit int
+	PaginationOptions
+}
+
+// ParseListing parses a listing name as returned by Listing.String, i.e. hot, top or top:week
+func ParseListing(name string) (Listing, error) {
+	sort, t, timed := strings.Cut(strings.ToLower(strings.TrimSpace(name)), ":")
+	if !slices.Contains(Sorts, sort) {
+		return Listing{}, fmt.Errorf("unknown listing %q, must be one of %s", name, strings.Join(Sorts, ", "))
+	}
+	if !timed {
+		return Listing{Sort: sort}, nil
+	}
+	if sort != "top" && sort != "controversial" {
+		return Listing{}, fmt.Errorf("listing %q has no time filter", name)
+	}
+	if !slices.Contains(TimeFilters, t) {
+		return Listing{}, fmt.Errorf("unknown time filter in listing %q, must be one of %s", name, strings.Join(TimeFilters, ", "))
+	}
+	return Listing{Sort: sort, Time: t}, nil
+}
+
+// String names the listing as sort or sort:time, i.e. top:week
+func (l Listing) String() string {
+	sort := l.Sort
+	if sort == "" {
+		sort = "new"
+	}
+	if l.Time == "" {
+		return sort
+	}
+	return sort + ":" + l.Time
+}
+
+func (l Listing) url(subreddit string) string {
+	sort := l.Sort
+	if sort == "" {
+		sort = "new"
+	}
+	params := url.Values{}
+	if l.Time != "" {
+		params.Set("t", l.Time)
+	}
+	if l.Limit > 0 {
+		params.Set("limit", strconv.Itoa(min(l.Limit, MaxListingLimit)))
+	}
+	if l.Before != "" {
+		params.Set("before", l.Before)
+	}
+	if l.After != "" {
+		params.Set("after", l.After)
+	}
+	u := fmt.Sprintf("https://oauth.reddit.com/r/%s/%s.json", subreddit, sort)
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	return u
+}
+
+// FetchPosts retrieves the latest posts from a subreddit's "new" listing, see FetchListing.
 // If provided, PaginationOptions determine the "before" and "after" query parameters in the request URL.
-// The method sets the "Accept" and "Authorization" headers in the request and handles any errors that occur during the HTTP request.
-// It also logs information about the rate limit headers received in the HTTP response.
-// The method returns the RedditResponse and an error if one occurs.
 // Example usage:
 //
 //	client := &Client{}
 //	resp, err := client.FetchPosts(context.Background(), "golang")
 func (c *Client) FetchPosts(ctx context.Context, subreddit string, opts ...PaginationOptions) (RedditResponse, error) {
+	listing := Listing{Sort: "new"}
+	if len(opts) > 0 {
+		listing.PaginationOptions = opts[0]
+	}
+	return c.FetchListing(ctx, subreddit, listing)
+}
+
+// FetchListing retrieves one page of a subreddit listing using the Reddit API and returns a RedditResponse containing the posts.
+// The request waits for the client's rate limiter, sets the "Accept" and "Authorization" headers
+// and records the rate limit headers received in the HTTP response.
+// The After of the response continues with the next page when it is passed back in the listing.
+func (c *Client) FetchListing(ctx context.Context, subreddit string, listing Listing) (RedditResponse, error) {
+	ctx = logging.WithAttrs(ctx, slog.String("subreddit", subreddit))
+	return c.fetch(ctx, subreddit, listing.url(subreddit))
+}
+
+// FetchInfo retrieves the current state of up to MaxListingLimit posts by their IDs, the posts reddit doesn't know are left out.
+// Deleted and removed posts are returned with their State set.
+func (c *Client) FetchInfo(ctx context.Context, postIDs []string) (RedditResponse, error) {
+	if len(postIDs) > MaxListingLimit {
+		return RedditResponse{}, fmt.Errorf("at most %d posts can be fetched at once, got %d", MaxListingLimit, len(postIDs))
+	}
+	names := make([]string, 0, len(postIDs))
+	for _, id := range postIDs {
+		names = append(names, "t3_"+id)
+	}
+	infoURL := "https://oauth.reddit.com/api/info.json?" + url.Values{"id": {strings.Join(names, ",")}}.Encode()
+	return c.fetch(ctx, infoMetricsLabel, infoURL)
+}
+
+// infoMetricsLabel is the subreddit label of the requests for posts by ID in the metrics
+const infoMetricsLabel = "(info)"
+
+// accountMetricsLabel is the subreddit label of the requests for user profiles in the metrics
+const accountMetricsLabel = "(user)"
+
+// FetchAccount retrieves the profile of a user. Deleted and shadowbanned accounts, which reddit answers with 404,
+// are returned with NotFound set.
+func (c *Client) FetchAccount(ctx context.Context, name string) (Account, error) {
+	ctx = logging.WithAttrs(ctx, slog.String("author", name))
+	accountURL := "https://oauth.reddit.com/user/" + url.PathEscape(name) + "/about.json"
+	resp, err := c.get(ctx, accountMetricsLabel, accountURL)
+	if err != nil {
+		return Account{}, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return processAccountResponse(resp, name)
+	case http.StatusNotFound:
+		return Account{Name: name, NotFound: true, Fetched: time.Now().UTC()}, nil
+	default:
+		return Account{}, fmt.Errorf("fetching %s failed with status: %s", accountURL, resp.Status)
+	}
+}
+
+type accountResponse struct {
+	Data struct {
+		Name         string  `json:"name"`
+		CreatedUTC   float64 `json:"created_utc"`
+		LinkKarma    int     `json:"link_karma"`
+		CommentKarma int     `json:"comment_karma"`
+		IsMod        bool    `json:"is_mod"`
+		IsGold       bool    `json:"is_gold"`
+		IsSuspended  bool    `json:"is_suspended"`
+	} `json:"data"`
+}
+
+func processAccountResponse(resp *http.Response, name string) (Account, error) {
+	var jsonData accountResponse
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Account{}, err
+	}
+	err = json.Unmarshal(body, &jsonData)
+	if err != nil {
+		return Account{}, fmt.Errorf("unparsable account %s: %w", name, err)
+	}
+	account := Account{
+		Name:         cmp.Or(jsonData.Data.Name, name),
+		LinkKarma:    jsonData.Data.LinkKarma,
+		CommentKarma: jsonData.Data.CommentKarma,
+		IsMod:        jsonData.Data.IsMod,
+		IsGold:       jsonData.Data.IsGold,
+		Suspended:    jsonData.Data.IsSuspended,
+		Fetched:      time.Now().UTC(),
+	}
+	if jsonData.Data.CreatedUTC > 0 {
+		account.Created = time.Unix(int64(jsonData.Data.CreatedUTC), 0).UTC()
+	}
+	return account, nil
+}
+
+// fetch requests a listing and records the request under the subreddit label in the metrics
+func (c *Client) fetch(ctx context.Context, subreddit, listingURL string) (RedditResponse, error) {
+	resp, err := c.get(ctx, subreddit, listingURL)
+	if err != nil {
+		return RedditResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return RedditResponse{}, fmt.Errorf("fetching %s failed with status: %s", listingURL, resp.Status)
+	}
+	return processRedditResponse(resp)
+}
+
+// get sends a GET request once the rate limiter allows it, records it under the label in the metrics
+// and observes the rate limit headers. The caller closes the body of the response.
+func (c *Client) get(ctx context.Context, label, u string) (*http.Response, error) {
+	ctx = logging.WithAttrs(ctx, slog.String("request_id", newRequestID()))
+
 	// wait for permission to proceed under the rate limit
 	err := c.RateLimiter.Wait(ctx)
 	if err != nil {
-		return RedditResponse{}, err
+		return nil, err
 	}
-	baseURL := fmt.Sprintf("https://oauth.reddit.com/r/%s/new.json", subreddit)
-	req, err := http.NewRequestWithContext(ctx, "GET", baseURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
 	if err != nil {
-		return RedditResponse{}, err
+		return nil, err
 	}
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.Token.AccessToken)
-	if len(opts) > 0 {
-		params := url.Values{}
-		if opts[0].Before != "" {
-			params.Add("before", opts[0].Before)
-		}
-		if opts[0].After != "" {
-			params.Add("after", opts[0].After)
-		}
-	}
+	start := time.Now()
 	resp, err := c.HttpClient.Do(req)
 	if err != nil {
-		return RedditResponse{}, err
+		c.Metrics.ObserveRequest(label, 0, time.Since(start))
+		return nil, err
 	}
+	c.Metrics.ObserveRequest(label, resp.StatusCode, time.Since(start))
+	c.observeRateLimit(resp.Header)
 
 	// Inspect rate limit headers right after the HTTP request is made
-	log.Printf("Ratelimit-Used: %s, Ratelimit-Remaining: %s, Ratelimit-Reset: %s, URL: %s\n",
-		resp.Header.Get("X-Ratelimit-Used"),
-		resp.Header.Get("X-Ratelimit-Remaining"),
-		resp.Header.Get("X-Ratelimit-Reset"),
-		baseURL)
-	defer resp.Body.Close()
-	return processRedditResponse(resp)
+	c.Logger.InfoContext(ctx, "reddit request",
+		"status", resp.StatusCode,
+		"ratelimit_used", resp.Header.Get("X-Ratelimit-Used"),
+		"ratelimit_remaining", resp.Header.Get("X-Ratelimit-Remaining"),
+		"ratelimit_reset", resp.Header.Get("X-Ratelimit-Reset"),
+		"url", u)
+	return resp, nil
+}
+
+// observeRateLimit records the rate limit headers, responses without them are ignored
+func (c *Client) observeRateLimit(header http.Header) {
+	used, errUsed := strconv.ParseFloat(header.Get("X-Ratelimit-Used"), 64)
+	remaining, errRemaining := strconv.ParseFloat(header.Get("X-Ratelimit-Remaining"), 64)
+	reset, errReset := strconv.ParseFloat(header.Get("X-Ratelimit-Reset"), 64)
+	if errUsed != nil || errRemaining != nil || errReset != nil {
+		return
+	}
+	c.Metrics.ObserveRateLimit(used, remaining, reset)
+
+	now := time.Now()
+	c.mu.Lock()
+	c.rateLimit = RateLimitStatus{
+		Used:      used,
+		Remaining: remaining,
+		Reset:     now.Add(time.Duration(reset * float64(time.Second))),
+		Observed:  now,
+	}
+	c.mu.Unlock()
+}
+
+// RateLimitStatus returns the rate limit state of the latest response
+func (c *Client) RateLimitStatus() RateLimitStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rateLimit
+}
+
+// Spare reports whether a request can be sent right away without making another one wait for the rate limiter,
+// and more than reserve, a share between 0 and 1, of reddit's budget of the current period is left.
+// Low priority requests are only sent while the budget is spare.
+func (c *Client) Spare(reserve float64) bool {
+	if c.RateLimiter.Tokens() < 1 {
+		return false
+	}
+	status := c.RateLimitStatus()
+	total := status.Used + status.Remaining
+	if status.Observed.IsZero() || total <= 0 || time.Now().After(status.Reset) {
+		// nothing is known about the current period
+		return true
+	}
+	return status.Remaining > reserve*total
 }
 
 // callbackHandler handles the callback request from the OAuth server.
@@ -264,12 +583,14 @@ func (c *Client) FetchPosts(ctx context.Context, subreddit string, opts ...Pagin
 //	// The authorization code is automatically stored in c.AuthCode by the callbackHandler method
 //	token, err := c.ExchangeAuthCode(context.Background())
 func (c *Client) callbackHandler(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
 	c.AuthCode = r.URL.Query().Get("code")
-	log.Printf("code received: %s", c.AuthCode)
+	c.mu.Unlock()
+	c.Logger.Info("authorization code received")
 	_, err := fmt.Fprintf(w, "Authorization code received. You can close this window.")
 	if err != nil {
 		http.Error(w, "Error occurred while writing response in callback:", http.StatusInternalServerError)
-		log.Fatalf("Error when writing response in callback: %v", err)
+		c.Logger.Error("writing callback response failed", "error", err)
 	}
 }
 
@@ -289,10 +610,41 @@ func (c *Client) callbackHandler(w http.ResponseWriter, r *http.Request) {
 //	token, err := c.ExchangeAuthCode(context.Background())
 func (c *Client) ExchangeAuthCode(ctx context.Context) (*oauth2.Token, error) {
 	<-c.Throttle
-	t, err := c.OAuthConfig.Exchange(ctx, c.AuthCode)
+	t, err := c.OAuthConfig.Exchange(ctx, c.authCode())
 	if err != nil {
 		return nil, err
 	}
 	c.Token = t
 	return t, nil
 }
+
+// RevokeToken asks reddit to invalidate the token so it can no longer be used.
+// The refresh token is revoked when present since that also invalidates its access tokens,
+// otherwise the access token is revoked.
+func (c *Client) RevokeToken(ctx context.Context, token *oauth2.Token) error {
+	<-c.Throttle
+	form := url.Values{}
+	if token.RefreshToken != "" {
+		form.Set("token", token.RefreshToken)
+		form.Set("token_type_hint", "refresh_token")
+	} else {
+		form.Set("token", token.AccessToken)
+		form.Set("token_type_hint", "access_token")
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", revokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(c.OAuthConfig.ClientID, c.OAuthConfig.ClientSecret)
+
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("revoking token failed with status: %s", resp.Status)
+	}
+	return nil
+}
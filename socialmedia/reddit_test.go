@@ -0,0 +1,131 @@
+package socialmedia
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+	"golang.org/x/time/rate"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const listing = `{"data":{"after":"t3_b","before":null,"children":[
+{"kind":"t3","data":{"id":"a","title":"Donkey v2","selftext":"","author":"gopher","num_comments":3,"ups":42,"score":42,
+"upvote_ratio":0.97,"created_utc":1712685532.0,"subreddit":"golang","link_flair_text":"news","permalink":"/r/golang/comments/a/donkey_v2/",
+"url":"https://v.redd.it/xyz","domain":"v.redd.it","is_self":false,"over_18":false,"spoiler":false,"stickied":true,"locked":true,
+"author_flair_text":null,"author_fullname":"t2_g","num_crossposts":1,"gilded":0,"total_awards_received":4,"distinguished":"moderator",
+"post_hint":"hosted:video","is_video":true,"edited":false}},
+{"kind":"t3","data":{"id":"b","title":"Ask","selftext":"why?","author":"[deleted]","is_self":true,"distinguished":null,"edited":1712690000.0}},
+{"kind":"t3","data":{"id":"c","title":"Spam","selftext":"[removed]","author":"spammer","is_self":true,"removed_by_category":"moderator"}}]}}`
+
+func TestProcessRedditResponse(t *testing.T) {
+	resp, err := processRedditResponse(&http.Response{Body: io.NopCloser(strings.NewReader(listing))})
+	assert.NoError(t, err)
+	assert.Equal(t, "t3_b", resp.After)
+	assert.Len(t, resp.Posts, 3)
+	assert.Equal(t, Post{
+		PostID: "a", Title: "Donkey v2", Author: "gopher", NumComments: 3, UpVotes: 42,
+		Created: time.Unix(1712685532, 0).UTC(), SubReddit: "golang", Flair: "news",
+		Score: 42, UpvoteRatio: 0.97, Permalink: "/r/golang/comments/a/donkey_v2/", URL: "https://v.redd.it/xyz", Domain: "v.redd.it",
+		Stickied: true, Locked: true, AuthorFullname: "t2_g", NumCrossposts: 1, TotalAwards: 4, Distinguished: "moderator",
+		MediaType: MediaVideo, State: PostActive,
+	}, resp.Posts[0])
+	assert.Equal(t, MediaSelf, resp.Posts[1].MediaType)
+	assert.Equal(t, PostActive, resp.Posts[1].State)
+	assert.Equal(t, time.Unix(1712690000, 0).UTC(), resp.Posts[1].Edited)
+	assert.Equal(t, PostRemoved, resp.Posts[2].State)
+	assert.Equal(t, "moderator", resp.Posts[2].RemovedBy)
+	assert.Equal(t, "https://www.reddit.com/r/golang/comments/a/donkey_v2/", resp.Posts[0].Link())
+	assert.Equal(t, "https://www.reddit.com/comments/b/", resp.Posts[1].Link())
+}
+
+func TestProcessAccountResponse(t *testing.T) {
+	about := `{"kind":"t2","data":{"name":"Gopher","created_utc":1712685532.0,"link_karma":120,"comment_karma":3400,"is_mod":true,"is_gold":false,"is_suspended":false}}`
+	account, err := processAccountResponse(&http.Response{Body: io.NopCloser(strings.NewReader(about))}, "gopher")
+	assert.NoError(t, err)
+	assert.Equal(t, "Gopher", account.Name)
+	assert.Equal(t, time.Unix(1712685532, 0).UTC(), account.Created)
+	assert.Equal(t, 120, account.LinkKarma)
+	assert.Equal(t, 3400, account.CommentKarma)
+	assert.True(t, account.IsMod)
+	assert.False(t, account.IsGold)
+	assert.False(t, account.Suspended)
+	assert.False(t, account.Fetched.IsZero())
+
+	suspended := `{"kind":"t2","data":{"name":"spammer","is_suspended":true}}`
+	account, err = processAccountResponse(&http.Response{Body: io.NopCloser(strings.NewReader(suspended))}, "spammer")
+	assert.NoError(t, err)
+	assert.True(t, account.Suspended)
+	assert.True(t, account.Created.IsZero())
+
+	_, err = processAccountResponse(&http.Response{Body: io.NopCloser(strings.NewReader("<html>"))}, "gopher")
+	assert.Error(t, err)
+}
+
+func TestSpare(t *testing.T) {
+	c := &Client{RateLimiter: rate.NewLimiter(1, 1)}
+	// nothing observed yet
+	assert.True(t, c.Spare(0.2))
+
+	now := time.Now()
+	c.rateLimit = RateLimitStatus{Used: 70, Remaining: 30, Reset: now.Add(time.Minute), Observed: now}
+	assert.True(t, c.Spare(0.2))
+	assert.False(t, c.Spare(0.5))
+	// a new period starts with the whole budget
+	c.rateLimit.Reset = now.Add(-time.Second)
+	assert.True(t, c.Spare(0.5))
+
+	// a request would have to wait for the limiter
+	assert.True(t, c.RateLimiter.Allow())
+	assert.False(t, c.Spare(0))
+}
+
+func TestStartServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	c := &Client{OAuthConfig: &oauth2.Config{}, CallbackListen: addr, Logger: logger}
+	go func() {
+		// the browser is redirected once the server is up
+		for {
+			resp, err := http.Get("http://" + addr + "/callback?code=secret")
+			if err == nil {
+				resp.Body.Close()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	assert.NoError(t, c.StartServer(context.Background()))
+	assert.Equal(t, "secret", c.authCode())
+
+	// the address is taken by the first server now
+	taken := &Client{OAuthConfig: &oauth2.Config{}, CallbackListen: addr, Logger: logger}
+	err = taken.StartServer(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, err, taken.ServerErr)
+}
+
+func TestPostStateOf(t *testing.T) {
+	assert.Equal(t, PostActive, PostStateOf("hello", ""))
+	assert.Equal(t, PostDeleted, PostStateOf("[deleted]", ""))
+	assert.Equal(t, PostDeleted, PostStateOf("", "deleted"))
+	assert.Equal(t, PostRemoved, PostStateOf("[removed]", ""))
+	assert.Equal(t, PostRemoved, PostStateOf("", "automod_filtered"))
+}
+
+func TestMediaTypeOf(t *testing.T) {
+	assert.Equal(t, MediaGallery, MediaTypeOf("", false, false, true))
+	assert.Equal(t, MediaImage, MediaTypeOf("image", false, false, false))
+	assert.Equal(t, MediaEmbed, MediaTypeOf("rich:video", false, false, false))
+	assert.Equal(t, MediaSelf, MediaTypeOf("", true, false, false))
+	assert.Equal(t, MediaLink, MediaTypeOf("", false, false, false))
+}
@@ -2,7 +2,12 @@ package socialmedia
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"golang.org/x/oauth2"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,6 +26,186 @@ type Post struct {
 	UpVotes     int
 	Created     time.Time
 	SubReddit   string
+	// Flair is the link flair text of the post, empty if it has none
+	Flair string
+	// Backfilled posts were created before ingestion started, they come from a backfill or a listing other than new
+	Backfilled bool
+
+	// Score is the score reddit shows, UpVotes the upvotes it reports, they are usually equal
+	Score int
+	// UpvoteRatio is the share of the votes that are upvotes, between 0 and 1
+	UpvoteRatio float64
+	// Permalink is the path of the post on reddit, i.e. /r/golang/comments/1bzk3xq/donkey_v2/
+	Permalink string
+	// URL is the link of a link post and the post itself for self posts, Domain is its host or self.<subreddit>
+	URL    string
+	Domain string
+	IsSelf bool
+	// Over18 marks posts that are NSFW
+	Over18   bool
+	Spoiler  bool
+	Stickied bool
+	Locked   bool
+	// AuthorFlair is the flair text of the author in the subreddit, AuthorFullname the t2_ id of the author
+	AuthorFlair    string
+	AuthorFullname string
+	NumCrossposts  int
+	Gilded         int
+	TotalAwards    int
+	// Distinguished is moderator or admin for posts made in an official capacity, empty otherwise
+	Distinguished string
+	// MediaType is one of the Media* constants
+	MediaType string
+
+	// State is PostActive until the post is seen deleted by its author or removed, RemovedBy is reddit's removed_by_category
+	State     string
+	RemovedBy string
+	// Disappeared is when the post was first seen deleted or removed, zero if that is unknown
+	Disappeared time.Time
+	// Edited is when the author last edited the post according to reddit, zero if it was never edited
+	Edited time.Time
+	// CrosspostParent is the original of a crosspost, nil for other posts
+	CrosspostParent *CrosspostParent
+	// RepostOf is the earliest stored post sharing the link or a near-duplicate title and body, empty if the post is no repost
+	RepostOf string
+	// Sentiment is the sentiment of the title and body between -1 and 1, set when the post is stored
+	Sentiment float64
+	// Language is the ISO 639-1 code of the language of the title and body, "und" if it is unknown, set when the post is stored
+	Language string
+}
+
+// ContentHash identifies the title and body of the post, it changes when the post is edited
+func (p Post) ContentHash() string {
+	sum := sha256.Sum256([]byte(p.Title + "\x00" + p.Body))
+	return hex.EncodeToString(sum[:])
+}
+
+// PostRevision is one version of the title and body of an edited post, revisions are numbered from 1, the original
+type PostRevision struct {
+	PostID   string
+	Revision int
+	Title    string
+	Body     string
+	// Edited is reddit's edit time of the revision, zero for the original
+	Edited time.Time
+	// Seen is when the revision was first seen, UpVotes and NumComments the score of the post at that time
+	Seen        time.Time
+	UpVotes     int
+	NumComments int
+}
+
+// EditedTime decodes reddit's edited field, which is false for posts that were never edited and the unix time of the last edit otherwise
+type EditedTime time.Time
+
+func (t *EditedTime) UnmarshalJSON(data []byte) error {
+	value := strings.Trim(string(data), `"`)
+	switch value {
+	case "", "null", "false", "true":
+		*t = EditedTime{}
+		return nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid edited time %s", data)
+	}
+	*t = EditedTime(time.Unix(int64(seconds), 0).UTC())
+	return nil
+}
+
+// Post states
+const (
+	PostActive  = "active"
+	PostDeleted = "deleted"
+	PostRemoved = "removed"
+)
+
+// DeletedAuthor is the author reddit shows for deleted posts and accounts
+const DeletedAuthor = "[deleted]"
+
+// PostStateOf tells from the listing fields whether a post was deleted by its author or removed by the moderators or reddit.
+// The author alone doesn't tell, posts of deleted accounts stay up.
+func PostStateOf(selftext, removedByCategory string) string {
+	switch {
+	case removedByCategory == "deleted" || removedByCategory == "author" || selftext == "[deleted]":
+		return PostDeleted
+	case removedByCategory != "" || selftext == "[removed]":
+		return PostRemoved
+	default:
+		return PostActive
+	}
+}
+
+// Media types of posts
+const (
+	MediaSelf    = "self"
+	MediaLink    = "link"
+	MediaImage   = "image"
+	MediaVideo   = "video"
+	MediaGallery = "gallery"
+	MediaEmbed   = "embed"
+)
+
+// MediaTypeOf derives the media type of a post from its listing fields, postHint is reddit's post_hint which is not always set
+func MediaTypeOf(postHint string, isSelf, isVideo, isGallery bool) string {
+	switch {
+	case isGallery:
+		return MediaGallery
+	case isVideo || postHint == "hosted:video":
+		return MediaVideo
+	case postHint == "image":
+		return MediaImage
+	case postHint == "rich:video":
+		return MediaEmbed
+	case isSelf || postHint == "self":
+		return MediaSelf
+	default:
+		return MediaLink
+	}
+}
+
+// Link returns the URL of the post on reddit
+func (p Post) Link() string {
+	if p.Permalink != "" {
+		return "https://www.reddit.com" + p.Permalink
+	}
+	return "https://www.reddit.com/comments/" + p.PostID + "/"
+}
+
+// Comment is a comment on a post, ParentID is the post or comment it replies to
+type Comment struct {
+	CommentID string
+	PostID    string
+	ParentID  string
+	Author    string
+	Body      string
+	UpVotes   int
+	Created   time.Time
+	SubReddit string
+	// Sentiment is the sentiment of the body between -1 and 1, set when the comment is stored
+	Sentiment float64
+}
+
+// PostSnapshot is the score of a post at the time it was seen, the history of a post is its snapshots in order
+type PostSnapshot struct {
+	PostID      string
+	UpVotes     int
+	NumComments int
+	Time        time.Time
+}
+
+// ListingRank is the 1-based position of a post in a subreddit listing from Time on, Rank 0 means it left the listing
+type ListingRank struct {
+	PostID string
+	Rank   int
+	Time   time.Time
+}
+
+// ListingHistory holds the rank changes of one subreddit listing in order, Polled is the time it was fetched last
+type ListingHistory struct {
+	Subreddit string
+	Listing   string
+	Polled    time.Time
+	Ranks     []ListingRank
 }
 
 type AuthorStatistic struct {
@@ -28,6 +213,119 @@ type AuthorStatistic struct {
 	TotalPosts    int
 	TotalUpvotes  int
 	TotalComments int
+	// Account is the cached profile of the author, nil until it is fetched
+	Account *Account
+}
+
+// SubredditStatistic aggregates the stored posts of one subreddit
+type SubredditStatistic struct {
+	Subreddit     string
+	TotalPosts    int
+	TotalUpvotes  int
+	TotalComments int
+}
+
+// PostVelocity is how fast a post gains upvotes and comments compared to the other recent posts of its subreddit
+type PostVelocity struct {
+	Post
+	// Age is the time since the post was created
+	Age time.Duration
+	// UpvotesPerMinute and CommentsPerMinute are the gains over the velocity window, or since creation for younger posts
+	UpvotesPerMinute  float64
+	CommentsPerMinute float64
+	// Baseline is the median UpvotesPerMinute of the recent posts of the subreddit, 0 until it is computed
+	Baseline float64
+	// Ratio is UpvotesPerMinute divided by Baseline
+	Ratio float64
+}
+
+// RemovalStatistic counts the deleted and removed posts of a subreddit
+type RemovalStatistic struct {
+	Subreddit  string
+	TotalPosts int
+	Deleted    int
+	Removed    int
+	// DeletionRate and RemovalRate are the shares of the posts that were deleted and removed
+	DeletionRate float64
+	RemovalRate  float64
+	// MedianTimeToRemoval is the median time from the creation of a removed post until it was seen removed, 0 if unknown
+	MedianTimeToRemoval time.Duration
+}
+
+// TrendingTerm is a word or phrase appearing in more posts of the current window than the baseline of its subreddit suggests
+type TrendingTerm struct {
+	// Subreddit is empty for the terms trending across all subreddits
+	Subreddit string
+	Term      string
+	// Count is the number of posts of the window the term appears in, Expected the number its baseline frequency suggests
+	Count    int
+	Expected float64
+	// Score is Count+1 divided by Expected+1, the burst of the term
+	Score float64
+}
+
+// SentimentStatistic is the sentiment of the posts of a subreddit created in the period starting at Start
+type SentimentStatistic struct {
+	Subreddit string
+	Start     time.Time
+	Posts     int
+	// Average is the mean sentiment of the posts, Positive and Negative count the posts scored positive and negative
+	Average  float64
+	Positive int
+	Negative int
+}
+
+// AuthorSentiment is the mean sentiment of the posts and comments of an author
+type AuthorSentiment struct {
+	Author   string
+	Posts    int
+	Comments int
+	Average  float64
+}
+
+// LanguageStatistic counts the posts of a subreddit written in a language
+type LanguageStatistic struct {
+	Subreddit string
+	Language  string
+	Posts     int
+	// Share is the share of the posts of the subreddit written in the language
+	Share float64
+}
+
+// Account is the profile of a reddit user as returned by /user/{name}/about.json
+type Account struct {
+	Name         string
+	Created      time.Time
+	LinkKarma    int
+	CommentKarma int
+	// IsMod is set for the moderators of any subreddit, IsGold for the accounts with reddit premium
+	IsMod  bool
+	IsGold bool
+	// Suspended accounts have no creation time or karma
+	Suspended bool
+	// NotFound is set for deleted and shadowbanned accounts, reddit knows nothing else about them
+	NotFound bool
+	// Fetched is when the profile was requested
+	Fetched time.Time
+}
+
+// AuthorScore is how likely an author is a bot or spam account, from 0 to 1. The signals range from 0 to 1 as well
+// and are -1 when there was too little to judge them by.
+type AuthorScore struct {
+	Author string
+	Score  float64
+	// Bot is set when the score reaches the threshold of a suspected bot
+	Bot   bool
+	Posts int
+	// Cadence is how regular the intervals between the posts are
+	Cadence float64
+	// RepeatedTitles is the share of the posts whose title the author posted to another subreddit as well
+	RepeatedTitles float64
+	// Account is how new the account is and how little karma it has
+	Account float64
+	// Name is 1 when the name follows a known bot pattern
+	Name   float64
+	Scored time.Time
 }
 
 type SocialMedia interface {
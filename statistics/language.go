@@ -0,0 +1,36 @@
+package statistics
+
+import (
+	"cmp"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"slices"
+)
+
+// GetLanguageStatistics counts the posts matching the filter per subreddit and language, in order of the subreddit
+// and the most posts first
+func GetLanguageStatistics(dbStore store.Store, filter store.Filter) ([]socialmedia.LanguageStatistic, error) {
+	type key struct {
+		subreddit, language string
+	}
+	counts := make(map[key]int)
+	totals := make(map[string]int)
+	err := dbStore.EachPost(filter, func(post socialmedia.Post) error {
+		counts[key{subreddit: post.SubReddit, language: post.Language}]++
+		totals[post.SubReddit]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statistics := make([]socialmedia.LanguageStatistic, 0, len(counts))
+	for k, posts := range counts {
+		statistics = append(statistics, socialmedia.LanguageStatistic{Subreddit: k.subreddit, Language: k.language, Posts: posts,
+			Share: float64(posts) / float64(totals[k.subreddit])})
+	}
+	slices.SortFunc(statistics, func(a, b socialmedia.LanguageStatistic) int {
+		return cmp.Or(cmp.Compare(a.Subreddit, b.Subreddit), cmp.Compare(b.Posts, a.Posts), cmp.Compare(a.Language, b.Language))
+	})
+	return statistics, nil
+}
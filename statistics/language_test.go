@@ -0,0 +1,38 @@
+package statistics
+
+import (
+	"github.com/Valimere/donkey/db/dbtest"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestLanguageStatistics(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+
+	for i, post := range []socialmedia.Post{
+		{SubReddit: "movies", Title: "What do you think about the new trailer?"},
+		{SubReddit: "movies", Title: "Was haltet ihr von dem neuen Trailer?"},
+		{SubReddit: "movies", Title: "Which sequel was better than the original?"},
+		{SubReddit: "movies", Title: "Help"},
+		{SubReddit: "fussball", Title: "Wer gewinnt heute das Spiel gegen Bayern?"},
+	} {
+		post.PostID = string(rune('1' + i))
+		post.Author = "a"
+		assert.NoError(t, dbStore.SavePost(&post))
+	}
+
+	statistics, err := GetLanguageStatistics(dbStore, store.Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, []socialmedia.LanguageStatistic{
+		{Subreddit: "fussball", Language: "de", Posts: 1, Share: 1},
+		{Subreddit: "movies", Language: "en", Posts: 2, Share: 0.5},
+		{Subreddit: "movies", Language: "de", Posts: 1, Share: 0.25},
+		{Subreddit: "movies", Language: "und", Posts: 1, Share: 0.25},
+	}, statistics)
+
+	statistics, err = GetLanguageStatistics(dbStore, store.Filter{Language: "de"})
+	assert.NoError(t, err)
+	assert.Len(t, statistics, 2)
+}
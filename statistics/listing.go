@@ -0,0 +1,65 @@
+package statistics
+
+import (
+	"github.com/Valimere/donkey/socialmedia"
+	"sort"
+	"time"
+)
+
+// ListingStint summarizes how long a post stayed at the front of a listing
+type ListingStint struct {
+	PostID   string
+	BestRank int
+	// Reached is when the post first ranked at the front
+	Reached time.Time
+	// Duration is the total time the post spent at the front, up to the last poll
+	Duration time.Duration
+	// Current reports whether the post was still at the front when the listing was polled last
+	Current bool
+}
+
+// FrontPageStints returns the posts of the listing history that ranked within the first front positions,
+// the longest stays first. Posts that are still at the front count until the last poll.
+func FrontPageStints(history socialmedia.ListingHistory, front int) []ListingStint {
+	stints := make(map[string]*ListingStint)
+	// since holds when the posts currently at the front got there
+	since := make(map[string]time.Time)
+	for _, rank := range history.Ranks {
+		atFront := rank.Rank > 0 && rank.Rank <= front
+		entered, wasAtFront := since[rank.PostID]
+		switch {
+		case atFront && !wasAtFront:
+			since[rank.PostID] = rank.Time
+			if stints[rank.PostID] == nil {
+				stints[rank.PostID] = &ListingStint{PostID: rank.PostID, BestRank: rank.Rank, Reached: rank.Time}
+			}
+		case !atFront && wasAtFront:
+			stints[rank.PostID].Duration += rank.Time.Sub(entered)
+			delete(since, rank.PostID)
+		}
+		if atFront {
+			stints[rank.PostID].BestRank = min(stints[rank.PostID].BestRank, rank.Rank)
+		}
+	}
+	for postID, entered := range since {
+		stints[postID].Current = true
+		if history.Polled.After(entered) {
+			stints[postID].Duration += history.Polled.Sub(entered)
+		}
+	}
+
+	result := make([]ListingStint, 0, len(stints))
+	for _, stint := range stints {
+		result = append(result, *stint)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Duration != result[j].Duration {
+			return result[i].Duration > result[j].Duration
+		}
+		if !result[i].Reached.Equal(result[j].Reached) {
+			return result[i].Reached.Before(result[j].Reached)
+		}
+		return result[i].PostID < result[j].PostID
+	})
+	return result
+}
@@ -0,0 +1,35 @@
+package statistics
+
+import (
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFrontPageStints(t *testing.T) {
+	start := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	history := socialmedia.ListingHistory{
+		Subreddit: "music",
+		Listing:   "hot",
+		Polled:    at(60),
+		Ranks: []socialmedia.ListingRank{
+			{PostID: "a", Rank: 1, Time: at(0)},
+			{PostID: "b", Rank: 12, Time: at(0)},
+			{PostID: "c", Rank: 30, Time: at(0)},
+			{PostID: "b", Rank: 3, Time: at(10)},
+			{PostID: "a", Rank: 0, Time: at(20)},
+			{PostID: "b", Rank: 11, Time: at(30)},
+			{PostID: "b", Rank: 2, Time: at(40)},
+		},
+	}
+
+	stints := FrontPageStints(history, 10)
+	assert.Equal(t, []ListingStint{
+		{PostID: "b", BestRank: 2, Reached: at(10), Duration: 40 * time.Minute, Current: true},
+		{PostID: "a", BestRank: 1, Reached: at(0), Duration: 20 * time.Minute},
+	}, stints)
+
+	assert.Empty(t, FrontPageStints(socialmedia.ListingHistory{}, 10))
+}
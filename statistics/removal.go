@@ -0,0 +1,58 @@
+package statistics
+
+import (
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"slices"
+	"sort"
+	"time"
+)
+
+// GetRemovalStatistics counts the deleted and removed posts matching the filter per subreddit, the highest removal rate first.
+// The time to removal is measured until the removal was noticed, so it is only as precise as the refresh interval.
+func GetRemovalStatistics(dbStore store.Store, filter store.Filter) ([]socialmedia.RemovalStatistic, error) {
+	bySubreddit := make(map[string]*socialmedia.RemovalStatistic)
+	timesToRemoval := make(map[string][]time.Duration)
+	err := dbStore.EachPost(filter, func(post socialmedia.Post) error {
+		statistic, found := bySubreddit[post.SubReddit]
+		if !found {
+			statistic = &socialmedia.RemovalStatistic{Subreddit: post.SubReddit}
+			bySubreddit[post.SubReddit] = statistic
+		}
+		statistic.TotalPosts++
+		switch post.State {
+		case socialmedia.PostDeleted:
+			statistic.Deleted++
+		case socialmedia.PostRemoved:
+			statistic.Removed++
+			if !post.Disappeared.IsZero() && !post.Created.IsZero() {
+				timesToRemoval[post.SubReddit] = append(timesToRemoval[post.SubReddit], post.Disappeared.Sub(post.Created))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statistics := make([]socialmedia.RemovalStatistic, 0, len(bySubreddit))
+	for subreddit, statistic := range bySubreddit {
+		statistic.DeletionRate = float64(statistic.Deleted) / float64(statistic.TotalPosts)
+		statistic.RemovalRate = float64(statistic.Removed) / float64(statistic.TotalPosts)
+		if durations := timesToRemoval[subreddit]; len(durations) > 0 {
+			slices.Sort(durations)
+			statistic.MedianTimeToRemoval = durations[len(durations)/2]
+			if len(durations)%2 == 0 {
+				statistic.MedianTimeToRemoval = (durations[len(durations)/2-1] + durations[len(durations)/2]) / 2
+			}
+		}
+		statistics = append(statistics, *statistic)
+	}
+	sort.Slice(statistics, func(i, j int) bool {
+		if statistics[i].RemovalRate != statistics[j].RemovalRate {
+			return statistics[i].RemovalRate > statistics[j].RemovalRate
+		}
+		return statistics[i].Subreddit < statistics[j].Subreddit
+	})
+	return statistics, nil
+}
@@ -0,0 +1,35 @@
+package statistics
+
+import (
+	"github.com/Valimere/donkey/db/dbtest"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRemovalStatistics(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+
+	created := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	for i, subreddit := range []string{"music", "music", "music", "music", "movies"} {
+		post := socialmedia.Post{PostID: string(rune('1' + i)), Author: "a", SubReddit: subreddit, Created: created}
+		assert.NoError(t, dbStore.SavePost(&post))
+	}
+	disappear := func(id, state string, after time.Duration) {
+		changed, err := dbStore.UpdatePostState(&socialmedia.Post{PostID: id, State: state}, created.Add(after))
+		assert.NoError(t, err)
+		assert.True(t, changed)
+	}
+	disappear("1", socialmedia.PostRemoved, 10*time.Minute)
+	disappear("2", socialmedia.PostRemoved, 30*time.Minute)
+	disappear("3", socialmedia.PostDeleted, time.Hour)
+
+	statistics, err := GetRemovalStatistics(dbStore, store.Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, []socialmedia.RemovalStatistic{
+		{Subreddit: "music", TotalPosts: 4, Deleted: 1, Removed: 2, DeletionRate: 0.25, RemovalRate: 0.5, MedianTimeToRemoval: 20 * time.Minute},
+		{Subreddit: "movies", TotalPosts: 1},
+	}, statistics)
+}
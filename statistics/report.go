@@ -0,0 +1,132 @@
+package statistics
+
+import (
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"time"
+)
+
+// Report is a leaderboard snapshot printed periodically while ingesting
+type Report struct {
+	Time       time.Time
+	TopPosts   []socialmedia.Post
+	TopAuthors []socialmedia.AuthorStatistic
+	Subreddits []socialmedia.SubredditStatistic
+	TotalPosts int
+	// IngestionRate is the number of new posts per minute since the previous report
+	IngestionRate float64
+	// RateLimitUtilization is the share of the rate limit period's budget used, -1 when unknown
+	RateLimitUtilization float64
+
+	// PostRanks and AuthorRanks hold the movement of each TopPosts and TopAuthors entry against the previous report
+	PostRanks   []RankChange
+	AuthorRanks []RankChange
+	// SubredditDeltas maps each subreddit to the number of posts added since the previous report
+	SubredditDeltas map[string]int
+}
+
+// RankChange describes where an entry sits in a leaderboard compared to the previous one
+type RankChange struct {
+	Key  string
+	Rank int
+	// PreviousRank is 0 for entries that were not on the previous leaderboard
+	PreviousRank int
+}
+
+// New reports whether the entry entered the leaderboard
+func (r RankChange) New() bool {
+	return r.PreviousRank == 0
+}
+
+// Movement is positive when the entry climbed, negative when it dropped
+func (r RankChange) Movement() int {
+	if r.New() {
+		return 0
+	}
+	return r.PreviousRank - r.Rank
+}
+
+// RankChanges compares two ordered leaderboards by key, ranks start at 1
+func RankChanges(previous, current []string) []RankChange {
+	previousRanks := make(map[string]int, len(previous))
+	for i, key := range previous {
+		previousRanks[key] = i + 1
+	}
+	changes := make([]RankChange, 0, len(current))
+	for i, key := range current {
+		changes = append(changes, RankChange{Key: key, Rank: i + 1, PreviousRank: previousRanks[key]})
+	}
+	return changes
+}
+
+// RateLimitUtilization is the share of the rate limit budget used in the current period, -1 if unknown
+func RateLimitUtilization(status socialmedia.RateLimitStatus) float64 {
+	total := status.Used + status.Remaining
+	if status.Observed.IsZero() || total <= 0 {
+		return -1
+	}
+	return status.Used / total
+}
+
+// BuildReport queries the leaderboards, limited to top entries, and diffs them against the previous report which may be nil
+func BuildReport(dbStore store.Store, top int, previous *Report, rateLimit socialmedia.RateLimitStatus, now time.Time) (*Report, error) {
+	posts, err := dbStore.GetLeadingPosts(top)
+	if err != nil {
+		return nil, err
+	}
+	authors, err := dbStore.GetLeadingAuthors(top)
+	if err != nil {
+		return nil, err
+	}
+	subreddits, err := dbStore.GetSubredditStatistics()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{
+		Time:                 now,
+		TopPosts:             posts,
+		TopAuthors:           authors,
+		Subreddits:           subreddits,
+		RateLimitUtilization: RateLimitUtilization(rateLimit),
+		SubredditDeltas:      make(map[string]int, len(subreddits)),
+	}
+	for _, subreddit := range subreddits {
+		report.TotalPosts += subreddit.TotalPosts
+	}
+
+	var previousPosts, previousAuthors []string
+	previousCounts := map[string]int{}
+	if previous != nil {
+		previousPosts = postKeys(previous.TopPosts)
+		previousAuthors = authorKeys(previous.TopAuthors)
+		for _, subreddit := range previous.Subreddits {
+			previousCounts[subreddit.Subreddit] = subreddit.TotalPosts
+		}
+		if elapsed := now.Sub(previous.Time).Minutes(); elapsed > 0 {
+			report.IngestionRate = float64(report.TotalPosts-previous.TotalPosts) / elapsed
+		}
+	}
+	report.PostRanks = RankChanges(previousPosts, postKeys(posts))
+	report.AuthorRanks = RankChanges(previousAuthors, authorKeys(authors))
+	for _, subreddit := range subreddits {
+		report.SubredditDeltas[subreddit.Subreddit] = subreddit.TotalPosts - previousCounts[subreddit.Subreddit]
+	}
+	return report, nil
+}
+
+func postKeys(posts []socialmedia.Post) []string {
+	keys := make([]string, 0, len(posts))
+	for _, post := range posts {
+		keys = append(keys, post.PostID)
+	}
+	return keys
+}
+
+func authorKeys(authors []socialmedia.AuthorStatistic) []string {
+	keys := make([]string, 0, len(authors))
+	for _, author := range authors {
+		keys = append(keys, author.Author)
+	}
+	return keys
+}
@@ -0,0 +1,63 @@
+package statistics
+
+import (
+	"github.com/Valimere/donkey/db/dbtest"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRankChanges(t *testing.T) {
+	changes := RankChanges([]string{"a", "b", "c"}, []string{"c", "a", "d"})
+
+	assert.Equal(t, []RankChange{
+		{Key: "c", Rank: 1, PreviousRank: 3},
+		{Key: "a", Rank: 2, PreviousRank: 1},
+		{Key: "d", Rank: 3, PreviousRank: 0},
+	}, changes)
+	assert.Equal(t, 2, changes[0].Movement())
+	assert.Equal(t, -1, changes[1].Movement())
+	assert.True(t, changes[2].New())
+	assert.Equal(t, 0, changes[2].Movement())
+}
+
+func TestRankChangesFirstReport(t *testing.T) {
+	changes := RankChanges(nil, []string{"a"})
+	assert.True(t, changes[0].New())
+}
+
+func TestRateLimitUtilization(t *testing.T) {
+	assert.Equal(t, float64(-1), RateLimitUtilization(socialmedia.RateLimitStatus{}))
+
+	status := socialmedia.RateLimitStatus{Used: 150, Remaining: 450, Observed: time.Now()}
+	assert.Equal(t, 0.25, RateLimitUtilization(status))
+}
+
+func TestBuildReport(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+
+	start := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	dbStore.SavePost(&socialmedia.Post{PostID: "1", Author: "a", SubReddit: "music", UpVotes: 5})
+	dbStore.SavePost(&socialmedia.Post{PostID: "2", Author: "b", SubReddit: "movies", UpVotes: 10})
+	first, err := BuildReport(dbStore, 2, nil, socialmedia.RateLimitStatus{}, start)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, first.TotalPosts)
+	assert.Equal(t, float64(-1), first.RateLimitUtilization)
+	assert.True(t, first.PostRanks[0].New())
+
+	dbStore.SavePost(&socialmedia.Post{PostID: "3", Author: "a", SubReddit: "music", UpVotes: 20})
+	dbStore.SavePost(&socialmedia.Post{PostID: "4", Author: "c", SubReddit: "music", UpVotes: 1})
+	second, err := BuildReport(dbStore, 2, first, socialmedia.RateLimitStatus{}, start.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, second.TotalPosts)
+	assert.Equal(t, float64(2), second.IngestionRate)
+	assert.Equal(t, 2, second.SubredditDeltas["music"])
+	assert.Equal(t, 0, second.SubredditDeltas["movies"])
+
+	// post 3 is new at the top and post 2 dropped from first to second place
+	assert.Equal(t, RankChange{Key: "3", Rank: 1}, second.PostRanks[0])
+	assert.Equal(t, RankChange{Key: "2", Rank: 2, PreviousRank: 1}, second.PostRanks[1])
+	// author a climbed to first place with two posts
+	assert.Equal(t, RankChange{Key: "a", Rank: 1, PreviousRank: 2}, second.AuthorRanks[0])
+}
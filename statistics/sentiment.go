@@ -0,0 +1,125 @@
+package statistics
+
+import (
+	"cmp"
+	"github.com/Valimere/donkey/sentiment"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"slices"
+	"time"
+)
+
+// GetSentimentStatistics averages the sentiment of the posts matching the filter per subreddit and period of their creation,
+// in order of the subreddit and the start of the period. Periods start at multiples of period since the unix epoch in UTC.
+func GetSentimentStatistics(dbStore store.Store, filter store.Filter, period time.Duration) ([]socialmedia.SentimentStatistic, error) {
+	type key struct {
+		subreddit string
+		start     time.Time
+	}
+	byPeriod := make(map[key]*socialmedia.SentimentStatistic)
+	err := dbStore.EachPost(filter, func(post socialmedia.Post) error {
+		k := key{subreddit: post.SubReddit, start: post.Created.UTC().Truncate(period)}
+		statistic, found := byPeriod[k]
+		if !found {
+			statistic = &socialmedia.SentimentStatistic{Subreddit: k.subreddit, Start: k.start}
+			byPeriod[k] = statistic
+		}
+		statistic.Posts++
+		// the sum until all posts are counted
+		statistic.Average += post.Sentiment
+		switch {
+		case post.Sentiment >= sentiment.Positive:
+			statistic.Positive++
+		case post.Sentiment <= sentiment.Negative:
+			statistic.Negative++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statistics := make([]socialmedia.SentimentStatistic, 0, len(byPeriod))
+	for _, statistic := range byPeriod {
+		statistic.Average /= float64(statistic.Posts)
+		statistics = append(statistics, *statistic)
+	}
+	slices.SortFunc(statistics, func(a, b socialmedia.SentimentStatistic) int {
+		return cmp.Or(cmp.Compare(a.Subreddit, b.Subreddit), a.Start.Compare(b.Start))
+	})
+	return statistics, nil
+}
+
+// GetMostPositivePosts returns up to limit posts matching the filter with the highest sentiment, leaving out neutral posts
+func GetMostPositivePosts(dbStore store.Store, filter store.Filter, limit int) ([]socialmedia.Post, error) {
+	return extremePosts(dbStore, filter, limit, 1)
+}
+
+// GetMostNegativePosts returns up to limit posts matching the filter with the lowest sentiment, leaving out neutral posts
+func GetMostNegativePosts(dbStore store.Store, filter store.Filter, limit int) ([]socialmedia.Post, error) {
+	return extremePosts(dbStore, filter, limit, -1)
+}
+
+// extremePosts returns the posts whose sentiment multiplied by sign is highest, ties are broken by the upvotes
+func extremePosts(dbStore store.Store, filter store.Filter, limit int, sign float64) ([]socialmedia.Post, error) {
+	var posts []socialmedia.Post
+	err := dbStore.EachPost(filter, func(post socialmedia.Post) error {
+		if post.Sentiment*sign >= sentiment.Positive {
+			posts = append(posts, post)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(posts, func(a, b socialmedia.Post) int {
+		return cmp.Or(cmp.Compare(b.Sentiment*sign, a.Sentiment*sign), cmp.Compare(b.UpVotes, a.UpVotes), cmp.Compare(a.PostID, b.PostID))
+	})
+	return posts[:min(limit, len(posts))], nil
+}
+
+// GetAuthorSentiment averages the sentiment of the posts and comments matching the filter per author, up to limit authors
+// with the most posts and comments first. Deleted authors are left out.
+func GetAuthorSentiment(dbStore store.Store, filter store.Filter, limit int) ([]socialmedia.AuthorSentiment, error) {
+	byAuthor := make(map[string]*socialmedia.AuthorSentiment)
+	author := func(name string) *socialmedia.AuthorSentiment {
+		statistic, found := byAuthor[name]
+		if !found {
+			statistic = &socialmedia.AuthorSentiment{Author: name}
+			byAuthor[name] = statistic
+		}
+		return statistic
+	}
+	err := dbStore.EachPost(filter, func(post socialmedia.Post) error {
+		if post.Author != socialmedia.DeletedAuthor {
+			statistic := author(post.Author)
+			statistic.Posts++
+			statistic.Average += post.Sentiment
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = dbStore.EachComment(filter, func(comment socialmedia.Comment) error {
+		if comment.Author != socialmedia.DeletedAuthor {
+			statistic := author(comment.Author)
+			statistic.Comments++
+			statistic.Average += comment.Sentiment
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	authors := make([]socialmedia.AuthorSentiment, 0, len(byAuthor))
+	for _, statistic := range byAuthor {
+		statistic.Average /= float64(statistic.Posts + statistic.Comments)
+		authors = append(authors, *statistic)
+	}
+	slices.SortFunc(authors, func(a, b socialmedia.AuthorSentiment) int {
+		return cmp.Or(cmp.Compare(b.Posts+b.Comments, a.Posts+a.Comments), cmp.Compare(a.Author, b.Author))
+	})
+	return authors[:min(limit, len(authors))], nil
+}
@@ -0,0 +1,64 @@
+package statistics
+
+import (
+	"github.com/Valimere/donkey/db/dbtest"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSentimentStatistics(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+
+	day := time.Date(2024, 4, 9, 0, 0, 0, 0, time.UTC)
+	posts := []socialmedia.Post{
+		{PostID: "1", Author: "alice", SubReddit: "movies", Title: "I love this movie", UpVotes: 5, Created: day.Add(time.Hour)},
+		{PostID: "2", Author: "bob", SubReddit: "movies", Title: "The worst sequel ever", Created: day.Add(2 * time.Hour)},
+		{PostID: "3", Author: "alice", SubReddit: "movies", Title: "Trailer is out", Created: day.Add(25 * time.Hour)},
+		{PostID: "4", Author: "bob", SubReddit: "music", Title: "What a wonderful album", Created: day.Add(3 * time.Hour)},
+	}
+	for i := range posts {
+		assert.NoError(t, dbStore.SavePost(&posts[i]))
+	}
+	assert.Greater(t, posts[0].Sentiment, 0.5)
+	comment := socialmedia.Comment{CommentID: "c1", PostID: "1", Author: "bob", SubReddit: "movies", Body: "I hate it", Created: day}
+	assert.NoError(t, dbStore.SaveComment(&comment))
+	assert.Less(t, comment.Sentiment, -0.5)
+
+	statistics, err := GetSentimentStatistics(dbStore, store.Filter{}, 24*time.Hour)
+	assert.NoError(t, err)
+	if assert.Len(t, statistics, 3) {
+		assert.Equal(t, "movies", statistics[0].Subreddit)
+		assert.Equal(t, day, statistics[0].Start)
+		assert.Equal(t, 2, statistics[0].Posts)
+		assert.Equal(t, 1, statistics[0].Positive)
+		assert.Equal(t, 1, statistics[0].Negative)
+		assert.InDelta(t, (posts[0].Sentiment+posts[1].Sentiment)/2, statistics[0].Average, 1e-9)
+		assert.Equal(t, socialmedia.SentimentStatistic{Subreddit: "movies", Start: day.Add(24 * time.Hour), Posts: 1}, statistics[1])
+		assert.Equal(t, "music", statistics[2].Subreddit)
+	}
+
+	positive, err := GetMostPositivePosts(dbStore, store.Filter{}, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, positive, 2) {
+		assert.ElementsMatch(t, []string{"1", "4"}, []string{positive[0].PostID, positive[1].PostID})
+		assert.GreaterOrEqual(t, positive[0].Sentiment, positive[1].Sentiment)
+	}
+	negative, err := GetMostNegativePosts(dbStore, store.Filter{Subreddit: "movies"}, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, negative, 1) {
+		assert.Equal(t, "2", negative[0].PostID)
+	}
+
+	authors, err := GetAuthorSentiment(dbStore, store.Filter{}, 10)
+	assert.NoError(t, err)
+	if assert.Len(t, authors, 2) {
+		assert.Equal(t, "bob", authors[0].Author)
+		assert.Equal(t, 2, authors[0].Posts)
+		assert.Equal(t, 1, authors[0].Comments)
+		assert.InDelta(t, (posts[1].Sentiment+posts[3].Sentiment+comment.Sentiment)/3, authors[0].Average, 1e-9)
+		assert.Equal(t, socialmedia.AuthorSentiment{Author: "alice", Posts: 2, Average: posts[0].Sentiment / 2}, authors[1])
+	}
+}
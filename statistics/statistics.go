@@ -16,3 +16,36 @@ func GetTopPoster(dbStore store.Store) ([]socialmedia.AuthorStatistic, error) {
 func GetTopPosts(dbStore store.Store) ([]socialmedia.Post, error) {
 	return dbStore.GetTopPosts()
 }
+
+// GetFilteredTopPoster returns the authors with the most posts matching the filter, ties included.
+// It is empty when no post matches.
+func GetFilteredTopPoster(dbStore store.Store, filter store.Filter) ([]socialmedia.AuthorStatistic, error) {
+	authors, err := dbStore.GetAuthorStatistics(filter)
+	if err != nil || len(authors) == 0 {
+		return nil, err
+	}
+	top := authors[:1]
+	for _, author := range authors[1:] {
+		if author.TotalPosts != top[0].TotalPosts {
+			break
+		}
+		top = append(top, author)
+	}
+	return top, nil
+}
+
+// GetFilteredTopPosts returns the posts matching the filter with the most upvotes, ties included.
+// It is empty when no post matches.
+func GetFilteredTopPosts(dbStore store.Store, filter store.Filter) ([]socialmedia.Post, error) {
+	var posts []socialmedia.Post
+	err := dbStore.EachPost(filter, func(post socialmedia.Post) error {
+		switch {
+		case len(posts) == 0 || post.UpVotes > posts[0].UpVotes:
+			posts = []socialmedia.Post{post}
+		case post.UpVotes == posts[0].UpVotes:
+			posts = append(posts, post)
+		}
+		return nil
+	})
+	return posts, err
+}
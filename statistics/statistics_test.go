@@ -0,0 +1,38 @@
+package statistics
+
+import (
+	"github.com/Valimere/donkey/db/dbtest"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFilteredTopPoster(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+
+	dbStore.SavePost(&socialmedia.Post{PostID: "1", Author: "a", SubReddit: "music", UpVotes: 50, Backfilled: true})
+	dbStore.SavePost(&socialmedia.Post{PostID: "2", Author: "a", SubReddit: "music", UpVotes: 5, Backfilled: true})
+	dbStore.SavePost(&socialmedia.Post{PostID: "3", Author: "b", SubReddit: "music", UpVotes: 10})
+	dbStore.SavePost(&socialmedia.Post{PostID: "4", Author: "c", SubReddit: "music", UpVotes: 10})
+
+	authors, err := GetFilteredTopPoster(dbStore, store.Filter{})
+	assert.NoError(t, err)
+	assert.Len(t, authors, 1)
+	assert.Equal(t, "a", authors[0].Author)
+
+	filter := store.Filter{ExcludeBackfilled: true}
+	authors, err = GetFilteredTopPoster(dbStore, filter)
+	assert.NoError(t, err)
+	assert.Len(t, authors, 2)
+
+	posts, err := GetFilteredTopPosts(dbStore, filter)
+	assert.NoError(t, err)
+	assert.Len(t, posts, 2)
+	assert.Equal(t, "3", posts[0].PostID)
+	assert.Equal(t, "4", posts[1].PostID)
+
+	posts, err = GetFilteredTopPosts(dbStore, store.Filter{Subreddit: "movies"})
+	assert.NoError(t, err)
+	assert.Empty(t, posts)
+}
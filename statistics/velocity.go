@@ -0,0 +1,129 @@
+package statistics
+
+import (
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"slices"
+	"sort"
+	"time"
+)
+
+// RisingOptions select the posts on the rising leaderboard
+type RisingOptions struct {
+	// Window is how far back the velocity of a post is measured
+	Window time.Duration
+	// MaxAge leaves older posts out, they are neither rising nor part of the baseline
+	MaxAge time.Duration
+	// MinRatio is how many times as fast as the baseline of its subreddit a rising post gains upvotes
+	MinRatio float64
+	// MinBaseline is the least baseline in upvotes per minute, it keeps a few upvotes in a slow subreddit from being rising
+	MinBaseline float64
+}
+
+// Velocity measures the gains of a post over the window before now from its snapshots, oldest first.
+// The gains count from the last snapshot taken before the window started, or from the creation of the post
+// if there is none, so the velocity of posts younger than the window is their score normalized by their age.
+func Velocity(post socialmedia.Post, snapshots []socialmedia.PostSnapshot, now time.Time, window time.Duration) socialmedia.PostVelocity {
+	velocity := socialmedia.PostVelocity{Post: post, Age: now.Sub(post.Created)}
+	from := socialmedia.PostSnapshot{Time: post.Created}
+	for _, snapshot := range snapshots {
+		if snapshot.Time.After(now.Add(-window)) {
+			break
+		}
+		from = snapshot
+	}
+	minutes := now.Sub(from.Time).Minutes()
+	if minutes <= 0 {
+		return velocity
+	}
+	velocity.UpvotesPerMinute = float64(post.UpVotes-from.UpVotes) / minutes
+	velocity.CommentsPerMinute = float64(post.NumComments-from.NumComments) / minutes
+	return velocity
+}
+
+// Rising sets the baseline of every velocity, the median upvote velocity of its subreddit but at least opts.MinBaseline,
+// and returns the posts gaining upvotes at least opts.MinRatio times as fast as their baseline, the highest ratio first
+func Rising(velocities []socialmedia.PostVelocity, opts RisingOptions) []socialmedia.PostVelocity {
+	perSubreddit := make(map[string][]float64)
+	for _, velocity := range velocities {
+		perSubreddit[velocity.SubReddit] = append(perSubreddit[velocity.SubReddit], velocity.UpvotesPerMinute)
+	}
+	baselines := make(map[string]float64, len(perSubreddit))
+	for subreddit, rates := range perSubreddit {
+		baselines[subreddit] = max(median(rates), opts.MinBaseline)
+	}
+
+	var rising []socialmedia.PostVelocity
+	for _, velocity := range velocities {
+		velocity.Baseline = baselines[velocity.SubReddit]
+		if velocity.Baseline <= 0 {
+			continue
+		}
+		velocity.Ratio = velocity.UpvotesPerMinute / velocity.Baseline
+		if velocity.Ratio >= opts.MinRatio {
+			rising = append(rising, velocity)
+		}
+	}
+	sort.SliceStable(rising, func(i, j int) bool {
+		if rising[i].Ratio != rising[j].Ratio {
+			return rising[i].Ratio > rising[j].Ratio
+		}
+		return rising[i].PostID < rising[j].PostID
+	})
+	return rising
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Sorted(slices.Values(values))
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// GetRising measures the velocity of the posts created within opts.MaxAge before now and returns the rising ones
+func GetRising(dbStore store.Store, now time.Time, opts RisingOptions) ([]socialmedia.PostVelocity, error) {
+	filter := store.Filter{Since: now.Add(-opts.MaxAge)}
+	var posts []socialmedia.Post
+	err := dbStore.EachPost(filter, func(post socialmedia.Post) error {
+		posts = append(posts, post)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// snapshots are never older than their post, so the filter keeps every snapshot of the posts
+	snapshots := make(map[string][]socialmedia.PostSnapshot, len(posts))
+	err = dbStore.EachPostSnapshot(filter, func(snapshot socialmedia.PostSnapshot) error {
+		snapshots[snapshot.PostID] = append(snapshots[snapshot.PostID], snapshot)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	velocities := make([]socialmedia.PostVelocity, 0, len(posts))
+	for _, post := range posts {
+		velocities = append(velocities, Velocity(post, snapshots[post.PostID], now, opts.Window))
+	}
+	return Rising(velocities, opts), nil
+}
+
+// NewlyRising returns the posts of current that are not in previous
+func NewlyRising(previous, current []socialmedia.PostVelocity) []socialmedia.PostVelocity {
+	seen := make(map[string]bool, len(previous))
+	for _, velocity := range previous {
+		seen[velocity.PostID] = true
+	}
+	var entered []socialmedia.PostVelocity
+	for _, velocity := range current {
+		if !seen[velocity.PostID] {
+			entered = append(entered, velocity)
+		}
+	}
+	return entered
+}
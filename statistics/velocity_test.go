@@ -0,0 +1,93 @@
+package statistics
+
+import (
+	"github.com/Valimere/donkey/db/dbtest"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestVelocity(t *testing.T) {
+	now := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	snapshot := func(ago time.Duration, upvotes, comments int) socialmedia.PostSnapshot {
+		return socialmedia.PostSnapshot{PostID: "1", UpVotes: upvotes, NumComments: comments, Time: now.Add(-ago)}
+	}
+	tests := []struct {
+		name      string
+		created   time.Duration
+		snapshots []socialmedia.PostSnapshot
+		upvotes   int
+		comments  int
+		perMinute float64
+		comPerMin float64
+	}{
+		{"young post counts from its creation", 10 * time.Minute,
+			[]socialmedia.PostSnapshot{snapshot(8*time.Minute, 5, 0)}, 50, 20, 5, 2},
+		{"old post counts over the window", 5 * time.Hour,
+			[]socialmedia.PostSnapshot{snapshot(3*time.Hour, 100, 10), snapshot(2*time.Hour, 400, 40), snapshot(30*time.Minute, 500, 50)},
+			520, 46, 1, 0.05},
+		{"old post without snapshots", 2 * time.Hour, nil, 120, 0, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := socialmedia.Post{PostID: "1", UpVotes: tt.upvotes, NumComments: tt.comments, Created: now.Add(-tt.created)}
+			velocity := Velocity(post, tt.snapshots, now, time.Hour)
+			assert.Equal(t, tt.created, velocity.Age)
+			assert.InDelta(t, tt.perMinute, velocity.UpvotesPerMinute, 0.001)
+			assert.InDelta(t, tt.comPerMin, velocity.CommentsPerMinute, 0.001)
+		})
+	}
+}
+
+func TestRising(t *testing.T) {
+	velocity := func(id, subreddit string, perMinute float64) socialmedia.PostVelocity {
+		return socialmedia.PostVelocity{Post: socialmedia.Post{PostID: id, SubReddit: subreddit}, UpvotesPerMinute: perMinute}
+	}
+	velocities := []socialmedia.PostVelocity{
+		velocity("1", "music", 1), velocity("2", "music", 2), velocity("3", "music", 3), velocity("4", "music", 12),
+		// a slow subreddit is measured against the least baseline
+		velocity("5", "knitting", 0), velocity("6", "knitting", 0.1), velocity("7", "knitting", 1.6),
+	}
+	rising := Rising(velocities, RisingOptions{MinRatio: 3, MinBaseline: 0.5})
+	assert.Len(t, rising, 2)
+	assert.Equal(t, "4", rising[0].PostID)
+	assert.Equal(t, 2.5, rising[0].Baseline)
+	assert.InDelta(t, 4.8, rising[0].Ratio, 0.001)
+	assert.Equal(t, "7", rising[1].PostID)
+	assert.Equal(t, 0.5, rising[1].Baseline)
+
+	assert.Empty(t, Rising(nil, RisingOptions{MinRatio: 3, MinBaseline: 0.5}))
+}
+
+func TestGetRising(t *testing.T) {
+	dbStore := dbtest.NewStore(t)
+
+	now := time.Now()
+	for _, post := range []socialmedia.Post{
+		{PostID: "1", SubReddit: "music", UpVotes: 10, Created: now.Add(-10 * time.Minute)},
+		{PostID: "2", SubReddit: "music", UpVotes: 20, Created: now.Add(-10 * time.Minute)},
+		{PostID: "3", SubReddit: "music", UpVotes: 300, Created: now.Add(-10 * time.Minute)},
+		{PostID: "4", SubReddit: "music", UpVotes: 9000, Created: now.Add(-48 * time.Hour)},
+	} {
+		assert.NoError(t, dbStore.SavePost(&post))
+	}
+
+	opts := RisingOptions{Window: time.Hour, MaxAge: 24 * time.Hour, MinRatio: 3, MinBaseline: 0.5}
+	rising, err := GetRising(dbStore, now, opts)
+	assert.NoError(t, err)
+	assert.Len(t, rising, 1)
+	assert.Equal(t, "3", rising[0].PostID)
+	assert.InDelta(t, 30, rising[0].UpvotesPerMinute, 0.1)
+	assert.InDelta(t, 2, rising[0].Baseline, 0.1)
+}
+
+func TestNewlyRising(t *testing.T) {
+	velocity := func(id string) socialmedia.PostVelocity {
+		return socialmedia.PostVelocity{Post: socialmedia.Post{PostID: id}}
+	}
+	entered := NewlyRising([]socialmedia.PostVelocity{velocity("1"), velocity("2")},
+		[]socialmedia.PostVelocity{velocity("2"), velocity("3")})
+	assert.Equal(t, []socialmedia.PostVelocity{velocity("3")}, entered)
+	assert.Len(t, NewlyRising(nil, []socialmedia.PostVelocity{velocity("1")}), 1)
+}
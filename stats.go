@@ -0,0 +1,292 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Valimere/donkey/bots"
+	"github.com/Valimere/donkey/config"
+	"github.com/Valimere/donkey/logging"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/statistics"
+	"github.com/Valimere/donkey/store"
+	"github.com/Valimere/donkey/trends"
+	"gorm.io/gorm"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// printStatistics prints the top authors and posts, a non-zero filter computes them from the matching posts only
+func printStatistics(dbStore store.Store, filter store.Filter) error {
+	var authorStatistics []socialmedia.AuthorStatistic
+	var err error
+	if filter == (store.Filter{}) {
+		authorStatistics, err = statistics.GetTopPoster(dbStore)
+	} else {
+		authorStatistics, err = statistics.GetFilteredTopPoster(dbStore, filter)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) || err == nil && len(authorStatistics) == 0 {
+		fmt.Printf("\n\nNo posts stored yet.\n")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting author statistics: %w", err)
+	}
+
+	fmt.Printf("\n\nAuthor Statistics:\n")
+	for _, authorStatistic := range authorStatistics {
+		fmt.Printf("Author: %s, PostsCount: %d, Account: %s\n", authorStatistic.Author, authorStatistic.TotalPosts,
+			accountSummary(authorStatistic.Account, time.Now()))
+	}
+	var postStatistics []socialmedia.Post
+	if filter == (store.Filter{}) {
+		postStatistics, err = statistics.GetTopPosts(dbStore)
+	} else {
+		postStatistics, err = statistics.GetFilteredTopPosts(dbStore, filter)
+	}
+	if err != nil {
+		return fmt.Errorf("error in getting post statistics: %w", err)
+	}
+	fmt.Printf("\n\nPost Statistics:\n")
+	for _, postStatistic := range postStatistics {
+		fmt.Printf("Post PostID: %8s, UpVotes: %4d, Comments: %4d, Author: %24s\n",
+			postStatistic.PostID, postStatistic.UpVotes, postStatistic.NumComments, postStatistic.Author)
+	}
+	return nil
+}
+
+func statsCommand(cfg *config.Config, args []string) error {
+	fs := newFlagSet("stats", "[flags]",
+		"Prints the author and post statistics stored by the last \"donkey run\" without contacting reddit.")
+	fs.BoolVar(&cfg.Report.ExcludeBackfilled, "exclude-backfilled", cfg.Report.ExcludeBackfilled,
+		"leave the posts fetched by a backfill out of the statistics (report.exclude_backfilled)")
+	rising := fs.Bool("rising", false, "print the posts gaining upvotes fastest compared to their subreddit as well, see the rising section of the config")
+	removals := fs.Bool("removals", false, "print the deleted and removed posts per subreddit as well")
+	trending := fs.Bool("trending", false, "print the terms trending in every subreddit right now as well, see the trending section of the config")
+	reposts := fs.Bool("reposts", false, "print the most reposted posts with the subreddits they were reposted in as well")
+	sentiment := fs.Bool("sentiment", false, "print the daily sentiment per subreddit, the most positive and negative posts and the sentiment of the top authors as well")
+	crossposts := fs.Bool("crossposts", false, "print the most crossposted posts, the subreddits feeding each other and the reposted links as well")
+	languages := fs.Bool("languages", false, "print the number of posts per subreddit and detected language as well")
+	suspected := fs.Bool("bots", false, "score the authors with the cached accounts and print the suspected bots as well, see the bots section of the config")
+	fs.BoolVar(&cfg.Bots.Exclude, "exclude-bots", cfg.Bots.Exclude, "leave the authors scored as suspected bots out of the author statistics (bots.exclude)")
+	lang := fs.String("language", "", "compute the statistics from the posts detected in this language only, i.e. en")
+	var posts store.Filter
+	addPostFilterFlags(fs, &posts, "compute the statistics from")
+	addStorageFlags(fs, cfg)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+	filter := statisticsFilter(cfg)
+	filter.Language = *lang
+	filter.Over18, filter.Stickied, filter.MediaType, filter.Domain = posts.Over18, posts.Stickied, posts.MediaType, posts.Domain
+
+	dbStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	var scores []socialmedia.AuthorScore
+	if *suspected {
+		// scored before the statistics are printed so they leave out the bots found now
+		scorer := bots.NewScorer(dbStore, nil, cfg.Bots.Options(cfg.Authors.TTL), logging.Component(slog.Default(), logging.ComponentBots))
+		scores, err = scorer.ScoreAll(context.Background(), time.Now())
+		if err != nil {
+			return fmt.Errorf("error scoring the authors: %w", err)
+		}
+	}
+	err = printStatistics(dbStore, filter)
+	if err != nil {
+		return err
+	}
+	if *rising {
+		velocities, err := statistics.GetRising(dbStore, time.Now(), cfg.Rising.Options())
+		if err != nil {
+			return fmt.Errorf("error getting the rising posts: %w", err)
+		}
+		printRising(os.Stdout, velocities, cfg.Report.Top)
+	}
+	if *removals {
+		removalStatistics, err := statistics.GetRemovalStatistics(dbStore, filter)
+		if err != nil {
+			return fmt.Errorf("error getting the removal statistics: %w", err)
+		}
+		printRemovals(os.Stdout, removalStatistics)
+	}
+	if *trending {
+		tracker := trends.New(cfg.Trending.Options())
+		err = tracker.Seed(dbStore)
+		if err != nil {
+			return fmt.Errorf("error counting the terms: %w", err)
+		}
+		if !printTrending(os.Stdout, "\n\nTrending Terms:\n", tracker, cfg.Report.Top) {
+			fmt.Printf("\n\nTrending Terms:\nNo term is trending.\n")
+		}
+	}
+	if *reposts {
+		clusters, err := dbStore.GetRepostClusters(cfg.Report.Top)
+		if err != nil {
+			return fmt.Errorf("error getting the reposts: %w", err)
+		}
+		printRepostClusters(os.Stdout, clusters)
+	}
+	if *crossposts {
+		err = printCrossposts(os.Stdout, dbStore, cfg.Report.Top)
+		if err != nil {
+			return err
+		}
+	}
+	if *sentiment {
+		err = printSentiment(os.Stdout, dbStore, filter, cfg.Report.Top)
+		if err != nil {
+			return err
+		}
+	}
+	if *languages {
+		languageStatistics, err := statistics.GetLanguageStatistics(dbStore, filter)
+		if err != nil {
+			return fmt.Errorf("error getting the language statistics: %w", err)
+		}
+		printLanguages(os.Stdout, languageStatistics)
+	}
+	if *suspected {
+		printBots(os.Stdout, scores, cfg.Report.Top)
+	}
+	return nil
+}
+
+// printBots writes the authors scored as suspected bots, up to top with the highest score first
+func printBots(out io.Writer, scores []socialmedia.AuthorScore, top int) {
+	suspected := slices.DeleteFunc(slices.Clone(scores), func(score socialmedia.AuthorScore) bool {
+		return !score.Bot
+	})
+	slices.SortFunc(suspected, func(a, b socialmedia.AuthorScore) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(b.Posts, a.Posts), cmp.Compare(a.Author, b.Author))
+	})
+	fmt.Fprintf(out, "\n\nSuspected Bots:\n")
+	if len(suspected) == 0 {
+		fmt.Fprintf(out, "No author is a suspected bot.\n")
+		return
+	}
+	signal := func(value float64) string {
+		if value == bots.Unknown {
+			return "   -"
+		}
+		return fmt.Sprintf("%4.2f", value)
+	}
+	for _, score := range suspected[:min(top, len(suspected))] {
+		fmt.Fprintf(out, "Author: %24s, Score: %4.2f, Posts: %4d, Cadence: %s, Repeated titles: %s, Account: %s, Name: %s\n",
+			score.Author, score.Score, score.Posts, signal(score.Cadence), signal(score.RepeatedTitles), signal(score.Account),
+			signal(score.Name))
+	}
+}
+
+// printLanguages writes the number of posts per subreddit and language
+func printLanguages(out io.Writer, languages []socialmedia.LanguageStatistic) {
+	fmt.Fprintf(out, "\n\nLanguages:\n")
+	for _, l := range languages {
+		fmt.Fprintf(out, "r/%-24s %-3s Posts: %5d (%5.1f%%)\n", l.Subreddit, l.Language, l.Posts, l.Share*100)
+	}
+}
+
+// printSentiment writes the daily sentiment per subreddit and the top most positive and negative posts and authors
+func printSentiment(out io.Writer, dbStore store.Store, filter store.Filter, top int) error {
+	averages, err := statistics.GetSentimentStatistics(dbStore, filter, 24*time.Hour)
+	if err != nil {
+		return fmt.Errorf("error getting the sentiment statistics: %w", err)
+	}
+	positive, err := statistics.GetMostPositivePosts(dbStore, filter, top)
+	if err != nil {
+		return fmt.Errorf("error getting the most positive posts: %w", err)
+	}
+	negative, err := statistics.GetMostNegativePosts(dbStore, filter, top)
+	if err != nil {
+		return fmt.Errorf("error getting the most negative posts: %w", err)
+	}
+	authors, err := statistics.GetAuthorSentiment(dbStore, filter, top)
+	if err != nil {
+		return fmt.Errorf("error getting the author sentiment: %w", err)
+	}
+
+	fmt.Fprintf(out, "\n\nSentiment:\n")
+	for _, average := range averages {
+		fmt.Fprintf(out, "r/%-24s %s Posts: %5d, Average: %+.3f, Positive: %4d, Negative: %4d\n",
+			average.Subreddit, average.Start.Format(time.DateOnly), average.Posts, average.Average, average.Positive, average.Negative)
+	}
+	fmt.Fprintf(out, "\n\nMost Positive Posts:\n")
+	for _, post := range positive {
+		fmt.Fprintf(out, "Post PostID: %8s, Sentiment: %+.3f, Title: %s\n", post.PostID, post.Sentiment, post.Title)
+	}
+	fmt.Fprintf(out, "\n\nMost Negative Posts:\n")
+	for _, post := range negative {
+		fmt.Fprintf(out, "Post PostID: %8s, Sentiment: %+.3f, Title: %s\n", post.PostID, post.Sentiment, post.Title)
+	}
+	fmt.Fprintf(out, "\n\nAuthor Sentiment:\n")
+	for _, author := range authors {
+		fmt.Fprintf(out, "Author: %24s, Posts: %4d, Comments: %5d, Average: %+.3f\n", author.Author, author.Posts, author.Comments, author.Average)
+	}
+	return nil
+}
+
+// printRepostClusters writes the most reposted posts
+func printRepostClusters(out io.Writer, clusters []socialmedia.RepostCluster) {
+	fmt.Fprintf(out, "\n\nMost Reposted:\n")
+	for _, cluster := range clusters {
+		fmt.Fprintf(out, "Post PostID: %8s, Reposts: %4d, Subreddits: r/%s, Title: %s\n",
+			cluster.Original.PostID, len(cluster.Reposts), strings.Join(cluster.Subreddits, ", r/"), cluster.Original.Title)
+	}
+}
+
+// printCrossposts writes the most crossposted posts, the busiest subreddit feeds and the most reposted links, top of each
+func printCrossposts(out io.Writer, dbStore store.Store, top int) error {
+	mostCrossposted, err := dbStore.GetMostCrossposted(top)
+	if err != nil {
+		return fmt.Errorf("error getting the most crossposted posts: %w", err)
+	}
+	feeds, err := dbStore.GetSubredditFeeds(top)
+	if err != nil {
+		return fmt.Errorf("error getting the subreddit feeds: %w", err)
+	}
+	reposts, err := dbStore.GetReposts(top)
+	if err != nil {
+		return fmt.Errorf("error getting the reposts: %w", err)
+	}
+
+	fmt.Fprintf(out, "\n\nMost Crossposted:\n")
+	for _, crossposted := range mostCrossposted {
+		fmt.Fprintf(out, "Post PostID: %8s, Crossposts: %4d (%4d on reddit), From: r/%s, To: r/%s\n",
+			crossposted.PostID, crossposted.Crossposts, crossposted.NumCrossposts, crossposted.Subreddit,
+			strings.Join(crossposted.Subreddits, ", r/"))
+	}
+	fmt.Fprintf(out, "\n\nSubreddit Feeds:\n")
+	for _, feed := range feeds {
+		fmt.Fprintf(out, "r/%-24s -> r/%-24s Crossposts: %4d, Shared links: %4d\n", feed.From, feed.To, feed.Crossposts, feed.SharedLinks)
+	}
+	fmt.Fprintf(out, "\n\nReposts:\n")
+	for _, repost := range reposts {
+		fmt.Fprintf(out, "%4d posts of %s\n", len(repost.Posts), repost.URL)
+	}
+	return nil
+}
+
+// printRemovals writes the deleted and removed posts per subreddit
+func printRemovals(out io.Writer, removals []socialmedia.RemovalStatistic) {
+	fmt.Fprintf(out, "\n\nRemovals:\n")
+	for _, removal := range removals {
+		timeToRemoval := "unknown"
+		if removal.MedianTimeToRemoval > 0 {
+			timeToRemoval = removal.MedianTimeToRemoval.Round(time.Minute).String()
+		}
+		fmt.Fprintf(out, "r/%-24s Posts: %5d, Deleted: %4d (%4.1f%%), Removed: %4d (%4.1f%%), Median time to removal: %s\n",
+			removal.Subreddit, removal.TotalPosts, removal.Deleted, removal.DeletionRate*100, removal.Removed, removal.RemovalRate*100,
+			timeToRemoval)
+	}
+}
+
+// statisticsFilter selects the posts the statistics are computed from
+func statisticsFilter(cfg *config.Config) store.Filter {
+	return store.Filter{ExcludeBackfilled: cfg.Report.ExcludeBackfilled}
+}
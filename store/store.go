@@ -1,16 +1,134 @@
 package store
 
 import (
+	"context"
+	"errors"
 	"github.com/Valimere/donkey/socialmedia"
 	"golang.org/x/oauth2"
+	"time"
 )
 
+// ErrDuplicatePost is returned by SavePost when the post is already stored
+var ErrDuplicatePost = errors.New("post already stored")
+
+// ErrDuplicateComment is returned by SaveComment when the comment is already stored
+var ErrDuplicateComment = errors.New("comment already stored")
+
+// Session is a single "donkey run", the posts and comments saved during it belong to it
+type Session struct {
+	ID         uint
+	Started    time.Time
+	Subreddits []string
+}
+
+// ImportCheckpoint is how far an archive import got, Line counts the lines that are fully processed
+type ImportCheckpoint struct {
+	Source string
+	// Size of the source when the import started, a different size means it is another file
+	Size int64
+	Line int64
+	Done bool
+}
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event queued for one webhook endpoint, it stays in the store as the delivery log
+type WebhookDelivery struct {
+	ID       uint
+	Endpoint string
+	URL      string
+	Event    string
+	// EventKey identifies events that are only sent once, i.e. a post crossing an upvote threshold
+	EventKey string
+	Payload  []byte
+	// Status is pending until it is delivered or failed for good
+	Status      string
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	// ResponseStatus is the HTTP status of the last attempt, 0 if there was no response
+	ResponseStatus int
+	Created        time.Time
+	Updated        time.Time
+}
+
+// DeliveryFilter narrows down the delivery log, zero values match everything
+type DeliveryFilter struct {
+	Endpoint string
+	Status   string
+	Limit    int
+}
+
+// Filter narrows down the Each* queries, zero values match everything.
+// Since and Until bound the creation time of posts and comments and the time of snapshots, Until is exclusive.
+// ExcludeBackfilled skips the posts fetched by a backfill and their snapshots.
+// Language keeps the posts detected in the language, an ISO 639-1 code, and their snapshots and comments.
+// Over18 and Stickied keep the posts with the flag set to the value when they aren't nil, MediaType the posts
+// of one of the socialmedia.Media* types and Domain the posts linking to the domain, with their snapshots and comments as well.
+type Filter struct {
+	Subreddit         string
+	Since             time.Time
+	Until             time.Time
+	SessionID         uint
+	ExcludeBackfilled bool
+	Language          string
+	Over18            *bool
+	Stickied          *bool
+	MediaType         string
+	Domain            string
+}
+
 type Store interface {
+	Ping(ctx context.Context) error
 	SaveToken(token *oauth2.Token) error
 	GetToken() (*oauth2.Token, error)
+	DeleteTokens() error
 	SavePost(post *socialmedia.Post) error
+	UpdatePostScore(post *socialmedia.Post) (bool, error)
+	UpdatePostState(post *socialmedia.Post, seen time.Time) (bool, error)
+	GetPostsToRefresh(createdSince time.Time, limit int) ([]string, error)
+	RecordPostRevision(post *socialmedia.Post, seen time.Time) (bool, error)
+	GetPostRevisions(postID string) ([]socialmedia.PostRevision, error)
+	GetPost(postID string) (socialmedia.Post, error)
+	GetPostHistory(postID string) ([]socialmedia.PostSnapshot, error)
 	ClearPosts() error
 	ClearAuthorStatistics() error
 	GetTopPoster() ([]socialmedia.AuthorStatistic, error)
 	GetTopPosts() ([]socialmedia.Post, error)
+	GetPosts() ([]socialmedia.Post, error)
+	GetLeadingPosts(limit int) ([]socialmedia.Post, error)
+	GetLeadingAuthors(limit int) ([]socialmedia.AuthorStatistic, error)
+	GetSubredditStatistics() ([]socialmedia.SubredditStatistic, error)
+	GetSubreddits() ([]string, error)
+	AddSubreddit(name string) error
+	RemoveSubreddit(name string) error
+	StartSession(subreddits []string) (Session, error)
+	GetSessions() ([]Session, error)
+	SaveComment(comment *socialmedia.Comment) error
+	EachPost(filter Filter, fn func(socialmedia.Post) error) error
+	EachPostSnapshot(filter Filter, fn func(socialmedia.PostSnapshot) error) error
+	EachComment(filter Filter, fn func(socialmedia.Comment) error) error
+	GetAuthorStatistics(filter Filter) ([]socialmedia.AuthorStatistic, error)
+	GetImportCheckpoint(source string) (ImportCheckpoint, error)
+	SaveImportCheckpoint(checkpoint ImportCheckpoint) error
+	RecordListingRanks(subreddit, listing string, postIDs []string, polled time.Time) (int, error)
+	GetListingHistory(subreddit, listing string) (socialmedia.ListingHistory, error)
+	EnqueueWebhookDeliveries(eventKey string, deliveries []WebhookDelivery) (bool, error)
+	DueWebhookDeliveries(now time.Time, limit int) ([]WebhookDelivery, error)
+	UpdateWebhookDelivery(delivery WebhookDelivery) error
+	GetWebhookDeliveries(filter DeliveryFilter) ([]WebhookDelivery, error)
+	GetMostCrossposted(limit int) ([]socialmedia.CrosspostStatistic, error)
+	GetSubredditFeeds(limit int) ([]socialmedia.SubredditFeed, error)
+	GetReposts(limit int) ([]socialmedia.Repost, error)
+	GetRepostClusters(limit int) ([]socialmedia.RepostCluster, error)
+	GetAccount(name string) (socialmedia.Account, error)
+	SaveAccount(account socialmedia.Account) error
+	SaveAuthorScores(scores []socialmedia.AuthorScore) error
+	GetAuthorScore(author string) (socialmedia.AuthorScore, error)
+	GetSuspectedBots(limit int) ([]socialmedia.AuthorScore, error)
 }
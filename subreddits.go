@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Valimere/donkey/config"
+	"gorm.io/gorm"
+	"strings"
+)
+
+const subredditsDescription = `Manages the persisted list of subreddits "donkey run" ingests when -r is not given.
+
+Subcommands:
+  list               print the persisted subreddits
+  add <name>...      add one or more subreddits
+  remove <name>...   remove one or more subreddits`
+
+func subredditsCommand(cfg *config.Config, args []string) error {
+	fs := newFlagSet("subreddits", "[flags] list|add|remove [names]", subredditsDescription)
+	addStorageFlags(fs, cfg)
+	if err := parseFlags(fs, args, cfg); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	action := fs.Arg(0)
+	var names []string
+	for _, name := range fs.Args()[1:] {
+		// accept both "r/music" and "music"
+		name = strings.TrimPrefix(strings.TrimSpace(name), "r/")
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if (action == "add" || action == "remove") && len(names) == 0 {
+		fmt.Fprintf(fs.Output(), "donkey subreddits %s: at least one subreddit name is required\n\n", action)
+		fs.Usage()
+		return errUsage
+	}
+
+	dbStore, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "list":
+		subreddits, err := dbStore.GetSubreddits()
+		if err != nil {
+			return err
+		}
+		if len(subreddits) == 0 {
+			fmt.Printf("No subreddits stored, \"donkey run\" defaults to %s.\n", defaultSubreddit)
+		}
+		for _, subreddit := range subreddits {
+			fmt.Println(subreddit)
+		}
+	case "add":
+		for _, name := range names {
+			err := dbStore.AddSubreddit(name)
+			if err != nil {
+				return fmt.Errorf("failed to add %s: %w", name, err)
+			}
+			fmt.Printf("Added %s\n", name)
+		}
+	case "remove":
+		for _, name := range names {
+			err := dbStore.RemoveSubreddit(name)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				fmt.Printf("%s was not in the list\n", name)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to remove %s: %w", name, err)
+			}
+			fmt.Printf("Removed %s\n", name)
+		}
+	default:
+		fmt.Fprintf(fs.Output(), "donkey subreddits: unknown subcommand %q\n\n", action)
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
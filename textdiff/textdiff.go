@@ -0,0 +1,127 @@
+// Package textdiff compares the revisions of post titles and bodies line by line
+package textdiff
+
+import (
+	"strings"
+)
+
+// Op tells whether a line was kept, removed from the old text or added in the new one
+type Op string
+
+const (
+	Equal  Op = " "
+	Delete Op = "-"
+	Insert Op = "+"
+)
+
+// Line is one line of a diff
+type Line struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// maxCells bounds the memory of the comparison, longer texts are diffed as a whole removal and insertion
+const maxCells = 4_000_000
+
+// Lines returns the shortest line diff turning old into new, the lines of old and new interleaved in order
+func Lines(old, new string) []Line {
+	a, b := split(old), split(new)
+	// common prefix and suffix keep the table small for the usual small edits
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	diff := make([]Line, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		diff = append(diff, Line{Equal, line})
+	}
+	diff = append(diff, middle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, Line{Equal, line})
+	}
+	return diff
+}
+
+// middle diffs the lines between the common prefix and suffix with the longest common subsequence
+func middle(a, b []string) []Line {
+	var diff []Line
+	if len(a)*len(b) > maxCells {
+		for _, line := range a {
+			diff = append(diff, Line{Delete, line})
+		}
+		for _, line := range b {
+			diff = append(diff, Line{Insert, line})
+		}
+		return diff
+	}
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, Line{Equal, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, Line{Delete, a[i]})
+			i++
+		default:
+			diff = append(diff, Line{Insert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, Line{Delete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, Line{Insert, b[j]})
+	}
+	return diff
+}
+
+// Changed reports whether the diff removes or inserts any line
+func Changed(diff []Line) bool {
+	for _, line := range diff {
+		if line.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the diff with the op in front of every line
+func String(diff []Line) string {
+	var sb strings.Builder
+	for _, line := range diff {
+		sb.WriteString(string(line.Op))
+		sb.WriteString(" ")
+		sb.WriteString(line.Text)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func split(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
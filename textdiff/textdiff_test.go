@@ -0,0 +1,48 @@
+package textdiff
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{"unchanged", "a\nb", "a\nb", "  a\n  b\n"},
+		{"appended", "a", "a\nb", "  a\n+ b\n"},
+		{"replaced line", "a\nb\nc", "a\nB\nc", "  a\n- b\n+ B\n  c\n"},
+		{"removed lines", "a\nb\nc\nd", "a\nd", "  a\n- b\n- c\n  d\n"},
+		{"from empty", "", "a", "+ a\n"},
+		{"to empty", "a", "", "- a\n"},
+		{"moved line", "a\nb\nc", "b\nc\na", "- a\n  b\n  c\n+ a\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := Lines(tt.old, tt.new)
+			assert.Equal(t, tt.want, String(diff))
+			assert.Equal(t, tt.old != tt.new, Changed(diff))
+		})
+	}
+}
+
+func TestLinesTooLong(t *testing.T) {
+	old := strings.Repeat("x\n", 3000) + "y"
+	new := "z\n" + strings.Repeat("x\n", 2999) + "w"
+	diff := Lines(old, new)
+	assert.True(t, Changed(diff))
+	deleted, inserted := 0, 0
+	for _, line := range diff {
+		switch line.Op {
+		case Delete:
+			deleted++
+		case Insert:
+			inserted++
+		}
+	}
+	assert.Equal(t, 3001, deleted)
+	assert.Equal(t, 3001, inserted)
+}
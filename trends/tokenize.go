@@ -0,0 +1,89 @@
+package trends
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxTokens bounds the words taken from one post, long bodies would otherwise dominate the counts and the memory
+const maxTokens = 200
+
+// Tokenize splits text into lowercase words, leaving out links, markdown and punctuation. Possessive 's is dropped
+// and apostrophes are removed, so "don't" becomes dont.
+func Tokenize(text string) []string {
+	text = strings.ReplaceAll(strings.ToLower(text), "’", "'")
+	var tokens []string
+	for _, field := range strings.Fields(text) {
+		if strings.Contains(field, "://") || strings.HasPrefix(field, "www.") || strings.HasPrefix(field, "/r/") || strings.HasPrefix(field, "/u/") {
+			continue
+		}
+		words := strings.FieldsFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+		})
+		for _, word := range words {
+			word = strings.TrimSuffix(strings.Trim(word, "'"), "'s")
+			word = strings.ReplaceAll(word, "'", "")
+			if len(word) < 2 && !(len(word) == 1 && unicode.IsDigit(rune(word[0]))) {
+				continue
+			}
+			tokens = append(tokens, word)
+			if len(tokens) == maxTokens {
+				return tokens
+			}
+		}
+	}
+	return tokens
+}
+
+// Terms returns the distinct words and phrases of up to maxN words of text. Stopwords are no terms on their own
+// and phrases neither start nor end with one, so "lord of the rings" is a phrase but "of the" is not.
+func Terms(text string, maxN int) []string {
+	tokens := Tokenize(text)
+	seen := make(map[string]bool)
+	var terms []string
+	for i := range tokens {
+		if IsStopword(tokens[i]) {
+			continue
+		}
+		for n := 1; n <= maxN && i+n <= len(tokens); n++ {
+			if IsStopword(tokens[i+n-1]) {
+				continue
+			}
+			term := strings.Join(tokens[i:i+n], " ")
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// IsStopword reports whether word is too common to tell anything about a post
+func IsStopword(word string) bool {
+	return stopwords[word]
+}
+
+var stopwords = func() map[string]bool {
+	words := strings.Fields(`
+a about above after again against all almost also am an and any are aren arent as at
+be because been before being below between both but by
+can cant could couldnt did didnt do does doesnt doing dont down during
+each either else even ever every few for from further
+get gets getting got had hadnt has hasnt have havent having he hed her here heres hers herself hes him himself his how hows
+i if im in into is isnt it itd itll its itself ive
+just let lets like lot made make makes many may me might more most much must mustnt my myself
+need never no nor not now of off often on once one only or other others ought our ours ourselves out over own
+please quite rather really same say says see seem seems shall shant she shes should shouldnt since so some still such
+than that thats the their theirs them themselves then there theres these they theyd theyll theyre theyve thing things think this those
+though through to too under until up upon us use used using very
+want wants was wasnt way we wed well were weve werent what whats when whens where wheres whether which while who whos whom why whys
+will with without wont would wouldnt yes yet you youd youll your youre yours yourself yourselves youve
+amp nbsp x200b gt lt http https www com edit update removed deleted anyone someone something anything
+`)
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}()
@@ -0,0 +1,224 @@
+// Package trends counts the words and phrases of post titles and bodies per subreddit over time
+// and scores how much more often they appear in the current window than usual
+package trends
+
+import (
+	"cmp"
+	"github.com/Valimere/donkey/language"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options configures a Tracker, the values usually come from config.TrendingConfig
+type Options struct {
+	// Window is the current window, terms trend when they appear in more of its posts than the baseline suggests
+	Window time.Duration
+	// Baseline is how long before the window the usual frequency of the terms is measured
+	Baseline time.Duration
+	// MaxPhrase is the longest phrase counted in words
+	MaxPhrase int
+	// MinCount is the least number of posts of the window a term must appear in to trend
+	MinCount int
+	// Languages are the ISO 639-1 codes of the languages of the posts counted, posts in any language are counted if empty
+	Languages []string
+}
+
+// bucketsPerWindow is how finely the counts are kept, the window moves on in steps of a bucket
+const bucketsPerWindow = 4
+
+// Tracker keeps the windowed term counts of the ingested posts in memory. A nil *Tracker ignores posts and has no trends.
+type Tracker struct {
+	opts Options
+	// Now returns the current time, it is replaced in tests
+	Now func() time.Time
+
+	mu         sync.Mutex
+	subreddits map[string]*subredditCounts
+	// seen holds the bucket of the counted posts so none is counted twice
+	seen map[string]int64
+}
+
+type subredditCounts struct {
+	name    string
+	buckets map[int64]*bucket
+}
+
+// bucket holds the number of posts created within a bucket each term appears in
+type bucket struct {
+	terms map[string]int
+}
+
+func New(opts Options) *Tracker {
+	return &Tracker{opts: opts, Now: time.Now, subreddits: map[string]*subredditCounts{}, seen: map[string]int64{}}
+}
+
+func (t *Tracker) bucketSize() time.Duration {
+	return max(t.opts.Window/bucketsPerWindow, time.Second)
+}
+
+func (t *Tracker) bucketOf(tm time.Time) int64 {
+	return tm.UnixNano() / int64(t.bucketSize())
+}
+
+// baselineBuckets is how many buckets the baseline spans
+func (t *Tracker) baselineBuckets() int64 {
+	return max(int64(t.opts.Baseline/t.bucketSize()), 1)
+}
+
+// Add counts the terms of the post in the bucket of its creation time, posts older than the window and baseline
+// and posts in other languages than Languages are ignored
+func (t *Tracker) Add(post socialmedia.Post) {
+	if t == nil {
+		return
+	}
+	now := t.Now()
+	created := post.Created
+	if created.IsZero() || created.After(now) {
+		created = now
+	}
+	current := t.bucketOf(now)
+	index := t.bucketOf(created)
+	if index <= current-bucketsPerWindow-t.baselineBuckets() {
+		return
+	}
+	if len(t.opts.Languages) > 0 {
+		lang := post.Language
+		if lang == "" {
+			lang = language.Detect(post.Title + "\n" + post.Body)
+		}
+		if !slices.Contains(t.opts.Languages, lang) {
+			return
+		}
+	}
+	terms := Terms(post.Title+"\n"+post.Body, t.opts.MaxPhrase)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, found := t.seen[post.PostID]; found {
+		return
+	}
+	t.seen[post.PostID] = index
+	key := strings.ToLower(post.SubReddit)
+	counts, found := t.subreddits[key]
+	if !found {
+		counts = &subredditCounts{name: post.SubReddit, buckets: map[int64]*bucket{}}
+		t.subreddits[key] = counts
+	}
+	b, found := counts.buckets[index]
+	if !found {
+		b = &bucket{terms: map[string]int{}}
+		counts.buckets[index] = b
+		t.prune(current)
+	}
+	for _, term := range terms {
+		b.terms[term]++
+	}
+}
+
+// prune drops the buckets and seen posts that left the baseline
+func (t *Tracker) prune(current int64) {
+	oldest := current - bucketsPerWindow - t.baselineBuckets()
+	for _, counts := range t.subreddits {
+		maps.DeleteFunc(counts.buckets, func(index int64, _ *bucket) bool { return index <= oldest })
+	}
+	maps.DeleteFunc(t.seen, func(_ string, index int64) bool { return index <= oldest })
+}
+
+// Seed counts the stored posts created within the window and baseline, so the trends are known right after a restart
+func (t *Tracker) Seed(dbStore store.Store) error {
+	if t == nil {
+		return nil
+	}
+	since := t.Now().Add(-t.opts.Window - t.opts.Baseline)
+	return dbStore.EachPost(store.Filter{Since: since}, func(post socialmedia.Post) error {
+		t.Add(post)
+		return nil
+	})
+}
+
+// Subreddits returns the names of the subreddits with counted posts in order
+func (t *Tracker) Subreddits() []string {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	names := make([]string, 0, len(t.subreddits))
+	for _, counts := range t.subreddits {
+		names = append(names, counts.name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Trending returns up to limit terms of the subreddit, of all subreddits if it is empty, that appear in at least MinCount
+// posts of the current window and more often than their baseline suggests, the highest score first.
+// A term is left out when a longer trending phrase containing it appears in as many posts.
+func (t *Tracker) Trending(subreddit string, limit int) []socialmedia.TrendingTerm {
+	if t == nil {
+		return nil
+	}
+	current := t.bucketOf(t.Now())
+	windowStart := current - bucketsPerWindow
+	baselineBuckets := t.baselineBuckets()
+
+	counts := make(map[string]int)
+	baseline := make(map[string]int)
+	name := subreddit
+	t.mu.Lock()
+	for key, c := range t.subreddits {
+		if subreddit != "" && key != strings.ToLower(subreddit) {
+			continue
+		}
+		if subreddit != "" {
+			name = c.name
+		}
+		for index, b := range c.buckets {
+			target := baseline
+			if index > windowStart {
+				target = counts
+			} else if index <= windowStart-baselineBuckets {
+				continue
+			}
+			for term, count := range b.terms {
+				target[term] += count
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	// the baseline spans baselineBuckets buckets, the window bucketsPerWindow
+	scale := float64(bucketsPerWindow) / float64(baselineBuckets)
+	var trending []socialmedia.TrendingTerm
+	for term, count := range counts {
+		if count < t.opts.MinCount {
+			continue
+		}
+		expected := float64(baseline[term]) * scale
+		score := float64(count+1) / (expected + 1)
+		if score <= 1 {
+			continue
+		}
+		trending = append(trending, socialmedia.TrendingTerm{Subreddit: name, Term: term, Count: count, Expected: expected, Score: score})
+	}
+	all := slices.Clone(trending)
+	trending = slices.DeleteFunc(trending, func(term socialmedia.TrendingTerm) bool {
+		return slices.ContainsFunc(all, func(longer socialmedia.TrendingTerm) bool {
+			return longer.Count >= term.Count && len(longer.Term) > len(term.Term) && containsPhrase(longer.Term, term.Term)
+		})
+	})
+	slices.SortFunc(trending, func(a, b socialmedia.TrendingTerm) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(b.Count, a.Count), cmp.Compare(a.Term, b.Term))
+	})
+	return trending[:min(limit, len(trending))]
+}
+
+// containsPhrase reports whether the words of part appear in phrase in a row
+func containsPhrase(phrase, part string) bool {
+	return strings.Contains(" "+phrase+" ", " "+part+" ")
+}
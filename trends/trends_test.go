@@ -0,0 +1,106 @@
+package trends
+
+import (
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+
+func TestTokenize(t *testing.T) {
+	assert.Empty(t, Tokenize(""))
+	assert.Equal(t, []string{"nolan", "new", "movie", "dont", "miss", "it", "2"},
+		Tokenize("Nolan’s NEW movie: don't miss it!! https://example.com/trailer **2**"))
+}
+
+func TestTerms(t *testing.T) {
+	assert.Equal(t, []string{"lord", "lord of the rings", "rings", "rings extended", "rings extended edition", "extended",
+		"extended edition", "edition"}, Terms("The Lord of the Rings extended edition", 4))
+	assert.Equal(t, []string{"lord", "rings"}, Terms("the lord of the rings, the rings", 2))
+	assert.Empty(t, Terms("of the", 3))
+}
+
+func setupTracker() (*Tracker, *time.Time) {
+	now := start
+	tracker := New(Options{Window: time.Hour, Baseline: 24 * time.Hour, MaxPhrase: 3, MinCount: 3})
+	tracker.Now = func() time.Time { return now }
+	return tracker, &now
+}
+
+func TestTrending(t *testing.T) {
+	tracker, _ := setupTracker()
+	id := 0
+	add := func(subreddit, title string, age time.Duration) {
+		id++
+		tracker.Add(socialmedia.Post{PostID: strconv.Itoa(id), SubReddit: subreddit, Title: title, Created: start.Add(-age)})
+	}
+	// the usual talk of the last day
+	for i := range 24 * 6 {
+		add("movies", "Best movie of the year so far", 2*time.Hour+time.Duration(i)*10*time.Minute)
+	}
+	for i := range 5 {
+		add("movies", "Dune Part Two trailer is out", time.Duration(i)*time.Minute)
+		add("movies", "Best movie of the year so far", time.Duration(i)*time.Minute)
+	}
+	add("Music", "Dune Part Two soundtrack review", time.Minute)
+	// older than the baseline
+	add("movies", "Dune Part Two trailer", 30*time.Hour)
+
+	trending := tracker.Trending("Movies", 10)
+	assert.NotEmpty(t, trending)
+	assert.Equal(t, "dune part two", trending[0].Term)
+	assert.Equal(t, "movies", trending[0].Subreddit)
+	assert.Equal(t, 5, trending[0].Count)
+	assert.Zero(t, trending[0].Expected)
+	assert.Equal(t, 6.0, trending[0].Score)
+	for _, term := range trending {
+		// contained in the longer phrase with the same count
+		assert.NotEqual(t, "dune", term.Term)
+		// as frequent as usual
+		assert.NotEqual(t, "best movie", term.Term)
+	}
+
+	all := tracker.Trending("", 1)
+	assert.Len(t, all, 1)
+	assert.Equal(t, "dune part two", all[0].Term)
+	assert.Equal(t, 6, all[0].Count)
+	assert.Equal(t, []string{"Music", "movies"}, tracker.Subreddits())
+	assert.Empty(t, tracker.Trending("golang", 10))
+}
+
+func TestTrendingWindowMoves(t *testing.T) {
+	tracker, now := setupTracker()
+	for i := range 3 {
+		tracker.Add(socialmedia.Post{PostID: strconv.Itoa(i), SubReddit: "movies", Title: "Dune Part Two trailer", Created: start})
+	}
+	// counted once
+	tracker.Add(socialmedia.Post{PostID: "0", SubReddit: "movies", Title: "Dune Part Two trailer", Created: start})
+	assert.Equal(t, 3, tracker.Trending("movies", 1)[0].Count)
+
+	*now = start.Add(2 * time.Hour)
+	assert.Empty(t, tracker.Trending("movies", 1))
+	*now = start.Add(48 * time.Hour)
+	tracker.Add(socialmedia.Post{PostID: "new", SubReddit: "movies", Title: "Furiosa trailer", Created: *now})
+	assert.Len(t, tracker.subreddits["movies"].buckets, 1)
+	assert.Len(t, tracker.seen, 1)
+}
+
+func TestTrendingLanguages(t *testing.T) {
+	tracker := New(Options{Window: time.Hour, Baseline: 24 * time.Hour, MaxPhrase: 1, MinCount: 1, Languages: []string{"en"}})
+	tracker.Now = func() time.Time { return start }
+	tracker.Add(socialmedia.Post{PostID: "1", SubReddit: "movies", Title: "Der neue Trailer ist endlich da", Created: start})
+	tracker.Add(socialmedia.Post{PostID: "2", SubReddit: "movies", Title: "Der neue Trailer", Language: "de", Created: start})
+	assert.Empty(t, tracker.Trending("movies", 10))
+	tracker.Add(socialmedia.Post{PostID: "3", SubReddit: "movies", Title: "The new trailer is finally out", Created: start})
+	assert.NotEmpty(t, tracker.Trending("movies", 10))
+}
+
+func TestNilTracker(t *testing.T) {
+	var tracker *Tracker
+	tracker.Add(socialmedia.Post{PostID: "1"})
+	assert.Nil(t, tracker.Trending("", 10))
+	assert.NoError(t, tracker.Seed(nil))
+}
@@ -0,0 +1,279 @@
+package tui
+
+import (
+	"github.com/Valimere/donkey/events"
+	"github.com/Valimere/donkey/socialmedia"
+	tea "github.com/charmbracelet/bubbletea"
+	"sort"
+	"time"
+)
+
+const (
+	// feedSize is how many of the newest posts the feed keeps
+	feedSize = 200
+	// sparkBuckets and bucketWidth define the throughput history, 40 buckets of 15 seconds is 10 minutes
+	sparkBuckets = 40
+	bucketWidth  = 15 * time.Second
+	// leaderboardSize is how many posts and authors the leaderboards list
+	leaderboardSize = 10
+)
+
+// eventMsg wraps an ingestion event for the bubbletea update loop
+type eventMsg events.Event
+
+// tickMsg advances the throughput buckets when no events arrive
+type tickMsg time.Time
+
+// AuthorCount is an author's number of posts within the current filter
+type AuthorCount struct {
+	Author  string
+	Posts   int
+	UpVotes int
+}
+
+// Model is the dashboard state, it is only fed by ingestion events so it never queries the store
+type Model struct {
+	subreddits []string
+	// filter is 0 for all subreddits, otherwise the index into subreddits plus one
+	filter int
+
+	posts map[string]socialmedia.Post
+	// feed holds post ids, newest last, capped at feedSize
+	feed []string
+
+	// throughput holds posts per bucket per subreddit, the last bucket starts at bucketStart
+	throughput  map[string][]int
+	bucketStart time.Time
+	fetchErrors map[string]string
+
+	rateLimit socialmedia.RateLimitStatus
+
+	authorCursor int
+	drillAuthor  string
+
+	width  int
+	height int
+	now    func() time.Time
+}
+
+// NewModel creates the dashboard for the subreddits being ingested
+func NewModel(subreddits []string) *Model {
+	m := &Model{
+		subreddits:  subreddits,
+		posts:       map[string]socialmedia.Post{},
+		throughput:  map[string][]int{},
+		fetchErrors: map[string]string{},
+		width:       100,
+		height:      40,
+		now:         time.Now,
+	}
+	m.bucketStart = m.now().Truncate(bucketWidth)
+	for _, subreddit := range subreddits {
+		m.throughput[subreddit] = make([]int, sparkBuckets)
+	}
+	return m
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg { return tickMsg(t) })
+}
+
+func (m *Model) Init() tea.Cmd {
+	return tick()
+}
+
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case tickMsg:
+		m.advance(time.Time(msg))
+		return m, tick()
+	case eventMsg:
+		m.apply(events.Event(msg))
+	case tea.KeyMsg:
+		return m, m.handleKey(msg.String())
+	}
+	return m, nil
+}
+
+func (m *Model) handleKey(key string) tea.Cmd {
+	switch key {
+	case "q", "ctrl+c":
+		return tea.Quit
+	case "tab", "right", "l":
+		m.setFilter(m.filter + 1)
+	case "shift+tab", "left", "h":
+		m.setFilter(m.filter - 1)
+	case "a":
+		m.setFilter(0)
+	case "down", "j":
+		if m.authorCursor < len(m.TopAuthors())-1 {
+			m.authorCursor++
+		}
+	case "up", "k":
+		if m.authorCursor > 0 {
+			m.authorCursor--
+		}
+	case "enter":
+		authors := m.TopAuthors()
+		if m.authorCursor < len(authors) {
+			m.drillAuthor = authors[m.authorCursor].Author
+		}
+	case "esc", "backspace":
+		m.drillAuthor = ""
+	}
+	return nil
+}
+
+func (m *Model) setFilter(filter int) {
+	count := len(m.subreddits) + 1
+	m.filter = ((filter % count) + count) % count
+	m.authorCursor = 0
+}
+
+// Filter returns the subreddit the panes are filtered by, empty for all
+func (m *Model) Filter() string {
+	if m.filter == 0 {
+		return ""
+	}
+	return m.subreddits[m.filter-1]
+}
+
+func (m *Model) apply(e events.Event) {
+	m.advance(e.Time)
+	switch e.Type {
+	case events.PostIngested:
+		if e.Post == nil {
+			return
+		}
+		post := *e.Post
+		if _, seen := m.posts[post.PostID]; !seen {
+			m.feed = append(m.feed, post.PostID)
+			if len(m.feed) > feedSize {
+				m.feed = m.feed[len(m.feed)-feedSize:]
+			}
+			buckets, found := m.throughput[post.SubReddit]
+			if !found {
+				buckets = make([]int, sparkBuckets)
+				m.throughput[post.SubReddit] = buckets
+			}
+			buckets[sparkBuckets-1]++
+		}
+		m.posts[post.PostID] = post
+	case events.PostUpdated:
+		// only posts ingested while the dashboard is shown are tracked
+		if e.Post != nil {
+			if _, seen := m.posts[e.Post.PostID]; seen {
+				m.posts[e.Post.PostID] = *e.Post
+			}
+		}
+	case events.FetchCompleted:
+		delete(m.fetchErrors, e.Subreddit)
+		if e.RateLimit != nil {
+			m.rateLimit = *e.RateLimit
+		}
+	case events.FetchFailed:
+		m.fetchErrors[e.Subreddit] = e.Err
+	}
+}
+
+// advance shifts the throughput buckets so the last one covers now
+func (m *Model) advance(now time.Time) {
+	if now.IsZero() {
+		return
+	}
+	shift := int(now.Sub(m.bucketStart) / bucketWidth)
+	if shift <= 0 {
+		return
+	}
+	for subreddit, buckets := range m.throughput {
+		if shift >= sparkBuckets {
+			m.throughput[subreddit] = make([]int, sparkBuckets)
+			continue
+		}
+		shifted := append(buckets[shift:], make([]int, shift)...)
+		m.throughput[subreddit] = shifted
+	}
+	m.bucketStart = m.bucketStart.Add(time.Duration(shift) * bucketWidth)
+}
+
+func (m *Model) matches(post socialmedia.Post) bool {
+	filter := m.Filter()
+	return filter == "" || post.SubReddit == filter
+}
+
+// TopPosts returns the posts with the most upvotes within the filter, or all posts of the drilled author
+func (m *Model) TopPosts() []socialmedia.Post {
+	var posts []socialmedia.Post
+	for _, post := range m.posts {
+		if m.drillAuthor != "" {
+			if post.Author == m.drillAuthor {
+				posts = append(posts, post)
+			}
+			continue
+		}
+		if m.matches(post) {
+			posts = append(posts, post)
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if posts[i].UpVotes != posts[j].UpVotes {
+			return posts[i].UpVotes > posts[j].UpVotes
+		}
+		if posts[i].NumComments != posts[j].NumComments {
+			return posts[i].NumComments > posts[j].NumComments
+		}
+		return posts[i].PostID < posts[j].PostID
+	})
+	if m.drillAuthor == "" && len(posts) > leaderboardSize {
+		posts = posts[:leaderboardSize]
+	}
+	return posts
+}
+
+// TopAuthors returns the authors with the most posts within the filter
+func (m *Model) TopAuthors() []AuthorCount {
+	counts := map[string]*AuthorCount{}
+	for _, post := range m.posts {
+		if !m.matches(post) {
+			continue
+		}
+		count, found := counts[post.Author]
+		if !found {
+			count = &AuthorCount{Author: post.Author}
+			counts[post.Author] = count
+		}
+		count.Posts++
+		count.UpVotes += post.UpVotes
+	}
+	authors := make([]AuthorCount, 0, len(counts))
+	for _, count := range counts {
+		authors = append(authors, *count)
+	}
+	sort.Slice(authors, func(i, j int) bool {
+		if authors[i].Posts != authors[j].Posts {
+			return authors[i].Posts > authors[j].Posts
+		}
+		if authors[i].UpVotes != authors[j].UpVotes {
+			return authors[i].UpVotes > authors[j].UpVotes
+		}
+		return authors[i].Author < authors[j].Author
+	})
+	if len(authors) > leaderboardSize {
+		authors = authors[:leaderboardSize]
+	}
+	return authors
+}
+
+// Feed returns up to limit of the newest posts within the filter, newest first
+func (m *Model) Feed(limit int) []socialmedia.Post {
+	var posts []socialmedia.Post
+	for i := len(m.feed) - 1; i >= 0 && len(posts) < limit; i-- {
+		post := m.posts[m.feed[i]]
+		if m.matches(post) {
+			posts = append(posts, post)
+		}
+	}
+	return posts
+}
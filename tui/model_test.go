@@ -0,0 +1,111 @@
+package tui
+
+import (
+	"github.com/Valimere/donkey/events"
+	"github.com/Valimere/donkey/socialmedia"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func ingested(m *Model, at time.Time, post socialmedia.Post) {
+	m.Update(eventMsg(events.Event{Type: events.PostIngested, Time: at, Subreddit: post.SubReddit, Post: &post}))
+}
+
+func key(m *Model, k string) {
+	m.handleKey(k)
+}
+
+func newTestModel(now time.Time) *Model {
+	m := NewModel([]string{"music", "movies"})
+	m.bucketStart = now.Truncate(bucketWidth)
+	return m
+}
+
+func TestLeaderboardsAndFilter(t *testing.T) {
+	now := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	m := newTestModel(now)
+	ingested(m, now, socialmedia.Post{PostID: "1", Author: "a", SubReddit: "music", UpVotes: 3})
+	ingested(m, now, socialmedia.Post{PostID: "2", Author: "b", SubReddit: "movies", UpVotes: 9})
+	ingested(m, now, socialmedia.Post{PostID: "3", Author: "a", SubReddit: "movies", UpVotes: 1})
+
+	assert.Equal(t, "2", m.TopPosts()[0].PostID)
+	assert.Equal(t, AuthorCount{Author: "a", Posts: 2, UpVotes: 4}, m.TopAuthors()[0])
+	assert.Equal(t, "3", m.Feed(1)[0].PostID)
+
+	key(m, "tab")
+	assert.Equal(t, "music", m.Filter())
+	assert.Len(t, m.TopPosts(), 1)
+	assert.Equal(t, AuthorCount{Author: "a", Posts: 1, UpVotes: 3}, m.TopAuthors()[0])
+
+	key(m, "tab")
+	assert.Equal(t, "movies", m.Filter())
+	key(m, "tab")
+	assert.Equal(t, "", m.Filter())
+	key(m, "shift+tab")
+	assert.Equal(t, "movies", m.Filter())
+	key(m, "a")
+	assert.Equal(t, "", m.Filter())
+}
+
+func TestDrillIntoAuthor(t *testing.T) {
+	now := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	m := newTestModel(now)
+	ingested(m, now, socialmedia.Post{PostID: "1", Author: "a", SubReddit: "music"})
+	ingested(m, now, socialmedia.Post{PostID: "2", Author: "b", SubReddit: "movies"})
+	ingested(m, now, socialmedia.Post{PostID: "3", Author: "b", SubReddit: "music"})
+
+	key(m, "down")
+	key(m, "down")
+	assert.Equal(t, 1, m.authorCursor, "cursor stops at the last author")
+	key(m, "up")
+	key(m, "enter")
+	assert.Equal(t, "b", m.drillAuthor)
+	assert.Len(t, m.TopPosts(), 2)
+
+	key(m, "esc")
+	assert.Equal(t, "", m.drillAuthor)
+	assert.Len(t, m.TopPosts(), 3)
+}
+
+func TestThroughputBuckets(t *testing.T) {
+	now := time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+	m := newTestModel(now)
+	ingested(m, now, socialmedia.Post{PostID: "1", SubReddit: "music"})
+	ingested(m, now, socialmedia.Post{PostID: "1", SubReddit: "music"})
+	assert.Equal(t, 1, m.throughput["music"][sparkBuckets-1], "duplicates are not counted")
+
+	m.Update(tickMsg(now.Add(2 * bucketWidth)))
+	assert.Equal(t, 1, m.throughput["music"][sparkBuckets-3])
+	assert.Equal(t, 0, m.throughput["music"][sparkBuckets-1])
+
+	m.Update(tickMsg(now.Add(sparkBuckets * 2 * bucketWidth)))
+	assert.Equal(t, make([]int, sparkBuckets), m.throughput["music"])
+}
+
+func TestRateLimitAndErrors(t *testing.T) {
+	m := newTestModel(time.Now())
+	m.Update(eventMsg(events.Event{Type: events.FetchFailed, Subreddit: "music", Err: "503"}))
+	assert.Equal(t, "503", m.fetchErrors["music"])
+
+	rl := socialmedia.RateLimitStatus{Used: 10, Remaining: 590, Observed: time.Now()}
+	m.Update(eventMsg(events.Event{Type: events.FetchCompleted, Subreddit: "music", RateLimit: &rl}))
+	assert.Empty(t, m.fetchErrors)
+	assert.Equal(t, rl, m.rateLimit)
+
+	m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	assert.Contains(t, m.View(), "Rate limit")
+}
+
+func TestQuit(t *testing.T) {
+	m := newTestModel(time.Now())
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")})
+	assert.NotNil(t, cmd)
+	assert.Equal(t, tea.Quit(), cmd())
+}
+
+func TestSparkline(t *testing.T) {
+	assert.Equal(t, " ▁█", sparkline([]int{0, 1, 8}))
+	assert.Equal(t, "  ", sparkline([]int{0, 0}))
+}
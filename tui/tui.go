@@ -0,0 +1,29 @@
+package tui
+
+import (
+	"context"
+	"github.com/Valimere/donkey/events"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// eventBuffer is how many events may queue up for the dashboard before they are dropped
+const eventBuffer = 1024
+
+// Run shows the full-screen dashboard fed from the bus until the user quits or ctx is done
+func Run(ctx context.Context, bus *events.Bus, subreddits []string) error {
+	ch, unsubscribe := bus.Subscribe(eventBuffer)
+	defer unsubscribe()
+
+	program := tea.NewProgram(NewModel(subreddits), tea.WithAltScreen(), tea.WithContext(ctx))
+	go func() {
+		for e := range ch {
+			program.Send(eventMsg(e))
+		}
+	}()
+	_, err := program.Run()
+	if ctx.Err() != nil {
+		// a cancelled context is a regular way to stop the dashboard
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package tui
+
+import (
+	"fmt"
+	"github.com/charmbracelet/lipgloss"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	paneStyle     = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("8")).Padding(0, 1)
+	titleStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	dimStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+)
+
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+func (m *Model) View() string {
+	width := max(m.width, 60)
+	half := width / 2
+	// each pane has a border and one column of padding on each side
+	const chrome = 4
+
+	posts := m.renderPosts(width - half - chrome)
+	authors := m.renderAuthors(half - chrome)
+	top := lipgloss.JoinHorizontal(lipgloss.Top,
+		paneStyle.Width(width-half-2).Height(leaderboardSize+1).Render(posts),
+		paneStyle.Width(half-2).Height(leaderboardSize+1).Render(authors))
+
+	throughput := m.renderThroughput(width - half - chrome)
+	rateLimit := m.renderRateLimit(half - chrome)
+	middleHeight := max(len(m.subreddits), 2) + 1
+	middle := lipgloss.JoinHorizontal(lipgloss.Top,
+		paneStyle.Width(width-half-2).Height(middleHeight).Render(throughput),
+		paneStyle.Width(half-2).Height(middleHeight).Render(rateLimit))
+
+	used := lipgloss.Height(top) + lipgloss.Height(middle) + 1
+	feedLines := max(m.height-used-3, 3)
+	feed := paneStyle.Width(width - 2).Height(feedLines + 1).Render(m.renderFeed(width-chrome, feedLines))
+
+	return lipgloss.JoinVertical(lipgloss.Left, top, middle, feed, m.renderHelp())
+}
+
+func (m *Model) filterLabel() string {
+	if filter := m.Filter(); filter != "" {
+		return "r/" + filter
+	}
+	return "all subreddits"
+}
+
+func (m *Model) renderPosts(width int) string {
+	title := "Top posts, " + m.filterLabel()
+	if m.drillAuthor != "" {
+		title = "Posts by " + m.drillAuthor + " (esc to go back)"
+	}
+	lines := []string{titleStyle.Render(title)}
+	for i, post := range m.TopPosts() {
+		line := fmt.Sprintf("%2d %5d↑ %4d💬 %-12s %s", i+1, post.UpVotes, post.NumComments,
+			fit("r/"+post.SubReddit, 12), post.Title)
+		lines = append(lines, fit(line, width))
+	}
+	if len(lines) == 1 {
+		lines = append(lines, dimStyle.Render("waiting for posts…"))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *Model) renderAuthors(width int) string {
+	lines := []string{titleStyle.Render("Top authors, " + m.filterLabel())}
+	for i, author := range m.TopAuthors() {
+		line := fit(fmt.Sprintf("%2d %-24s %3d posts %5d↑", i+1, fit(author.Author, 24), author.Posts, author.UpVotes), width)
+		if i == m.authorCursor {
+			line = selectedStyle.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *Model) renderThroughput(width int) string {
+	lines := []string{titleStyle.Render(fmt.Sprintf("Posts per %s, last %s", bucketWidth, bucketWidth*sparkBuckets))}
+	subreddits := make([]string, 0, len(m.throughput))
+	for subreddit := range m.throughput {
+		subreddits = append(subreddits, subreddit)
+	}
+	sort.Strings(subreddits)
+
+	// leave room for the name, the total and a short fetch error
+	const nameWidth, errorWidth = 16, 14
+	sparkWidth := min(sparkBuckets, max(width-nameWidth-errorWidth-6, 0))
+	for _, subreddit := range subreddits {
+		buckets := m.throughput[subreddit]
+		total := 0
+		for _, count := range buckets {
+			total += count
+		}
+		line := fmt.Sprintf("%-*s %s %4d", nameWidth, fit("r/"+subreddit, nameWidth),
+			sparkline(buckets[len(buckets)-sparkWidth:]), total)
+		if subreddit == m.Filter() {
+			line = selectedStyle.Render(line)
+		}
+		if err, failed := m.fetchErrors[subreddit]; failed {
+			line += " " + errorStyle.Render(fit("! "+err, max(width-lipgloss.Width(line)-1, 0)))
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *Model) renderRateLimit(width int) string {
+	lines := []string{titleStyle.Render("Rate limit")}
+	rl := m.rateLimit
+	total := rl.Used + rl.Remaining
+	if rl.Observed.IsZero() || total <= 0 {
+		return strings.Join(append(lines, dimStyle.Render("no response yet")), "\n")
+	}
+	ratio := rl.Used / total
+	barWidth := max(width-6, 10)
+	filled := int(ratio * float64(barWidth))
+	bar := strings.Repeat("█", filled) + dimStyle.Render(strings.Repeat("░", barWidth-filled))
+	reset := time.Until(rl.Reset).Round(time.Second)
+	lines = append(lines,
+		fmt.Sprintf("%s %3.0f%%", bar, ratio*100),
+		fmt.Sprintf("used %.0f, remaining %.0f, resets in %s", rl.Used, rl.Remaining, max(reset, 0)))
+	return strings.Join(lines, "\n")
+}
+
+func (m *Model) renderFeed(width, lines int) string {
+	out := []string{titleStyle.Render("New posts, " + m.filterLabel())}
+	for _, post := range m.Feed(lines) {
+		line := fmt.Sprintf("%s %-12s %-20s %s", post.Created.Local().Format(time.TimeOnly),
+			fit("r/"+post.SubReddit, 12), fit(post.Author, 20), post.Title)
+		out = append(out, fit(line, width))
+	}
+	return strings.Join(out, "\n")
+}
+
+func (m *Model) renderHelp() string {
+	return dimStyle.Render(" tab/←→ filter subreddit • a all • ↑↓ select author • enter author's posts • esc back • q quit")
+}
+
+// sparkline maps the counts onto block characters scaled to the largest count
+func sparkline(counts []int) string {
+	peak := 0
+	for _, count := range counts {
+		peak = max(peak, count)
+	}
+	var b strings.Builder
+	for _, count := range counts {
+		if peak == 0 || count == 0 {
+			b.WriteRune(' ')
+			continue
+		}
+		level := (count*len(sparkLevels) - 1) / peak
+		b.WriteRune(sparkLevels[min(level, len(sparkLevels)-1)])
+	}
+	return b.String()
+}
+
+// fit puts s on a single line and truncates it to width cells
+func fit(s string, width int) string {
+	s = strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == '\t' {
+			return ' '
+		}
+		return r
+	}, s)
+	if width <= 0 {
+		return ""
+	}
+	if lipgloss.Width(s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && lipgloss.Width(string(runes)) > width-1 {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
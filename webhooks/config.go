@@ -0,0 +1,94 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Event types
+const (
+	EventPostNew        = "post.new"
+	EventPostUpvotes    = "post.upvotes"
+	EventAuthorTop      = "author.top"
+	EventSubredditQuiet = "subreddit.quiet"
+)
+
+// Events lists every event type
+var Events = []string{EventPostNew, EventPostUpvotes, EventAuthorTop, EventSubredditQuiet}
+
+const (
+	// DefaultMaxAttempts is the default of Config.MaxAttempts
+	DefaultMaxAttempts = 8
+	// DefaultRetryBackoff is the default of Config.RetryBackoff
+	DefaultRetryBackoff = 30 * time.Second
+)
+
+// Config holds the webhook endpoints and when the events fire
+type Config struct {
+	Endpoints []Endpoint `yaml:"endpoints"`
+	// UpvoteThresholds fire post.upvotes once per post and threshold the first time a score update reaches it
+	UpvoteThresholds []int `yaml:"upvote_thresholds"`
+	// QuietAfter fires subreddit.quiet when a subreddit had no new post for that long, 0 disables it
+	QuietAfter time.Duration `yaml:"quiet_after"`
+	// MaxAttempts is how often a delivery is tried before it is marked as failed
+	MaxAttempts int `yaml:"max_attempts"`
+	// RetryBackoff is the delay before the first retry, it doubles with every attempt up to maxBackoff
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+}
+
+// Endpoint is a URL receiving the events as JSON POST requests
+type Endpoint struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+	// Secret signs the payloads with HMAC-SHA256 in the X-Donkey-Signature header, they are unsigned if empty
+	Secret string `yaml:"secret,omitempty"`
+	// Events are the event types sent to the endpoint, all if empty
+	Events []string `yaml:"events,omitempty"`
+}
+
+// Validate checks the endpoints and settings, errors name the offending entry
+func (c Config) Validate() error {
+	var errs []error
+	if c.MaxAttempts < 1 {
+		errs = append(errs, fmt.Errorf("max_attempts: must be at least 1, got %d", c.MaxAttempts))
+	}
+	if c.RetryBackoff <= 0 {
+		errs = append(errs, fmt.Errorf("retry_backoff: must be greater than 0, got %s", c.RetryBackoff))
+	}
+	if c.QuietAfter < 0 {
+		errs = append(errs, fmt.Errorf("quiet_after: must not be negative, got %s", c.QuietAfter))
+	}
+	for i, threshold := range c.UpvoteThresholds {
+		if threshold < 1 {
+			errs = append(errs, fmt.Errorf("upvote_thresholds[%d]: must be at least 1, got %d", i, threshold))
+		}
+	}
+	names := make(map[string]bool)
+	for i, endpoint := range c.Endpoints {
+		if strings.TrimSpace(endpoint.Name) == "" {
+			errs = append(errs, fmt.Errorf("endpoints[%d]: name must not be empty", i))
+		}
+		if names[endpoint.Name] {
+			errs = append(errs, fmt.Errorf("endpoints[%d]: duplicate name %q", i, endpoint.Name))
+		}
+		names[endpoint.Name] = true
+		if u, err := url.Parse(endpoint.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("endpoints[%d]: url must be an absolute http(s) URL, got %q", i, endpoint.URL))
+		}
+		for _, event := range endpoint.Events {
+			if !slices.Contains(Events, event) {
+				errs = append(errs, fmt.Errorf("endpoints[%d]: unknown event %q, must be one of %s", i, event, strings.Join(Events, ", ")))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// subscribed reports whether the endpoint receives the event
+func (e Endpoint) subscribed(event string) bool {
+	return len(e.Events) == 0 || slices.Contains(e.Events, event)
+}
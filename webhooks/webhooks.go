@@ -0,0 +1,413 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBackoff caps the delay between two attempts of a delivery
+const maxBackoff = time.Hour
+
+// pollInterval is how often the queue is checked for due deliveries and the subreddits for quiet ones
+const pollInterval = time.Second
+
+// dueBatch is the most deliveries sent per poll
+const dueBatch = 50
+
+// requestTimeout bounds a single delivery attempt
+const requestTimeout = 10 * time.Second
+
+// maxErrorLength truncates the error stored with a failed attempt
+const maxErrorLength = 500
+
+// Payload is the JSON body of every webhook request, Data depends on the type
+type Payload struct {
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+// PostData is the data of post.new and post.upvotes, Threshold is the upvote threshold that was reached
+type PostData struct {
+	ID          string    `json:"id"`
+	Subreddit   string    `json:"subreddit"`
+	Author      string    `json:"author"`
+	Title       string    `json:"title"`
+	Flair       string    `json:"flair,omitempty"`
+	URL         string    `json:"url"`
+	UpVotes     int       `json:"upvotes"`
+	NumComments int       `json:"num_comments"`
+	Created     time.Time `json:"created"`
+	Threshold   int       `json:"threshold,omitempty"`
+}
+
+// AuthorData is the data of author.top, Previous is the author that led before
+type AuthorData struct {
+	Author        string `json:"author"`
+	TotalPosts    int    `json:"total_posts"`
+	TotalUpvotes  int    `json:"total_upvotes"`
+	TotalComments int    `json:"total_comments"`
+	Previous      string `json:"previous"`
+}
+
+// QuietData is the data of subreddit.quiet
+type QuietData struct {
+	Subreddit string `json:"subreddit"`
+	// LastPost is when the last new post was seen, or when the watch started
+	LastPost     time.Time `json:"last_post"`
+	QuietSeconds int       `json:"quiet_seconds"`
+}
+
+// Dispatcher turns ingestion activity into webhook events, queues a delivery per subscribed endpoint in the store
+// and sends the queued deliveries with retries, so deliveries that are pending when donkey stops are sent on the next run
+type Dispatcher struct {
+	Store  store.Store
+	Config Config
+	Logger *slog.Logger
+	// Client sends the requests, a client with requestTimeout if nil
+	Client *http.Client
+	// Now returns the current time, time.Now if nil
+	Now func() time.Time
+
+	mu sync.Mutex
+	// sent holds the event keys known to be queued already, it saves store lookups
+	sent      map[string]bool
+	topAuthor string
+	// watched maps the lower case subreddit names to their quiet state
+	watched map[string]*watch
+	wake    chan struct{}
+}
+
+type watch struct {
+	name     string
+	lastPost time.Time
+	quiet    bool
+}
+
+// New returns a dispatcher for the configured endpoints
+func New(st store.Store, cfg Config, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		Store:   st,
+		Config:  cfg,
+		Logger:  logger,
+		sent:    make(map[string]bool),
+		watched: make(map[string]*watch),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Watch tracks the subreddits for subreddit.quiet from now on
+func (d *Dispatcher) Watch(subreddits ...string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, subreddit := range subreddits {
+		d.watched[strings.ToLower(subreddit)] = &watch{name: subreddit, lastPost: d.now()}
+	}
+}
+
+// PostIngested queues post.new for posts created since ingestion started and author.top when the leading author changes
+func (d *Dispatcher) PostIngested(post socialmedia.Post) {
+	if d == nil || post.Backfilled {
+		return
+	}
+	d.mu.Lock()
+	if w, found := d.watched[strings.ToLower(post.SubReddit)]; found {
+		w.lastPost, w.quiet = d.now(), false
+	}
+	d.mu.Unlock()
+
+	d.publish(EventPostNew, "", postData(post, 0))
+	d.checkTopAuthor()
+}
+
+// PostUpdated queues post.upvotes for every threshold the score of the post reached, once per post and threshold
+func (d *Dispatcher) PostUpdated(post socialmedia.Post) {
+	if d == nil {
+		return
+	}
+	for _, threshold := range d.Config.UpvoteThresholds {
+		if post.UpVotes >= threshold {
+			d.publish(EventPostUpvotes, fmt.Sprintf("%s:%s:%d", EventPostUpvotes, post.PostID, threshold), postData(post, threshold))
+		}
+	}
+}
+
+func postData(post socialmedia.Post, threshold int) PostData {
+	return PostData{
+		ID:          post.PostID,
+		Subreddit:   post.SubReddit,
+		Author:      post.Author,
+		Title:       post.Title,
+		Flair:       post.Flair,
+		URL:         post.Link(),
+		UpVotes:     post.UpVotes,
+		NumComments: post.NumComments,
+		Created:     post.Created,
+		Threshold:   threshold,
+	}
+}
+
+// checkTopAuthor queues author.top when the leading author changed, the first leader seen is not an event
+func (d *Dispatcher) checkTopAuthor() {
+	if !d.subscribed(EventAuthorTop) {
+		return
+	}
+	authors, err := d.Store.GetLeadingAuthors(1)
+	if err != nil {
+		d.Logger.Error("failed to load the leading author", "error", err)
+		return
+	}
+	if len(authors) == 0 {
+		return
+	}
+	d.mu.Lock()
+	previous := d.topAuthor
+	d.topAuthor = authors[0].Author
+	d.mu.Unlock()
+	if previous == "" || previous == authors[0].Author {
+		return
+	}
+	d.publish(EventAuthorTop, "", AuthorData{
+		Author:        authors[0].Author,
+		TotalPosts:    authors[0].TotalPosts,
+		TotalUpvotes:  authors[0].TotalUpvotes,
+		TotalComments: authors[0].TotalComments,
+		Previous:      previous,
+	})
+}
+
+// checkQuiet queues subreddit.quiet for the watched subreddits without a new post for Config.QuietAfter,
+// once until their next post
+func (d *Dispatcher) checkQuiet() {
+	if d.Config.QuietAfter <= 0 {
+		return
+	}
+	now := d.now()
+	var quiet []QuietData
+	d.mu.Lock()
+	for _, w := range d.watched {
+		if !w.quiet && now.Sub(w.lastPost) >= d.Config.QuietAfter {
+			w.quiet = true
+			quiet = append(quiet, QuietData{Subreddit: w.name, LastPost: w.lastPost, QuietSeconds: int(now.Sub(w.lastPost).Seconds())})
+		}
+	}
+	d.mu.Unlock()
+	for _, data := range quiet {
+		d.publish(EventSubredditQuiet, "", data)
+	}
+}
+
+func (d *Dispatcher) subscribed(event string) bool {
+	for _, endpoint := range d.Config.Endpoints {
+		if endpoint.subscribed(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// publish queues the event for every subscribed endpoint, events with a key are only queued once
+func (d *Dispatcher) publish(event, key string, data any) {
+	if !d.subscribed(event) {
+		return
+	}
+	d.mu.Lock()
+	sent := key != "" && d.sent[key]
+	d.mu.Unlock()
+	if sent {
+		return
+	}
+
+	now := d.now()
+	body, err := json.Marshal(Payload{ID: newEventID(), Type: event, Time: now, Data: data})
+	if err != nil {
+		d.Logger.Error("failed to encode the webhook payload", "event", event, "error", err)
+		return
+	}
+	var deliveries []store.WebhookDelivery
+	for _, endpoint := range d.Config.Endpoints {
+		if endpoint.subscribed(event) {
+			deliveries = append(deliveries, store.WebhookDelivery{
+				Endpoint: endpoint.Name, URL: endpoint.URL, Event: event, Payload: body,
+				Status: store.DeliveryPending, NextAttempt: now,
+			})
+		}
+	}
+	queued, err := d.Store.EnqueueWebhookDeliveries(key, deliveries)
+	if err != nil {
+		d.Logger.Error("failed to queue the webhook deliveries", "event", event, "error", err)
+		return
+	}
+	if key != "" {
+		d.mu.Lock()
+		d.sent[key] = true
+		d.mu.Unlock()
+	}
+	if queued {
+		select {
+		case d.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run sends the due deliveries and checks for quiet subreddits until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		d.checkQuiet()
+		d.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// deliverDue attempts the due deliveries once, it returns how many were attempted
+func (d *Dispatcher) deliverDue(ctx context.Context) int {
+	due, err := d.Store.DueWebhookDeliveries(d.now(), dueBatch)
+	if err != nil {
+		d.Logger.Error("failed to load the due webhook deliveries", "error", err)
+		return 0
+	}
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			return 0
+		}
+		d.attempt(ctx, delivery)
+	}
+	return len(due)
+}
+
+// attempt sends one delivery and stores the outcome, failures are retried with an exponential backoff
+func (d *Dispatcher) attempt(ctx context.Context, delivery store.WebhookDelivery) {
+	logger := d.Logger.With("endpoint", delivery.Endpoint, "event", delivery.Event, "delivery_id", delivery.ID)
+	delivery.Attempts++
+	endpoint, found := d.endpoint(delivery.Endpoint)
+	var status int
+	var err error
+	if found {
+		status, err = d.send(ctx, endpoint, delivery)
+	} else {
+		err = fmt.Errorf("endpoint %s is no longer configured", delivery.Endpoint)
+		delivery.Attempts = d.Config.MaxAttempts
+	}
+	delivery.ResponseStatus = status
+
+	switch {
+	case err == nil:
+		delivery.Status, delivery.LastError = store.DeliveryDelivered, ""
+		logger.Debug("webhook delivered", "status", status, "attempts", delivery.Attempts)
+	case delivery.Attempts >= d.Config.MaxAttempts:
+		delivery.Status, delivery.LastError = store.DeliveryFailed, truncate(err.Error(), maxErrorLength)
+		logger.Error("webhook delivery failed for good", "attempts", delivery.Attempts, "error", err)
+	default:
+		delivery.LastError = truncate(err.Error(), maxErrorLength)
+		delivery.NextAttempt = d.now().Add(d.backoff(delivery.Attempts))
+		logger.Warn("webhook delivery failed", "attempts", delivery.Attempts, "retry_at", delivery.NextAttempt, "error", err)
+	}
+	if err := d.Store.UpdateWebhookDelivery(delivery); err != nil {
+		logger.Error("failed to store the webhook delivery", "error", err)
+	}
+}
+
+// send posts the payload, signed when the endpoint has a secret, and returns the response status
+func (d *Dispatcher) send(ctx context.Context, endpoint Endpoint, delivery store.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "donkey-webhooks")
+	req.Header.Set("X-Donkey-Event", delivery.Event)
+	req.Header.Set("X-Donkey-Delivery", strconv.FormatUint(uint64(delivery.ID), 10))
+	if endpoint.Secret != "" {
+		req.Header.Set("X-Donkey-Signature", Sign(endpoint.Secret, d.now(), delivery.Payload))
+	}
+
+	client := d.Client
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered with status: %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the X-Donkey-Signature header value, "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">".
+// Receivers recompute the HMAC with the shared secret and should reject old timestamps to prevent replays.
+func Sign(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff is the delay after the given number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.Config.RetryBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+func (d *Dispatcher) endpoint(name string) (Endpoint, bool) {
+	for _, endpoint := range d.Config.Endpoints {
+		if endpoint.Name == name {
+			return endpoint, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+func (d *Dispatcher) now() time.Time {
+	if d.Now != nil {
+		return d.Now()
+	}
+	return time.Now()
+}
+
+func newEventID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,210 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/Valimere/donkey/db/dbtest"
+	"github.com/Valimere/donkey/socialmedia"
+	"github.com/Valimere/donkey/store"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+var start = time.Date(2024, 4, 9, 12, 0, 0, 0, time.UTC)
+
+// setupDispatcher returns a dispatcher on a fresh store whose clock is advanced through the returned pointer
+func setupDispatcher(t *testing.T, cfg Config) (*Dispatcher, *time.Time) {
+	t.Helper()
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+	now := start
+	d := New(dbtest.NewStore(t), cfg, testLogger)
+	d.Now = func() time.Time { return now }
+	return d, &now
+}
+
+func deliveries(t *testing.T, d *Dispatcher) []store.WebhookDelivery {
+	deliveries, err := d.Store.GetWebhookDeliveries(store.DeliveryFilter{})
+	assert.NoError(t, err)
+	return deliveries
+}
+
+// receiver answers with the given statuses in turn and records the requests
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	status := rc.statuses[min(len(rc.requests), len(rc.statuses)-1)]
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, body)
+	w.WriteHeader(status)
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusNoContent}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+	d, now := setupDispatcher(t, Config{
+		Endpoints:    []Endpoint{{Name: "chat", URL: server.URL, Secret: "swordfish"}},
+		RetryBackoff: time.Minute,
+	})
+	ctx := context.Background()
+
+	d.PostIngested(socialmedia.Post{PostID: "1", SubReddit: "music", Author: "a", Title: "hello", UpVotes: 3})
+	assert.Equal(t, 1, d.deliverDue(ctx))
+	queued := deliveries(t, d)
+	assert.Len(t, queued, 1)
+	assert.Equal(t, store.DeliveryPending, queued[0].Status)
+	assert.Equal(t, 1, queued[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, queued[0].ResponseStatus)
+	assert.Equal(t, start.Add(time.Minute), queued[0].NextAttempt.UTC())
+
+	// the retry is not due yet
+	assert.Equal(t, 0, d.deliverDue(ctx))
+	*now = now.Add(time.Minute)
+	assert.Equal(t, 1, d.deliverDue(ctx))
+	queued = deliveries(t, d)
+	assert.Equal(t, store.DeliveryDelivered, queued[0].Status)
+	assert.Equal(t, 2, queued[0].Attempts)
+	assert.Empty(t, queued[0].LastError)
+
+	assert.Len(t, rc.requests, 2)
+	request, body := rc.requests[1], rc.bodies[1]
+	assert.Equal(t, EventPostNew, request.Header.Get("X-Donkey-Event"))
+	assert.Equal(t, Sign("swordfish", *now, body), request.Header.Get("X-Donkey-Signature"))
+	var payload struct {
+		Type string   `json:"type"`
+		Data PostData `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, EventPostNew, payload.Type)
+	assert.Equal(t, "hello", payload.Data.Title)
+}
+
+func TestDeliveryFails(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+	d, now := setupDispatcher(t, Config{
+		Endpoints:   []Endpoint{{Name: "chat", URL: server.URL}},
+		MaxAttempts: 2,
+	})
+
+	d.PostIngested(socialmedia.Post{PostID: "1", SubReddit: "music", Author: "a"})
+	d.deliverDue(context.Background())
+	*now = now.Add(DefaultRetryBackoff)
+	d.deliverDue(context.Background())
+	*now = now.Add(maxBackoff)
+	assert.Equal(t, 0, d.deliverDue(context.Background()))
+
+	queued := deliveries(t, d)
+	assert.Equal(t, store.DeliveryFailed, queued[0].Status)
+	assert.Equal(t, 2, queued[0].Attempts)
+	assert.Contains(t, queued[0].LastError, "503")
+	assert.Empty(t, rc.requests[0].Header.Get("X-Donkey-Signature"))
+}
+
+func TestBackoff(t *testing.T) {
+	d := New(nil, Config{RetryBackoff: 30 * time.Second}, testLogger)
+	assert.Equal(t, 30*time.Second, d.backoff(1))
+	assert.Equal(t, 2*time.Minute, d.backoff(3))
+	assert.Equal(t, maxBackoff, d.backoff(20))
+}
+
+func TestUpvoteThresholds(t *testing.T) {
+	cfg := Config{
+		Endpoints:        []Endpoint{{Name: "chat", URL: "http://localhost", Events: []string{EventPostUpvotes}}},
+		UpvoteThresholds: []int{10, 100},
+	}
+	d, _ := setupDispatcher(t, cfg)
+	post := socialmedia.Post{PostID: "1", SubReddit: "music", UpVotes: 5}
+
+	d.PostIngested(post)
+	d.PostUpdated(post)
+	assert.Empty(t, deliveries(t, d))
+	post.UpVotes = 50
+	d.PostUpdated(post)
+	post.UpVotes = 60
+	d.PostUpdated(post)
+	assert.Len(t, deliveries(t, d), 1)
+	post.UpVotes = 150
+	d.PostUpdated(post)
+	assert.Len(t, deliveries(t, d), 2)
+
+	// a restarted dispatcher knows the crossed thresholds from the store
+	restarted := New(d.Store, d.Config, testLogger)
+	restarted.PostUpdated(post)
+	assert.Len(t, deliveries(t, d), 2)
+}
+
+func TestQuietSubreddits(t *testing.T) {
+	d, now := setupDispatcher(t, Config{
+		Endpoints:  []Endpoint{{Name: "chat", URL: "http://localhost", Events: []string{EventSubredditQuiet}}},
+		QuietAfter: time.Hour,
+	})
+	d.Watch("Music", "golang")
+
+	*now = start.Add(30 * time.Minute)
+	d.PostIngested(socialmedia.Post{PostID: "1", SubReddit: "music"})
+	*now = start.Add(time.Hour)
+	d.checkQuiet()
+	queued := deliveries(t, d)
+	assert.Len(t, queued, 1)
+	assert.Contains(t, string(queued[0].Payload), `"subreddit":"golang"`)
+
+	// quiet subreddits fire once until their next post
+	*now = start.Add(2 * time.Hour)
+	d.checkQuiet()
+	assert.Len(t, deliveries(t, d), 2)
+	assert.Contains(t, string(deliveries(t, d)[0].Payload), `"subreddit":"Music"`)
+	d.checkQuiet()
+	assert.Len(t, deliveries(t, d), 2)
+}
+
+func TestTopAuthor(t *testing.T) {
+	d, _ := setupDispatcher(t, Config{
+		Endpoints: []Endpoint{{Name: "chat", URL: "http://localhost", Events: []string{EventAuthorTop}}},
+	})
+	ingest := func(post socialmedia.Post) {
+		assert.NoError(t, d.Store.SavePost(&post))
+		d.PostIngested(post)
+	}
+
+	ingest(socialmedia.Post{PostID: "1", SubReddit: "music", Author: "a", UpVotes: 5})
+	assert.Empty(t, deliveries(t, d))
+	ingest(socialmedia.Post{PostID: "2", SubReddit: "music", Author: "b", UpVotes: 2, Backfilled: true})
+	ingest(socialmedia.Post{PostID: "3", SubReddit: "music", Author: "b", UpVotes: 1})
+	queued := deliveries(t, d)
+	assert.Len(t, queued, 1)
+	var payload struct {
+		Data AuthorData `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(queued[0].Payload, &payload))
+	assert.Equal(t, AuthorData{Author: "b", TotalPosts: 2, TotalUpvotes: 3, Previous: "a"}, payload.Data)
+}
+
+func TestNilDispatcher(t *testing.T) {
+	var d *Dispatcher
+	d.Watch("music")
+	d.PostIngested(socialmedia.Post{PostID: "1"})
+	d.PostUpdated(socialmedia.Post{PostID: "1"})
+}